@@ -2,25 +2,34 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	pb "metrics/internal/proto"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 
 	"metrics/internal/agent/adapters/storage"
 	"metrics/internal/agent/adapters/storage/memory"
 	"metrics/internal/agent/adapters/workers"
 	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/domain"
+	"metrics/internal/agent/core/handlers"
 	"metrics/internal/agent/core/service"
 	"metrics/internal/agent/logger"
+	"metrics/internal/shared-kernel/reload"
 
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
+// buildVersion is reported to the server, set with -ldflags "-X main.buildVersion=<version>".
+var buildVersion = "N/A"
+
 func main() {
 	if err := run(); err != nil {
 		log.Fatal(err)
@@ -29,6 +38,10 @@ func main() {
 
 func run() error {
 	cfg, err := config.NewConfig()
+	if cfg != nil && cfg.PrintConfig {
+		// An invalid config is printed too, its errors following.
+		return errors.Join(cfg.Print(os.Stdout), err)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	if err != nil {
@@ -37,6 +50,7 @@ func run() error {
 	if err = logger.Initialize(cfg.LogLevel); err != nil {
 		return fmt.Errorf("can't load logger: %w", err)
 	}
+	cfg.Version = buildVersion
 	gaugeAgentStorage, err := storage.NewAgentStorage(storage.Config{
 		Memory: &memory.Config{},
 	})
@@ -49,7 +63,6 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to initialize a storage: %w", err)
 	}
-	agentMetricService := service.NewAgentMetricService(gaugeAgentStorage, counterAgentStorage)
 	if cfg.UseGRPC {
 		conn, err := grpc.NewClient(
 			fmt.Sprintf(":%d", cfg.GRPCPort), grpc.WithTransportCredentials(insecure.NewCredentials()),
@@ -64,7 +77,32 @@ func run() error {
 			}
 		}()
 	}
+	reloader := reload.New(cfg, (*config.Config).Reload)
+	reloader.Subscribe(func(cfg *config.Config) {
+		if err := logger.SetLevel(cfg.LogLevel); err != nil {
+			logger.Log.Error("failed to change log level", zap.Error(err))
+		}
+	})
+	sender, err := newSender(cfg, reloader)
+	if err != nil {
+		return fmt.Errorf("failed to initialize a sender: %w", err)
+	}
+	if !cfg.UseGRPC && slices.Contains(exporters(cfg), config.ExporterServer) {
+		if err = handlers.RegisterMetadataHTTP(cfg, domain.RuntimeMetadata); err != nil {
+			logger.Log.Error("failed to register metric metadata", zap.Error(err))
+		}
+	}
+	agentMetricService := service.NewAgentMetricService(gaugeAgentStorage, counterAgentStorage, sender)
 	worker := workers.NewAgentWorker(agentMetricService, cfg)
+	reloader.Subscribe(worker.Reload)
+	reloader.Watch(ctx, cfg.Config, reload.PollInterval, func(changed bool, err error) {
+		switch {
+		case err != nil:
+			logger.Log.Error("config reload is rejected", zap.Error(err))
+		case changed:
+			logger.Log.Info("config is reloaded")
+		}
+	})
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 	go func() {
@@ -76,3 +114,42 @@ func run() error {
 	}
 	return nil
 }
+
+// newSender builds the senders of the configured exporters, those of the server following the config reloads.
+func newSender(cfg *config.Config, reloader *reload.Reloader[config.Config]) (handlers.Sender, error) {
+	exporters := exporters(cfg)
+	senders := make([]handlers.Sender, 0, len(exporters))
+	for _, exporter := range exporters {
+		switch exporter {
+		case config.ExporterServer:
+			if cfg.UseGRPC {
+				sender := handlers.NewGRPCSender(cfg)
+				reloader.Subscribe(sender.Reload)
+				senders = append(senders, sender)
+			} else {
+				sender := handlers.NewHTTPSender(cfg)
+				reloader.Subscribe(sender.Reload)
+				senders = append(senders, sender)
+			}
+		case config.ExporterOTLP:
+			senders = append(senders, handlers.NewOTLPSender(cfg.OTLPEndpoint, cfg.LocalIP))
+		case config.ExporterPushgateway:
+			senders = append(senders, handlers.NewPushgatewaySender(cfg.Pushgateway, cfg.PushgatewayJob, cfg.LocalIP))
+		default:
+			return nil, fmt.Errorf("unknown exporter %q", exporter)
+		}
+	}
+	if len(senders) == 1 {
+		return senders[0], nil
+	}
+	return handlers.NewFanOutSender(senders...), nil
+}
+
+// exporters returns the configured exporter names.
+func exporters(cfg *config.Config) []string {
+	names := strings.Split(cfg.Exporters, ",")
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+	}
+	return names
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"metrics/internal/ctl/clients"
+	"metrics/internal/ctl/commands"
+	"metrics/internal/ctl/config"
+)
+
+func main() {
+	if err := run(); err != nil {
+		if errors.Is(err, commands.ErrUsage) {
+			_, _ = fmt.Fprint(os.Stderr, config.Commands)
+		}
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	cfg, err := config.Load(os.Args[1:])
+	if cfg != nil && cfg.PrintConfig {
+		// An invalid config is printed too, its errors following.
+		return errors.Join(cfg.Print(os.Stdout), err)
+	}
+	if err != nil {
+		return fmt.Errorf("can't load config: %w", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var client commands.Client
+	if cfg.UseGRPC {
+		grpcClient, err := clients.NewGRPC(cfg)
+		if err != nil {
+			return fmt.Errorf("can't dial grpc server: %w", err)
+		}
+		defer func() {
+			_ = grpcClient.Close()
+		}()
+		client = grpcClient
+	} else {
+		client = clients.NewREST(cfg)
+	}
+	return commands.New(cfg, client, os.Stdin, os.Stdout, os.Stderr).Run(ctx, cfg.Args)
+}
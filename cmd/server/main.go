@@ -1,21 +1,33 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"metrics/internal/server/adapters/storage/database"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"metrics/internal/server/adapters/api/rest"
 	gs "metrics/internal/server/adapters/grpc"
+	"metrics/internal/server/adapters/ingest/graphite"
+	"metrics/internal/server/adapters/ingest/rules"
 	"metrics/internal/server/adapters/storage"
 	"metrics/internal/server/adapters/storage/file"
 	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/sqlite"
 	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/files"
 	"metrics/internal/server/core/service"
 	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/reload"
 
 	"go.uber.org/zap"
 )
@@ -27,7 +39,14 @@ func main() {
 }
 
 func run() error {
+	if len(os.Args) > 1 && os.Args[1] == migrateCommand {
+		return migrate(os.Args[2:])
+	}
 	cfg, err := config.NewConfig()
+	if cfg != nil && cfg.PrintConfig {
+		// An invalid config is printed too, its errors following.
+		return errors.Join(cfg.Print(os.Stdout), err)
+	}
 	if err != nil {
 		return fmt.Errorf("can't load config: %w", err)
 	}
@@ -38,10 +57,35 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to initialize a storage: %w", err)
 	}
-	metricService, err := service.NewMetricService(cfg.FileStoragePath, metricStorage)
+	defer closeStorage(metricStorage)
+	opts := []service.Option{
+		service.WithHistoryWindow(time.Duration(cfg.HistoryWindow) * time.Second),
+		service.WithRateInterval(time.Duration(cfg.RateInterval) * time.Second),
+		service.WithStreamBuffer(cfg.StreamBuffer),
+		service.WithStaleness(time.Duration(cfg.StaleAfter)*time.Second, time.Duration(cfg.EvictAfter)*time.Second),
+		service.WithMissedReports(cfg.MissedReports),
+		service.WithAlertRules(cfg.AlertRulesFile),
+	}
+	if cfg.Buckets != "" {
+		buckets, err := domain.ParseBuckets(cfg.Buckets)
+		if err != nil {
+			return fmt.Errorf("failed to parse histogram buckets: %w", err)
+		}
+		opts = append(opts, service.WithHistogramBuckets(buckets))
+	}
+	metricService, err := service.NewMetricService(cfg.FileStoragePath, metricStorage, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to initialize a service: %w", err)
 	}
+	if cfg.MetadataFile != "" {
+		metadata, err := files.LoadMetadataFromFile(cfg.MetadataFile)
+		if err != nil {
+			return fmt.Errorf("failed to load metric metadata: %w", err)
+		}
+		if err = metricService.RegisterMetadata(context.Background(), metadata); err != nil {
+			return fmt.Errorf("failed to register metric metadata: %w", err)
+		}
+	}
 	if cfg.Restore {
 		err = metricService.LoadMetrics()
 		if err != nil {
@@ -61,13 +105,67 @@ func run() error {
 			}
 		}()
 	}
+	if cfg.EvictAfter > 0 {
+		go func() {
+			t := time.NewTicker(evictInterval(time.Duration(cfg.EvictAfter) * time.Second))
+			for now := range t.C {
+				keys, err := metricService.EvictStale(context.Background(), now)
+				if err != nil {
+					logger.Log.Error("failed to evict stale metrics", zap.Error(err))
+					continue
+				}
+				if len(keys) > 0 {
+					logger.Log.Info("stale metrics evicted", zap.Int("series", len(keys)))
+				}
+			}
+		}()
+	}
+	go func() {
+		t := time.NewTicker(agentCheckInterval)
+		for now := range t.C {
+			for _, agent := range metricService.CheckAgents(now) {
+				if agent.Down {
+					logger.Log.Warn("agent is down", zap.String("agent", agent.ID), zap.Time("last_seen", agent.LastSeen))
+				} else {
+					logger.Log.Info("agent is back", zap.String("agent", agent.ID))
+				}
+			}
+		}
+	}()
+	if cfg.GraphiteAddress != "" {
+		graphiteRules, err := rules.Parse(cfg.GraphiteRules)
+		if err != nil {
+			return fmt.Errorf("failed to parse graphite rules: %w", err)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+		defer stop()
+		listener := graphite.NewListener(cfg.GraphiteAddress, graphite.NewParser(graphiteRules), metricService)
+		go func() {
+			if err := listener.Run(ctx); err != nil {
+				logger.Log.Error("graphite listener has failed", zap.Error(err))
+			}
+		}()
+	}
+	reloader := reload.New(cfg, (*config.Config).Reload)
+	reloader.Subscribe(func(cfg *config.Config) {
+		if err := logger.SetLevel(cfg.LogLevel); err != nil {
+			logger.Log.Error("failed to change log level", zap.Error(err))
+		}
+	})
 	if cfg.UseGRPC {
 		grpcServer := gs.NewGRPC(metricService, cfg)
+		reloader.Subscribe(grpcServer.Reload)
+		watchConfig(reloader)
 		if err := grpcServer.Run(); err != nil {
 			return fmt.Errorf("failed to start gRPC server: %w", err)
 		}
 	} else {
-		api := rest.NewAPI(metricService, cfg)
+		api, err := rest.NewAPI(metricService, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to initialize api: %w", err)
+		}
+		reloader.Subscribe(api.Reload)
+		watchConfig(reloader)
 		if err = api.Run(); err != nil {
 			if errors.Is(err, http.ErrServerClosed) {
 				err = metricService.SaveMetrics()
@@ -83,12 +181,58 @@ func run() error {
 	return nil
 }
 
+// watchConfig reloads the config on SIGHUP and when its file changes, the settings which need a restart
+// being left as they are.
+func watchConfig(reloader *reload.Reloader[config.Config]) {
+	reloader.Watch(context.Background(), reloader.Current().Config, reload.PollInterval, func(changed bool, err error) {
+		switch {
+		case err != nil:
+			logger.Log.Error("config reload is rejected", zap.Error(err))
+		case changed:
+			logger.Log.Info("config is reloaded")
+		}
+	})
+}
+
+// agentCheckInterval is how often agents are checked for missed reports.
+const agentCheckInterval = 5 * time.Second
+
+// evictInterval is how often stale series are looked for, a tenth of the eviction TTL so a series
+// outlives it by little, but not more often than every second.
+func evictInterval(evictAfter time.Duration) time.Duration {
+	return max(evictAfter/10, time.Second)
+}
+
+// closeStorage closes a storage holding resources, such as a database connection.
+func closeStorage(metricStorage storage.MetricStorage) {
+	closer, ok := metricStorage.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		logger.Log.Error("failed to close storage", zap.Error(err))
+	}
+}
+
 func initMetricStorage(cfg *config.Config) (storage.MetricStorage, error) {
 	switch {
+	case strings.HasPrefix(cfg.DatabaseDSN, sqlite.Scheme):
+		metricStorage, err := storage.NewStorage(storage.Config{
+			SQLite: &sqlite.Config{
+				DSN: strings.TrimPrefix(cfg.DatabaseDSN, sqlite.Scheme),
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to init sqlite storage %w", err)
+		}
+		logger.Log.Info("initialize sqlite storage")
+		return metricStorage, nil
 	case cfg.DatabaseDSN != "":
 		metricStorage, err := storage.NewStorage(storage.Config{
 			Database: &database.Config{
-				DSN: cfg.DatabaseDSN,
+				DSN:                cfg.DatabaseDSN,
+				RetentionDays:      cfg.HistoryDays,
+				MaintainPartitions: true,
 			},
 		})
 		if err != nil {
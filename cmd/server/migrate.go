@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/database"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/sqlite"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/migration"
+	"metrics/internal/server/core/service"
+	"metrics/internal/server/logger"
+
+	"go.uber.org/zap"
+)
+
+// migrateCommand is the first argument running migrate instead of the server.
+const migrateCommand = "migrate"
+
+// maxReported is how many missing or mismatched series a failed verification names.
+const maxReported = 10
+
+// migrate copies every series, with its history where both storages keep one, from the storage of one
+// server config to the storage of another, then verifies the copy. An interrupted migration run again
+// with the same checkpoint resumes after the last batch copied.
+func migrate(args []string) error {
+	fs := flag.NewFlagSet(migrateCommand, flag.ContinueOnError)
+	from := fs.String("from", "", "config file of the server whose storage is copied, JSON or YAML")
+	to := fs.String("to", "", "config file of the server whose storage the series are copied to, JSON or YAML")
+	batch := fs.Int("batch", migration.DefaultBatch, "series copied at a time")
+	checkpoint := fs.String("checkpoint", "migrate-checkpoint.json",
+		"file the progress is saved to, an interrupted migration resuming from it, empty disables it")
+	noHistory := fs.Bool("no-history", false, "copy the latest values without the history")
+	level := fs.String("l", "info", "log level")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return fmt.Errorf("%w", err)
+	}
+	if *from == "" || *to == "" {
+		return errors.New("migrate needs both -from and -to")
+	}
+	if err := logger.Initialize(*level); err != nil {
+		return fmt.Errorf("can't load logger: %w", err)
+	}
+	srcCfg, err := config.LoadFile(*from)
+	if err != nil {
+		return fmt.Errorf("can't load source config: %w", err)
+	}
+	dstCfg, err := config.LoadFile(*to)
+	if err != nil {
+		return fmt.Errorf("can't load destination config: %w", err)
+	}
+	if storageKind(srcCfg) == "memory" || storageKind(dstCfg) == "memory" {
+		return errors.New("memory storage keeps nothing to migrate, set store_file or database_dsn")
+	}
+	if storageLocation(srcCfg) == storageLocation(dstCfg) {
+		return errors.New("source and destination are the same storage")
+	}
+	src, _, err := openStorage(srcCfg, true)
+	if err != nil {
+		return fmt.Errorf("failed to open source storage: %w", err)
+	}
+	defer closeStorage(src)
+	dst, flush, err := openStorage(dstCfg, false)
+	if err != nil {
+		return fmt.Errorf("failed to open destination storage: %w", err)
+	}
+	defer closeStorage(dst)
+
+	opts := []migration.Option{
+		migration.WithBatch(*batch),
+		migration.WithCheckpoint(*checkpoint, storageLocation(srcCfg), storageLocation(dstCfg)),
+		migration.WithProgress(func(p migration.Progress) {
+			logger.Log.Info("batch migrated", zap.Int("series", p.Series), zap.Int("samples", p.Samples),
+				zap.String("last_type", p.Last.MType), zap.String("last_id", p.Last.ID))
+		}),
+	}
+	if *noHistory {
+		opts = append(opts, migration.WithoutHistory())
+	}
+	if flush != nil {
+		opts = append(opts, migration.WithFlush(flush))
+	}
+	m := migration.New(src, dst, opts...)
+	if *checkpoint != "" {
+		if _, err = os.Stat(*checkpoint); err == nil {
+			logger.Log.Info("resuming migration from checkpoint", zap.String("checkpoint", *checkpoint))
+		}
+	}
+	logger.Log.Info("migration started", zap.String("from", storageKind(srcCfg)), zap.String("to", storageKind(dstCfg)),
+		zap.Bool("history", m.CopiesHistory()))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	progress, err := m.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("migration stopped after %d series: %w", progress.Series, err)
+	}
+	logger.Log.Info("migration completed", zap.Int("series", progress.Series), zap.Int("samples", progress.Samples))
+	// History older than the partitions of a database lands in its default partition, which its maintenance
+	// splits into daily partitions, dropping the days past the retention of the destination.
+	if p, ok := dst.(partitioner); ok && m.CopiesHistory() {
+		if err = p.MaintainPartitions(ctx, time.Now()); err != nil {
+			return fmt.Errorf("failed to partition migrated history: %w", err)
+		}
+	}
+
+	report, err := m.Verify(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to verify migration: %w", err)
+	}
+	logger.Log.Info("migration verified", zap.Int("source_series", report.Source),
+		zap.Int("destination_series", report.Destination), zap.Int("missing", len(report.Missing)),
+		zap.Int("mismatched", len(report.Mismatched)))
+	if !report.OK() {
+		return fmt.Errorf("destination differs from source: %d series against %d, missing %s, mismatched %s",
+			report.Destination, report.Source, keys(report.Missing), keys(report.Mismatched))
+	}
+	return nil
+}
+
+// partitioner is a destination whose history is partitioned by day.
+type partitioner interface {
+	MaintainPartitions(ctx context.Context, now time.Time) error
+}
+
+// openStorage opens the storage of a server config without starting its background jobs, so that nothing
+// but the copied series is written to it. A file storage is loaded into memory and the returned flush saves
+// it to the file, a source file is only read; other storages need no flush.
+func openStorage(cfg *config.Config, source bool) (storage.MetricStorage, func(ctx context.Context) error, error) {
+	switch storageKind(cfg) {
+	case "database":
+		metricStorage, err := storage.NewStorage(storage.Config{
+			Database: &database.Config{DSN: cfg.DatabaseDSN, RetentionDays: cfg.HistoryDays},
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init db storage %w", err)
+		}
+		return metricStorage, nil, nil
+	case "file":
+		return openFile(cfg.FileStoragePath, source)
+	default:
+		metricStorage, err := initMetricStorage(cfg)
+		return metricStorage, nil, err
+	}
+}
+
+// openFile loads a storage file into memory, a source file being required to exist.
+func openFile(path string, source bool) (storage.MetricStorage, func(ctx context.Context) error, error) {
+	if _, err := os.Stat(path); source && err != nil {
+		return nil, nil, fmt.Errorf("%w", err)
+	}
+	metricStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init memory storage %w", err)
+	}
+	metricService, err := service.NewMetricService(path, metricStorage)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w", err)
+	}
+	if err = metricService.LoadMetrics(); err != nil {
+		return nil, nil, fmt.Errorf("%w", err)
+	}
+	if source {
+		return metricStorage, nil, nil
+	}
+	return metricStorage, func(context.Context) error {
+		return metricService.SaveMetrics()
+	}, nil
+}
+
+// storageKind names the storage initMetricStorage opens for a config.
+func storageKind(cfg *config.Config) string {
+	switch {
+	case strings.HasPrefix(cfg.DatabaseDSN, sqlite.Scheme):
+		return "sqlite"
+	case cfg.DatabaseDSN != "":
+		return "database"
+	case cfg.FileStoragePath == "":
+		return "memory"
+	default:
+		return "file"
+	}
+}
+
+// storageLocation identifies the storage of a config, the DSN of a database or the path of a file.
+func storageLocation(cfg *config.Config) string {
+	if cfg.DatabaseDSN != "" {
+		return cfg.DatabaseDSN
+	}
+	return cfg.FileStoragePath
+}
+
+// keys lists the first keys of a report.
+func keys(list []domain.Key) string {
+	names := make([]string, 0, min(len(list), maxReported))
+	for _, key := range list[:min(len(list), maxReported)] {
+		names = append(names, key.MType+" "+key.ID)
+	}
+	if len(list) > maxReported {
+		names = append(names, fmt.Sprintf("and %d more", len(list)-maxReported))
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
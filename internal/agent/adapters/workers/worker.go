@@ -7,6 +7,7 @@ package workers
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -17,46 +18,85 @@ import (
 	"metrics/internal/agent/logger"
 )
 
-// Metrics represents the number of metrics collected per poll interval.
-const metrics = 100
+// reports is how many reports wait to be sent before reporting blocks.
+const reports = 10
 
 // AgentMetricService defines the interface for metric-related operations.
 type AgentMetricService interface {
 	// CollectMetrics collects metrics based on the given poll count.
 	CollectMetrics(pollCount int) error
 
-	// ReportMetrics reports collected metrics to the channel.
-	ReportMetrics(jobs chan<- domain.Metric) error
+	// ReportMetrics reports collected metrics to the channel, all of them in one job.
+	ReportMetrics(jobs chan<- []domain.Metric) error
 
 	// SendMetrics sends reported metrics asynchronously.
-	SendMetrics(ctx context.Context, cfg *config.Config, jobs <-chan domain.Metric) error
+	SendMetrics(ctx context.Context, jobs <-chan []domain.Metric) error
 }
 
 // AgentWorker manages the collection, reporting, and sending of metrics.
 type AgentWorker struct {
 	agentMetricService AgentMetricService
-	config             *config.Config
+	// config is swapped on reload, the changes of the intervals being signalled to the tickers.
+	config        atomic.Pointer[config.Config]
+	pollChanged   chan struct{}
+	reportChanged chan struct{}
 }
 
 // NewAgentWorker creates a new AgentWorker instance.
 func NewAgentWorker(agentMetricService AgentMetricService, cfg *config.Config) *AgentWorker {
-	return &AgentWorker{
+	a := &AgentWorker{
 		agentMetricService: agentMetricService,
-		config:             cfg,
+		pollChanged:        make(chan struct{}, 1),
+		reportChanged:      make(chan struct{}, 1),
 	}
+	a.config.Store(cfg)
+	return a
+}
+
+// Reload makes the worker use a new config, resetting the tickers whose interval has changed. The rate limit
+// stays as it was at start up.
+func (a *AgentWorker) Reload(cfg *config.Config) {
+	prev := a.config.Swap(cfg)
+	if prev.PollInterval != cfg.PollInterval {
+		notify(a.pollChanged)
+	}
+	if prev.ReportInterval != cfg.ReportInterval {
+		notify(a.reportChanged)
+	}
+}
+
+// notify signals a change on ch without blocking, a pending signal standing for the new one.
+func notify(ch chan<- struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// pollInterval returns the current poll interval.
+func (a *AgentWorker) pollInterval() time.Duration {
+	return time.Duration(a.config.Load().PollInterval) * time.Second
+}
+
+// reportInterval returns the current report interval.
+func (a *AgentWorker) reportInterval() time.Duration {
+	return time.Duration(a.config.Load().ReportInterval) * time.Second
 }
 
 // collectMetrics runs in a separate goroutine to continuously collect metrics.
 func (a *AgentWorker) collectMetrics(ctx context.Context) error {
-	collectMetricsTicker := time.NewTicker(time.Duration(a.config.PollInterval) * time.Second)
+	collectMetricsTicker := time.NewTicker(a.pollInterval())
 	defer collectMetricsTicker.Stop()
 
 	pollCount := 0
-	for range collectMetricsTicker.C {
+	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
+		case <-a.pollChanged:
+			collectMetricsTicker.Reset(a.pollInterval())
+			logger.Log.Info("poll interval is changed", zap.Duration("interval", a.pollInterval()))
+		case <-collectMetricsTicker.C:
 			err := a.agentMetricService.CollectMetrics(pollCount)
 			if err != nil {
 				logger.Log.Error("error occurred during collecting metrics", zap.Error(err))
@@ -65,23 +105,25 @@ func (a *AgentWorker) collectMetrics(ctx context.Context) error {
 			pollCount++
 		}
 	}
-	return nil
 }
 
 // reportMetrics runs in a separate goroutine to continuously report collected metrics.
-func (a *AgentWorker) reportMetrics(ctx context.Context, jobs chan<- domain.Metric) error {
+func (a *AgentWorker) reportMetrics(ctx context.Context, jobs chan<- []domain.Metric) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	reportMetricsTicker := time.NewTicker(time.Duration(a.config.ReportInterval) * time.Second)
+	reportMetricsTicker := time.NewTicker(a.reportInterval())
 	defer reportMetricsTicker.Stop()
 
 	pollCount := 0
-	for range reportMetricsTicker.C {
+	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		default:
+		case <-a.reportChanged:
+			reportMetricsTicker.Reset(a.reportInterval())
+			logger.Log.Info("report interval is changed", zap.Duration("interval", a.reportInterval()))
+		case <-reportMetricsTicker.C:
 			err := a.agentMetricService.ReportMetrics(jobs)
 			if err != nil {
 				logger.Log.Error("error occurred during reporting metrics", zap.Error(err))
@@ -90,13 +132,12 @@ func (a *AgentWorker) reportMetrics(ctx context.Context, jobs chan<- domain.Metr
 			pollCount++
 		}
 	}
-	return nil
 }
 
 // Run starts the worker and manages its lifecycle.
 func (a *AgentWorker) Run(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
-	jobs := make(chan domain.Metric, metrics)
+	jobs := make(chan []domain.Metric, reports)
 
 	go func() {
 		if err := a.collectMetrics(ctx); err != nil {
@@ -110,9 +151,9 @@ func (a *AgentWorker) Run(ctx context.Context) error {
 	}()
 
 	g := new(errgroup.Group)
-	for w := 1; w <= a.config.RateLimit; w++ {
+	for w := 1; w <= a.config.Load().RateLimit; w++ {
 		g.Go(func() error {
-			err := a.agentMetricService.SendMetrics(ctx, a.config, jobs)
+			err := a.agentMetricService.SendMetrics(ctx, jobs)
 			if err != nil {
 				return fmt.Errorf("%w", err)
 			}
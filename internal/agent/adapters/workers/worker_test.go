@@ -0,0 +1,46 @@
+package workers
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/domain"
+)
+
+type countingService struct {
+	collected atomic.Int32
+}
+
+func (s *countingService) CollectMetrics(int) error {
+	s.collected.Add(1)
+	return nil
+}
+
+func (s *countingService) ReportMetrics(chan<- []domain.Metric) error {
+	return nil
+}
+
+func (s *countingService) SendMetrics(ctx context.Context, _ <-chan []domain.Metric) error {
+	<-ctx.Done()
+	return nil
+}
+
+func TestAgentWorker_Reload(t *testing.T) {
+	svc := &countingService{}
+	worker := NewAgentWorker(svc, &config.Config{PollInterval: 3600, ReportInterval: 3600, RateLimit: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		_ = worker.Run(ctx)
+	}()
+
+	worker.Reload(&config.Config{PollInterval: 1, ReportInterval: 3600, RateLimit: 1})
+	assert.Eventually(t, func() bool {
+		return svc.collected.Load() > 0
+	}, 3*time.Second, 50*time.Millisecond)
+}
@@ -3,57 +3,101 @@ package config
 
 import (
 	"crypto/rsa"
-	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	pb "metrics/internal/proto"
+	"metrics/internal/shared-kernel/agentinfo"
 	"metrics/internal/shared-kernel/cert"
+	"metrics/internal/shared-kernel/settings"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 
-	"github.com/caarlos0/env/v11"
+	"go.uber.org/zap"
 )
 
 const (
 	defaultPollInterval   = 2
 	defaultReportInterval = 10
+	maxPort               = 65535
 )
 
+// Destinations the agent can export metrics to.
+const (
+	ExporterServer      = "server"
+	ExporterOTLP        = "otlp"
+	ExporterPushgateway = "pushgateway"
+)
+
+// Config holds the settings of the agent. The ones tagged reload:"live" are swapped on reload, changing the
+// others needs a restart. The ones tagged secret are redacted when the config is printed.
 type Config struct {
-	Address        string `env:"ADDRESS" json:"address"`
-	ReportInterval int    `env:"REPORT_INTERVAL" json:"report_interval"`
-	PollInterval   int    `env:"POLL_INTERVAL" json:"poll_interval"`
-	RateLimit      int    `env:"RATE_LIMIT" json:"rate_limit"`
-	Key            string `env:"KEY" json:"key"`
-	LogLevel       string `json:"log_level"`
-	LocalIP        string `env:"LOCAL_IP" json:"-"`
-	Host           string `json:"host"`
-	CryptoKey      string `env:"CRYPTO_KEY" json:"crypto_key"`
-	Config         string `env:"CONFIG" json:"config"`
-	UseGRPC        bool   `env:"GRPC"`
-	GRPCPort       int    `env:"GRPC_PORT"`
-	GRPCClient     pb.MetricServiceClient
-	PublicKey      *rsa.PublicKey `json:"-"`
+	Address        string                 `env:"ADDRESS" json:"address"`
+	ReportInterval int                    `env:"REPORT_INTERVAL" json:"report_interval" reload:"live"`
+	PollInterval   int                    `env:"POLL_INTERVAL" json:"poll_interval" reload:"live"`
+	RateLimit      int                    `env:"RATE_LIMIT" json:"rate_limit"`
+	Key            string                 `env:"KEY" json:"key" reload:"live" secret:"true"`
+	LogLevel       string                 `json:"log_level" reload:"live"`
+	LocalIP        string                 `env:"LOCAL_IP" json:"-"`
+	Host           string                 `json:"-" alias:"host"`
+	CryptoKey      string                 `env:"CRYPTO_KEY" json:"crypto_key" reload:"live"`
+	Config         string                 `env:"CONFIG" json:"config"`
+	UseGRPC        bool                   `env:"GRPC" json:"grpc" alias:"UseGRPC"`
+	GRPCPort       int                    `env:"GRPC_PORT" json:"grpc_port" alias:"GRPCPort"`
+	Exporters      string                 `env:"EXPORTERS" json:"exporters"`
+	OTLPEndpoint   string                 `env:"OTLP_ENDPOINT" json:"otlp_endpoint"`
+	Pushgateway    string                 `env:"PUSHGATEWAY" json:"pushgateway"`
+	PushgatewayJob string                 `env:"PUSHGATEWAY_JOB" json:"pushgateway_job"`
+	Hostname       string                 `env:"AGENT_HOSTNAME" json:"hostname"`
+	HostLabel      string                 `env:"HOST_LABEL" json:"host_label"`
+	Version        string                 `json:"-"`
+	PrintConfig    bool                   `json:"-"`
+	GRPCClient     pb.MetricServiceClient `json:"-"`
+	PublicKey      *rsa.PublicKey         `json:"-"`
+	// args are the command line arguments, parsed again on reload.
+	args []string
 }
 
+// NewConfig reads the config from the defaults, the config file, the environment and the command line.
 func NewConfig() (*Config, error) {
-	cfg := getJSONConfig()
-	flag.StringVar(&cfg.Address, "a", "localhost:8080", "run address")
-	flag.IntVar(&cfg.PollInterval, "p", defaultPollInterval, " poll interval ")
-	flag.IntVar(&cfg.ReportInterval, "r", defaultReportInterval, " report interval ")
-	flag.StringVar(&cfg.LogLevel, "L", "info", "log level")
-	flag.IntVar(&cfg.RateLimit, "l", 1, "rate limit")
-	flag.StringVar(&cfg.Key, "k", "", "hashing key")
-	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "public key file path")
-	flag.StringVar(&cfg.Config, "c", "./configs/agent.json", "agent config file path")
-	flag.BoolVar(&cfg.UseGRPC, "grpc", false, "using GRPC client")
-	flag.IntVar(&cfg.GRPCPort, "gp", 3200, "GRPC port")
-	flag.Parse()
-	err := env.Parse(&cfg)
+	return Load(os.Args[1:])
+}
+
+// Load reads the config in layers, each overriding the settings of the previous one: the defaults, the JSON
+// or YAML file named by the -c flag or else by CONFIG, the environment and the flags set in args. An invalid
+// config is returned along with the errors naming its invalid settings.
+func Load(args []string) (*Config, error) {
+	cfg := defaults()
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "run address")
+	fs.IntVar(&cfg.PollInterval, "p", cfg.PollInterval, " poll interval ")
+	fs.IntVar(&cfg.ReportInterval, "r", cfg.ReportInterval, " report interval ")
+	fs.StringVar(&cfg.LogLevel, "L", cfg.LogLevel, "log level")
+	fs.IntVar(&cfg.RateLimit, "l", cfg.RateLimit, "rate limit")
+	fs.StringVar(&cfg.Key, "k", cfg.Key, "hashing key")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "public key file path")
+	fs.StringVar(&cfg.Config, "c", cfg.Config, "config file path, JSON or YAML")
+	fs.BoolVar(&cfg.UseGRPC, "grpc", cfg.UseGRPC, "using GRPC client")
+	fs.IntVar(&cfg.GRPCPort, "gp", cfg.GRPCPort, "GRPC port")
+	fs.StringVar(&cfg.Exporters, "exporters", cfg.Exporters, "comma separated destinations: server, otlp, pushgateway")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlp-endpoint", cfg.OTLPEndpoint, "OTLP/HTTP metrics endpoint")
+	fs.StringVar(&cfg.Pushgateway, "pushgateway", cfg.Pushgateway, "Prometheus Pushgateway address")
+	fs.StringVar(&cfg.PushgatewayJob, "pushgateway-job", cfg.PushgatewayJob, "Prometheus Pushgateway job name")
+	fs.StringVar(&cfg.Hostname, "hostname", cfg.Hostname, "hostname reported to the server, the system one when empty")
+	fs.StringVar(&cfg.HostLabel, "host-label", cfg.HostLabel,
+		"label the hostname is added to the series sent to the server under, e.g. host, empty sends them bare")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config with the secrets redacted and exit")
+	path, err := settings.Load(&cfg, fs, args, "c", "CONFIG")
 	if err != nil {
-		return &cfg, fmt.Errorf("failed to get config for worker: %w", err)
+		return nil, fmt.Errorf("failed to get config for worker: %w", err)
+	}
+	cfg.Config = path
+	cfg.args = args
+	if err = cfg.validate(); err != nil {
+		return &cfg, err
 	}
 	address := strings.Split(cfg.Address, ":")
 	port := "8080"
@@ -63,25 +107,100 @@ func NewConfig() (*Config, error) {
 	if cfg.LocalIP, err = getLocalIP(cfg.Address); err != nil {
 		return &cfg, fmt.Errorf("failed to get local ip: %w", err)
 	}
+	if cfg.Hostname == "" {
+		if cfg.Hostname, err = os.Hostname(); err != nil {
+			return &cfg, fmt.Errorf("failed to get hostname: %w", err)
+		}
+	}
 	cfg.Host = "http://localhost:" + port
-	cfg.PublicKey = cert.PublicKey(cfg.CryptoKey)
 	return &cfg, nil
 }
 
-func getJSONConfig() Config {
-	var cfg Config
-	configPath := os.Getenv("CONFIG")
-	if configPath == "" {
-		return cfg
-	}
-	buf, err := os.ReadFile(configPath)
+// Reload reads the config again from the same command line arguments, keeping the version and the gRPC
+// client set at start up.
+func (c *Config) Reload() (*Config, error) {
+	next, err := Load(c.args)
 	if err != nil {
-		return cfg
+		return nil, err
+	}
+	next.Version = c.Version
+	next.GRPCClient = c.GRPCClient
+	return next, nil
+}
+
+// Print writes the config as a JSON config file with the secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	return settings.Print(w, c)
+}
+
+// defaults returns the settings used when neither the file, nor the environment, nor the flags set them.
+func defaults() Config {
+	return Config{
+		Address:        "localhost:8080",
+		PollInterval:   defaultPollInterval,
+		ReportInterval: defaultReportInterval,
+		LogLevel:       "info",
+		RateLimit:      1,
+		GRPCPort:       3200,
+		Exporters:      ExporterServer,
+		OTLPEndpoint:   "http://localhost:4318/v1/metrics",
+		Pushgateway:    "http://localhost:9091",
+		PushgatewayJob: "agent",
+	}
+}
+
+// validate checks the settings, naming every invalid one, and reads the public key.
+func (c *Config) validate() error {
+	var errs settings.Errors
+	if c.Address == "" {
+		errs.Add("address", "must not be empty")
+	}
+	for _, s := range []struct {
+		field string
+		value int
+	}{
+		{"poll_interval", c.PollInterval},
+		{"report_interval", c.ReportInterval},
+		{"rate_limit", c.RateLimit},
+	} {
+		if s.value <= 0 {
+			errs.Add(s.field, "must be positive, got %d", s.value)
+		}
+	}
+	if c.GRPCPort <= 0 || c.GRPCPort > maxPort {
+		errs.Add("grpc_port", "must be between 1 and %d, got %d", maxPort, c.GRPCPort)
 	}
-	if err = json.Unmarshal(buf, &cfg); err != nil {
-		return cfg
+	for _, exporter := range strings.Split(c.Exporters, ",") {
+		switch strings.TrimSpace(exporter) {
+		case ExporterServer, ExporterOTLP, ExporterPushgateway:
+		default:
+			errs.Add("exporters", "unknown exporter %q", exporter)
+		}
+	}
+	if strings.ContainsAny(c.HostLabel, `{}=,"`) {
+		errs.Add("host_label", "must not contain any of {}=,\", got %q", c.HostLabel)
+	}
+	if _, err := zap.ParseAtomicLevel(c.LogLevel); err != nil {
+		errs.Add("log_level", "%w", err)
+	}
+	var err error
+	if c.PublicKey, err = cert.PublicKey(c.CryptoKey); err != nil {
+		errs.Add("crypto_key", "%w", err)
+	}
+	return errs.Err()
+}
+
+// Summary describes the configuration to the server, without the keys and addresses.
+func (c *Config) Summary() map[string]string {
+	return map[string]string{
+		agentinfo.ReportInterval: strconv.Itoa(c.ReportInterval),
+		"poll_interval":          strconv.Itoa(c.PollInterval),
+		"rate_limit":             strconv.Itoa(c.RateLimit),
+		"exporters":              c.Exporters,
+		"grpc":                   strconv.FormatBool(c.UseGRPC),
+		"signed":                 strconv.FormatBool(c.Key != ""),
+		"encrypted":              strconv.FormatBool(c.PublicKey != nil),
 	}
-	return cfg
 }
 
 func getLocalIP(serverIP string) (string, error) {
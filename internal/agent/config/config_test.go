@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/shared-kernel/settings"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfig(t, "agent.yaml", "address: localhost:9090\npoll_interval: 1\nreport_interval: 5\nkey: file\n")
+	t.Setenv("REPORT_INTERVAL", "7")
+
+	cfg, err := Load([]string{"-c", path, "-k", "flag", "-hostname", "agent-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:9090", cfg.Address)
+	assert.Equal(t, "http://localhost:9090", cfg.Host)
+	assert.Equal(t, 1, cfg.PollInterval)
+	assert.Equal(t, 7, cfg.ReportInterval)
+	assert.Equal(t, "flag", cfg.Key)
+	assert.Equal(t, "agent-1", cfg.Hostname)
+	assert.Empty(t, cfg.HostLabel, "the series are sent bare unless a host label is set")
+	assert.Equal(t, path, cfg.Config)
+
+	cfg.Version = "v1.0.0"
+	next, err := cfg.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", next.Version)
+}
+
+func TestLoadFormerKeys(t *testing.T) {
+	// The keys of the gRPC settings before they were given json tags, and the host, derived from the address.
+	path := writeConfig(t, "agent.json",
+		`{"address": "localhost:9090", "UseGRPC": true, "GRPCPort": 3300, "host": "http://localhost:8080"}`)
+
+	cfg, err := Load([]string{"-c", path})
+	require.NoError(t, err)
+	assert.True(t, cfg.UseGRPC)
+	assert.Equal(t, 3300, cfg.GRPCPort)
+	assert.Equal(t, "http://localhost:9090", cfg.Host)
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := writeConfig(t, "agent.json",
+		`{"poll_interval": 0, "report_interval": -1, "exporters": "server,statsd", "host_label": "a=b"}`)
+
+	_, err := Load([]string{"-c", path, "-L", "loud", "-crypto-key", "/nonexistent/public.pem"})
+	require.Error(t, err)
+	var joined interface{ Unwrap() []error }
+	require.ErrorAs(t, err, &joined)
+	var fields []string
+	for _, err := range joined.Unwrap() {
+		var fieldErr *settings.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			fields = append(fields, fieldErr.Field)
+		}
+	}
+	assert.Equal(t, []string{
+		"poll_interval", "report_interval", "exporters", "host_label", "log_level", "crypto_key",
+	}, fields)
+}
@@ -0,0 +1,45 @@
+package domain
+
+// Metadata describes a metric to the server.
+type Metadata struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// RuntimeMetadata describes the metrics collected by the agent.
+var RuntimeMetadata = []Metadata{
+	{Name: "Alloc", Type: Gauge, Unit: "bytes", Description: "Bytes of allocated heap objects"},
+	{Name: "BuckHashSys", Type: Gauge, Unit: "bytes", Description: "Bytes of memory in profiling bucket hash tables"},
+	{Name: "CPUutilization1", Type: Gauge, Unit: "percent", Description: "CPU utilization"},
+	{Name: "Frees", Type: Gauge, Description: "Cumulative count of heap objects freed"},
+	{Name: "FreeMemory", Type: Gauge, Unit: "bytes", Description: "Free system memory"},
+	{Name: "GCCPUFraction", Type: Gauge, Unit: "ratio", Description: "Fraction of CPU time used by the GC"},
+	{Name: "GCSys", Type: Gauge, Unit: "bytes", Description: "Bytes of memory in garbage collection metadata"},
+	{Name: "HeapAlloc", Type: Gauge, Unit: "bytes", Description: "Bytes of allocated heap objects"},
+	{Name: "HeapIdle", Type: Gauge, Unit: "bytes", Description: "Bytes in idle heap spans"},
+	{Name: "HeapInuse", Type: Gauge, Unit: "bytes", Description: "Bytes in in-use heap spans"},
+	{Name: "HeapObjects", Type: Gauge, Description: "Number of allocated heap objects"},
+	{Name: "HeapReleased", Type: Gauge, Unit: "bytes", Description: "Bytes of physical memory returned to the OS"},
+	{Name: "HeapSys", Type: Gauge, Unit: "bytes", Description: "Bytes of heap memory obtained from the OS"},
+	{Name: "LastGC", Type: Gauge, Unit: "ns", Description: "Time the last garbage collection finished, since the epoch"},
+	{Name: "Lookups", Type: Gauge, Description: "Number of pointer lookups performed by the runtime"},
+	{Name: "MCacheInuse", Type: Gauge, Unit: "bytes", Description: "Bytes of allocated mcache structures"},
+	{Name: "MCacheSys", Type: Gauge, Unit: "bytes", Description: "Bytes obtained from the OS for mcache structures"},
+	{Name: "MSpanInuse", Type: Gauge, Unit: "bytes", Description: "Bytes of allocated mspan structures"},
+	{Name: "MSpanSys", Type: Gauge, Unit: "bytes", Description: "Bytes obtained from the OS for mspan structures"},
+	{Name: "Mallocs", Type: Gauge, Description: "Cumulative count of heap objects allocated"},
+	{Name: "NextGC", Type: Gauge, Unit: "bytes", Description: "Target heap size of the next GC cycle"},
+	{Name: "NumForcedGC", Type: Gauge, Description: "Number of GC cycles forced by the application"},
+	{Name: "NumGC", Type: Gauge, Description: "Number of completed GC cycles"},
+	{Name: "OtherSys", Type: Gauge, Unit: "bytes", Description: "Bytes in miscellaneous off-heap allocations"},
+	{Name: "PauseTotalNs", Type: Gauge, Unit: "ns", Description: "Cumulative time spent in GC stop-the-world pauses"},
+	{Name: "StackInuse", Type: Gauge, Unit: "bytes", Description: "Bytes in stack spans"},
+	{Name: "StackSys", Type: Gauge, Unit: "bytes", Description: "Bytes of stack memory obtained from the OS"},
+	{Name: "Sys", Type: Gauge, Unit: "bytes", Description: "Total bytes of memory obtained from the OS"},
+	{Name: "TotalAlloc", Type: Gauge, Unit: "bytes", Description: "Cumulative bytes allocated for heap objects"},
+	{Name: "TotalMemory", Type: Gauge, Unit: "bytes", Description: "Total system memory"},
+	{Name: RandomValue, Type: Gauge, Description: "Random value in [0, 1)"},
+	{Name: PollCount, Type: Counter, Description: "Number of times the metrics were collected"},
+}
@@ -8,9 +8,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/go-resty/resty/v2"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
 
 	"metrics/internal/agent/config"
 	"metrics/internal/agent/core/domain"
@@ -19,6 +21,7 @@ import (
 
 	"metrics/internal/agent/logger"
 	pb "metrics/internal/proto"
+	"metrics/internal/shared-kernel/agentinfo"
 	"metrics/internal/shared-kernel/compress"
 	"metrics/internal/shared-kernel/hash"
 )
@@ -41,7 +44,37 @@ import (
 //   - Sends HTTP POST request to the configured endpoint.
 //   - Logs the request details if successful.
 func SendMetricHTTP(cfg *config.Config, request *domain.Metric) error {
-	data, err := json.Marshal(request)
+	return postHTTP(cfg, "/update/", labelled(cfg, request), http.StatusOK)
+}
+
+// labelled returns the metric with its hostname added under the host label, so that the series of several
+// agents are kept apart on the server. The metric is returned as is when the host label is empty.
+func labelled(cfg *config.Config, m *domain.Metric) *domain.Metric {
+	if cfg.HostLabel == "" {
+		return m
+	}
+	l := *m
+	l.ID = m.ID + "{" + cfg.HostLabel + "=" + strconv.Quote(cfg.Hostname) + "}"
+	return &l
+}
+
+// RegisterMetadataHTTP registers the description, unit and type of metrics on the server.
+//
+// Args:
+//
+//	cfg *config.Config: Configuration object containing host and key information.
+//	metadata []domain.Metadata: Metadata of the metrics.
+//
+// Returns:
+//
+//	error: Any error that occurs during the process.
+func RegisterMetadataHTTP(cfg *config.Config, metadata []domain.Metadata) error {
+	return postHTTP(cfg, "/api/v1/metadata", metadata, http.StatusNoContent)
+}
+
+// postHTTP marshals, compresses, signs and optionally encrypts the body and posts it to the server.
+func postHTTP(cfg *config.Config, path string, body any, status int) error {
+	data, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to parse model: %w", err)
 	}
@@ -54,7 +87,7 @@ func SendMetricHTTP(cfg *config.Config, request *domain.Metric) error {
 		SetHeader(headers.ContentType, `application/json`).
 		SetHeader(headers.ContentEncoding, `gzip`).
 		SetHeader(headers.AcceptEncoding, `gzip`).
-		SetHeader(headers.XRealIP, cfg.LocalIP)
+		SetHeaders(identityHeaders(cfg))
 	if cfg.Key != "" {
 		req.SetHeader(hash.Header, hash.Encode(buf, cfg.Key))
 	}
@@ -65,11 +98,11 @@ func SendMetricHTTP(cfg *config.Config, request *domain.Metric) error {
 			return fmt.Errorf("failed to encrypt data: %w", err)
 		}
 	}
-	resp, err := req.SetBody(buf).Post(cfg.Host + "/update/")
+	resp, err := req.SetBody(buf).Post(cfg.Host + path)
 	if err != nil {
 		return fmt.Errorf("failed to send metrics: %w", err)
 	}
-	if resp.StatusCode() != http.StatusOK {
+	if resp.StatusCode() != status {
 		return fmt.Errorf("bad request. Status Code %d", resp.StatusCode())
 	}
 	logger.Log.Info(
@@ -82,6 +115,16 @@ func SendMetricHTTP(cfg *config.Config, request *domain.Metric) error {
 	return nil
 }
 
+// identityHeaders are the headers, or the gRPC metadata, identifying the agent to the server.
+func identityHeaders(cfg *config.Config) map[string]string {
+	return map[string]string{
+		headers.XRealIP:          cfg.LocalIP,
+		agentinfo.HeaderHostname: cfg.Hostname,
+		agentinfo.HeaderVersion:  cfg.Version,
+		agentinfo.HeaderConfig:   agentinfo.EncodeConfig(cfg.Summary()),
+	}
+}
+
 // SendMetricGRPC sends metrics to the configured endpoint.
 //
 // This function marshals the provided Metric, compresses the data,
@@ -100,6 +143,7 @@ func SendMetricHTTP(cfg *config.Config, request *domain.Metric) error {
 //   - Sends GRPC request to the configured endpoint.
 func SendMetricGRPC(cfg *config.Config, request *domain.Metric) error {
 	var metric pb.Metric
+	request = labelled(cfg, request)
 	metric.Id = request.ID
 	if request.MType == domain.Gauge {
 		metric.Type = pb.Metric_GAUGE
@@ -108,7 +152,8 @@ func SendMetricGRPC(cfg *config.Config, request *domain.Metric) error {
 		metric.Type = pb.Metric_COUNTER
 		metric.Delta = *request.Delta
 	}
-	resp, err := cfg.GRPCClient.Update(context.Background(), &metric)
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.New(identityHeaders(cfg)))
+	resp, err := cfg.GRPCClient.Update(ctx, &metric)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/domain"
+	"metrics/internal/shared-kernel/agentinfo"
+)
+
+func TestSendMetricHTTP_Identity(t *testing.T) {
+	var (
+		got    http.Header
+		metric domain.Metric
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		body, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		assert.NoError(t, json.NewDecoder(body).Decode(&metric))
+	}))
+	defer srv.Close()
+	cfg := &config.Config{
+		Host:           srv.URL,
+		LocalIP:        "10.0.0.1",
+		Hostname:       "web1",
+		HostLabel:      "host",
+		Version:        "1.2.0",
+		ReportInterval: 10,
+		Key:            "secret",
+		Exporters:      config.ExporterServer,
+	}
+	require.NoError(t, SendMetricHTTP(cfg, gauge("Alloc", 1)))
+
+	assert.Equal(t, `Alloc{host="web1"}`, metric.ID, "the series of the agent carry its hostname")
+	assert.Equal(t, "10.0.0.1", got.Get(headers.XRealIP))
+	assert.Equal(t, "web1", got.Get(agentinfo.HeaderHostname))
+	assert.Equal(t, "1.2.0", got.Get(agentinfo.HeaderVersion))
+	summary := agentinfo.ParseConfig(got.Get(agentinfo.HeaderConfig))
+	assert.Equal(t, "10", summary[agentinfo.ReportInterval])
+	assert.Equal(t, "true", summary["signed"])
+	assert.NotContains(t, got.Get(agentinfo.HeaderConfig), "secret", "the summary leaves out the keys")
+}
+
+func TestLabelled(t *testing.T) {
+	m := gauge("Alloc", 1)
+	assert.Same(t, m, labelled(&config.Config{Hostname: "web1"}, m), "an empty host label leaves the ID bare")
+	assert.Equal(t, `Alloc{node="web \"1\""}`, labelled(&config.Config{Hostname: `web "1"`, HostLabel: "node"}, m).ID)
+	assert.Equal(t, "Alloc", m.ID)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/go-resty/resty/v2"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"metrics/internal/agent/core/domain"
+	"metrics/internal/agent/logger"
+)
+
+// otlpServiceName is reported as the service.name resource attribute.
+const otlpServiceName = "metrics-agent"
+
+// OTLPSender sends metrics to an OTLP/HTTP receiver, e.g. http://localhost:4318/v1/metrics.
+//
+// Gauges are exported as gauges and counters as monotonic sums with delta temporality, each increase
+// starting at the previous export accepted.
+type OTLPSender struct {
+	endpoint string
+	client   *resty.Client
+	resource *resourcepb.Resource
+	// start is when the increases of the next export started, the time of the previous one accepted.
+	mux   *sync.Mutex
+	start time.Time
+}
+
+// NewOTLPSender creates a new instance of OTLPSender, hostIP is reported as the host.ip resource attribute.
+func NewOTLPSender(endpoint, hostIP string) *OTLPSender {
+	return &OTLPSender{
+		endpoint: endpoint,
+		client:   resty.New().SetTimeout(exporterTimeout),
+		resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttribute("service.name", otlpServiceName),
+			stringAttribute("host.ip", hostIP),
+		}},
+		mux:   &sync.Mutex{},
+		start: time.Now(),
+	}
+}
+
+// Send implements Sender.
+func (s *OTLPSender) Send(ctx context.Context, m *domain.Metric) error {
+	return s.SendBatch(ctx, []domain.Metric{*m})
+}
+
+// SendBatch implements BatchSender, exporting the metrics in a single request. The lock spans the export,
+// so that the increases of concurrent exports don't overlap.
+func (s *OTLPSender) SendBatch(ctx context.Context, metrics []domain.Metric) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := time.Now()
+	start, end := uint64(s.start.UnixNano()), uint64(now.UnixNano())
+	list := make([]*metricspb.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		metric := &metricspb.Metric{Name: m.ID}
+		switch m.MType {
+		case domain.Gauge:
+			metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{{
+					TimeUnixNano: end,
+					Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: *m.Value},
+				}},
+			}}
+		case domain.Counter:
+			metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				IsMonotonic:            true,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints: []*metricspb.NumberDataPoint{{
+					StartTimeUnixNano: start,
+					TimeUnixNano:      end,
+					Value:             &metricspb.NumberDataPoint_AsInt{AsInt: *m.Delta},
+				}},
+			}}
+		default:
+			return fmt.Errorf("unknown metric type %q", m.MType)
+		}
+		list = append(list, metric)
+	}
+	body, err := proto.Marshal(&colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     s.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: list}},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal otlp request: %w", err)
+	}
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetHeader(headers.ContentType, "application/x-protobuf").
+		SetBody(body).
+		Post(s.endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to send otlp metrics: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("bad request. Status Code %d", resp.StatusCode())
+	}
+	s.start = now
+	var export colmetricspb.ExportMetricsServiceResponse
+	if err = proto.Unmarshal(resp.Body(), &export); err != nil {
+		return fmt.Errorf("failed to unmarshal otlp response: %w", err)
+	}
+	// A rejected data point would be rejected again, so it is reported instead of retried.
+	if ps := export.GetPartialSuccess(); ps.GetRejectedDataPoints() > 0 {
+		logger.Log.Warn("otlp receiver rejected metrics",
+			zap.Int64("data_points", ps.GetRejectedDataPoints()),
+			zap.String("reason", ps.GetErrorMessage()),
+		)
+	}
+	return nil
+}
+
+func stringAttribute(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-http-utils/headers"
+	"github.com/go-resty/resty/v2"
+
+	"metrics/internal/agent/core/domain"
+)
+
+// invalidNameChars matches the characters not allowed in Prometheus metric names.
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// PushgatewaySender pushes metrics to a Prometheus Pushgateway, grouped by job and instance.
+//
+// The Pushgateway keeps the last pushed value, so counter increases are summed into running totals
+// before they are pushed.
+type PushgatewaySender struct {
+	url    string
+	client *resty.Client
+	mux    *sync.Mutex
+	totals map[string]int64
+}
+
+// NewPushgatewaySender creates a new instance of PushgatewaySender.
+func NewPushgatewaySender(address, job, instance string) *PushgatewaySender {
+	u := strings.TrimSuffix(address, "/") + "/metrics/job/" + url.PathEscape(job)
+	if instance != "" {
+		u += "/instance/" + url.PathEscape(instance)
+	}
+	return &PushgatewaySender{
+		url:    u,
+		client: resty.New().SetTimeout(exporterTimeout),
+		mux:    &sync.Mutex{},
+		totals: make(map[string]int64),
+	}
+}
+
+// Send implements Sender.
+func (s *PushgatewaySender) Send(ctx context.Context, m *domain.Metric) error {
+	name := metricName(m.ID)
+	switch m.MType {
+	case domain.Gauge:
+		return s.push(ctx, name, domain.Gauge, strconv.FormatFloat(*m.Value, 'g', -1, 64))
+	case domain.Counter:
+		// The lock spans the push, so the total is only advanced once it was accepted and a retried
+		// increase isn't counted twice.
+		s.mux.Lock()
+		defer s.mux.Unlock()
+		total := s.totals[name] + *m.Delta
+		if err := s.push(ctx, name, domain.Counter, strconv.FormatInt(total, 10)); err != nil {
+			return err
+		}
+		s.totals[name] = total
+		return nil
+	default:
+		return fmt.Errorf("unknown metric type %q", m.MType)
+	}
+}
+
+// push sends a sample in the text exposition format. POST only replaces the metrics with the same name,
+// so the other metrics of the group are kept.
+func (s *PushgatewaySender) push(ctx context.Context, name, mType, value string) error {
+	body := fmt.Sprintf("# TYPE %s %s\n%s %s\n", name, mType, name, value)
+	resp, err := s.client.R().
+		SetContext(ctx).
+		SetHeader(headers.ContentType, "text/plain; version=0.0.4").
+		SetBody(body).
+		Post(s.url)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	if resp.StatusCode() != http.StatusOK && resp.StatusCode() != http.StatusAccepted {
+		return fmt.Errorf("bad request. Status Code %d", resp.StatusCode())
+	}
+	return nil
+}
+
+// metricName turns a metric ID into a valid Prometheus metric name.
+func metricName(id string) string {
+	name := invalidNameChars.ReplaceAllString(id, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/agent/config"
+	"metrics/internal/agent/core/domain"
+	"metrics/internal/agent/logger"
+)
+
+var ErrNoDestinations = errors.New("no destinations to send metrics to")
+
+// exporterTimeout bounds a request to an exporter, so that a destination that hangs doesn't stall the reports.
+const exporterTimeout = 10 * time.Second
+
+// Sender delivers metrics to a destination.
+type Sender interface {
+	// Send delivers a single metric, counters carry the increase since the previous report.
+	Send(ctx context.Context, m *domain.Metric) error
+}
+
+// BatchSender is implemented by senders delivering the metrics of a report in a single request.
+type BatchSender interface {
+	// SendBatch delivers the metrics of a report, all of them or none.
+	SendBatch(ctx context.Context, metrics []domain.Metric) error
+}
+
+// HTTPSender sends metrics to the server over its JSON API.
+type HTTPSender struct {
+	// cfg is swapped on reload.
+	cfg atomic.Pointer[config.Config]
+}
+
+// NewHTTPSender creates a new instance of HTTPSender.
+func NewHTTPSender(cfg *config.Config) *HTTPSender {
+	s := &HTTPSender{}
+	s.Reload(cfg)
+	return s
+}
+
+// Reload makes the sender use a new config: the hashing and the crypto keys.
+func (s *HTTPSender) Reload(cfg *config.Config) {
+	s.cfg.Store(cfg)
+}
+
+// Send implements Sender.
+func (s *HTTPSender) Send(_ context.Context, m *domain.Metric) error {
+	return SendMetricHTTP(s.cfg.Load(), m)
+}
+
+// GRPCSender sends metrics to the server over gRPC.
+type GRPCSender struct {
+	// cfg is swapped on reload.
+	cfg atomic.Pointer[config.Config]
+}
+
+// NewGRPCSender creates a new instance of GRPCSender.
+func NewGRPCSender(cfg *config.Config) *GRPCSender {
+	s := &GRPCSender{}
+	s.Reload(cfg)
+	return s
+}
+
+// Reload makes the sender use a new config, reported to the server along with the metrics.
+func (s *GRPCSender) Reload(cfg *config.Config) {
+	s.cfg.Store(cfg)
+}
+
+// Send implements Sender.
+func (s *GRPCSender) Send(_ context.Context, m *domain.Metric) error {
+	return SendMetricGRPC(s.cfg.Load(), m)
+}
+
+// FanOutSender sends every metric to several destinations at once.
+type FanOutSender struct {
+	destinations []*destination
+}
+
+// destination is a sender with the counter increases it failed to accept while others did, by series ID.
+type destination struct {
+	sender  Sender
+	mux     *sync.Mutex
+	pending map[string]int64
+}
+
+// delivery is the outcome of sending metrics to a destination: the increases taken from its pending ones
+// and the metrics it failed to accept.
+type delivery struct {
+	taken  map[string]int64
+	failed []domain.Metric
+	err    error
+}
+
+// NewFanOutSender creates a new instance of FanOutSender.
+func NewFanOutSender(senders ...Sender) *FanOutSender {
+	destinations := make([]*destination, 0, len(senders))
+	for _, sender := range senders {
+		destinations = append(destinations, &destination{sender: sender, mux: &sync.Mutex{}, pending: make(map[string]int64)})
+	}
+	return &FanOutSender{destinations: destinations}
+}
+
+// Send delivers a metric to all destinations concurrently, see SendBatch.
+func (s *FanOutSender) Send(ctx context.Context, m *domain.Metric) error {
+	return s.SendBatch(ctx, []domain.Metric{*m})
+}
+
+// SendBatch delivers the metrics of a report to all destinations concurrently, in a single request to those
+// sending batches. It fails only when no destination accepted any metric: a retry would deliver counters
+// twice to the destinations that did. The increase of a counter a destination failed to accept is kept
+// instead and added to the next one sent to it for the same series, so that it doesn't under-count.
+func (s *FanOutSender) SendBatch(ctx context.Context, metrics []domain.Metric) error {
+	if len(s.destinations) == 0 {
+		return ErrNoDestinations
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	deliveries := make([]delivery, len(s.destinations))
+	var wg sync.WaitGroup
+	for i, d := range s.destinations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			deliveries[i] = d.send(ctx, metrics)
+		}()
+	}
+	wg.Wait()
+	errs := make([]error, 0, len(deliveries))
+	accepted := false
+	for _, dl := range deliveries {
+		errs = append(errs, dl.err)
+		accepted = accepted || len(dl.failed) < len(metrics)
+	}
+	if !accepted {
+		// The metrics are retried as a whole, so the increases taken from the destinations are given back.
+		for i, d := range s.destinations {
+			for id, delta := range deliveries[i].taken {
+				d.keep(id, delta)
+			}
+		}
+		return fmt.Errorf("failed to send metrics to all destinations: %w", errors.Join(errs...))
+	}
+	for i, d := range s.destinations {
+		dl := deliveries[i]
+		if len(dl.failed) == 0 {
+			continue
+		}
+		for _, m := range dl.failed {
+			d.keep(m.ID, dl.taken[m.ID]+counterDelta(&m))
+		}
+		logger.Log.Error("failed to send metrics to a destination", zap.Int("metrics", len(dl.failed)), zap.Error(dl.err))
+	}
+	return nil
+}
+
+// send delivers metrics to the destination, counters along with the increases it failed to accept before.
+func (d *destination) send(ctx context.Context, metrics []domain.Metric) delivery {
+	dl := delivery{taken: make(map[string]int64)}
+	merged := make([]domain.Metric, len(metrics))
+	d.mux.Lock()
+	for i, m := range metrics {
+		merged[i] = m
+		pending, found := d.pending[m.ID]
+		if m.MType != domain.Counter || m.Delta == nil || !found {
+			continue
+		}
+		delete(d.pending, m.ID)
+		dl.taken[m.ID] = pending
+		delta := *m.Delta + pending
+		merged[i].Delta = &delta
+	}
+	d.mux.Unlock()
+	if batch, ok := d.sender.(BatchSender); ok {
+		if dl.err = batch.SendBatch(ctx, merged); dl.err != nil {
+			dl.failed = metrics
+		}
+		return dl
+	}
+	errs := make([]error, 0)
+	for i := range merged {
+		if err := d.sender.Send(ctx, &merged[i]); err != nil {
+			dl.failed = append(dl.failed, metrics[i])
+			errs = append(errs, err)
+		}
+	}
+	dl.err = errors.Join(errs...)
+	return dl
+}
+
+// keep adds to the increase of a counter the destination failed to accept.
+func (d *destination) keep(id string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.pending[id] += delta
+}
+
+// counterDelta returns the increase a metric carries, zero unless it is a counter.
+func counterDelta(m *domain.Metric) int64 {
+	if m.MType != domain.Counter || m.Delta == nil {
+		return 0
+	}
+	return *m.Delta
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"metrics/internal/agent/core/domain"
+)
+
+func gauge(id string, v float64) *domain.Metric {
+	return &domain.Metric{ID: id, MType: domain.Gauge, Value: &v}
+}
+
+func counter(id string, d int64) *domain.Metric {
+	return &domain.Metric{ID: id, MType: domain.Counter, Delta: &d}
+}
+
+type recordingSender struct {
+	mux    sync.Mutex
+	err    error
+	sent   []string
+	deltas []int64
+}
+
+func (s *recordingSender) Send(_ context.Context, m *domain.Metric) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.sent = append(s.sent, m.ID)
+	if m.Delta != nil {
+		s.deltas = append(s.deltas, *m.Delta)
+	}
+	return s.err
+}
+
+func (s *recordingSender) fail(err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.err = err
+}
+
+func TestFanOutSender_Send(t *testing.T) {
+	ctx := context.Background()
+	ok, failing := &recordingSender{}, &recordingSender{err: errors.New("unavailable")}
+
+	require.NoError(t, NewFanOutSender(ok, failing).Send(ctx, gauge("Alloc", 1)))
+	assert.Equal(t, []string{"Alloc"}, ok.sent)
+	assert.Equal(t, []string{"Alloc"}, failing.sent)
+
+	err := NewFanOutSender(failing, &recordingSender{err: errors.New("refused")}).Send(ctx, gauge("Alloc", 1))
+	require.ErrorContains(t, err, "unavailable")
+	require.ErrorContains(t, err, "refused")
+
+	require.ErrorIs(t, NewFanOutSender().Send(ctx, gauge("Alloc", 1)), ErrNoDestinations)
+}
+
+func TestFanOutSender_SendPendingCounters(t *testing.T) {
+	ctx := context.Background()
+	ok, flaky := &recordingSender{}, &recordingSender{err: errors.New("unavailable")}
+	s := NewFanOutSender(ok, flaky)
+
+	require.NoError(t, s.Send(ctx, counter("PollCount", 3)))
+	require.NoError(t, s.Send(ctx, counter("PollCount", 2)))
+	flaky.fail(nil)
+	require.NoError(t, s.Send(ctx, counter("PollCount", 4)))
+	require.NoError(t, s.Send(ctx, counter("PollCount", 1)))
+	assert.Equal(t, []int64{3, 2, 4, 1}, ok.deltas)
+	assert.Equal(t, []int64{3, 5, 9, 1}, flaky.deltas, "the increases it failed to accept are sent again")
+
+	// When every destination fails the metric is retried as a whole, so nothing is kept.
+	ok.fail(errors.New("refused"))
+	flaky.fail(errors.New("unavailable"))
+	require.Error(t, s.Send(ctx, counter("PollCount", 6)))
+	ok.fail(nil)
+	flaky.fail(nil)
+	require.NoError(t, s.Send(ctx, counter("PollCount", 6)))
+	assert.Equal(t, []int64{3, 2, 4, 1, 6, 6}, ok.deltas)
+	assert.Equal(t, []int64{3, 5, 9, 1, 6, 6}, flaky.deltas)
+}
+
+// batchSender records the batches it is sent.
+type batchSender struct {
+	recordingSender
+	batches int
+}
+
+func (s *batchSender) SendBatch(ctx context.Context, metrics []domain.Metric) error {
+	s.mux.Lock()
+	s.batches++
+	s.mux.Unlock()
+	var err error
+	for _, m := range metrics {
+		err = s.Send(ctx, &m)
+	}
+	return err
+}
+
+func TestFanOutSender_SendBatch(t *testing.T) {
+	ctx := context.Background()
+	batch, single := &batchSender{}, &recordingSender{}
+	s := NewFanOutSender(batch, single)
+
+	report := []domain.Metric{*gauge("Alloc", 1), *counter("PollCount", 3)}
+	require.NoError(t, s.SendBatch(ctx, report))
+	assert.Equal(t, 1, batch.batches)
+	assert.Equal(t, []string{"Alloc", "PollCount"}, batch.sent)
+	assert.Equal(t, []string{"Alloc", "PollCount"}, single.sent)
+
+	batch.fail(errors.New("unavailable"))
+	require.NoError(t, s.SendBatch(ctx, report))
+	batch.fail(nil)
+	require.NoError(t, s.SendBatch(ctx, report))
+	assert.Equal(t, []int64{3, 3, 6}, batch.deltas, "a failed batch keeps its increases")
+	assert.Equal(t, []int64{3, 3, 3}, single.deltas)
+}
+
+func TestOTLPSender_SendBatch(t *testing.T) {
+	var exports [][]*metricspb.Metric
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req colmetricspb.ExportMetricsServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		rm := req.GetResourceMetrics()[0]
+		assert.Equal(t, "service.name", rm.GetResource().GetAttributes()[0].GetKey())
+		exports = append(exports, rm.GetScopeMetrics()[0].GetMetrics())
+		out, err := proto.Marshal(&colmetricspb.ExportMetricsServiceResponse{})
+		require.NoError(t, err)
+		_, err = w.Write(out)
+		require.NoError(t, err)
+	}))
+	defer srv.Close()
+
+	s := NewOTLPSender(srv.URL+"/v1/metrics", "10.0.0.1")
+	assert.Equal(t, exporterTimeout, s.client.GetClient().Timeout)
+	ctx := context.Background()
+	require.NoError(t, s.SendBatch(ctx, []domain.Metric{*gauge("Alloc", 1.5), *counter("PollCount", 3)}))
+	require.NoError(t, s.Send(ctx, counter("PollCount", 2)))
+	require.Len(t, exports, 2, "a report is exported in a single request")
+	require.Len(t, exports[0], 2)
+
+	assert.Equal(t, "Alloc", exports[0][0].GetName())
+	assert.InDelta(t, 1.5, exports[0][0].GetGauge().GetDataPoints()[0].GetAsDouble(), 0)
+	sum := exports[0][1].GetSum()
+	assert.Equal(t, "PollCount", exports[0][1].GetName())
+	assert.True(t, sum.GetIsMonotonic())
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.GetAggregationTemporality())
+	first := sum.GetDataPoints()[0]
+	assert.Equal(t, int64(3), first.GetAsInt())
+	assert.NotZero(t, first.GetStartTimeUnixNano())
+	assert.Less(t, first.GetStartTimeUnixNano(), first.GetTimeUnixNano())
+
+	second := exports[1][0].GetSum().GetDataPoints()[0]
+	assert.Equal(t, first.GetTimeUnixNano(), second.GetStartTimeUnixNano(), "an increase starts at the previous export")
+}
+
+func TestPushgatewaySender_Send(t *testing.T) {
+	var (
+		bodies []string
+		fail   bool
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/metrics/job/agent/instance/10.0.0.1", r.URL.Path)
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+	}))
+	defer srv.Close()
+
+	s := NewPushgatewaySender(srv.URL+"/", "agent", "10.0.0.1")
+	assert.Equal(t, exporterTimeout, s.client.GetClient().Timeout)
+	ctx := context.Background()
+	require.NoError(t, s.Send(ctx, gauge("CPU.utilization-1", 0.25)))
+	require.NoError(t, s.Send(ctx, counter("PollCount", 3)))
+	fail = true
+	require.Error(t, s.Send(ctx, counter("PollCount", 4)))
+	fail = false
+	require.NoError(t, s.Send(ctx, counter("PollCount", 4)))
+
+	assert.Equal(t, []string{
+		"# TYPE CPU_utilization_1 gauge\nCPU_utilization_1 0.25\n",
+		"# TYPE PollCount counter\nPollCount 3\n",
+		"# TYPE PollCount counter\nPollCount 7\n",
+	}, bodies)
+}
@@ -15,7 +15,6 @@ import (
 	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
 
-	"metrics/internal/agent/config"
 	"metrics/internal/agent/core/domain"
 	"metrics/internal/agent/core/handlers"
 	"metrics/internal/agent/logger"
@@ -38,16 +37,19 @@ type AgentMetricStorage interface {
 type AgentMetricService struct {
 	gaugeAgentStorage   AgentMetricStorage
 	counterAgentStorage AgentMetricStorage
+	sender              handlers.Sender
 }
 
 // NewAgentMetricService creates a new instance of AgentMetricService.
 func NewAgentMetricService(
 	gaugeAgentStorage AgentMetricStorage,
 	counterAgentStorage AgentMetricStorage,
+	sender handlers.Sender,
 ) *AgentMetricService {
 	return &AgentMetricService{
 		gaugeAgentStorage:   gaugeAgentStorage,
 		counterAgentStorage: counterAgentStorage,
+		sender:              sender,
 	}
 }
 
@@ -154,8 +156,8 @@ func (a *AgentMetricService) getAllMetrics(request *domain.GetAllMetricsRequest)
 	}
 }
 
-// ReportMetrics sends collected metrics to the configured destination.
-func (a *AgentMetricService) ReportMetrics(jobs chan<- domain.Metric) error {
+// ReportMetrics sends collected metrics to the configured destination, the whole report as one job.
+func (a *AgentMetricService) ReportMetrics(jobs chan<- []domain.Metric) error {
 	response := a.getAllMetrics(&domain.GetAllMetricsRequest{
 		MetricType: domain.Gauge,
 	})
@@ -164,18 +166,18 @@ func (a *AgentMetricService) ReportMetrics(jobs chan<- domain.Metric) error {
 		return fmt.Errorf("error occurred during getting gauge metrics: %w", response.Error)
 	}
 
+	report := make([]domain.Metric, 0, len(response.Values))
 	for metricName, metricValue := range response.Values {
 		gaugeValue, err := strconv.ParseFloat(metricValue, 64)
 		if err != nil {
 			logger.Log.Error("error occurred during parsing gauge metrics", zap.Error(err))
 			return fmt.Errorf("error occurred during parsing gauge metrics: %w", err)
 		}
-		request := domain.Metric{
+		report = append(report, domain.Metric{
 			ID:    metricName,
 			MType: domain.Gauge,
 			Value: &gaugeValue,
-		}
-		jobs <- request
+		})
 	}
 
 	response = a.getAllMetrics(&domain.GetAllMetricsRequest{
@@ -193,56 +195,61 @@ func (a *AgentMetricService) ReportMetrics(jobs chan<- domain.Metric) error {
 			return fmt.Errorf("error occurred during parsing counter metrics: %w", err)
 		}
 		counterInt64Value := int64(counterValue)
-		request := domain.Metric{
+		report = append(report, domain.Metric{
 			ID:    metricName,
 			MType: domain.Counter,
 			Delta: &counterInt64Value,
-		}
-		jobs <- request
+		})
 	}
+	jobs <- report
 
 	logger.Log.Info("metrics reported")
 	return nil
 }
 
-// SendMetrics sends metrics asynchronously using the retry-go package.
-func (a *AgentMetricService) SendMetrics(
-	ctx context.Context,
-	cfg *config.Config,
-	jobs <-chan domain.Metric,
-) error {
-	var err error
+// SendMetrics sends metrics asynchronously using the retry-go package. A report is retried as a whole when
+// the sender takes batches, metric by metric otherwise.
+func (a *AgentMetricService) SendMetrics(ctx context.Context, jobs <-chan []domain.Metric) error {
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
-		case req, ok := <-jobs:
+		case report, ok := <-jobs:
 			if !ok {
 				return nil
 			}
-			err = retry.Do(
-				func() error {
-					if cfg.UseGRPC {
-						if err = handlers.SendMetricGRPC(cfg, &req); err != nil {
-							logger.Log.Error("grpc error occurred during sending metrics", zap.Error(err))
-							return fmt.Errorf("failed to send metrics through grpc: %w", err)
-						}
-						return nil
-					}
-					if err = handlers.SendMetricHTTP(cfg, &req); err != nil {
-						logger.Log.Error("http error occurred during sending metrics", zap.Error(err))
-						return fmt.Errorf("failed to send metrics through http: %w", err)
-					}
-					return nil
-				},
-				retry.Attempts(retrying.Attempts),
-				retry.DelayType(retrying.DelayType),
-				retry.OnRetry(retrying.OnRetry),
-			)
-			if err != nil {
-				logger.Log.Error("error occurred during sending metric", zap.Error(err))
-				return fmt.Errorf("failed to send metric: %w", err)
+			if batch, ok := a.sender.(handlers.BatchSender); ok {
+				if err := a.send(func() error { return batch.SendBatch(ctx, report) }); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, req := range report {
+				if err := a.send(func() error { return a.sender.Send(ctx, &req) }); err != nil {
+					return err
+				}
 			}
 		}
 	}
 }
+
+// send retries a delivery.
+func (a *AgentMetricService) send(deliver func() error) error {
+	err := retry.Do(
+		func() error {
+			if err := deliver(); err != nil {
+				logger.Log.Error("error occurred during sending metrics", zap.Error(err))
+				return fmt.Errorf("failed to send metrics: %w", err)
+			}
+			return nil
+		},
+		retry.Attempts(retrying.Attempts),
+		retry.DelayType(retrying.DelayType),
+		retry.OnRetry(retrying.OnRetry),
+	)
+	if err != nil {
+		logger.Log.Error("error occurred during sending metric", zap.Error(err))
+		return fmt.Errorf("failed to send metric: %w", err)
+	}
+	return nil
+}
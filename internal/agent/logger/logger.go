@@ -5,10 +5,14 @@ import (
 	"fmt"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var Log *zap.Logger = zap.NewNop()
 
+// atomicLevel is the level of Log, changed with SetLevel.
+var atomicLevel = zap.NewAtomicLevel()
+
 // Initialize инициализирует синглтон логера с необходимым уровнем логирования.
 func Initialize(level string) error {
 	lvl, err := zap.ParseAtomicLevel(level)
@@ -22,5 +26,16 @@ func Initialize(level string) error {
 		return fmt.Errorf("failed to build log config: %w", err)
 	}
 	Log = zl
+	atomicLevel = lvl
+	return nil
+}
+
+// SetLevel changes the level of Log in place.
+func SetLevel(lvl string) error {
+	l, err := zapcore.ParseLevel(lvl)
+	if err != nil {
+		return fmt.Errorf("failed to parse log level: %w", err)
+	}
+	atomicLevel.SetLevel(l)
 	return nil
 }
@@ -0,0 +1,271 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+	pb "metrics/internal/proto"
+)
+
+// ErrUnsupported is returned for what the gRPC API doesn't offer.
+var ErrUnsupported = errors.New("not supported over gRPC")
+
+// types maps the domain metric types to the protobuf ones.
+var types = map[string]pb.Metric_Type{
+	domain.Gauge:     pb.Metric_GAUGE,
+	domain.Counter:   pb.Metric_COUNTER,
+	domain.Histogram: pb.Metric_HISTOGRAM,
+	domain.Timer:     pb.Metric_TIMER,
+}
+
+// GRPC talks to the gRPC API of the server. The server neither signs nor decrypts gRPC messages, so the
+// hashing and the public keys are unused.
+type GRPC struct {
+	cfg    *config.Config
+	conn   *grpc.ClientConn
+	client pb.MetricServiceClient
+}
+
+// NewGRPC creates a new instance of GRPC.
+func NewGRPC(cfg *config.Config) (*GRPC, error) {
+	conn, err := grpc.NewClient(cfg.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC client: %w", err)
+	}
+	return &GRPC{cfg: cfg, conn: conn, client: pb.NewMetricServiceClient(conn)}, nil
+}
+
+// Close closes the connection.
+func (c *GRPC) Close() error {
+	return c.conn.Close()
+}
+
+// Get returns a metric.
+func (c *GRPC) Get(ctx context.Context, mType, id string) (*domain.Metric, error) {
+	t, err := toType(mType)
+	if err != nil {
+		return nil, err
+	}
+	metric, err := c.client.Get(ctx, &pb.GetRequest{Id: id, Type: t})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return fromProto(metric), nil
+}
+
+// Set writes a metric. Timers may only be sent as a single sample since gRPC doesn't carry sketches.
+func (c *GRPC) Set(ctx context.Context, m *domain.Metric) error {
+	metric, err := toProto(m)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Update(ctx, metric)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if resp.GetStatus() != 0 {
+		return fmt.Errorf("server replied status %d", resp.GetStatus())
+	}
+	return nil
+}
+
+// SetAll writes metrics one by one, the gRPC API having no batch update.
+func (c *GRPC) SetAll(ctx context.Context, metrics []domain.Metric) error {
+	for _, m := range metrics {
+		if err := c.Set(ctx, &m); err != nil {
+			return fmt.Errorf("%s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// List returns a page of the metrics selected by the filter, which may not match names or labels.
+func (c *GRPC) List(ctx context.Context, filter domain.ListFilter) (*domain.Page, error) {
+	if filter.Match != "" || len(filter.Labels) > 0 {
+		return nil, fmt.Errorf("filtering by match or label is %w", ErrUnsupported)
+	}
+	req := &pb.ListRequest{Prefix: filter.Prefix, Limit: int32(filter.Limit), Cursor: filter.Cursor}
+	for _, mType := range filter.Types {
+		t, err := toType(mType)
+		if err != nil {
+			return nil, err
+		}
+		req.Types = append(req.Types, t)
+	}
+	resp, err := c.client.List(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	page := &domain.Page{Next: resp.GetNext()}
+	for _, metric := range resp.GetMetrics() {
+		page.Metrics = append(page.Metrics, *fromProto(metric))
+	}
+	return page, nil
+}
+
+// Delete removes a series.
+func (c *GRPC) Delete(ctx context.Context, mType, id string) error {
+	t, err := toType(mType)
+	if err != nil {
+		return err
+	}
+	if _, err = c.client.Delete(c.admin(ctx), &pb.DeleteRequest{Id: id, Type: t}); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+func (c *GRPC) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	resp, err := c.client.DeleteByPrefix(c.admin(ctx), &pb.DeleteByPrefixRequest{Prefix: prefix})
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	return int(resp.GetDeleted()), nil
+}
+
+// ResetCounter sets the total of a counter to zero.
+func (c *GRPC) ResetCounter(ctx context.Context, id string) (*domain.Metric, error) {
+	metric, err := c.client.ResetCounter(c.admin(ctx), &pb.ResetCounterRequest{Id: id})
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return fromProto(metric), nil
+}
+
+// Ping checks the server and its storage.
+func (c *GRPC) Ping(ctx context.Context) error {
+	if _, err := c.client.Ping(ctx, &pb.PingRequest{}); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// Alerts isn't offered by the gRPC API, alert rules are managed over REST.
+func (c *GRPC) Alerts(context.Context) ([]domain.Alert, error) {
+	return nil, fmt.Errorf("alert rules are %w", ErrUnsupported)
+}
+
+// SetAlertRule isn't offered by the gRPC API, alert rules are managed over REST.
+func (c *GRPC) SetAlertRule(context.Context, *domain.AlertRule) error {
+	return fmt.Errorf("alert rules are %w", ErrUnsupported)
+}
+
+// DeleteAlertRule isn't offered by the gRPC API, alert rules are managed over REST.
+func (c *GRPC) DeleteAlertRule(context.Context, string) error {
+	return fmt.Errorf("alert rules are %w", ErrUnsupported)
+}
+
+// Watch calls fn with the updates of the metrics selected by the filter until ctx is done, fn fails or the
+// server ends the stream.
+func (c *GRPC) Watch(ctx context.Context, filter domain.WatchFilter, fn func(m domain.Metric) error) error {
+	req := &pb.WatchRequest{Names: filter.Names}
+	for _, mType := range filter.Types {
+		t, err := toType(mType)
+		if err != nil {
+			return err
+		}
+		req.Types = append(req.Types, t)
+	}
+	stream, err := c.client.Watch(ctx, req)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	for {
+		metric, err := stream.Recv()
+		if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("stream has ended: %w", err)
+		}
+		if err = fn(*fromProto(metric)); err != nil {
+			return err
+		}
+	}
+}
+
+// admin adds the admin token to the metadata of an admin request.
+func (c *GRPC) admin(ctx context.Context) context.Context {
+	if c.cfg.AdminToken == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.cfg.AdminToken)
+}
+
+func toType(mType string) (pb.Metric_Type, error) {
+	t, found := types[mType]
+	if !found {
+		return 0, fmt.Errorf("unknown metric type %q", mType)
+	}
+	return t, nil
+}
+
+func toProto(m *domain.Metric) (*pb.Metric, error) {
+	t, err := toType(m.MType)
+	if err != nil {
+		return nil, err
+	}
+	metric := &pb.Metric{Id: m.ID, Type: t}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	if h := m.Histogram; h != nil {
+		metric.Histogram = &pb.Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+	}
+	if m.MType == domain.Timer && m.Value == nil {
+		return nil, fmt.Errorf("timer %s without a sample is %w", m.ID, ErrUnsupported)
+	}
+	return metric, nil
+}
+
+func fromProto(metric *pb.Metric) *domain.Metric {
+	m := &domain.Metric{ID: metric.GetId(), Stale: metric.GetStale()}
+	for mType, t := range types {
+		if t == metric.GetType() {
+			m.MType = mType
+		}
+	}
+	if nano := metric.GetUpdatedUnixNano(); nano != 0 {
+		updated := time.Unix(0, nano)
+		m.Updated = &updated
+	}
+	switch m.MType {
+	case domain.Gauge:
+		value := metric.GetValue()
+		m.Value = &value
+	case domain.Counter:
+		delta := metric.GetDelta()
+		m.Delta = &delta
+	case domain.Histogram:
+		if h := metric.GetHistogram(); h != nil {
+			m.Histogram = &domain.HistogramValue{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+		}
+	case domain.Timer:
+		if sum := metric.GetSummary(); sum != nil {
+			m.Summary = &domain.TimerSummary{
+				Count: sum.Count,
+				Sum:   sum.Sum,
+				P50:   sum.P50,
+				P90:   sum.P90,
+				P99:   sum.P99,
+				Max:   sum.Max,
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,76 @@
+package clients
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/ctl/domain"
+	pb "metrics/internal/proto"
+)
+
+func TestToProto(t *testing.T) {
+	v, d := 2.5, int64(3)
+	tests := []struct {
+		name    string
+		m       domain.Metric
+		want    *pb.Metric
+		wantErr error
+	}{
+		{
+			name: "gauge",
+			m:    domain.Metric{ID: "g", MType: domain.Gauge, Value: &v},
+			want: &pb.Metric{Id: "g", Type: pb.Metric_GAUGE, Value: 2.5},
+		},
+		{
+			name: "counter",
+			m:    domain.Metric{ID: "c", MType: domain.Counter, Delta: &d},
+			want: &pb.Metric{Id: "c", Type: pb.Metric_COUNTER, Delta: 3},
+		},
+		{
+			name: "timer sample",
+			m:    domain.Metric{ID: "t", MType: domain.Timer, Value: &v},
+			want: &pb.Metric{Id: "t", Type: pb.Metric_TIMER, Value: 2.5},
+		},
+		{
+			name:    "timer sketch",
+			m:       domain.Metric{ID: "t", MType: domain.Timer, Sketch: json.RawMessage(`{}`)},
+			wantErr: ErrUnsupported,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := toProto(&tt.m)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want.String(), got.String())
+		})
+	}
+}
+
+func TestFromProto(t *testing.T) {
+	m := fromProto(&pb.Metric{
+		Id:              "t",
+		Type:            pb.Metric_TIMER,
+		Summary:         &pb.TimerSummary{Count: 2, Sum: 3, P50: 1, P90: 2, P99: 2, Max: 2},
+		UpdatedUnixNano: 1e18,
+		Stale:           true,
+	})
+
+	assert.Equal(t, domain.Timer, m.MType)
+	require.NotNil(t, m.Summary)
+	assert.Equal(t, uint64(2), m.Summary.Count)
+	assert.Nil(t, m.Value, "a timer carries its summary rather than a value")
+	require.NotNil(t, m.Updated)
+	assert.Equal(t, int64(1e18), m.Updated.UnixNano())
+	assert.True(t, m.Stale)
+
+	c := fromProto(&pb.Metric{Id: "c", Type: pb.Metric_COUNTER})
+	require.NotNil(t, c.Delta, "a zero counter still has a delta")
+	assert.Zero(t, *c.Delta)
+}
@@ -0,0 +1,300 @@
+// Package clients talks to the metrics server over its REST and gRPC APIs.
+package clients
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+	"metrics/internal/shared-kernel/compress"
+	"metrics/internal/shared-kernel/hash"
+)
+
+// maxEvent bounds the size of a stream event, a histogram with many buckets being the largest.
+const maxEvent = 1 << 20
+
+// StatusError is an HTTP response the server failed a request with.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server replied %d %s", e.Code, http.StatusText(e.Code))
+	}
+	return fmt.Sprintf("server replied %d %s: %s", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// REST talks to the HTTP API of the server. Request bodies are compressed, signed with the hashing key and
+// encrypted with the public key when they are configured, as the agent sends them.
+type REST struct {
+	cfg    *config.Config
+	base   string
+	client *http.Client
+}
+
+// NewREST creates a new instance of REST.
+func NewREST(cfg *config.Config) *REST {
+	base := cfg.Address
+	if !strings.Contains(base, "://") {
+		base = "http://" + base
+	}
+	return &REST{cfg: cfg, base: strings.TrimSuffix(base, "/"), client: &http.Client{}}
+}
+
+// Get returns a metric.
+func (c *REST) Get(ctx context.Context, mType, id string) (*domain.Metric, error) {
+	var m domain.Metric
+	if err := c.do(ctx, http.MethodPost, "/value/", domain.Metric{ID: id, MType: mType}, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Set writes a metric.
+func (c *REST) Set(ctx context.Context, m *domain.Metric) error {
+	return c.do(ctx, http.MethodPost, "/update/", m, nil)
+}
+
+// SetAll writes metrics in a single request, or one by one when they are encrypted since a request must
+// fit in a single RSA block.
+func (c *REST) SetAll(ctx context.Context, metrics []domain.Metric) error {
+	if c.cfg.PublicKey == nil {
+		return c.do(ctx, http.MethodPost, "/updates/", metrics, nil)
+	}
+	for _, m := range metrics {
+		if err := c.Set(ctx, &m); err != nil {
+			return fmt.Errorf("%s: %w", m.ID, err)
+		}
+	}
+	return nil
+}
+
+// List returns a page of the metrics selected by the filter.
+func (c *REST) List(ctx context.Context, filter domain.ListFilter) (*domain.Page, error) {
+	q := url.Values{}
+	if len(filter.Types) > 0 {
+		q.Set("type", strings.Join(filter.Types, ","))
+	}
+	if filter.Prefix != "" {
+		q.Set("prefix", filter.Prefix)
+	}
+	if filter.Match != "" {
+		q.Set("match", filter.Match)
+	}
+	for _, label := range filter.Labels {
+		q.Add("label", label)
+	}
+	if filter.Limit > 0 {
+		q.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	if filter.Cursor != "" {
+		q.Set("cursor", filter.Cursor)
+	}
+	var page domain.Page
+	if err := c.do(ctx, http.MethodGet, "/api/v1/metrics?"+q.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Delete removes a series.
+func (c *REST) Delete(ctx context.Context, mType, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/metrics/"+url.PathEscape(mType)+"/"+url.PathEscape(id), nil, nil)
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+func (c *REST) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	var resp struct {
+		Deleted int `json:"deleted"`
+	}
+	q := url.Values{"prefix": {prefix}}
+	if err := c.do(ctx, http.MethodDelete, "/api/v1/metrics?"+q.Encode(), nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Deleted, nil
+}
+
+// ResetCounter sets the total of a counter to zero.
+func (c *REST) ResetCounter(ctx context.Context, id string) (*domain.Metric, error) {
+	var m domain.Metric
+	if err := c.do(ctx, http.MethodPost, "/api/v1/metrics/counter/"+url.PathEscape(id)+"/reset", nil, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Ping checks the server and its storage.
+func (c *REST) Ping(ctx context.Context) error {
+	return c.do(ctx, http.MethodGet, "/ping", nil, nil)
+}
+
+// Alerts returns the alert rules evaluated by the server.
+func (c *REST) Alerts(ctx context.Context) ([]domain.Alert, error) {
+	var alerts []domain.Alert
+	if err := c.do(ctx, http.MethodGet, "/api/v1/alerts", nil, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// SetAlertRule creates an alert rule or replaces the one of the same name.
+func (c *REST) SetAlertRule(ctx context.Context, rule *domain.AlertRule) error {
+	return c.do(ctx, http.MethodPut, "/api/v1/alerts/"+url.PathEscape(rule.Name), rule, nil)
+}
+
+// DeleteAlertRule removes an alert rule.
+func (c *REST) DeleteAlertRule(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/alerts/"+url.PathEscape(name), nil, nil)
+}
+
+// Watch calls fn with the updates of the metrics selected by the filter, read from the Server-Sent Events
+// stream, until ctx is done, fn fails or the server ends the stream.
+func (c *REST) Watch(ctx context.Context, filter domain.WatchFilter, fn func(m domain.Metric) error) error {
+	q := url.Values{}
+	if len(filter.Names) > 0 {
+		q.Set("name", strings.Join(filter.Names, ","))
+	}
+	if len(filter.Types) > 0 {
+		q.Set("type", strings.Join(filter.Types, ","))
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/v1/stream?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxEvent)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err = dispatch(event, data, fn); err != nil {
+				return err
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+	if err = scanner.Err(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil
+}
+
+// dispatch handles a stream event, comments and heartbeats having neither name nor data.
+func dispatch(event, data string, fn func(m domain.Metric) error) error {
+	switch event {
+	case "metric":
+		var m domain.Metric
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return fmt.Errorf("failed to decode update: %w", err)
+		}
+		return fn(m)
+	case "error":
+		return fmt.Errorf("stream has ended: %s", data)
+	default:
+		return nil
+	}
+}
+
+// do sends a request with body as JSON, unless it is nil, and decodes the response into out, unless it is nil.
+func (c *REST) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request and returns the response when it is successful.
+func (c *REST) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	reader, header, err := c.encode(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header = header
+	if c.cfg.AdminToken != "" {
+		req.Header.Set(headers.Authorization, "Bearer "+c.cfg.AdminToken)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxEvent))
+		return nil, &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// encode marshals, compresses, signs and encrypts a request body, returning the headers describing it.
+func (c *REST) encode(body any) (io.Reader, http.Header, error) {
+	header := http.Header{}
+	if body == nil {
+		return http.NoBody, header, nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	buf, err := compress.GzipData(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to compress request: %w", err)
+	}
+	header.Set(headers.ContentType, "application/json")
+	header.Set(headers.ContentEncoding, "gzip")
+	if c.cfg.Key != "" {
+		header.Set(hash.Header, hash.Encode(buf, c.cfg.Key))
+	}
+	if c.cfg.PublicKey != nil {
+		header.Set("Encrypted", "crypto/rsa")
+		if buf, err = rsa.EncryptPKCS1v15(rand.Reader, c.cfg.PublicKey, buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt request: %w", err)
+		}
+	}
+	return bytes.NewReader(buf), header, nil
+}
+
+// IsNotFound reports whether err means that the metric doesn't exist.
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+}
@@ -0,0 +1,168 @@
+package clients
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+	"metrics/internal/shared-kernel/hash"
+)
+
+func TestREST_Set(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var (
+		got  domain.Metric
+		hdr  http.Header
+		path string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hdr, path = r.Header.Clone(), r.URL.Path
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body, err = rsa.DecryptPKCS1v15(rand.Reader, key, body)
+		require.NoError(t, err)
+		assert.Equal(t, hash.Encode(body, "secret"), hdr.Get(hash.Header), "the gzipped body is signed")
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		require.NoError(t, json.NewDecoder(zr).Decode(&got))
+	}))
+	defer srv.Close()
+	c := NewREST(&config.Config{Address: srv.URL, Key: "secret", PublicKey: &key.PublicKey})
+
+	v := 1.5
+	require.NoError(t, c.Set(context.Background(), &domain.Metric{ID: "g", MType: domain.Gauge, Value: &v}))
+
+	assert.Equal(t, "/update/", path)
+	assert.Equal(t, "gzip", hdr.Get(headers.ContentEncoding))
+	assert.Equal(t, "crypto/rsa", hdr.Get("Encrypted"))
+	assert.Equal(t, "g", got.ID)
+	assert.Equal(t, 1.5, *got.Value)
+}
+
+func TestREST_List(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		_, _ = fmt.Fprint(w, `{"metrics":[{"id":"a","type":"counter","delta":3}],"next":"abc"}`)
+	}))
+	defer srv.Close()
+	c := NewREST(&config.Config{Address: srv.URL})
+
+	page, err := c.List(context.Background(), domain.ListFilter{
+		Types:  []string{domain.Counter, domain.Gauge},
+		Prefix: "http_",
+		Labels: []string{"env=prod", "dc=eu"},
+		Limit:  10,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "label=env%3Dprod&label=dc%3Deu&limit=10&prefix=http_&type=counter%2Cgauge", query)
+	require.Len(t, page.Metrics, 1)
+	assert.Equal(t, int64(3), *page.Metrics[0].Delta)
+	assert.Equal(t, "abc", page.Next)
+}
+
+func TestREST_Admin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(headers.Authorization) != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/metrics/gauge/missing":
+			http.Error(w, "item not found", http.StatusNotFound)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/metrics":
+			assert.Equal(t, "http_", r.URL.Query().Get("prefix"))
+			_, _ = fmt.Fprint(w, `{"deleted":4}`)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	err := NewREST(&config.Config{Address: srv.URL}).Delete(ctx, domain.Gauge, "a")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusUnauthorized, statusErr.Code)
+	assert.Equal(t, "unauthorized", statusErr.Message)
+
+	c := NewREST(&config.Config{Address: srv.URL, AdminToken: "tok"})
+	require.NoError(t, c.Delete(ctx, domain.Gauge, "a"))
+	assert.True(t, IsNotFound(c.Delete(ctx, domain.Gauge, "missing")))
+	deleted, err := c.DeleteByPrefix(ctx, "http_")
+	require.NoError(t, err)
+	assert.Equal(t, 4, deleted)
+}
+
+func TestREST_Alerts(t *testing.T) {
+	var rule domain.AlertRule
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/alerts":
+			_, _ = fmt.Fprint(w, `[{"name":"high-load","query":"load","op":">","threshold":2,`+
+				`"firing":[{"name":"load","labels":{"host":"a"},"value":3}]}]`)
+		case r.Method == http.MethodPut && r.URL.Path == "/api/v1/alerts/high-load":
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			require.NoError(t, json.NewDecoder(zr).Decode(&rule))
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/v1/alerts/missing":
+			http.Error(w, "item not found", http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	c := NewREST(&config.Config{Address: srv.URL})
+
+	alerts, err := c.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "high-load", alerts[0].Name)
+	assert.Equal(t, []domain.AlertSeries{{Name: "load", Labels: map[string]string{"host": "a"}, Value: 3}},
+		alerts[0].Firing)
+
+	want := domain.AlertRule{Name: "high-load", Query: "load", Op: ">", Threshold: 2}
+	require.NoError(t, c.SetAlertRule(ctx, &want))
+	assert.Equal(t, want, rule)
+	require.NoError(t, c.DeleteAlertRule(ctx, "high-load"))
+	assert.True(t, IsNotFound(c.DeleteAlertRule(ctx, "missing")))
+}
+
+func TestREST_Watch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "a,b", r.URL.Query().Get("name"))
+		_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+		_, _ = fmt.Fprint(w, "event: metric\ndata: {\"id\":\"a\",\"type\":\"gauge\",\"value\":1}\n\n")
+		_, _ = fmt.Fprint(w, "event: metric\ndata: {\"id\":\"b\",\"type\":\"gauge\",\"value\":2}\n\n")
+		_, _ = fmt.Fprint(w, "event: error\ndata: subscriber is too slow\n\n")
+	}))
+	defer srv.Close()
+	c := NewREST(&config.Config{Address: srv.URL})
+
+	var got []string
+	err := c.Watch(context.Background(), domain.WatchFilter{Names: []string{"a", "b"}}, func(m domain.Metric) error {
+		got = append(got, m.ID)
+		return nil
+	})
+
+	require.ErrorContains(t, err, "subscriber is too slow")
+	assert.Equal(t, []string{"a", "b"}, got)
+}
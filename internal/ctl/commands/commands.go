@@ -0,0 +1,425 @@
+// Package commands implements the commands of metricsctl.
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+)
+
+const (
+	// maxPage is the largest page the server returns.
+	maxPage = 1000
+	// importBatch is how many metrics an import sends in a request.
+	importBatch = 100
+)
+
+// ErrUsage is returned for a command line which doesn't name a command or misses its arguments.
+var ErrUsage = errors.New("incorrect usage")
+
+// Client defines the server API the commands use.
+type Client interface {
+	// Get returns a metric.
+	Get(ctx context.Context, mType, id string) (*domain.Metric, error)
+
+	// Set writes a metric.
+	Set(ctx context.Context, m *domain.Metric) error
+
+	// SetAll writes metrics.
+	SetAll(ctx context.Context, metrics []domain.Metric) error
+
+	// List returns a page of the metrics selected by the filter.
+	List(ctx context.Context, filter domain.ListFilter) (*domain.Page, error)
+
+	// Delete removes a series.
+	Delete(ctx context.Context, mType, id string) error
+
+	// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+
+	// ResetCounter sets the total of a counter to zero.
+	ResetCounter(ctx context.Context, id string) (*domain.Metric, error)
+
+	// Watch calls fn with the updates of the metrics selected by the filter until ctx is done.
+	Watch(ctx context.Context, filter domain.WatchFilter, fn func(m domain.Metric) error) error
+
+	// Ping checks the server and its storage.
+	Ping(ctx context.Context) error
+
+	// Alerts returns the alert rules evaluated by the server.
+	Alerts(ctx context.Context) ([]domain.Alert, error)
+
+	// SetAlertRule creates an alert rule or replaces the one of the same name.
+	SetAlertRule(ctx context.Context, rule *domain.AlertRule) error
+
+	// DeleteAlertRule removes an alert rule.
+	DeleteAlertRule(ctx context.Context, name string) error
+}
+
+// Runner runs the commands against a server.
+type Runner struct {
+	cfg    *config.Config
+	client Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// New creates a new instance of Runner.
+func New(cfg *config.Config, client Client, stdin io.Reader, stdout, stderr io.Writer) *Runner {
+	return &Runner{cfg: cfg, client: client, stdin: stdin, stdout: stdout, stderr: stderr}
+}
+
+// Run runs the command named by the first of args with the rest as its arguments. Every command but watch
+// is bounded by the configured timeout.
+func (r *Runner) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: no command given", ErrUsage)
+	}
+	name, args := args[0], args[1:]
+	if name == "watch" {
+		return r.watch(ctx, args)
+	}
+	if r.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(r.cfg.Timeout)*time.Second)
+		defer cancel()
+	}
+	commands := map[string]func(ctx context.Context, args []string) error{
+		"get":    r.get,
+		"set":    r.set,
+		"list":   r.list,
+		"delete": r.delete,
+		"reset":  r.reset,
+		"export": r.export,
+		"import": r.importFile,
+		"health": r.health,
+		"alerts": r.alerts,
+	}
+	command, found := commands[name]
+	if !found {
+		return fmt.Errorf("%w: unknown command %q", ErrUsage, name)
+	}
+	return command(ctx, args)
+}
+
+func (r *Runner) get(ctx context.Context, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%w: get <type> <name>", ErrUsage)
+	}
+	m, err := r.client.Get(ctx, args[0], args[1])
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", args[1], err)
+	}
+	return writeOne(r.stdout, r.cfg.Output, m)
+}
+
+func (r *Runner) set(ctx context.Context, args []string) error {
+	if len(args) != 3 {
+		return fmt.Errorf("%w: set <type> <name> <value>", ErrUsage)
+	}
+	m, err := parseMetric(args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	if err = r.client.Set(ctx, m); err != nil {
+		return fmt.Errorf("failed to set %s: %w", m.ID, err)
+	}
+	return nil
+}
+
+// parseMetric builds the metric set from the command line, histograms having no single value to set.
+func parseMetric(mType, id, value string) (*domain.Metric, error) {
+	m := &domain.Metric{ID: id, MType: mType}
+	switch mType {
+	case domain.Gauge, domain.Timer:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect %s value %q: %w", mType, value, err)
+		}
+		m.Value = &v
+	case domain.Counter:
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect counter delta %q: %w", value, err)
+		}
+		m.Delta = &delta
+	default:
+		return nil, fmt.Errorf("%w: set takes a gauge, a counter or a timer, got %q", ErrUsage, mType)
+	}
+	return m, nil
+}
+
+// labels collects the repeated -label flags.
+type labels []string
+
+func (l *labels) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *labels) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+func (r *Runner) list(ctx context.Context, args []string) error {
+	var (
+		filter domain.ListFilter
+		types  string
+		limit  int
+	)
+	fs := newFlagSet("list")
+	fs.StringVar(&types, "type", "", "metric types, comma separated")
+	fs.StringVar(&filter.Prefix, "prefix", "", "prefix of the series ID")
+	fs.StringVar(&filter.Match, "match", "", "regular expression searched in the metric name")
+	fs.Var((*labels)(&filter.Labels), "label", "k=v label the series must have, may be repeated")
+	fs.IntVar(&limit, "limit", 0, "most metrics to list, all when zero")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+	if types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	metrics, err := r.collect(ctx, filter, limit)
+	if err != nil {
+		return err
+	}
+	return writeAll(r.stdout, r.cfg.Output, metrics)
+}
+
+// collect follows the pages of a listing until there are limit metrics, or until the last page when limit
+// is zero.
+func (r *Runner) collect(ctx context.Context, filter domain.ListFilter, limit int) ([]domain.Metric, error) {
+	metrics := make([]domain.Metric, 0)
+	for {
+		filter.Limit = maxPage
+		if limit > 0 {
+			filter.Limit = min(limit-len(metrics), maxPage)
+		}
+		page, err := r.client.List(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list metrics: %w", err)
+		}
+		metrics = append(metrics, page.Metrics...)
+		if page.Next == "" || (limit > 0 && len(metrics) >= limit) {
+			return metrics, nil
+		}
+		filter.Cursor = page.Next
+	}
+}
+
+func (r *Runner) delete(ctx context.Context, args []string) error {
+	var prefix string
+	fs := newFlagSet("delete")
+	fs.StringVar(&prefix, "prefix", "", "prefix of the series IDs to delete")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+	switch {
+	case prefix != "" && fs.NArg() == 0:
+		deleted, err := r.client.DeleteByPrefix(ctx, prefix)
+		if err != nil {
+			return fmt.Errorf("failed to delete metrics: %w", err)
+		}
+		if _, err = fmt.Fprintf(r.stdout, "deleted %d series\n", deleted); err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		return nil
+	case prefix == "" && fs.NArg() == 2:
+		if err := r.client.Delete(ctx, fs.Arg(0), fs.Arg(1)); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", fs.Arg(1), err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: delete <type> <name> or delete -prefix <prefix>", ErrUsage)
+	}
+}
+
+func (r *Runner) reset(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("%w: reset <name>", ErrUsage)
+	}
+	m, err := r.client.ResetCounter(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("failed to reset %s: %w", args[0], err)
+	}
+	return writeOne(r.stdout, r.cfg.Output, m)
+}
+
+func (r *Runner) watch(ctx context.Context, args []string) error {
+	var filter domain.WatchFilter
+	var names, types string
+	fs := newFlagSet("watch")
+	fs.StringVar(&names, "name", "", "metric names, comma separated")
+	fs.StringVar(&types, "type", "", "metric types, comma separated")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+	if names != "" {
+		filter.Names = strings.Split(names, ",")
+	}
+	if types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+	w := newStreamWriter(r.stdout, r.cfg.Output)
+	if err := r.client.Watch(ctx, filter, w.write); err != nil {
+		return fmt.Errorf("failed to watch metrics: %w", err)
+	}
+	return nil
+}
+
+// export writes every metric as a JSON array, the format of the server file storage. The values the server
+// derives are left out, and so are the timers listed without their sketch, which can't be imported.
+func (r *Runner) export(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%w: export [file]", ErrUsage)
+	}
+	metrics, err := r.collect(ctx, domain.ListFilter{}, 0)
+	if err != nil {
+		return err
+	}
+	snapshot := make([]domain.Metric, 0, len(metrics))
+	skipped := 0
+	for _, m := range metrics {
+		if m.MType == domain.Timer && m.Sketch == nil {
+			skipped++
+			continue
+		}
+		m.Summary, m.Rate, m.Stale = nil, nil, false
+		snapshot = append(snapshot, m)
+	}
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(r.stderr, "skipped %d timers listed without their sketch, export over REST to keep them\n",
+			skipped)
+	}
+	w := r.stdout
+	if len(args) == 1 {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create snapshot: %w", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		w = f
+	}
+	if err = json.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	return nil
+}
+
+// importFile sends the metrics of a snapshot in batches. Counters are sent as deltas, so they are added
+// to the totals of the server.
+func (r *Runner) importFile(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("%w: import [file]", ErrUsage)
+	}
+	rd := r.stdin
+	if len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open snapshot: %w", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		rd = f
+	}
+	var metrics []domain.Metric
+	if err := json.NewDecoder(rd).Decode(&metrics); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	for i := 0; i < len(metrics); i += importBatch {
+		batch := metrics[i:min(i+importBatch, len(metrics))]
+		if err := r.client.SetAll(ctx, batch); err != nil {
+			return fmt.Errorf("failed to import metrics after %d of %d: %w", i, len(metrics), err)
+		}
+	}
+	if _, err := fmt.Fprintf(r.stdout, "imported %d metrics\n", len(metrics)); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (r *Runner) health(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("%w: health", ErrUsage)
+	}
+	if err := r.client.Ping(ctx); err != nil {
+		return fmt.Errorf("server is unhealthy: %w", err)
+	}
+	if _, err := fmt.Fprintln(r.stdout, "ok"); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// alerts lists, sets or deletes alert rules as its first argument says.
+func (r *Runner) alerts(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: alerts list|set|delete", ErrUsage)
+	}
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			return fmt.Errorf("%w: alerts list", ErrUsage)
+		}
+		alerts, err := r.client.Alerts(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list alerts: %w", err)
+		}
+		return writeAlerts(r.stdout, r.cfg.Output, alerts)
+	case "set":
+		return r.setAlertRule(ctx, args[1:])
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("%w: alerts delete <name>", ErrUsage)
+		}
+		if err := r.client.DeleteAlertRule(ctx, args[1]); err != nil {
+			return fmt.Errorf("failed to delete alert rule %s: %w", args[1], err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown alerts command %q", ErrUsage, args[0])
+	}
+}
+
+func (r *Runner) setAlertRule(ctx context.Context, args []string) error {
+	var rule domain.AlertRule
+	fs := newFlagSet("alerts set")
+	fs.StringVar(&rule.Description, "description", "", "description of the rule")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", ErrUsage, err)
+	}
+	if fs.NArg() != 4 {
+		return fmt.Errorf("%w: alerts set [-description d] <name> <query> <op> <threshold>", ErrUsage)
+	}
+	rule.Name, rule.Query, rule.Op = fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	threshold, err := strconv.ParseFloat(fs.Arg(3), 64)
+	if err != nil {
+		return fmt.Errorf("incorrect threshold %q: %w", fs.Arg(3), err)
+	}
+	rule.Threshold = threshold
+	if err = r.client.SetAlertRule(ctx, &rule); err != nil {
+		return fmt.Errorf("failed to set alert rule %s: %w", rule.Name, err)
+	}
+	return nil
+}
+
+// newFlagSet creates the flag set of a command, which reports its errors rather than exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+)
+
+// fakeClient serves metrics from memory, listing them in pages of its page size.
+type fakeClient struct {
+	Client
+	metrics  []domain.Metric
+	pageSize int
+	limits   []int
+	batches  [][]domain.Metric
+	rules    []domain.AlertRule
+	deleted  []string
+}
+
+func (c *fakeClient) List(_ context.Context, filter domain.ListFilter) (*domain.Page, error) {
+	c.limits = append(c.limits, filter.Limit)
+	from := 0
+	if filter.Cursor != "" {
+		from, _ = strconv.Atoi(filter.Cursor)
+	}
+	to := min(from+min(filter.Limit, c.pageSize), len(c.metrics))
+	page := &domain.Page{Metrics: c.metrics[from:to]}
+	if to < len(c.metrics) {
+		page.Next = strconv.Itoa(to)
+	}
+	return page, nil
+}
+
+func (c *fakeClient) SetAll(_ context.Context, metrics []domain.Metric) error {
+	c.batches = append(c.batches, metrics)
+	return nil
+}
+
+func (c *fakeClient) Watch(_ context.Context, _ domain.WatchFilter, fn func(m domain.Metric) error) error {
+	for _, m := range c.metrics {
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *fakeClient) Alerts(context.Context) ([]domain.Alert, error) {
+	alerts := make([]domain.Alert, 0, len(c.rules))
+	for _, rule := range c.rules {
+		alerts = append(alerts, domain.Alert{AlertRule: rule, Firing: []domain.AlertSeries{{Value: 1}}})
+	}
+	return alerts, nil
+}
+
+func (c *fakeClient) SetAlertRule(_ context.Context, rule *domain.AlertRule) error {
+	c.rules = append(c.rules, *rule)
+	return nil
+}
+
+func (c *fakeClient) DeleteAlertRule(_ context.Context, name string) error {
+	c.deleted = append(c.deleted, name)
+	return nil
+}
+
+func gauges(n int) []domain.Metric {
+	metrics := make([]domain.Metric, n)
+	for i := range metrics {
+		v := float64(i)
+		metrics[i] = domain.Metric{ID: "g" + strconv.Itoa(i), MType: domain.Gauge, Value: &v}
+	}
+	return metrics
+}
+
+func run(t *testing.T, client Client, output string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	r := New(&config.Config{Output: output}, client, strings.NewReader(""), &stdout, &stderr)
+	err := r.Run(context.Background(), args)
+	return stdout.String() + stderr.String(), err
+}
+
+func TestRunner_List(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantLen    int
+		wantLimits []int
+	}{
+		{name: "all pages", args: []string{"list"}, wantLen: 5, wantLimits: []int{1000, 1000, 1000}},
+		{name: "up to the limit", args: []string{"list", "-limit", "3"}, wantLen: 3, wantLimits: []int{3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{metrics: gauges(5), pageSize: 2}
+
+			out, err := run(t, client, config.OutputJSON, tt.args...)
+			require.NoError(t, err)
+
+			var got []domain.Metric
+			require.NoError(t, json.Unmarshal([]byte(out), &got))
+			assert.Len(t, got, tt.wantLen)
+			assert.Equal(t, tt.wantLimits, client.limits)
+		})
+	}
+}
+
+func TestRunner_Usage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"get", "gauge"},
+		{"set", "histogram", "h", "1"},
+		{"delete", "-prefix", "p", "gauge", "g"},
+		{"list", "-bogus"},
+		{"alerts"},
+		{"alerts", "show"},
+		{"alerts", "set", "high-load", "load", ">"},
+		{"alerts", "delete"},
+	} {
+		_, err := run(t, &fakeClient{}, config.OutputTable, args...)
+		assert.ErrorIs(t, err, ErrUsage, args)
+	}
+}
+
+func TestRunner_Export(t *testing.T) {
+	rate := 1.5
+	metrics := []domain.Metric{
+		{ID: "c", MType: domain.Counter, Delta: new(int64), Rate: &rate, Stale: true},
+		{ID: "t", MType: domain.Timer, Sketch: json.RawMessage(`{"count":1}`), Summary: &domain.TimerSummary{Count: 1}},
+		{ID: "t2", MType: domain.Timer, Summary: &domain.TimerSummary{Count: 1}},
+	}
+
+	out, err := run(t, &fakeClient{metrics: metrics, pageSize: 10}, config.OutputTable, "export")
+	require.NoError(t, err)
+
+	snapshot, warning, _ := strings.Cut(out, "\n")
+	assert.JSONEq(t, `[{"id":"c","type":"counter","delta":0},{"id":"t","type":"timer","sketch":{"count":1}}]`, snapshot)
+	assert.Contains(t, warning, "skipped 1 timers")
+}
+
+func TestRunner_Import(t *testing.T) {
+	var snapshot bytes.Buffer
+	require.NoError(t, json.NewEncoder(&snapshot).Encode(gauges(importBatch+1)))
+	client := &fakeClient{}
+	var stdout bytes.Buffer
+	r := New(&config.Config{}, client, &snapshot, &stdout, &stdout)
+
+	require.NoError(t, r.Run(context.Background(), []string{"import"}))
+
+	require.Len(t, client.batches, 2)
+	assert.Len(t, client.batches[0], importBatch)
+	assert.Len(t, client.batches[1], 1)
+	assert.Equal(t, "imported 101 metrics\n", stdout.String())
+}
+
+func TestRunner_Watch(t *testing.T) {
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	metrics := gauges(2)
+	metrics[1].Updated = &updated
+
+	out, err := run(t, &fakeClient{metrics: metrics}, config.OutputCSV, "watch")
+	require.NoError(t, err)
+
+	assert.Equal(t, "ID,TYPE,VALUE,UPDATED,STALE\ng0,gauge,0,,false\ng1,gauge,1,2024-05-01T10:00:00Z,false\n", out)
+}
+
+func TestRunner_Alerts(t *testing.T) {
+	client := &fakeClient{}
+
+	_, err := run(t, client, config.OutputTable, "alerts", "set", "-description", "busy host", "high-load", "load", ">", "2.5")
+	require.NoError(t, err)
+	require.Equal(t, []domain.AlertRule{
+		{Name: "high-load", Query: "load", Op: ">", Threshold: 2.5, Description: "busy host"},
+	}, client.rules)
+	_, err = run(t, client, config.OutputTable, "alerts", "set", "high-load", "load", ">", "high")
+	require.Error(t, err)
+
+	out, err := run(t, client, config.OutputCSV, "alerts", "list")
+	require.NoError(t, err)
+	assert.Equal(t, "NAME,QUERY,CONDITION,FIRING,ERROR\nhigh-load,load,> 2.5,=1,\n", out)
+
+	_, err = run(t, client, config.OutputTable, "alerts", "delete", "high-load")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high-load"}, client.deleted)
+}
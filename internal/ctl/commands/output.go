@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+)
+
+// columns head the table and CSV outputs.
+var columns = []string{"ID", "TYPE", "VALUE", "UPDATED", "STALE"}
+
+// alertColumns head the table and CSV outputs of alerts.
+var alertColumns = []string{"NAME", "QUERY", "CONDITION", "FIRING", "ERROR"}
+
+// writeOne writes a metric, as a JSON object rather than an array.
+func writeOne(w io.Writer, format string, m *domain.Metric) error {
+	if format == config.OutputJSON {
+		return encodeJSON(w, m)
+	}
+	return writeAll(w, format, []domain.Metric{*m})
+}
+
+// writeAll writes metrics in the format: an aligned table, a JSON array or CSV with a header.
+func writeAll(w io.Writer, format string, metrics []domain.Metric) error {
+	if format == config.OutputJSON {
+		return encodeJSON(w, metrics)
+	}
+	rows := make([][]string, 0, len(metrics))
+	for _, m := range metrics {
+		rows = append(rows, row(m))
+	}
+	return writeRows(w, format, columns, rows)
+}
+
+// writeAlerts writes alerts in the format, a table or CSV row listing the series each alert fires for.
+func writeAlerts(w io.Writer, format string, alerts []domain.Alert) error {
+	if format == config.OutputJSON {
+		return encodeJSON(w, alerts)
+	}
+	rows := make([][]string, 0, len(alerts))
+	for _, a := range alerts {
+		firing := make([]string, 0, len(a.Firing))
+		for _, s := range a.Firing {
+			firing = append(firing, seriesID(s)+"="+formatFloat(s.Value))
+		}
+		condition := a.Op + " " + formatFloat(a.Threshold)
+		rows = append(rows, []string{a.Name, a.Query, condition, strings.Join(firing, " "), a.Error})
+	}
+	return writeRows(w, format, alertColumns, rows)
+}
+
+// writeRows writes rows as an aligned table or as CSV, with a header.
+func writeRows(w io.Writer, format string, header []string, rows [][]string) error {
+	if format == config.OutputCSV {
+		cw := csv.NewWriter(w)
+		_ = cw.Write(header)
+		for _, r := range rows {
+			_ = cw.Write(r)
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, r := range rows {
+		_, _ = fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("failed to write table: %w", err)
+	}
+	return nil
+}
+
+// seriesID formats a series an alert fires for as name{k="v"}, its labels sorted.
+func seriesID(s domain.AlertSeries) string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+	pairs := make([]string, 0, len(s.Labels))
+	for _, k := range slices.Sorted(maps.Keys(s.Labels)) {
+		pairs = append(pairs, k+"="+strconv.Quote(s.Labels[k]))
+	}
+	return s.Name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// streamWriter writes the updates of a watch as they come: a table row, a JSON line or a CSV record each.
+type streamWriter struct {
+	w      io.Writer
+	format string
+	header bool
+}
+
+func newStreamWriter(w io.Writer, format string) *streamWriter {
+	return &streamWriter{w: w, format: format}
+}
+
+func (s *streamWriter) write(m domain.Metric) error {
+	if s.format == config.OutputJSON {
+		return encodeJSON(s.w, m)
+	}
+	var buf strings.Builder
+	if err := writeAll(&buf, s.format, []domain.Metric{m}); err != nil {
+		return err
+	}
+	out := buf.String()
+	if s.header {
+		// Every update is written alone, so only the first one keeps the header.
+		_, out, _ = strings.Cut(out, "\n")
+	}
+	s.header = true
+	if _, err := io.WriteString(s.w, out); err != nil {
+		return fmt.Errorf("failed to write update: %w", err)
+	}
+	return nil
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	return nil
+}
+
+// row lays out a metric as the columns.
+func row(m domain.Metric) []string {
+	var updated string
+	if m.Updated != nil {
+		updated = m.Updated.Format(time.RFC3339)
+	}
+	return []string{m.ID, m.MType, value(m), updated, strconv.FormatBool(m.Stale)}
+}
+
+// value formats the value of a metric, histograms and timers being summed up by their count, sum and,
+// for timers, quantiles.
+func value(m domain.Metric) string {
+	switch {
+	case m.Delta != nil:
+		return strconv.FormatInt(*m.Delta, 10)
+	case m.Value != nil:
+		return formatFloat(*m.Value)
+	case m.Histogram != nil:
+		return fmt.Sprintf("count=%d sum=%s", m.Histogram.Count, formatFloat(m.Histogram.Sum))
+	case m.Summary != nil:
+		s := m.Summary
+		return fmt.Sprintf("count=%d sum=%s p50=%s p90=%s p99=%s max=%s", s.Count, formatFloat(s.Sum),
+			formatFloat(s.P50), formatFloat(s.P90), formatFloat(s.P99), formatFloat(s.Max))
+	default:
+		return ""
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/ctl/config"
+	"metrics/internal/ctl/domain"
+)
+
+func TestWriteAll(t *testing.T) {
+	v, d := 0.25, int64(7)
+	metrics := []domain.Metric{
+		{ID: "gauge_with_long_name", MType: domain.Gauge, Value: &v},
+		{ID: "c", MType: domain.Counter, Delta: &d, Stale: true},
+		{ID: "h", MType: domain.Histogram, Histogram: &domain.HistogramValue{Count: 3, Sum: 1.5}},
+		{ID: "t", MType: domain.Timer, Summary: &domain.TimerSummary{Count: 2, Sum: 3, P50: 1, P90: 2, P99: 2, Max: 2}},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			format: config.OutputTable,
+			want: "ID                    TYPE       VALUE                                  UPDATED  STALE\n" +
+				"gauge_with_long_name  gauge      0.25                                            false\n" +
+				"c                     counter    7                                               true\n" +
+				"h                     histogram  count=3 sum=1.5                                 false\n" +
+				"t                     timer      count=2 sum=3 p50=1 p90=2 p99=2 max=2           false\n",
+		},
+		{
+			format: config.OutputCSV,
+			want: "ID,TYPE,VALUE,UPDATED,STALE\n" +
+				"gauge_with_long_name,gauge,0.25,,false\n" +
+				"c,counter,7,,true\n" +
+				"h,histogram,count=3 sum=1.5,,false\n" +
+				"t,timer,count=2 sum=3 p50=1 p90=2 p99=2 max=2,,false\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, writeAll(&buf, tt.format, metrics))
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestWriteAlerts(t *testing.T) {
+	alerts := []domain.Alert{
+		{
+			AlertRule: domain.AlertRule{Name: "high-load", Query: "load", Op: ">", Threshold: 2},
+			Firing: []domain.AlertSeries{
+				{Name: "load", Labels: map[string]string{"host": "a", "dc": "eu"}, Value: 3},
+				{Name: "load", Labels: map[string]string{"host": "b"}, Value: 2.5},
+			},
+		},
+		{AlertRule: domain.AlertRule{Name: "range", Query: "load[1m]", Op: "<", Threshold: 1}, Error: "bad query"},
+	}
+	var buf bytes.Buffer
+
+	require.NoError(t, writeAlerts(&buf, config.OutputTable, alerts))
+
+	assert.Equal(t,
+		"NAME       QUERY     CONDITION  FIRING                                       ERROR\n"+
+			"high-load  load      > 2        load{dc=\"eu\",host=\"a\"}=3 load{host=\"b\"}=2.5  \n"+
+			"range      load[1m]  < 1                                                     bad query\n",
+		buf.String())
+}
+
+func TestWriteOne_JSON(t *testing.T) {
+	v := 1.0
+	var buf bytes.Buffer
+
+	require.NoError(t, writeOne(&buf, config.OutputJSON, &domain.Metric{ID: "g", MType: domain.Gauge, Value: &v}))
+
+	assert.JSONEq(t, `{"id":"g","type":"gauge","value":1}`, buf.String(), "a single metric is an object")
+}
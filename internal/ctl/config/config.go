@@ -0,0 +1,118 @@
+// Package config provides the settings of metricsctl.
+package config
+
+import (
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"metrics/internal/shared-kernel/cert"
+	"metrics/internal/shared-kernel/settings"
+)
+
+// Output formats.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+// Config holds the settings of metricsctl, shared by all its commands. The ones tagged secret are redacted
+// when the config is printed.
+type Config struct {
+	Address     string         `env:"METRICS_ADDRESS" json:"address"`
+	UseGRPC     bool           `env:"METRICS_GRPC" json:"grpc"`
+	Key         string         `env:"METRICS_KEY" json:"key" secret:"true"`
+	CryptoKey   string         `env:"METRICS_CRYPTO_KEY" json:"crypto_key"`
+	AdminToken  string         `env:"METRICS_ADMIN_TOKEN" json:"admin_token" secret:"true"`
+	Output      string         `env:"METRICS_OUTPUT" json:"output"`
+	Timeout     int            `env:"METRICS_TIMEOUT" json:"timeout"`
+	Config      string         `env:"METRICSCTL_CONFIG" json:"config"`
+	PrintConfig bool           `json:"-"`
+	PublicKey   *rsa.PublicKey `json:"-"`
+	// Args are the command and its arguments, following the flags.
+	Args []string `json:"-"`
+}
+
+// Load reads the config in layers, each overriding the settings of the previous one: the defaults, the JSON
+// or YAML file named by the -c flag or else by METRICSCTL_CONFIG, the environment and the flags set in args.
+func Load(args []string) (*Config, error) {
+	cfg := Config{
+		Address: "localhost:8080",
+		Output:  OutputTable,
+		Timeout: 10,
+	}
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(fs.Output(), "Usage: %s [flags] <command> [arguments]\n\n%s\nFlags:\n", fs.Name(), Commands)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "server address, host:port of the HTTP or the gRPC server")
+	fs.BoolVar(&cfg.UseGRPC, "grpc", cfg.UseGRPC, "talk to the gRPC server")
+	fs.StringVar(&cfg.Key, "k", cfg.Key, "hashing key of the server")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "public key file path of the server")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken, "admin token of the server, for delete and reset")
+	fs.StringVar(&cfg.Output, "o", cfg.Output, "output format: table, json or csv")
+	fs.IntVar(&cfg.Timeout, "timeout", cfg.Timeout, "seconds a request may take, 0 without limit, watch has none")
+	fs.StringVar(&cfg.Config, "c", cfg.Config, "config file path, JSON or YAML")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config with the secrets redacted and exit")
+	path, err := settings.Load(&cfg, fs, args, "c", "METRICSCTL_CONFIG")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config for metricsctl: %w", err)
+	}
+	cfg.Config = path
+	cfg.Args = fs.Args()
+	return &cfg, cfg.validate()
+}
+
+// Print writes the config as a JSON config file with the secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	return settings.Print(w, c)
+}
+
+// validate checks the settings, naming every invalid one, and reads the public key.
+func (c *Config) validate() error {
+	var errs settings.Errors
+	if c.Address == "" {
+		errs.Add("address", "must not be empty")
+	}
+	switch c.Output {
+	case OutputTable, OutputJSON, OutputCSV:
+	default:
+		errs.Add("output", "unknown format %q", c.Output)
+	}
+	if c.Timeout < 0 {
+		errs.Add("timeout", "must not be negative, got %d", c.Timeout)
+	}
+	var err error
+	if c.PublicKey, err = cert.PublicKey(c.CryptoKey); err != nil {
+		errs.Add("crypto_key", "%w", err)
+	}
+	return errs.Err()
+}
+
+// Commands describes the commands of metricsctl.
+const Commands = `Commands:
+  get <type> <name>            print a metric
+  set <type> <name> <value>    set a gauge, add to a counter or record a timer sample
+  list [-type t] [-prefix p] [-match re] [-label k=v] [-limit n]
+                               list metrics, following the pages up to the limit
+  delete <type> <name>         delete a series, needs the admin token
+  delete -prefix <prefix>      delete the series whose ID starts with prefix, needs the admin token
+  reset <name>                 reset a counter to zero, needs the admin token
+  watch [-name n] [-type t]    print the updates of metrics until interrupted
+  export [file]                write a snapshot of all metrics as JSON, to stdout without a file;
+                               timers are exported over REST only, gRPC doesn't carry their sketch
+  import [file]                send the metrics of a snapshot, from stdin without a file; counters
+                               are added to the totals of the server
+  health                       check the server and its storage
+  alerts list                  evaluate the alert rules, listing the series each one fires for
+  alerts set [-description d] <name> <query> <op> <threshold>
+                               create or replace an alert rule firing for the series of the query
+                               whose value compares to the threshold by op, one of > >= < <= == !=;
+                               needs the admin token
+  alerts delete <name>         delete an alert rule, needs the admin token;
+                               alert rules are managed over REST only
+`
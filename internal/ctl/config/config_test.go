@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/shared-kernel/settings"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metricsctl.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("address: metrics:8080\noutput: csv\nadmin_token: file\n"), 0o600))
+	t.Setenv("METRICSCTL_CONFIG", path)
+	t.Setenv("METRICS_OUTPUT", "json")
+
+	cfg, err := Load([]string{"-admin-token", "flag", "list", "-limit", "5"})
+	require.NoError(t, err)
+	assert.Equal(t, "metrics:8080", cfg.Address)
+	assert.Equal(t, OutputJSON, cfg.Output)
+	assert.Equal(t, "flag", cfg.AdminToken)
+	assert.Equal(t, 10, cfg.Timeout)
+	assert.Equal(t, path, cfg.Config)
+	assert.Equal(t, []string{"list", "-limit", "5"}, cfg.Args, "the command keeps its own flags")
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load([]string{"-a", "", "-o", "yaml", "-timeout", "-1", "-crypto-key", "/nonexistent/public.pem"})
+	require.Error(t, err)
+	var joined interface{ Unwrap() []error }
+	require.ErrorAs(t, err, &joined)
+	var fields []string
+	for _, err := range joined.Unwrap() {
+		var fieldErr *settings.FieldError
+		if assert.ErrorAs(t, err, &fieldErr) {
+			fields = append(fields, fieldErr.Field)
+		}
+	}
+	assert.Equal(t, []string{"address", "output", "timeout", "crypto_key"}, fields)
+}
@@ -0,0 +1,94 @@
+// Package domain defines the metrics as the server API exposes them to metricsctl.
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Metric types.
+const (
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Timer     = "timer"
+)
+
+// Metric is a series as the server sends and accepts it, a snapshot being a list of them.
+type Metric struct {
+	ID        string          `json:"id"`
+	MType     string          `json:"type"`
+	Delta     *int64          `json:"delta,omitempty"`
+	Value     *float64        `json:"value,omitempty"`
+	Histogram *HistogramValue `json:"histogram,omitempty"`
+	Sketch    json.RawMessage `json:"sketch,omitempty"` // kept as sent, only moved between servers
+	Summary   *TimerSummary   `json:"summary,omitempty"`
+	Rate      *float64        `json:"rate,omitempty"`
+	Updated   *time.Time      `json:"updated,omitempty"`
+	Stale     bool            `json:"stale,omitempty"`
+}
+
+// HistogramValue is the value of a histogram, Counts having one more bucket than Bounds for +Inf.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// TimerSummary holds the quantiles of a timer.
+type TimerSummary struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// ListFilter selects a page of metrics.
+type ListFilter struct {
+	Types  []string // metric types, any when empty
+	Prefix string   // prefix of the series ID
+	Match  string   // regular expression searched in the metric name, REST only
+	Labels []string // k=v labels the series must have, REST only
+	Limit  int      // page size, the server default when zero
+	Cursor string   // Next of the previous page
+}
+
+// Page is a page of a listing, Next being the cursor of the following page if there is one.
+type Page struct {
+	Metrics []Metric `json:"metrics"`
+	Next    string   `json:"next,omitempty"`
+}
+
+// WatchFilter selects the updates to follow, all when empty.
+type WatchFilter struct {
+	Names []string
+	Types []string
+}
+
+// AlertRule fires for every series of the result of Query, or for its scalar, whose value compares to
+// Threshold by Op, one of > >= < <= == !=.
+type AlertRule struct {
+	Name        string  `json:"name"`
+	Query       string  `json:"query"`
+	Op          string  `json:"op"`
+	Threshold   float64 `json:"threshold"`
+	Description string  `json:"description,omitempty"`
+}
+
+// AlertSeries is a series an alert fires for, with no name or labels when the query gives a scalar.
+type AlertSeries struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Alert is a rule as the server evaluated it, Error telling why its query couldn't be evaluated.
+type Alert struct {
+	AlertRule
+	Firing      []AlertSeries `json:"firing"`
+	Error       string        `json:"error,omitempty"`
+	EvaluatedAt time.Time     `json:"evaluated_at"`
+}
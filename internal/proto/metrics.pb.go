@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.36.5
+// 	protoc-gen-go v1.36.6
 // 	protoc        v5.29.3
 // source: internal/proto/metrics.proto
 
@@ -24,8 +24,10 @@ const (
 type Metric_Type int32
 
 const (
-	Metric_GAUGE   Metric_Type = 0
-	Metric_COUNTER Metric_Type = 1
+	Metric_GAUGE     Metric_Type = 0
+	Metric_COUNTER   Metric_Type = 1
+	Metric_HISTOGRAM Metric_Type = 2
+	Metric_TIMER     Metric_Type = 3
 )
 
 // Enum value maps for Metric_Type.
@@ -33,10 +35,14 @@ var (
 	Metric_Type_name = map[int32]string{
 		0: "GAUGE",
 		1: "COUNTER",
+		2: "HISTOGRAM",
+		3: "TIMER",
 	}
 	Metric_Type_value = map[string]int32{
-		"GAUGE":   0,
-		"COUNTER": 1,
+		"GAUGE":     0,
+		"COUNTER":   1,
+		"HISTOGRAM": 2,
+		"TIMER":     3,
 	}
 )
 
@@ -68,13 +74,18 @@ func (Metric_Type) EnumDescriptor() ([]byte, []int) {
 }
 
 type Metric struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Type          Metric_Type            `protobuf:"varint,2,opt,name=type,proto3,enum=metrics.Metric_Type" json:"type,omitempty"`
-	Delta         int64                  `protobuf:"varint,3,opt,name=delta,proto3" json:"delta,omitempty"`
-	Value         float64                `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Id              string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type            Metric_Type            `protobuf:"varint,2,opt,name=type,proto3,enum=metrics.Metric_Type" json:"type,omitempty"`
+	Delta           int64                  `protobuf:"varint,3,opt,name=delta,proto3" json:"delta,omitempty"`
+	Value           float64                `protobuf:"fixed64,4,opt,name=value,proto3" json:"value,omitempty"` // gauge value or timer sample
+	Histogram       *Histogram             `protobuf:"bytes,5,opt,name=histogram,proto3" json:"histogram,omitempty"`
+	Summary         *TimerSummary          `protobuf:"bytes,6,opt,name=summary,proto3" json:"summary,omitempty"`                                           // timer quantiles, only in responses
+	UpdatedUnixNano int64                  `protobuf:"varint,7,opt,name=updated_unix_nano,json=updatedUnixNano,proto3" json:"updated_unix_nano,omitempty"` // time of the last write, only in responses
+	Stale           bool                   `protobuf:"varint,8,opt,name=stale,proto3" json:"stale,omitempty"`                                              // not written for the stale TTL, only in responses
+	Sketch          *Sketch                `protobuf:"bytes,9,opt,name=sketch,proto3" json:"sketch,omitempty"`                                             // timer sketch, only in snapshots
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
 func (x *Metric) Reset() {
@@ -135,27 +146,65 @@ func (x *Metric) GetValue() float64 {
 	return 0
 }
 
-type MetricResponse struct {
+func (x *Metric) GetHistogram() *Histogram {
+	if x != nil {
+		return x.Histogram
+	}
+	return nil
+}
+
+func (x *Metric) GetSummary() *TimerSummary {
+	if x != nil {
+		return x.Summary
+	}
+	return nil
+}
+
+func (x *Metric) GetUpdatedUnixNano() int64 {
+	if x != nil {
+		return x.UpdatedUnixNano
+	}
+	return 0
+}
+
+func (x *Metric) GetStale() bool {
+	if x != nil {
+		return x.Stale
+	}
+	return false
+}
+
+func (x *Metric) GetSketch() *Sketch {
+	if x != nil {
+		return x.Sketch
+	}
+	return nil
+}
+
+type Histogram struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Status        int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	Bounds        []float64              `protobuf:"fixed64,1,rep,packed,name=bounds,proto3" json:"bounds,omitempty"`
+	Counts        []uint64               `protobuf:"varint,2,rep,packed,name=counts,proto3" json:"counts,omitempty"`
+	Sum           float64                `protobuf:"fixed64,3,opt,name=sum,proto3" json:"sum,omitempty"`
+	Count         uint64                 `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *MetricResponse) Reset() {
-	*x = MetricResponse{}
+func (x *Histogram) Reset() {
+	*x = Histogram{}
 	mi := &file_internal_proto_metrics_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *MetricResponse) String() string {
+func (x *Histogram) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*MetricResponse) ProtoMessage() {}
+func (*Histogram) ProtoMessage() {}
 
-func (x *MetricResponse) ProtoReflect() protoreflect.Message {
+func (x *Histogram) ProtoReflect() protoreflect.Message {
 	mi := &file_internal_proto_metrics_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -167,11 +216,796 @@ func (x *MetricResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use MetricResponse.ProtoReflect.Descriptor instead.
-func (*MetricResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use Histogram.ProtoReflect.Descriptor instead.
+func (*Histogram) Descriptor() ([]byte, []int) {
 	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{1}
 }
 
+func (x *Histogram) GetBounds() []float64 {
+	if x != nil {
+		return x.Bounds
+	}
+	return nil
+}
+
+func (x *Histogram) GetCounts() []uint64 {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+func (x *Histogram) GetSum() float64 {
+	if x != nil {
+		return x.Sum
+	}
+	return 0
+}
+
+func (x *Histogram) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+// A DDSketch of timer samples, its stores counting the samples per logarithmic bucket from offset.
+type Sketch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Alpha         float64                `protobuf:"fixed64,1,opt,name=alpha,proto3" json:"alpha,omitempty"`
+	Positive      *SketchStore           `protobuf:"bytes,2,opt,name=positive,proto3" json:"positive,omitempty"`
+	Negative      *SketchStore           `protobuf:"bytes,3,opt,name=negative,proto3" json:"negative,omitempty"`
+	Zeros         uint64                 `protobuf:"varint,4,opt,name=zeros,proto3" json:"zeros,omitempty"`
+	Count         uint64                 `protobuf:"varint,5,opt,name=count,proto3" json:"count,omitempty"`
+	Sum           float64                `protobuf:"fixed64,6,opt,name=sum,proto3" json:"sum,omitempty"`
+	Min           float64                `protobuf:"fixed64,7,opt,name=min,proto3" json:"min,omitempty"`
+	Max           float64                `protobuf:"fixed64,8,opt,name=max,proto3" json:"max,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sketch) Reset() {
+	*x = Sketch{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sketch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sketch) ProtoMessage() {}
+
+func (x *Sketch) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sketch.ProtoReflect.Descriptor instead.
+func (*Sketch) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Sketch) GetAlpha() float64 {
+	if x != nil {
+		return x.Alpha
+	}
+	return 0
+}
+
+func (x *Sketch) GetPositive() *SketchStore {
+	if x != nil {
+		return x.Positive
+	}
+	return nil
+}
+
+func (x *Sketch) GetNegative() *SketchStore {
+	if x != nil {
+		return x.Negative
+	}
+	return nil
+}
+
+func (x *Sketch) GetZeros() uint64 {
+	if x != nil {
+		return x.Zeros
+	}
+	return 0
+}
+
+func (x *Sketch) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *Sketch) GetSum() float64 {
+	if x != nil {
+		return x.Sum
+	}
+	return 0
+}
+
+func (x *Sketch) GetMin() float64 {
+	if x != nil {
+		return x.Min
+	}
+	return 0
+}
+
+func (x *Sketch) GetMax() float64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+type SketchStore struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Offset        int32                  `protobuf:"zigzag32,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	Counts        []uint64               `protobuf:"varint,2,rep,packed,name=counts,proto3" json:"counts,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SketchStore) Reset() {
+	*x = SketchStore{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SketchStore) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SketchStore) ProtoMessage() {}
+
+func (x *SketchStore) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SketchStore.ProtoReflect.Descriptor instead.
+func (*SketchStore) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SketchStore) GetOffset() int32 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *SketchStore) GetCounts() []uint64 {
+	if x != nil {
+		return x.Counts
+	}
+	return nil
+}
+
+type TimerSummary struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Count         uint64                 `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	Sum           float64                `protobuf:"fixed64,2,opt,name=sum,proto3" json:"sum,omitempty"`
+	P50           float64                `protobuf:"fixed64,3,opt,name=p50,proto3" json:"p50,omitempty"`
+	P90           float64                `protobuf:"fixed64,4,opt,name=p90,proto3" json:"p90,omitempty"`
+	P99           float64                `protobuf:"fixed64,5,opt,name=p99,proto3" json:"p99,omitempty"`
+	Max           float64                `protobuf:"fixed64,6,opt,name=max,proto3" json:"max,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TimerSummary) Reset() {
+	*x = TimerSummary{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TimerSummary) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TimerSummary) ProtoMessage() {}
+
+func (x *TimerSummary) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TimerSummary.ProtoReflect.Descriptor instead.
+func (*TimerSummary) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *TimerSummary) GetCount() uint64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *TimerSummary) GetSum() float64 {
+	if x != nil {
+		return x.Sum
+	}
+	return 0
+}
+
+func (x *TimerSummary) GetP50() float64 {
+	if x != nil {
+		return x.P50
+	}
+	return 0
+}
+
+func (x *TimerSummary) GetP90() float64 {
+	if x != nil {
+		return x.P90
+	}
+	return 0
+}
+
+func (x *TimerSummary) GetP99() float64 {
+	if x != nil {
+		return x.P99
+	}
+	return 0
+}
+
+func (x *TimerSummary) GetMax() float64 {
+	if x != nil {
+		return x.Max
+	}
+	return 0
+}
+
+// Selects the updates of Watch, any name or type when empty.
+type WatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Names         []string               `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	Types         []Metric_Type          `protobuf:"varint,2,rep,packed,name=types,proto3,enum=metrics.Metric_Type" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *WatchRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetTypes() []Metric_Type {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          Metric_Type            `protobuf:"varint,2,opt,name=type,proto3,enum=metrics.Metric_Type" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetRequest) GetType() Metric_Type {
+	if x != nil {
+		return x.Type
+	}
+	return Metric_GAUGE
+}
+
+// Selects a page of metrics as the REST listing does, any type when empty.
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Types         []Metric_Type          `protobuf:"varint,1,rep,packed,name=types,proto3,enum=metrics.Metric_Type" json:"types,omitempty"`
+	Prefix        string                 `protobuf:"bytes,2,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	Limit         int32                  `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`  // 100 when zero, at most 1000
+	Cursor        string                 `protobuf:"bytes,4,opt,name=cursor,proto3" json:"cursor,omitempty"` // next of the previous page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListRequest) GetTypes() []Metric_Type {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+func (x *ListRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+func (x *ListRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+type ListResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Metrics       []*Metric              `protobuf:"bytes,1,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	Next          string                 `protobuf:"bytes,2,opt,name=next,proto3" json:"next,omitempty"` // empty on the last page
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListResponse) GetMetrics() []*Metric {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *ListResponse) GetNext() string {
+	if x != nil {
+		return x.Next
+	}
+	return ""
+}
+
+// Checks the storage of the server.
+type PingRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingRequest) Reset() {
+	*x = PingRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingRequest) ProtoMessage() {}
+
+func (x *PingRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingRequest.ProtoReflect.Descriptor instead.
+func (*PingRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{9}
+}
+
+type PingResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PingResponse) Reset() {
+	*x = PingResponse{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PingResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingResponse) ProtoMessage() {}
+
+func (x *PingResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingResponse.ProtoReflect.Descriptor instead.
+func (*PingResponse) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{10}
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          Metric_Type            `protobuf:"varint,2,opt,name=type,proto3,enum=metrics.Metric_Type" json:"type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DeleteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetType() Metric_Type {
+	if x != nil {
+		return x.Type
+	}
+	return Metric_GAUGE
+}
+
+type DeleteByPrefixRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteByPrefixRequest) Reset() {
+	*x = DeleteByPrefixRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteByPrefixRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteByPrefixRequest) ProtoMessage() {}
+
+func (x *DeleteByPrefixRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteByPrefixRequest.ProtoReflect.Descriptor instead.
+func (*DeleteByPrefixRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DeleteByPrefixRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Deleted       int64                  `protobuf:"varint,1,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DeleteResponse) GetDeleted() int64 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+type ResetCounterRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ResetCounterRequest) Reset() {
+	*x = ResetCounterRequest{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ResetCounterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ResetCounterRequest) ProtoMessage() {}
+
+func (x *ResetCounterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ResetCounterRequest.ProtoReflect.Descriptor instead.
+func (*ResetCounterRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ResetCounterRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type MetricResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MetricResponse) Reset() {
+	*x = MetricResponse{}
+	mi := &file_internal_proto_metrics_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MetricResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricResponse) ProtoMessage() {}
+
+func (x *MetricResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_metrics_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricResponse.ProtoReflect.Descriptor instead.
+func (*MetricResponse) Descriptor() ([]byte, []int) {
+	return file_internal_proto_metrics_proto_rawDescGZIP(), []int{15}
+}
+
 func (x *MetricResponse) GetStatus() int32 {
 	if x != nil {
 		return x.Status
@@ -181,29 +1015,85 @@ func (x *MetricResponse) GetStatus() int32 {
 
 var File_internal_proto_metrics_proto protoreflect.FileDescriptor
 
-var file_internal_proto_metrics_proto_rawDesc = string([]byte{
-	0x0a, 0x1c, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x2f, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07,
-	0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x22, 0x8e, 0x01, 0x0a, 0x06, 0x4d, 0x65, 0x74, 0x72,
-	0x69, 0x63, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
-	0x69, 0x64, 0x12, 0x28, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e,
-	0x32, 0x14, 0x2e, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69,
-	0x63, 0x2e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05,
-	0x64, 0x65, 0x6c, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x64, 0x65, 0x6c,
-	0x74, 0x61, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x01, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x1e, 0x0a, 0x04, 0x54, 0x79, 0x70, 0x65,
-	0x12, 0x09, 0x0a, 0x05, 0x47, 0x41, 0x55, 0x47, 0x45, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x43,
-	0x4f, 0x55, 0x4e, 0x54, 0x45, 0x52, 0x10, 0x01, 0x22, 0x28, 0x0a, 0x0e, 0x4d, 0x65, 0x74, 0x72,
-	0x69, 0x63, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73, 0x74,
-	0x61, 0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x06, 0x73, 0x74, 0x61, 0x74,
-	0x75, 0x73, 0x32, 0x43, 0x0a, 0x0d, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x53, 0x65, 0x72, 0x76,
-	0x69, 0x63, 0x65, 0x12, 0x32, 0x0a, 0x06, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x12, 0x0f, 0x2e,
-	0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x1a, 0x17,
-	0x2e, 0x6d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x52,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x10, 0x5a, 0x0e, 0x69, 0x6e, 0x74, 0x65, 0x72,
-	0x6e, 0x61, 0x6c, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
-})
+const file_internal_proto_metrics_proto_rawDesc = "" +
+	"\n" +
+	"\x1cinternal/proto/metrics.proto\x12\ametrics\"\xf6\x02\n" +
+	"\x06Metric\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12(\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x14.metrics.Metric.TypeR\x04type\x12\x14\n" +
+	"\x05delta\x18\x03 \x01(\x03R\x05delta\x12\x14\n" +
+	"\x05value\x18\x04 \x01(\x01R\x05value\x120\n" +
+	"\thistogram\x18\x05 \x01(\v2\x12.metrics.HistogramR\thistogram\x12/\n" +
+	"\asummary\x18\x06 \x01(\v2\x15.metrics.TimerSummaryR\asummary\x12*\n" +
+	"\x11updated_unix_nano\x18\a \x01(\x03R\x0fupdatedUnixNano\x12\x14\n" +
+	"\x05stale\x18\b \x01(\bR\x05stale\x12'\n" +
+	"\x06sketch\x18\t \x01(\v2\x0f.metrics.SketchR\x06sketch\"8\n" +
+	"\x04Type\x12\t\n" +
+	"\x05GAUGE\x10\x00\x12\v\n" +
+	"\aCOUNTER\x10\x01\x12\r\n" +
+	"\tHISTOGRAM\x10\x02\x12\t\n" +
+	"\x05TIMER\x10\x03\"c\n" +
+	"\tHistogram\x12\x16\n" +
+	"\x06bounds\x18\x01 \x03(\x01R\x06bounds\x12\x16\n" +
+	"\x06counts\x18\x02 \x03(\x04R\x06counts\x12\x10\n" +
+	"\x03sum\x18\x03 \x01(\x01R\x03sum\x12\x14\n" +
+	"\x05count\x18\x04 \x01(\x04R\x05count\"\xe4\x01\n" +
+	"\x06Sketch\x12\x14\n" +
+	"\x05alpha\x18\x01 \x01(\x01R\x05alpha\x120\n" +
+	"\bpositive\x18\x02 \x01(\v2\x14.metrics.SketchStoreR\bpositive\x120\n" +
+	"\bnegative\x18\x03 \x01(\v2\x14.metrics.SketchStoreR\bnegative\x12\x14\n" +
+	"\x05zeros\x18\x04 \x01(\x04R\x05zeros\x12\x14\n" +
+	"\x05count\x18\x05 \x01(\x04R\x05count\x12\x10\n" +
+	"\x03sum\x18\x06 \x01(\x01R\x03sum\x12\x10\n" +
+	"\x03min\x18\a \x01(\x01R\x03min\x12\x10\n" +
+	"\x03max\x18\b \x01(\x01R\x03max\"=\n" +
+	"\vSketchStore\x12\x16\n" +
+	"\x06offset\x18\x01 \x01(\x11R\x06offset\x12\x16\n" +
+	"\x06counts\x18\x02 \x03(\x04R\x06counts\"~\n" +
+	"\fTimerSummary\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x04R\x05count\x12\x10\n" +
+	"\x03sum\x18\x02 \x01(\x01R\x03sum\x12\x10\n" +
+	"\x03p50\x18\x03 \x01(\x01R\x03p50\x12\x10\n" +
+	"\x03p90\x18\x04 \x01(\x01R\x03p90\x12\x10\n" +
+	"\x03p99\x18\x05 \x01(\x01R\x03p99\x12\x10\n" +
+	"\x03max\x18\x06 \x01(\x01R\x03max\"P\n" +
+	"\fWatchRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\x12*\n" +
+	"\x05types\x18\x02 \x03(\x0e2\x14.metrics.Metric.TypeR\x05types\"F\n" +
+	"\n" +
+	"GetRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12(\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x14.metrics.Metric.TypeR\x04type\"\x7f\n" +
+	"\vListRequest\x12*\n" +
+	"\x05types\x18\x01 \x03(\x0e2\x14.metrics.Metric.TypeR\x05types\x12\x16\n" +
+	"\x06prefix\x18\x02 \x01(\tR\x06prefix\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\x04 \x01(\tR\x06cursor\"M\n" +
+	"\fListResponse\x12)\n" +
+	"\ametrics\x18\x01 \x03(\v2\x0f.metrics.MetricR\ametrics\x12\x12\n" +
+	"\x04next\x18\x02 \x01(\tR\x04next\"\r\n" +
+	"\vPingRequest\"\x0e\n" +
+	"\fPingResponse\"I\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12(\n" +
+	"\x04type\x18\x02 \x01(\x0e2\x14.metrics.Metric.TypeR\x04type\"/\n" +
+	"\x15DeleteByPrefixRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\"*\n" +
+	"\x0eDeleteResponse\x12\x18\n" +
+	"\adeleted\x18\x01 \x01(\x03R\adeleted\"%\n" +
+	"\x13ResetCounterRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"(\n" +
+	"\x0eMetricResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\x05R\x06status2\xd2\x03\n" +
+	"\rMetricService\x122\n" +
+	"\x06Update\x12\x0f.metrics.Metric\x1a\x17.metrics.MetricResponse\x121\n" +
+	"\x05Watch\x12\x15.metrics.WatchRequest\x1a\x0f.metrics.Metric0\x01\x12+\n" +
+	"\x03Get\x12\x13.metrics.GetRequest\x1a\x0f.metrics.Metric\x123\n" +
+	"\x04List\x12\x14.metrics.ListRequest\x1a\x15.metrics.ListResponse\x123\n" +
+	"\x04Ping\x12\x14.metrics.PingRequest\x1a\x15.metrics.PingResponse\x129\n" +
+	"\x06Delete\x12\x16.metrics.DeleteRequest\x1a\x17.metrics.DeleteResponse\x12I\n" +
+	"\x0eDeleteByPrefix\x12\x1e.metrics.DeleteByPrefixRequest\x1a\x17.metrics.DeleteResponse\x12=\n" +
+	"\fResetCounter\x12\x1c.metrics.ResetCounterRequest\x1a\x0f.metrics.MetricB\x10Z\x0einternal/protob\x06proto3"
 
 var (
 	file_internal_proto_metrics_proto_rawDescOnce sync.Once
@@ -218,21 +1108,59 @@ func file_internal_proto_metrics_proto_rawDescGZIP() []byte {
 }
 
 var file_internal_proto_metrics_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_internal_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_internal_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
 var file_internal_proto_metrics_proto_goTypes = []any{
-	(Metric_Type)(0),       // 0: metrics.Metric.Type
-	(*Metric)(nil),         // 1: metrics.Metric
-	(*MetricResponse)(nil), // 2: metrics.MetricResponse
+	(Metric_Type)(0),              // 0: metrics.Metric.Type
+	(*Metric)(nil),                // 1: metrics.Metric
+	(*Histogram)(nil),             // 2: metrics.Histogram
+	(*Sketch)(nil),                // 3: metrics.Sketch
+	(*SketchStore)(nil),           // 4: metrics.SketchStore
+	(*TimerSummary)(nil),          // 5: metrics.TimerSummary
+	(*WatchRequest)(nil),          // 6: metrics.WatchRequest
+	(*GetRequest)(nil),            // 7: metrics.GetRequest
+	(*ListRequest)(nil),           // 8: metrics.ListRequest
+	(*ListResponse)(nil),          // 9: metrics.ListResponse
+	(*PingRequest)(nil),           // 10: metrics.PingRequest
+	(*PingResponse)(nil),          // 11: metrics.PingResponse
+	(*DeleteRequest)(nil),         // 12: metrics.DeleteRequest
+	(*DeleteByPrefixRequest)(nil), // 13: metrics.DeleteByPrefixRequest
+	(*DeleteResponse)(nil),        // 14: metrics.DeleteResponse
+	(*ResetCounterRequest)(nil),   // 15: metrics.ResetCounterRequest
+	(*MetricResponse)(nil),        // 16: metrics.MetricResponse
 }
 var file_internal_proto_metrics_proto_depIdxs = []int32{
-	0, // 0: metrics.Metric.type:type_name -> metrics.Metric.Type
-	1, // 1: metrics.MetricService.Update:input_type -> metrics.Metric
-	2, // 2: metrics.MetricService.Update:output_type -> metrics.MetricResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	0,  // 0: metrics.Metric.type:type_name -> metrics.Metric.Type
+	2,  // 1: metrics.Metric.histogram:type_name -> metrics.Histogram
+	5,  // 2: metrics.Metric.summary:type_name -> metrics.TimerSummary
+	3,  // 3: metrics.Metric.sketch:type_name -> metrics.Sketch
+	4,  // 4: metrics.Sketch.positive:type_name -> metrics.SketchStore
+	4,  // 5: metrics.Sketch.negative:type_name -> metrics.SketchStore
+	0,  // 6: metrics.WatchRequest.types:type_name -> metrics.Metric.Type
+	0,  // 7: metrics.GetRequest.type:type_name -> metrics.Metric.Type
+	0,  // 8: metrics.ListRequest.types:type_name -> metrics.Metric.Type
+	1,  // 9: metrics.ListResponse.metrics:type_name -> metrics.Metric
+	0,  // 10: metrics.DeleteRequest.type:type_name -> metrics.Metric.Type
+	1,  // 11: metrics.MetricService.Update:input_type -> metrics.Metric
+	6,  // 12: metrics.MetricService.Watch:input_type -> metrics.WatchRequest
+	7,  // 13: metrics.MetricService.Get:input_type -> metrics.GetRequest
+	8,  // 14: metrics.MetricService.List:input_type -> metrics.ListRequest
+	10, // 15: metrics.MetricService.Ping:input_type -> metrics.PingRequest
+	12, // 16: metrics.MetricService.Delete:input_type -> metrics.DeleteRequest
+	13, // 17: metrics.MetricService.DeleteByPrefix:input_type -> metrics.DeleteByPrefixRequest
+	15, // 18: metrics.MetricService.ResetCounter:input_type -> metrics.ResetCounterRequest
+	16, // 19: metrics.MetricService.Update:output_type -> metrics.MetricResponse
+	1,  // 20: metrics.MetricService.Watch:output_type -> metrics.Metric
+	1,  // 21: metrics.MetricService.Get:output_type -> metrics.Metric
+	9,  // 22: metrics.MetricService.List:output_type -> metrics.ListResponse
+	11, // 23: metrics.MetricService.Ping:output_type -> metrics.PingResponse
+	14, // 24: metrics.MetricService.Delete:output_type -> metrics.DeleteResponse
+	14, // 25: metrics.MetricService.DeleteByPrefix:output_type -> metrics.DeleteResponse
+	1,  // 26: metrics.MetricService.ResetCounter:output_type -> metrics.Metric
+	19, // [19:27] is the sub-list for method output_type
+	11, // [11:19] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_internal_proto_metrics_proto_init() }
@@ -246,7 +1174,7 @@ func file_internal_proto_metrics_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_proto_metrics_proto_rawDesc), len(file_internal_proto_metrics_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   2,
+			NumMessages:   16,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
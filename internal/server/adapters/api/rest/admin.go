@@ -0,0 +1,79 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// deleteResponse is the body answering DELETE /api/v1/metrics.
+type deleteResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+// DeleteMetric handles DELETE requests to remove a series.
+func (h *Handler) DeleteMetric(w http.ResponseWriter, req *http.Request) {
+	mType, mName := chi.URLParam(req, metricType), chi.URLParam(req, metricName)
+	if err := h.metricService.DeleteMetric(req.Context(), mType, mName); err != nil {
+		if errors.Is(err, domain.ErrItemNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("failed to delete metric",
+			zap.String(metricType, mType),
+			zap.String(metricName, mName),
+			zap.Error(err),
+		)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("metric deleted", zap.String(metricType, mType), zap.String(metricName, mName))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteByPrefix handles DELETE requests to remove the series whose ID starts with the prefix query
+// parameter, which is required.
+func (h *Handler) DeleteByPrefix(w http.ResponseWriter, req *http.Request) {
+	prefix := req.URL.Query().Get("prefix")
+	deleted, err := h.metricService.DeleteByPrefix(req.Context(), prefix)
+	if err != nil {
+		if errors.Is(err, domain.ErrEmptyPrefix) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Error("failed to delete metrics", zap.String("prefix", prefix), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("metrics deleted", zap.String("prefix", prefix), zap.Int("deleted", deleted))
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(deleteResponse{Deleted: deleted}); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
+
+// ResetCounter handles POST requests to set the total of a counter to zero, answering with the counter.
+func (h *Handler) ResetCounter(w http.ResponseWriter, req *http.Request) {
+	mName := chi.URLParam(req, metricName)
+	metric, err := h.metricService.ResetCounter(req.Context(), mName)
+	if err != nil {
+		if errors.Is(err, domain.ErrItemNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("failed to reset counter", zap.String(metricName, mName), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("counter reset", zap.String(metricName, mName))
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(metric); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
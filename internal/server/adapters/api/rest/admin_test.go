@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_AdminMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "disabled", header: "Bearer secret", want: http.StatusForbidden},
+		{name: "missing", token: "secret", want: http.StatusUnauthorized},
+		{name: "wrong", token: "secret", header: "Bearer public", want: http.StatusUnauthorized},
+		{name: "not bearer", token: "secret", header: "secret", want: http.StatusUnauthorized},
+		{name: "valid", token: "secret", header: "Bearer secret", want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			h.Reload(&config.Config{AdminToken: tt.token})
+			r := httptest.NewRequest(http.MethodDelete, "/api/v1/metrics?prefix=a", http.NoBody)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.AdminMiddleware(next).ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestHandler_Admin(t *testing.T) {
+	metricService := newTestService(t)
+	_, err := metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Gauge("HeapAlloc", 1),
+		storagetest.Gauge("HeapInuse", 2),
+		storagetest.Counter("PollCount", 3),
+	})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+	r := chi.NewRouter()
+	r.Delete("/api/v1/metrics", h.DeleteByPrefix)
+	r.Delete("/api/v1/metrics/{metricType}/{metricName}", h.DeleteMetric)
+	r.Post("/api/v1/metrics/counter/{metricName}/reset", h.ResetCounter)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, http.NoBody))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/metrics/gauge/HeapInuse").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/metrics/gauge/HeapInuse").Code)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodDelete, "/api/v1/metrics").Code)
+	w := do(http.MethodDelete, "/api/v1/metrics?prefix=Heap")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"deleted":1}`, w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/v1/metrics/counter/Missing/reset").Code)
+	w = do(http.MethodPost, "/api/v1/metrics/counter/PollCount/reset")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var m domain.Metric
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&m))
+	assert.Equal(t, int64(0), *m.Delta)
+
+	metrics, err := metricService.GetAllMetrics(context.Background())
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "PollCount", metrics[0].ID)
+}
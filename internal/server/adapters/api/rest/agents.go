@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-http-utils/headers"
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/agentinfo"
+)
+
+// agentIdentity reads the identity an agent sends along with its metrics.
+func agentIdentity(req *http.Request) domain.AgentIdentity {
+	return domain.AgentIdentity{
+		Address:  req.Header.Get(headers.XRealIP),
+		Hostname: req.Header.Get(agentinfo.HeaderHostname),
+		Version:  req.Header.Get(agentinfo.HeaderVersion),
+		Config:   agentinfo.ParseConfig(req.Header.Get(agentinfo.HeaderConfig)),
+	}
+}
+
+// ListAgents handles GET requests for the inventory of the agents which reported metrics. With down=true
+// only the agents which missed several reports are listed.
+func (h *Handler) ListAgents(w http.ResponseWriter, req *http.Request) {
+	onlyDown := false
+	if s := req.URL.Query().Get("down"); s != "" {
+		var err error
+		if onlyDown, err = strconv.ParseBool(s); err != nil {
+			http.Error(w, "incorrect down parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	agents := make([]domain.Agent, 0)
+	for _, a := range h.metricService.Agents() {
+		if !onlyDown || a.Down {
+			agents = append(agents, a)
+		}
+	}
+	w.Header().Set(contentType, "application/json")
+	if err := json.NewEncoder(w).Encode(agents); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/agentinfo"
+)
+
+func TestHandler_ListAgents(t *testing.T) {
+	h := Handler{metricService: newTestService(t)}
+	post := func(body string, header map[string]string) {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.SetMetrics(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	post(`[{"id":"Alloc","type":"gauge","value":1},{"id":"PollCount","type":"counter","delta":1}]`, map[string]string{
+		headers.XRealIP:          "10.0.0.1",
+		agentinfo.HeaderHostname: "web1",
+		agentinfo.HeaderVersion:  "1.2.0",
+		agentinfo.HeaderConfig:   "report_interval=10&grpc=false",
+	})
+	post(`[{"id":"Alloc","type":"gauge","value":1}]`, nil)
+
+	w := httptest.NewRecorder()
+	h.ListAgents(w, httptest.NewRequest(http.MethodGet, "/api/v1/agents", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	var agents []domain.Agent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &agents))
+	require.Len(t, agents, 1, "writes without an identity aren't agents")
+	assert.Equal(t, "web1", agents[0].ID)
+	assert.Equal(t, "10.0.0.1", agents[0].Address)
+	assert.Equal(t, "1.2.0", agents[0].Version)
+	assert.Equal(t, map[string]string{"report_interval": "10", "grpc": "false"}, agents[0].Config)
+	assert.Equal(t, 2, agents[0].MetricsPerMinute)
+	assert.False(t, agents[0].Down)
+
+	w = httptest.NewRecorder()
+	h.ListAgents(w, httptest.NewRequest(http.MethodGet, "/api/v1/agents?down=true", http.NoBody))
+	assert.JSONEq(t, `[]`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ListAgents(w, httptest.NewRequest(http.MethodGet, "/api/v1/agents?down=maybe", http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// alertName is the URL parameter naming an alert rule.
+const alertName = "alertName"
+
+// ListAlerts handles GET requests to evaluate the alert rules, listing each with the series it fires for.
+func (h *Handler) ListAlerts(w http.ResponseWriter, req *http.Request) {
+	alerts, err := h.metricService.Alerts(req.Context())
+	if err != nil {
+		logger.Log.Error("failed to evaluate alert rules", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(alerts); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
+
+// SetAlertRule handles PUT requests to create or replace the alert rule named in the URL, the rule in the
+// body naming the same one or none.
+func (h *Handler) SetAlertRule(w http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, alertName)
+	var rule domain.AlertRule
+	if err := json.NewDecoder(req.Body).Decode(&rule); err != nil {
+		logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if rule.Name != "" && rule.Name != name {
+		http.Error(w, "rule name doesn't match the URL", http.StatusBadRequest)
+		return
+	}
+	rule.Name = name
+	if err := h.metricService.SetAlertRule(req.Context(), rule); err != nil {
+		if errors.Is(err, domain.ErrIncorrectAlertRule) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Error("failed to set alert rule", zap.String(alertName, name), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("alert rule set", zap.String(alertName, name))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAlertRule handles DELETE requests to remove an alert rule.
+func (h *Handler) DeleteAlertRule(w http.ResponseWriter, req *http.Request) {
+	name := chi.URLParam(req, alertName)
+	if err := h.metricService.DeleteAlertRule(req.Context(), name); err != nil {
+		if errors.Is(err, domain.ErrItemNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("failed to delete alert rule", zap.String(alertName, name), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Info("alert rule deleted", zap.String(alertName, name))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+)
+
+func TestHandler_Alerts(t *testing.T) {
+	metricService := newTestService(t)
+	_, err := metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Gauge(`load{host="a"}`, 3), storagetest.Gauge(`load{host="b"}`, 1),
+	})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+	r := chi.NewRouter()
+	r.Get("/api/v1/alerts", h.ListAlerts)
+	r.Put("/api/v1/alerts/{alertName}", h.SetAlertRule)
+	r.Delete("/api/v1/alerts/{alertName}", h.DeleteAlertRule)
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNoContent,
+		do(http.MethodPut, "/api/v1/alerts/high-load", `{"query": "load", "op": ">", "threshold": 2}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(http.MethodPut, "/api/v1/alerts/high-load", `{"name": "other", "query": "load", "op": ">"}`).Code)
+	assert.Equal(t, http.StatusBadRequest,
+		do(http.MethodPut, "/api/v1/alerts/bad", `{"query": "sum(", "op": ">"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/api/v1/alerts/bad", `{`).Code)
+
+	w := do(http.MethodGet, "/api/v1/alerts", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var alerts []domain.Alert
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&alerts))
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "high-load", alerts[0].Name)
+	assert.Equal(t, []domain.AlertSeries{{Name: "load", Labels: map[string]string{"host": "a"}, Value: 3}},
+		alerts[0].Firing)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/alerts/high-load", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/alerts/high-load", "").Code)
+	w = do(http.MethodGet, "/api/v1/alerts", "")
+	assert.JSONEq(t, `[]`, w.Body.String())
+}
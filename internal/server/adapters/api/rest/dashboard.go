@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"bytes"
+	"cmp"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// defaultGroupLabel is the label the dashboard groups series by, the host label agents may be set to add.
+const defaultGroupLabel = "host"
+
+//go:embed web
+var web embed.FS
+
+var (
+	dashboard = template.Must(template.ParseFS(web, "web/templates/dashboard.html"))
+	static    = mustSub(web, "web/static")
+)
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// dashboardRow is a series of the dashboard table.
+type dashboardRow struct {
+	ID          string
+	Name        string
+	Type        string
+	Value       string
+	Unit        string
+	Description string
+	Chart       bool // gauges and counters have a history to chart
+	Stale       bool // the series wasn't written for the stale TTL
+}
+
+// dashboardGroup is the series sharing a value of the group label.
+type dashboardGroup struct {
+	Name   string
+	Rows   []dashboardRow
+	Silent bool // every series is stale, the agent stopped reporting
+}
+
+type dashboardPage struct {
+	GroupBy string
+	Groups  []dashboardGroup
+}
+
+// GetAllMetrics handles GET requests to the dashboard. It lists the metrics grouped by the label given as
+// the group query parameter, host by default, and charts their history with the scripts under /static/.
+func (h *Handler) GetAllMetrics(w http.ResponseWriter, req *http.Request) {
+	metrics, err := h.metricService.GetAllMetrics(req.Context())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Log.Error("failed to get all metrics", zap.Error(err))
+		return
+	}
+	groupBy := cmp.Or(req.URL.Query().Get("group"), defaultGroupLabel)
+	page := dashboardPage{
+		GroupBy: groupBy,
+		Groups:  groupRows(metrics, metadataByName(h.metricService.GetMetadata(req.Context())), groupBy),
+	}
+	var buf bytes.Buffer
+	if err = dashboard.Execute(&buf, page); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Log.Error("failed to render dashboard", zap.Error(err))
+		return
+	}
+	w.Header().Set(contentType, "text/html")
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		logger.Log.Error("error writing response", zap.Error(err))
+	}
+}
+
+// groupRows builds the rows of the metrics with a value, grouped by a label and sorted by ID. Series
+// without the label come first in an unnamed group.
+func groupRows(metrics domain.MetricsList, metadata map[string]domain.Metadata, label string) []dashboardGroup {
+	groups := make(map[string][]dashboardRow)
+	for _, m := range metrics {
+		value := formatValue(&m)
+		if value == "" {
+			continue
+		}
+		name, labels, err := domain.ParseSeriesID(m.ID)
+		if err != nil {
+			name, labels = m.ID, nil
+		}
+		md := metadata[name]
+		groups[labels[label]] = append(groups[labels[label]], dashboardRow{
+			ID:          m.ID,
+			Name:        name,
+			Type:        m.MType,
+			Value:       value,
+			Unit:        md.Unit,
+			Description: md.Description,
+			Chart:       m.MType == domain.Gauge || m.MType == domain.Counter,
+			Stale:       m.Stale,
+		})
+	}
+	result := make([]dashboardGroup, 0, len(groups))
+	for name, rows := range groups {
+		slices.SortFunc(rows, func(a, b dashboardRow) int {
+			return cmp.Or(strings.Compare(a.ID, b.ID), strings.Compare(a.Type, b.Type))
+		})
+		silent := !slices.ContainsFunc(rows, func(r dashboardRow) bool { return !r.Stale })
+		result = append(result, dashboardGroup{Name: name, Rows: rows, Silent: silent})
+	}
+	slices.SortFunc(result, func(a, b dashboardGroup) int { return strings.Compare(a.Name, b.Name) })
+	return result
+}
+
+// formatValue describes the value of a metric, empty if it has none.
+func formatValue(m *domain.Metric) string {
+	switch m.MType {
+	case domain.Gauge:
+		if m.Value != nil {
+			return fmt.Sprintf("%v", *m.Value)
+		}
+	case domain.Counter:
+		if m.Delta != nil {
+			if m.Rate != nil {
+				return fmt.Sprintf("%v (%.3g/s)", *m.Delta, *m.Rate)
+			}
+			return fmt.Sprintf("%v", *m.Delta)
+		}
+	case domain.Histogram:
+		if m.Histogram != nil {
+			return fmt.Sprintf("count %v, sum %v", m.Histogram.Count, m.Histogram.Sum)
+		}
+	case domain.Timer:
+		if m.Sketch != nil {
+			s := domain.Summarize(m.Sketch)
+			return fmt.Sprintf("count %v, p50 %.3g, p90 %.3g, p99 %.3g, max %.3g", s.Count, s.P50, s.P90, s.P99, s.Max)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_GetAllMetricsDashboard(t *testing.T) {
+	metricService := newTestService(t)
+	_, err := metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Gauge(`Alloc{host="web1"}`, 1),
+		storagetest.Gauge(`Alloc{host="web2"}`, 2),
+		storagetest.Counter("<script>alert(1)</script>", 3),
+	})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+
+	w := httptest.NewRecorder()
+	h.GetAllMetrics(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.NotContains(t, body, "<script>alert(1)</script>")
+	assert.Contains(t, body, `<td class="name">&lt;script&gt;alert(1)&lt;/script&gt;</td>`)
+	assert.Contains(t, body, "no host")
+	assert.Contains(t, body, "host: web1")
+	assert.Contains(t, body, "host: web2")
+	assert.Contains(t, body, `data-name="Alloc"`)
+
+	w = httptest.NewRecorder()
+	h.GetAllMetrics(w, httptest.NewRequest(http.MethodGet, "/?group=dc", http.NoBody))
+	assert.Contains(t, w.Body.String(), "no dc")
+	assert.NotContains(t, w.Body.String(), "host: web1")
+}
+
+func TestDashboardStatic(t *testing.T) {
+	srv := httptest.NewServer(http.StripPrefix("/static/", http.FileServerFS(static)))
+	defer srv.Close()
+	for _, name := range []string{"dashboard.js", "dashboard.css"} {
+		resp, err := http.Get(srv.URL + "/static/" + name)
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusOK, resp.StatusCode, name)
+	}
+}
+
+func TestHandler_GetHistory(t *testing.T) {
+	metricService := newTestService(t)
+	_, err := metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Gauge(`Alloc{host="web1"}`, 1),
+	})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.GetHistory(w, httptest.NewRequest(http.MethodGet, "/api/v1/history?"+query, http.NoBody))
+		return w
+	}
+
+	w := get("name=Alloc&range=5m")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var series []domain.Series
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&series))
+	require.Len(t, series, 1)
+	assert.Equal(t, `Alloc{host="web1"}`, series[0].ID)
+	require.Len(t, series[0].Samples, 1)
+	assert.InDelta(t, 1, series[0].Samples[0].Value, 0)
+
+	for _, query := range []string{"", "name=Alloc&range=-1m", "name=Alloc&from=yesterday",
+		"name=Alloc&from=2024-01-02T00:00:00Z&to=2024-01-01T00:00:00Z"} {
+		assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+	}
+}
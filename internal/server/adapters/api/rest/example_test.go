@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 
 	"metrics/internal/server/adapters/storage/memory"
 	"metrics/internal/server/config"
@@ -61,11 +62,18 @@ func Example_getAllMetricsHandler_ServeHTTP() {
 		fmt.Println("error!: %w", err)
 		return
 	}
-	fmt.Fprintln(os.Stdout, []any{string(b)}...)
+	// The dashboard lists every metric as a table row.
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, `<td class="name">`) || strings.HasPrefix(line, `<td class="value">`) {
+			fmt.Fprintln(os.Stdout, line)
+		}
+	}
 
 	// Output:
 	// 200
-	// <html><body><ul><li>mType: gauge, mName: Alloc, Value 42</ul></body></html>
+	// <td class="name">Alloc</td>
+	// <td class="value">42</td>
 }
 
 func Example_getMetricHandler_ServeHTTP() {
@@ -110,9 +118,15 @@ func Example_getMetricHandler_ServeHTTP() {
 		fmt.Println("error!: %w", err)
 		return
 	}
-	fmt.Fprintln(os.Stdout, []any{string(b)}...)
+	// The update time differs on every run, so the fields are printed instead of the body.
+	var got domain.Metric
+	if err = json.Unmarshal(b, &got); err != nil {
+		fmt.Println("error!: %w", err)
+		return
+	}
+	fmt.Fprintln(os.Stdout, got.ID, got.MType, *got.Value, got.Updated != nil)
 
 	// Output:
 	// 200
-	// {"id":"Alloc","type":"gauge","value":42}
+	// Alloc gauge 42 true
 }
@@ -0,0 +1,200 @@
+package rest
+
+import (
+	"cmp"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// expositionContentType is the Prometheus text exposition format.
+const expositionContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family is the set of series exposed under one metric name.
+type family struct {
+	name    string
+	mType   string
+	help    string
+	metrics []domain.Metric
+}
+
+// GetPrometheusMetrics handles GET requests to expose all metrics in the Prometheus text format.
+func (h *Handler) GetPrometheusMetrics(w http.ResponseWriter, req *http.Request) {
+	metrics, err := h.metricService.GetAllMetrics(req.Context())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		logger.Log.Error("failed to get all metrics", zap.Error(err))
+		return
+	}
+	var b strings.Builder
+	for _, f := range families(metrics, metadataByName(h.metricService.GetMetadata(req.Context()))) {
+		writeFamily(&b, f)
+	}
+	w.Header().Set(contentType, expositionContentType)
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		logger.Log.Info("failed to write metrics", zap.Error(err))
+	}
+}
+
+// families groups metrics by sanitized name. A name stored with several types, which only data written
+// before types were registered can have, would make an invalid exposition, so each of its families gets
+// the type as a suffix.
+func families(metrics domain.MetricsList, metadata map[string]domain.Metadata) []family {
+	byKey := make(map[domain.Key]*family)
+	types := make(map[string][]string)
+	for _, m := range metrics {
+		name, _, err := domain.ParseSeriesID(m.ID)
+		if err != nil {
+			continue
+		}
+		key := domain.Key{MType: m.MType, ID: sanitizeName(name)}
+		f, found := byKey[key]
+		if !found {
+			f = &family{name: key.ID, mType: m.MType, help: help(metadata[name])}
+			byKey[key] = f
+			types[key.ID] = append(types[key.ID], m.MType)
+		}
+		f.metrics = append(f.metrics, m)
+	}
+	result := make([]family, 0, len(byKey))
+	for _, f := range byKey {
+		if len(types[f.name]) > 1 {
+			f.name += "_" + f.mType
+		}
+		slices.SortFunc(f.metrics, func(a, b domain.Metric) int { return cmp.Compare(a.ID, b.ID) })
+		result = append(result, *f)
+	}
+	slices.SortFunc(result, func(a, b family) int { return cmp.Compare(a.name, b.name) })
+	return result
+}
+
+// writeFamily writes the samples of a family, timers being exposed as summaries of their sketch.
+func writeFamily(b *strings.Builder, f family) {
+	mType := f.mType
+	if mType == domain.Timer {
+		mType = "summary"
+	}
+	if f.help != "" {
+		b.WriteString("# HELP " + f.name + " " + helpEscaper.Replace(f.help) + "\n")
+	}
+	b.WriteString("# TYPE " + f.name + " " + mType + "\n")
+	for _, m := range f.metrics {
+		_, labels, _ := domain.ParseSeriesID(m.ID)
+		switch m.MType {
+		case domain.Gauge:
+			writeSample(b, f.name, labels, "", "", formatFloat(*m.Value))
+		case domain.Counter:
+			writeSample(b, f.name, labels, "", "", strconv.FormatInt(*m.Delta, 10))
+		case domain.Histogram:
+			var cumulative uint64
+			for i, bound := range m.Histogram.Bounds {
+				cumulative += m.Histogram.Counts[i]
+				writeSample(b, f.name+"_bucket", labels, "le", formatFloat(bound), strconv.FormatUint(cumulative, 10))
+			}
+			count := strconv.FormatUint(m.Histogram.Count, 10)
+			writeSample(b, f.name+"_bucket", labels, "le", "+Inf", count)
+			writeSample(b, f.name+"_sum", labels, "", "", formatFloat(m.Histogram.Sum))
+			writeSample(b, f.name+"_count", labels, "", "", count)
+		case domain.Timer:
+			s := domain.Summarize(m.Sketch)
+			for _, q := range []struct {
+				quantile string
+				value    float64
+			}{{"0.5", s.P50}, {"0.9", s.P90}, {"0.99", s.P99}, {"1", s.Max}} {
+				writeSample(b, f.name, labels, "quantile", q.quantile, formatFloat(q.value))
+			}
+			writeSample(b, f.name+"_sum", labels, "", "", formatFloat(s.Sum))
+			writeSample(b, f.name+"_count", labels, "", "", strconv.FormatUint(s.Count, 10))
+		}
+	}
+}
+
+// writeSample writes one sample line, extra is an additional label such as the le of a bucket.
+func writeSample(b *strings.Builder, name string, labels map[string]string, extra, extraValue, value string) {
+	b.WriteString(name)
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	if len(names) > 0 || extra != "" {
+		b.WriteByte('{')
+		for i, k := range names {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeLabel(b, sanitizeLabel(k), labels[k])
+		}
+		if extra != "" {
+			if len(names) > 0 {
+				b.WriteByte(',')
+			}
+			writeLabel(b, extra, extraValue)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteString(" " + value + "\n")
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// help builds the HELP text of a metric from its description and unit.
+func help(md domain.Metadata) string {
+	if md.Unit == "" {
+		return md.Description
+	}
+	return strings.TrimSpace(md.Description + " (unit: " + md.Unit + ")")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(b *strings.Builder, name, value string) {
+	b.WriteString(name + `="` + labelValueEscaper.Replace(value) + `"`)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// sanitizeName replaces the characters Prometheus doesn't allow in metric names with underscores.
+func sanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// sanitizeLabel replaces the characters Prometheus doesn't allow in label names with underscores.
+func sanitizeLabel(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, colons bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' ||
+			i > 0 && r >= '0' && r <= '9' || colons && r == ':'
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestService(t *testing.T, opts ...service.Option) *service.MetricService {
+	t.Helper()
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage, opts...)
+	require.NoError(t, err)
+	return metricService
+}
+
+func TestHandler_GetPrometheusMetrics(t *testing.T) {
+	metricService := newTestService(t)
+	err := metricService.RegisterMetadata(context.Background(), []domain.Metadata{
+		{Name: "temperature", Unit: "celsius", Description: "Room temperature"},
+		{Name: "latency", Unit: "seconds"},
+	})
+	require.NoError(t, err)
+	_, err = metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Gauge(`temperature{room="kitchen \"A\""}`, 21.5),
+		storagetest.Counter(`http.requests{code="200"}`, 3),
+		storagetest.Histogram("latency", []float64{0.1, 1}, []uint64{2, 1, 1}, 3.5),
+		storagetest.Timer("rt", 5),
+	})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	h := Handler{metricService: metricService}
+	h.GetPrometheusMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", http.NoBody))
+	result := w.Result()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, result.Body.Close())
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, expositionContentType, result.Header.Get("Content-Type"))
+	assert.Equal(t, `# TYPE http_requests counter
+http_requests{code="200"} 3
+# HELP latency (unit: seconds)
+# TYPE latency histogram
+latency_bucket{le="0.1"} 2
+latency_bucket{le="1"} 3
+latency_bucket{le="+Inf"} 4
+latency_sum 3.5
+latency_count 4
+# TYPE rt summary
+rt{quantile="0.5"} 5
+rt{quantile="0.9"} 5
+rt{quantile="0.99"} 5
+rt{quantile="1"} 5
+rt_sum 5
+rt_count 1
+# HELP temperature Room temperature (unit: celsius)
+# TYPE temperature gauge
+temperature{room="kitchen \"A\""} 21.5
+`, string(body))
+}
+
+func TestFamiliesTypeSuffix(t *testing.T) {
+	got := families(domain.MetricsList{
+		storagetest.Gauge("mixed", 1),
+		storagetest.Counter("mixed", 2),
+		storagetest.Gauge("plain", 3),
+	}, nil)
+
+	require.Len(t, got, 3)
+	assert.Equal(t, "mixed_counter", got[0].name)
+	assert.Equal(t, "mixed_gauge", got[1].name)
+	assert.Equal(t, "plain", got[2].name)
+}
+
+func TestHandler_SetMetricsHistogramMismatch(t *testing.T) {
+	metricService := newTestService(t)
+	h := Handler{metricService: metricService}
+	post := func(body string) int {
+		w := httptest.NewRecorder()
+		h.SetMetrics(w, httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewBufferString(body)))
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		return result.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK,
+		post(`[{"id":"h","type":"histogram","histogram":{"bounds":[1],"counts":[1,0],"sum":0.5,"count":1}}]`))
+	assert.Equal(t, http.StatusConflict,
+		post(`[{"id":"h","type":"histogram","histogram":{"bounds":[2],"counts":[1,0],"sum":0.5,"count":1}}]`))
+	assert.Equal(t, http.StatusBadRequest,
+		post(`[{"id":"h","type":"histogram","histogram":{"bounds":[1],"counts":[1],"sum":0.5,"count":1}}]`))
+}
@@ -10,8 +10,12 @@ func handleSetMetricError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, domain.ErrItemNotFound):
 		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, domain.ErrTypeConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
 	case errors.Is(err, domain.ErrIncorrectMetricType) || errors.Is(err, domain.ErrIncorrectMetricValue):
 		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, domain.ErrHistogramMismatch) || errors.Is(err, domain.ErrTimerMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
 	default:
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
@@ -24,3 +28,12 @@ func handleGetMetricError(w http.ResponseWriter, err error) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 }
+
+// metadataByName indexes metadata by metric name.
+func metadataByName(list []domain.Metadata) map[string]domain.Metadata {
+	metadata := make(map[string]domain.Metadata, len(list))
+	for _, md := range list {
+		metadata[md.Name] = md
+	}
+	return metadata
+}
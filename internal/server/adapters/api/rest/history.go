@@ -0,0 +1,70 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/logger"
+)
+
+// defaultHistoryRange is how far back the history goes when from isn't given.
+const defaultHistoryRange = time.Hour
+
+var errIncorrectHistoryRequest = errors.New("incorrect history request")
+
+// GetHistory handles GET requests for the samples of the gauge and counter series of a metric name. The
+// query parameters are name, from and to as RFC 3339 times, to defaulting to now, and range as a duration
+// before to used when from isn't given, an hour by default.
+func (h *Handler) GetHistory(w http.ResponseWriter, req *http.Request) {
+	name, from, to, err := parseHistoryRequest(req.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := h.metricService.GetHistory(req.Context(), name, from, to)
+	if err != nil {
+		logger.Log.Error("failed to get history", zap.String(metricName, name), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(series); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
+
+func parseHistoryRequest(q url.Values, now time.Time) (name string, from, to time.Time, err error) {
+	name = q.Get("name")
+	if name == "" {
+		return "", from, to, fmt.Errorf("%w: name is required", errIncorrectHistoryRequest)
+	}
+	to = now
+	if s := q.Get("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			return "", from, to, fmt.Errorf("%w: to: %w", errIncorrectHistoryRequest, err)
+		}
+	}
+	if s := q.Get("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			return "", from, to, fmt.Errorf("%w: from: %w", errIncorrectHistoryRequest, err)
+		}
+	} else {
+		d := defaultHistoryRange
+		if s := q.Get("range"); s != "" {
+			if d, err = time.ParseDuration(s); err != nil || d <= 0 {
+				return "", from, to, fmt.Errorf("%w: range %q", errIncorrectHistoryRequest, s)
+			}
+		}
+		from = to.Add(-d)
+	}
+	if from.After(to) {
+		return "", from, to, fmt.Errorf("%w: from is after to", errIncorrectHistoryRequest)
+	}
+	return name, from, to, nil
+}
@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// ListMetrics handles GET requests to list metrics as JSON. The query parameters are:
+//
+//	type    a metric type, repeated or comma separated for several
+//	prefix  a prefix of the series ID
+//	match   a regular expression searched in the metric name
+//	label   a k=v pair the series must have as a label, may be repeated
+//	sort    name or type, name by default
+//	order   asc or desc, asc by default
+//	limit   the page size, 100 by default and at most 1000
+//	cursor  the next cursor of the previous page
+func (h *Handler) ListMetrics(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseListFilter(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.metricService.ListMetrics(req.Context(), *filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrIncorrectFilter) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Error("failed to list metrics", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(page); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
+
+func parseListFilter(q url.Values) (*domain.ListFilter, error) {
+	filter := &domain.ListFilter{
+		Prefix: q.Get("prefix"),
+		Sort:   q.Get("sort"),
+		Limit:  defaultPageSize,
+	}
+	for _, types := range q["type"] {
+		filter.Types = append(filter.Types, strings.Split(types, ",")...)
+	}
+	if match := q.Get("match"); match != "" {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return nil, fmt.Errorf("%w: match: %w", domain.ErrIncorrectFilter, err)
+		}
+		filter.Match = re
+	}
+	for _, label := range q["label"] {
+		k, v, found := strings.Cut(label, "=")
+		if !found || k == "" {
+			return nil, fmt.Errorf("%w: label %q isn't k=v", domain.ErrIncorrectFilter, label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[k] = v
+	}
+	switch order := q.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return nil, fmt.Errorf("%w: order %q", domain.ErrIncorrectFilter, order)
+	}
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 || n > maxPageSize {
+			return nil, fmt.Errorf("%w: limit must be between 1 and %d", domain.ErrIncorrectFilter, maxPageSize)
+		}
+		filter.Limit = n
+	}
+	if cursor := q.Get("cursor"); cursor != "" {
+		after, err := domain.DecodeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		filter.After = after
+	}
+	return filter, nil
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ListMetrics(t *testing.T) {
+	metricService := newTestService(t)
+	_, err := metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Counter(`PollCount{host="a"}`, 2),
+		storagetest.Counter(`PollCount{host="b"}`, 3),
+		storagetest.Gauge("Alloc", 1),
+		storagetest.Gauge("HeapAlloc", 1),
+	})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+	list := func(query url.Values) (*http.Response, domain.MetricsPage) {
+		w := httptest.NewRecorder()
+		h.ListMetrics(w, httptest.NewRequest(http.MethodGet, "/api/v1/metrics?"+query.Encode(), http.NoBody))
+		resp := w.Result()
+		var page domain.MetricsPage
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		}
+		require.NoError(t, resp.Body.Close())
+		return resp, page
+	}
+	ids := func(page domain.MetricsPage) []string {
+		result := make([]string, 0, len(page.Metrics))
+		for _, m := range page.Metrics {
+			result = append(result, m.ID)
+		}
+		return result
+	}
+
+	resp, page := list(url.Values{"type": {domain.Gauge}, "order": {"desc"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get(contentType))
+	assert.Equal(t, []string{"HeapAlloc", "Alloc"}, ids(page))
+
+	_, page = list(url.Values{"label": {"host=b"}})
+	assert.Equal(t, []string{`PollCount{host="b"}`}, ids(page))
+
+	_, page = list(url.Values{"match": {"^Heap"}})
+	assert.Equal(t, []string{"HeapAlloc"}, ids(page))
+
+	_, page = list(url.Values{"sort": {"type"}, "limit": {"3"}})
+	assert.Equal(t, []string{`PollCount{host="a"}`, `PollCount{host="b"}`, "Alloc"}, ids(page))
+	require.NotEmpty(t, page.Next)
+	_, page = list(url.Values{"sort": {"type"}, "limit": {"3"}, "cursor": {page.Next}})
+	assert.Equal(t, []string{"HeapAlloc"}, ids(page))
+	assert.Empty(t, page.Next)
+
+	for _, query := range []url.Values{
+		{"type": {"summary"}},
+		{"match": {"("}},
+		{"label": {"host"}},
+		{"sort": {"value"}},
+		{"order": {"up"}},
+		{"limit": {"0"}},
+		{"limit": {"1001"}},
+		{"cursor": {"!"}},
+	} {
+		resp, _ = list(query)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query.Encode())
+	}
+}
@@ -1,10 +1,12 @@
 package rest
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/subtle"
 	"fmt"
 	"io"
 	"net"
@@ -48,6 +50,21 @@ func (r *loggingResponseWriter) WriteHeader(statusCode int) {
 	r.responseData.status = statusCode
 }
 
+// Unwrap gives http.ResponseController access to the flushing of streams.
+func (r *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Hijack implements http.Hijacker for WebSocket upgrades.
+func (r *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w", err)
+	}
+	r.responseData.status = http.StatusSwitchingProtocols
+	return conn, rw, nil
+}
+
 // LoggingRequestMiddleware logs incoming HTTP requests.
 func (h *Handler) LoggingRequestMiddleware(next http.Handler) http.Handler {
 	logFn := func(w http.ResponseWriter, r *http.Request) {
@@ -127,13 +144,14 @@ func (h *Handler) CompressResponseMiddleware(next http.Handler) http.Handler {
 // WithHashMiddleware adds request hashing to the handler chain.
 func (h *Handler) WithHashMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get(hash.Header) != "" && h.config.Key != "" {
+		cfg := h.config.Load()
+		if r.Header.Get(hash.Header) != "" && cfg.Key != "" {
 			bodyBytes, err := io.ReadAll(r.Body)
 			if err != nil {
 				http.Error(w, "error reading request body", http.StatusInternalServerError)
 				return
 			}
-			if hash.Encode(bodyBytes, h.config.Key) != r.Header.Get(hash.Header) {
+			if hash.Encode(bodyBytes, cfg.Key) != r.Header.Get(hash.Header) {
 				http.Error(w, "incorrect hash", http.StatusBadRequest)
 				return
 			}
@@ -141,7 +159,7 @@ func (h *Handler) WithHashMiddleware(next http.Handler) http.Handler {
 		}
 		hw := &hash.Writer{
 			ResponseWriter: w,
-			Key:            h.config.Key,
+			Key:            cfg.Key,
 			RHash:          r.Header.Get(hash.Header),
 		}
 		next.ServeHTTP(hw, r)
@@ -151,8 +169,9 @@ func (h *Handler) WithHashMiddleware(next http.Handler) http.Handler {
 // DecryptMiddleware extracts request body, if headers contains Encrypted value crypto/rsa.
 func (h *Handler) DecryptMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.config.Load()
 		if r.Header.Get("Encrypted") == "crypto/rsa" {
-			if h.config.PrivateKey == nil {
+			if cfg.PrivateKey == nil {
 				http.Error(w, "private key is not defined", http.StatusInternalServerError)
 				return
 			}
@@ -160,7 +179,7 @@ func (h *Handler) DecryptMiddleware(next http.Handler) http.Handler {
 			if err != nil {
 				zap.L().Error(err.Error())
 			}
-			decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, h.config.PrivateKey, buf)
+			decrypted, err := rsa.DecryptPKCS1v15(rand.Reader, cfg.PrivateKey, buf)
 			if err != nil {
 				http.Error(w, "error during decrypt data", http.StatusBadRequest)
 				return
@@ -171,12 +190,32 @@ func (h *Handler) DecryptMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// AdminMiddleware lets through the requests bearing the admin token, the admin routes being disabled
+// when no token is configured.
+func (h *Handler) AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := h.config.Load()
+		if cfg.AdminToken == "" {
+			http.Error(w, "admin token is not configured", http.StatusForbidden)
+			return
+		}
+		token, found := strings.CutPrefix(r.Header.Get(headers.Authorization), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			w.Header().Set(headers.WWWAuthenticate, "Bearer")
+			http.Error(w, "invalid admin token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 // CIDRMiddleware Classless Inter-Domain Routing.
 func (h *Handler) CIDRMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if h.config.Subnet != nil {
+		cfg := h.config.Load()
+		if cfg.Subnet != nil {
 			agentIP := net.ParseIP(r.Header.Get(headers.XRealIP))
-			if agentIP == nil || !h.config.Subnet.Contains(agentIP) {
+			if agentIP == nil || !cfg.Subnet.Contains(agentIP) {
 				w.WriteHeader(http.StatusForbidden)
 				return
 			}
@@ -0,0 +1,35 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"metrics/internal/server/config"
+	"metrics/internal/shared-kernel/hash"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Reload(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := &Handler{}
+	h.Reload(&config.Config{Key: "old"})
+	mw := h.WithHashMiddleware(next)
+	send := func(key string) int {
+		body := `{"id":"Alloc","type":"gauge","value":1}`
+		r := httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(body))
+		r.Header.Set(hash.Header, hash.Encode([]byte(body), key))
+		w := httptest.NewRecorder()
+		mw.ServeHTTP(w, r)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, send("old"))
+
+	h.Reload(&config.Config{Key: "new"})
+	assert.Equal(t, http.StatusBadRequest, send("old"))
+	assert.Equal(t, http.StatusOK, send("new"))
+}
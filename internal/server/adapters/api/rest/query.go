@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/query"
+	"metrics/internal/server/logger"
+)
+
+// maxQueryBody bounds the body of POST /query, which holds a query of up to query.MaxLength bytes.
+const maxQueryBody = 4 * query.MaxLength
+
+// queryRequest is the body of POST /query.
+type queryRequest struct {
+	Query string `json:"query"`
+}
+
+// Query handles POST requests to evaluate a query, see package query for the language. Bodies larger
+// than maxQueryBody are refused.
+func (h *Handler) Query(w http.ResponseWriter, req *http.Request) {
+	var q queryRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxQueryBody)).Decode(&q); err != nil {
+		logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	result, err := h.metricService.Query(req.Context(), q.Query)
+	if err != nil {
+		if errors.Is(err, query.ErrSyntax) || errors.Is(err, query.ErrEvaluation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Log.Error("failed to evaluate query", zap.String("query", q.Query), zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,57 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/query"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_Query(t *testing.T) {
+	metricService := newTestService(t)
+	_, err := metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Counter(`PollCount{host="a"}`, 2),
+		storagetest.Counter(`PollCount{host="b"}`, 3),
+	})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+	post := func(body string) *http.Response {
+		w := httptest.NewRecorder()
+		h.Query(w, httptest.NewRequest(http.MethodPost, "/query", bytes.NewBufferString(body)))
+		return w.Result()
+	}
+
+	resp := post(`{"query":"sum(PollCount) * 2"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var result query.Result
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, query.Result{
+		Type:   query.TypeVector,
+		Vector: []query.Element{{Labels: map[string]string{}, Value: 10}},
+	}, result)
+
+	for _, body := range []string{`{"query":"sum("}`, `{"query":"PollCount[5m]"}`, `not json`} {
+		resp = post(body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+		require.NoError(t, resp.Body.Close())
+	}
+
+	deep := `{"query":"` + strings.Repeat("(", query.MaxDepth+1) + `"}`
+	resp = post(deep)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "nested too deeply")
+	require.NoError(t, resp.Body.Close())
+	resp = post(`{"query":"` + strings.Repeat(" ", maxQueryBody) + `1"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+}
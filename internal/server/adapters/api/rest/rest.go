@@ -10,6 +10,8 @@ import (
 	"net/http/pprof"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,8 +19,14 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"go.uber.org/zap"
 
+	"metrics/internal/server/adapters/ingest/influx"
+	"metrics/internal/server/adapters/ingest/otlp"
+	"metrics/internal/server/adapters/ingest/remotewrite"
+	"metrics/internal/server/adapters/ingest/rules"
 	"metrics/internal/server/config"
 	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/query"
+	"metrics/internal/server/core/stream"
 	"metrics/internal/server/logger"
 )
 
@@ -54,16 +62,82 @@ type MetricService interface {
 
 	// Ping checks the health of the storage system.
 	Ping(ctx context.Context) error
+
+	// RegisterMetadata registers the description, unit and type of metric names.
+	RegisterMetadata(ctx context.Context, list []domain.Metadata) error
+
+	// GetMetadata returns the metadata of every registered metric name.
+	GetMetadata(ctx context.Context) []domain.Metadata
+
+	// ListMetrics returns a page of the metrics selected by the filter.
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (*domain.MetricsPage, error)
+
+	// DeleteMetric removes a series.
+	DeleteMetric(ctx context.Context, mType, mName string) error
+
+	// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+
+	// ResetCounter sets the total of a counter to zero.
+	ResetCounter(ctx context.Context, mName string) (*domain.Metric, error)
+
+	// GetCounterRate returns the change of a counter over the rate interval, up to its last write.
+	GetCounterRate(ctx context.Context, id string) (*domain.CounterRate, error)
+
+	// GetHistory returns the gauge and counter series of a metric name sampled between from and to.
+	GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error)
+
+	// Query evaluates a query at the current time.
+	Query(ctx context.Context, q string) (*query.Result, error)
+
+	// Subscribe starts a subscription to the updates of the metrics selected by the filter.
+	Subscribe(filter stream.Filter) *stream.Subscription
+
+	// Staleness reports the stale series grouped by the value of a label.
+	Staleness(ctx context.Context, label string) (*domain.StaleReport, error)
+
+	// RecordAgent notes that an agent reported a number of metrics.
+	RecordAgent(id domain.AgentIdentity, metrics int)
+
+	// Agents returns the agents which reported metrics.
+	Agents() []domain.Agent
+
+	// ExportMetrics calls fn with every stored metric.
+	ExportMetrics(ctx context.Context, fn func(m *domain.Metric) error) (int, error)
+
+	// ImportMetrics writes the metrics read by next, merging them with the stored ones or replacing them.
+	ImportMetrics(ctx context.Context, next func() (*domain.Metric, error), mode string) (*domain.ImportResult, error)
+
+	// Alerts evaluates every alert rule.
+	Alerts(ctx context.Context) ([]domain.Alert, error)
+
+	// SetAlertRule creates an alert rule or replaces the one of the same name.
+	SetAlertRule(ctx context.Context, rule domain.AlertRule) error
+
+	// DeleteAlertRule removes an alert rule.
+	DeleteAlertRule(ctx context.Context, name string) error
 }
 
 // Handler represents the handler for API operations.
 type Handler struct {
 	metricService MetricService
-	config        *config.Config
+	// config is swapped on reload.
+	config atomic.Pointer[config.Config]
 }
 
 type API struct {
-	srv *http.Server
+	srv     *http.Server
+	handler *Handler
+}
+
+// Reload makes the handler use a new config: the keys, the trusted subnet and the admin token.
+func (h *Handler) Reload(cfg *config.Config) {
+	h.config.Store(cfg)
+}
+
+// Reload makes the API use a new config, the address and the rules staying as they were at start up.
+func (a *API) Reload(cfg *config.Config) {
+	a.handler.Reload(cfg)
 }
 
 // Run starts the HTTP server.
@@ -85,48 +159,91 @@ func (a *API) Run() error {
 }
 
 // NewAPI creates a new instance of the API.
-func NewAPI(metricService MetricService, cfg *config.Config) *API {
+func NewAPI(metricService MetricService, cfg *config.Config) (*API, error) {
+	influxRules, err := rules.Parse(cfg.InfluxRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse influx rules: %w", err)
+	}
 	h := &Handler{
 		metricService: metricService,
-		config:        cfg,
 	}
+	h.Reload(cfg)
 	r := chi.NewRouter()
 
 	r.Use(h.LoggingRequestMiddleware)
-	r.Use(h.DecryptMiddleware)
-	r.Use(h.WithHashMiddleware)
-	r.Use(h.CompressRequestMiddleware)
-	r.Use(h.CompressResponseMiddleware)
-	r.Use(middleware.Timeout(serverTimeout * time.Second))
-
-	r.HandleFunc("/debug/pprof", pprof.Index)
-	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
-	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
-	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
-	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
-
-	r.Handle("/debug/pprof/block", pprof.Handler("block"))
-	r.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
-	r.Handle("/debug/pprof/heap", pprof.Handler("heap"))
-	r.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
-
-	r.Route("/update", func(r chi.Router) {
-		r.Post("/", h.SetMetric)
-		r.Post("/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+	// Streams are long-lived and flushed as they go, so they skip the body middlewares and the timeout.
+	r.Get("/api/v1/stream", h.Stream)
+	r.Get("/api/v1/ws", h.WebSocket)
+	// Snapshots may take longer than the timeout and are too large to be signed or encrypted in one piece.
+	r.Group(func(r chi.Router) {
+		r.Use(h.AdminMiddleware)
+		r.Use(h.CompressRequestMiddleware)
+		r.Use(h.CompressResponseMiddleware)
+		r.Get("/api/v1/snapshot", h.ExportSnapshot)
+		r.Post("/api/v1/snapshot", h.ImportSnapshot)
 	})
-	r.Route("/value", func(r chi.Router) {
-		r.Post("/", h.GetMetric)
-		r.Get("/{metricType}/{metricName}", h.GetMetricValue)
+	r.Group(func(r chi.Router) {
+		r.Use(h.DecryptMiddleware)
+		r.Use(h.WithHashMiddleware)
+		r.Use(h.CompressRequestMiddleware)
+		r.Use(h.CompressResponseMiddleware)
+		r.Use(middleware.Timeout(serverTimeout * time.Second))
+
+		r.HandleFunc("/debug/pprof", pprof.Index)
+		r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+		r.Handle("/debug/pprof/block", pprof.Handler("block"))
+		r.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine"))
+		r.Handle("/debug/pprof/heap", pprof.Handler("heap"))
+		r.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate"))
+
+		r.Route("/update", func(r chi.Router) {
+			r.Post("/", h.SetMetric)
+			r.Post("/{metricType}/{metricName}/{metricValue}", h.SetMetricValue)
+		})
+		r.Route("/value", func(r chi.Router) {
+			r.Post("/", h.GetMetric)
+			r.Get("/{metricType}/{metricName}", h.GetMetricValue)
+		})
+		r.Post("/updates/", h.SetMetrics)
+		r.Method(http.MethodPost, "/api/v1/write", remotewrite.NewHandler(metricService))
+		influxHandler := influx.NewHandler(influx.NewParser(influxRules), metricService)
+		r.Method(http.MethodPost, "/write", influxHandler)
+		r.Method(http.MethodPost, "/api/v2/write", influxHandler)
+		r.Method(http.MethodPost, "/v1/metrics", otlp.NewHandler(metricService))
+		r.Get("/", h.GetAllMetrics)
+		r.Get("/metrics", h.GetPrometheusMetrics)
+		r.Get("/api/v1/metrics", h.ListMetrics)
+		r.Get("/api/v1/history", h.GetHistory)
+		r.Get("/api/v1/stale", h.GetStaleness)
+		r.Get("/api/v1/agents", h.ListAgents)
+		r.Get("/api/v1/alerts", h.ListAlerts)
+		r.Handle("/static/*", http.StripPrefix("/static/", http.FileServerFS(static)))
+		r.Route("/api/v1/metadata", func(r chi.Router) {
+			r.Get("/", h.GetMetadata)
+			r.Post("/", h.RegisterMetadata)
+		})
+		r.Post("/query", h.Query)
+		r.Group(func(r chi.Router) {
+			r.Use(h.AdminMiddleware)
+			r.Delete("/api/v1/metrics", h.DeleteByPrefix)
+			r.Delete("/api/v1/metrics/{metricType}/{metricName}", h.DeleteMetric)
+			r.Post("/api/v1/metrics/counter/{metricName}/reset", h.ResetCounter)
+			r.Put("/api/v1/alerts/{alertName}", h.SetAlertRule)
+			r.Delete("/api/v1/alerts/{alertName}", h.DeleteAlertRule)
+		})
+		r.Get("/ping", h.Ping)
 	})
-	r.Post("/updates/", h.SetMetrics)
-	r.Get("/", h.GetAllMetrics)
-	r.Get("/ping", h.Ping)
 	return &API{
 		srv: &http.Server{
 			Addr:    cfg.Address,
 			Handler: r,
 		},
-	}
+		handler: h,
+	}, nil
 }
 
 // SetMetricValue handles POST requests to update metric values.
@@ -149,6 +266,7 @@ func (h *Handler) SetMetricValue(w http.ResponseWriter, req *http.Request) {
 		handleSetMetricError(w, err)
 		return
 	}
+	h.metricService.RecordAgent(agentIdentity(req), 1)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -180,6 +298,7 @@ func (h *Handler) SetMetric(w http.ResponseWriter, req *http.Request) {
 		handleSetMetricError(w, err)
 		return
 	}
+	h.metricService.RecordAgent(agentIdentity(req), 1)
 	w.Header().Set(contentType, "application/json")
 
 	if err = json.NewEncoder(w).Encode(metric); err != nil {
@@ -216,6 +335,7 @@ func (h *Handler) SetMetrics(w http.ResponseWriter, req *http.Request) {
 		handleSetMetricError(w, err)
 		return
 	}
+	h.metricService.RecordAgent(agentIdentity(req), len(metricsIn))
 	w.Header().Set(contentType, "application/json")
 
 	if err = json.NewEncoder(w).Encode(metricsOut); err != nil {
@@ -226,8 +346,20 @@ func (h *Handler) SetMetrics(w http.ResponseWriter, req *http.Request) {
 }
 
 // GetMetricValue handles GET requests to retrieve metric values.
+//
+// Counters are returned as their total, ?as=delta and ?as=rate return instead their increase over the rate
+// interval up to the last write and its per-second rate.
 func (h *Handler) GetMetricValue(w http.ResponseWriter, req *http.Request) {
 	mType, mName := chi.URLParam(req, metricType), chi.URLParam(req, metricName)
+	switch as := req.URL.Query().Get("as"); as {
+	case "", "total":
+	case "delta", "rate":
+		h.getCounterRate(w, req, mType, mName, as)
+		return
+	default:
+		http.Error(w, fmt.Sprintf("unknown value %q of as", as), http.StatusBadRequest)
+		return
+	}
 	metricValue, err := h.metricService.GetMetricValue(req.Context(), mType, mName)
 	if err != nil {
 		logger.Log.Error("failed to get metric",
@@ -243,6 +375,27 @@ func (h *Handler) GetMetricValue(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// getCounterRate writes the delta or the rate of a counter.
+func (h *Handler) getCounterRate(w http.ResponseWriter, req *http.Request, mType, mName, as string) {
+	if mType != domain.Counter {
+		http.Error(w, "only counters have a delta and a rate", http.StatusBadRequest)
+		return
+	}
+	rate, err := h.metricService.GetCounterRate(req.Context(), mName)
+	if err != nil {
+		logger.Log.Info("failed to get counter rate", zap.String(metricName, mName), zap.Error(err))
+		handleGetMetricError(w, err)
+		return
+	}
+	value := strconv.FormatInt(rate.Delta, 10)
+	if as == "rate" {
+		value = strconv.FormatFloat(rate.Rate, 'f', -1, 64)
+	}
+	if _, err = w.Write([]byte(value)); err != nil {
+		logger.Log.Info("failed to write counter rate", zap.Error(err))
+	}
+}
+
 // GetMetric handles GET requests to retrieve metrics based on type and name.
 func (h *Handler) GetMetric(w http.ResponseWriter, req *http.Request) {
 	var m domain.Metric
@@ -268,33 +421,29 @@ func (h *Handler) GetMetric(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// GetAllMetrics handles GET requests to retrieve all available metrics.
-func (h *Handler) GetAllMetrics(w http.ResponseWriter, req *http.Request) {
-	metrics, err := h.metricService.GetAllMetrics(req.Context())
-	if err != nil {
+// GetMetadata handles GET requests to list the registered metric metadata.
+func (h *Handler) GetMetadata(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set(contentType, "application/json")
+	if err := json.NewEncoder(w).Encode(h.metricService.GetMetadata(req.Context())); err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		logger.Log.Error("failed to get all metrics", zap.Error(err))
-		return
+		logger.Log.Error("error encoding response", zap.Error(err))
 	}
-	html := "<html><body><ul>"
-	for _, metric := range metrics {
-		switch metric.MType {
-		case domain.Gauge:
-			if metric.Value != nil {
-				html += fmt.Sprintf("<li>mType: %s, mName: %s, Value %v", metric.MType, metric.ID, *metric.Value)
-			}
-		case domain.Counter:
-			if metric.Delta != nil {
-				html += fmt.Sprintf("<li>mType: %s, mName: %s, Value %v", metric.MType, metric.ID, *metric.Delta)
-			}
-		}
+}
+
+// RegisterMetadata handles POST requests to register the description, unit and type of metric names.
+func (h *Handler) RegisterMetadata(w http.ResponseWriter, req *http.Request) {
+	var list []domain.Metadata
+	if err := json.NewDecoder(req.Body).Decode(&list); err != nil {
+		logger.Log.Info("cannot decode request JSON body", zap.Error(err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
-	html += "</ul></body></html>"
-	w.Header().Set(contentType, "text/html")
-	if _, err := w.Write([]byte(html)); err != nil {
-		w.WriteHeader(http.StatusOK)
+	if err := h.metricService.RegisterMetadata(req.Context(), list); err != nil {
+		logger.Log.Error("failed to register metadata", zap.Error(err))
+		handleSetMetricError(w, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // Ping handles GET requests to check the health of the storage system.
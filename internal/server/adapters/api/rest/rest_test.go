@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"metrics/internal/server/adapters/storage"
 	"metrics/internal/server/adapters/storage/memory"
@@ -49,7 +51,7 @@ func TestHandler_SetMetricValueSuccess(t *testing.T) {
 		{
 			name: "statusOkCounter",
 			metric: Metric{
-				Name:  "someMetric",
+				Name:  "someCounter",
 				Value: "13",
 				Type:  domain.Counter,
 			},
@@ -388,3 +390,99 @@ func TestHandler_PingSuccess(t *testing.T) {
 		assert.Equal(t, http.StatusOK, result.StatusCode)
 	})
 }
+
+func TestHandler_Metadata(t *testing.T) {
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+	register := func(body string) int {
+		w := httptest.NewRecorder()
+		h.RegisterMetadata(w, httptest.NewRequest(http.MethodPost, "/api/v1/metadata", bytes.NewBufferString(body)))
+		result := w.Result()
+		require.NoError(t, result.Body.Close())
+		return result.StatusCode
+	}
+
+	assert.Equal(t, http.StatusNoContent,
+		register(`[{"name":"MSpanSys","type":"gauge","unit":"bytes","description":"Bytes of memory obtained for spans"}]`))
+	assert.Equal(t, http.StatusConflict, register(`[{"name":"MSpanSys","type":"counter"}]`))
+	assert.Equal(t, http.StatusBadRequest, register(`[{"name":"x{a=\"b\"}"}]`))
+
+	w := httptest.NewRecorder()
+	h.SetMetricValue(w, withURLParams(httptest.NewRequest(http.MethodPost, "/", http.NoBody),
+		metricType, domain.Counter, metricName, "MSpanSys", metricValue, "1"))
+	result := w.Result()
+	require.NoError(t, result.Body.Close())
+	assert.Equal(t, http.StatusConflict, result.StatusCode)
+
+	_, err = metricService.SetMetric(context.Background(),
+		&domain.Metric{ID: "MSpanSys", MType: domain.Gauge, Value: new(float64)})
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.GetAllMetrics(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	assert.Contains(t, w.Body.String(), `<td class="unit">bytes</td>`)
+	assert.Contains(t, w.Body.String(), `<td class="description">Bytes of memory obtained for spans</td>`)
+
+	w = httptest.NewRecorder()
+	h.GetMetadata(w, httptest.NewRequest(http.MethodGet, "/api/v1/metadata", http.NoBody))
+	var list []domain.Metadata
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	assert.Equal(t, []domain.Metadata{
+		{Name: "MSpanSys", Type: domain.Gauge, Unit: "bytes", Description: "Bytes of memory obtained for spans"},
+	}, list)
+}
+
+// withURLParams sets chi URL parameters given as name, value pairs.
+func withURLParams(r *http.Request, pairs ...string) *http.Request {
+	rctx := chi.NewRouteContext()
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rctx.URLParams.Add(pairs[i], pairs[i+1])
+	}
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestHandler_GetMetricValueRate(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	metricService := newTestService(t, service.WithRateInterval(interval))
+	h := Handler{metricService: metricService}
+	get := func(mType, mName, as string) (int, string) {
+		w := httptest.NewRecorder()
+		h.GetMetricValue(w, withURLParams(httptest.NewRequest(http.MethodGet, "/?as="+as, http.NoBody),
+			metricType, mType, metricName, mName))
+		return w.Code, w.Body.String()
+	}
+	for i, delta := range []string{"5", "7"} {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		_, err := metricService.SetMetricValue(context.Background(),
+			&domain.SetMetricRequest{MType: domain.Counter, ID: "PollCount", Value: delta})
+		require.NoError(t, err)
+		_, err = metricService.SetMetricValue(context.Background(),
+			&domain.SetMetricRequest{MType: domain.Gauge, ID: "Alloc", Value: delta})
+		require.NoError(t, err)
+	}
+
+	code, body := get(domain.Counter, "PollCount", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "12", body)
+	code, body = get(domain.Counter, "PollCount", "delta")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "7", body)
+	code, body = get(domain.Counter, "PollCount", "rate")
+	assert.Equal(t, http.StatusOK, code)
+	rate, err := strconv.ParseFloat(body, 64)
+	require.NoError(t, err)
+	assert.Positive(t, rate)
+
+	code, _ = get(domain.Gauge, "Alloc", "rate")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get(domain.Counter, "PollCount", "percent")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = get(domain.Counter, "missing", "rate")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,78 @@
+package rest
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/adapters/snapshot"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// ExportSnapshot handles GET requests to stream every stored metric in the format query parameter: jsonl,
+// the default, csv or protobuf. The status is sent before the metrics, so an export failing midway is only
+// cut short.
+func (h *Handler) ExportSnapshot(w http.ResponseWriter, req *http.Request) {
+	format := cmp.Or(req.URL.Query().Get("format"), snapshot.FormatJSONL)
+	enc, err := snapshot.NewEncoder(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(contentType, snapshot.ContentType(format))
+	exported, err := h.metricService.ExportMetrics(req.Context(), enc.Encode)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		logger.Log.Error("failed to export metrics", zap.Int("exported", exported), zap.Error(err))
+		if exported == 0 {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+	logger.Log.Info("metrics exported", zap.String("format", format), zap.Int("exported", exported))
+}
+
+// ImportSnapshot handles POST requests to import a snapshot in the format query parameter, as exported.
+// The mode query parameter is merge, the default, or replace. The response tells how many metrics were
+// imported and how many series were deleted, an error telling how many were imported before it.
+func (h *Handler) ImportSnapshot(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	format := cmp.Or(q.Get("format"), snapshot.FormatJSONL)
+	mode := cmp.Or(q.Get("mode"), domain.ImportMerge)
+	dec, err := snapshot.NewDecoder(req.Body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.metricService.ImportMetrics(req.Context(), dec.Decode, mode)
+	if err != nil {
+		logger.Log.Error("failed to import metrics", zap.String("format", format), zap.Error(err))
+		if result != nil {
+			err = fmt.Errorf("%w, %d metrics imported", err, result.Imported)
+		}
+		if errors.Is(err, snapshot.ErrMalformed) || errors.Is(err, domain.ErrIncorrectImportMode) ||
+			errors.Is(err, domain.ErrNilGaugeValue) || errors.Is(err, domain.ErrNilCounterDelta) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handleSetMetricError(w, err)
+		return
+	}
+	logger.Log.Info("metrics imported",
+		zap.String("format", format),
+		zap.String("mode", mode),
+		zap.Int("imported", result.Imported),
+		zap.Int("deleted", result.Deleted),
+	)
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
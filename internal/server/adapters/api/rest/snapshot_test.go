@@ -0,0 +1,99 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/snapshot"
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+)
+
+func snapshotRouter(h *Handler) http.Handler {
+	r := chi.NewRouter()
+	r.Get("/api/v1/snapshot", h.ExportSnapshot)
+	r.Post("/api/v1/snapshot", h.ImportSnapshot)
+	return r
+}
+
+func TestHandler_Snapshot(t *testing.T) {
+	ctx := context.Background()
+	source := newTestService(t)
+	_, err := source.SetMetrics(ctx, domain.MetricsList{
+		storagetest.Gauge("HeapAlloc", 1.5),
+		storagetest.Counter("PollCount", 3),
+		storagetest.Sketch("rtt", 10, 20),
+	})
+	require.NoError(t, err)
+	export := snapshotRouter(&Handler{metricService: source})
+
+	for _, format := range []string{snapshot.FormatJSONL, snapshot.FormatCSV, snapshot.FormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			export.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot?format="+format, http.NoBody))
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, snapshot.ContentType(format), w.Header().Get(contentType))
+
+			target := newTestService(t)
+			_, err := target.SetMetrics(ctx, domain.MetricsList{
+				storagetest.Counter("PollCount", 100),
+				storagetest.Gauge("Old", 1),
+			})
+			require.NoError(t, err)
+			body := bytes.NewReader(w.Body.Bytes())
+			w = httptest.NewRecorder()
+			snapshotRouter(&Handler{metricService: target}).ServeHTTP(w,
+				httptest.NewRequest(http.MethodPost, "/api/v1/snapshot?mode=replace&format="+format, body))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.JSONEq(t, `{"imported":3,"deleted":1}`, w.Body.String())
+
+			want, err := source.GetAllMetrics(ctx)
+			require.NoError(t, err)
+			got, err := target.GetAllMetrics(ctx)
+			require.NoError(t, err)
+			require.Len(t, got, len(want))
+			for i := range want {
+				want[i].Updated, got[i].Updated = nil, nil
+			}
+			assert.ElementsMatch(t, want, got)
+		})
+	}
+}
+
+func TestHandler_SnapshotErrors(t *testing.T) {
+	r := snapshotRouter(&Handler{metricService: newTestService(t)})
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   int
+	}{
+		{name: "export format", method: http.MethodGet, target: "/api/v1/snapshot?format=xml", want: http.StatusBadRequest},
+		{name: "import format", method: http.MethodPost, target: "/api/v1/snapshot?format=xml", want: http.StatusBadRequest},
+		{name: "mode", method: http.MethodPost, target: "/api/v1/snapshot?mode=append", want: http.StatusBadRequest},
+		{name: "malformed", method: http.MethodPost, target: "/api/v1/snapshot", body: `{"id":`, want: http.StatusBadRequest},
+		{
+			name:   "invalid metric",
+			method: http.MethodPost,
+			target: "/api/v1/snapshot",
+			body:   `{"id":"a","type":"gauge"}`,
+			want:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package rest
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/logger"
+)
+
+// GetStaleness handles GET requests for the series which stopped being written, grouped by the label
+// given as the group query parameter, host by default. Groups whose series are all stale are the agents
+// which stopped reporting and come first.
+func (h *Handler) GetStaleness(w http.ResponseWriter, req *http.Request) {
+	label := cmp.Or(req.URL.Query().Get("group"), defaultGroupLabel)
+	report, err := h.metricService.Staleness(req.Context(), label)
+	if err != nil {
+		logger.Log.Error("failed to get stale metrics", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentType, "application/json")
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		logger.Log.Error("error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,66 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_GetStaleness(t *testing.T) {
+	const ttl = 20 * time.Millisecond
+	metricStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage, service.WithStaleness(ttl, 0))
+	require.NoError(t, err)
+	ctx := context.Background()
+	_, err = metricService.SetMetrics(ctx, domain.MetricsList{
+		storagetest.Gauge(`Alloc{dc="eu",host="web1"}`, 1),
+		storagetest.Gauge(`Alloc{dc="eu",host="web2"}`, 2),
+	})
+	require.NoError(t, err)
+	time.Sleep(ttl + 10*time.Millisecond)
+	_, err = metricService.SetMetrics(ctx, domain.MetricsList{storagetest.Gauge(`Alloc{dc="eu",host="web2"}`, 3)})
+	require.NoError(t, err)
+	h := Handler{metricService: metricService}
+
+	w := httptest.NewRecorder()
+	h.GetStaleness(w, httptest.NewRequest(http.MethodGet, "/api/v1/stale", http.NoBody))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get(contentType))
+	var report domain.StaleReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "host", report.Label)
+	assert.Equal(t, ttl.String(), report.StaleAfter)
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, "web1", report.Groups[0].Name)
+	assert.True(t, report.Groups[0].Silent)
+	require.Len(t, report.Series, 1)
+	assert.True(t, report.Series[0].Stale)
+
+	w = httptest.NewRecorder()
+	h.GetStaleness(w, httptest.NewRequest(http.MethodGet, "/api/v1/stale?group=dc", http.NoBody))
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, domain.StaleGroup{
+		Name: "eu", Series: 2, Stale: 1, LastUpdated: report.Groups[0].LastUpdated,
+	}, report.Groups[0])
+
+	w = httptest.NewRecorder()
+	h.GetAllMetrics(w, httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	body := w.Body.String()
+	assert.Contains(t, body, `<tr class="metric stale" data-id="Alloc{dc=&#34;eu&#34;,host=&#34;web1&#34;}"`)
+	assert.Contains(t, body, "host: web1 (stopped reporting)")
+	assert.NotContains(t, body, "host: web2 (stopped reporting)")
+}
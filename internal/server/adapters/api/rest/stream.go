@@ -0,0 +1,150 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/stream"
+	"metrics/internal/server/logger"
+)
+
+const (
+	// streamHeartbeat is how often an idle stream is written to, keeping proxies from closing it.
+	streamHeartbeat = 15 * time.Second
+	// wsWriteTimeout bounds a write to a WebSocket client.
+	wsWriteTimeout = 5 * time.Second
+)
+
+// upgrader accepts same-origin WebSocket connections only.
+var upgrader = websocket.Upgrader{}
+
+// Stream handles GET requests to follow metric updates as Server-Sent Events. Every update is a metric
+// event with the JSON metric as data. A client which doesn't keep up gets an error event and the stream
+// ends. The name and type query parameters, repeated or comma separated, select the updates.
+func (h *Handler) Stream(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseStreamFilter(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub := h.metricService.Subscribe(*filter)
+	defer sub.Close()
+	rc := http.NewResponseController(w)
+	w.Header().Set(contentType, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		logger.Log.Error("stream can't be flushed", zap.Error(err))
+		return
+	}
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case m, ok := <-sub.Updates():
+			if !ok {
+				_, _ = fmt.Fprintf(w, "event: error\ndata: %s\n\n", sub.Err())
+				_ = rc.Flush()
+				return
+			}
+			var buf []byte
+			if buf, err = json.Marshal(m); err == nil {
+				_, err = fmt.Fprintf(w, "event: metric\ndata: %s\n\n", buf)
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			logger.Log.Info("stream has ended", zap.Error(err))
+			return
+		}
+	}
+}
+
+// WebSocket handles GET requests to follow metric updates over a WebSocket, each update being a JSON
+// text message. A client which doesn't keep up is closed with the try again later code. The updates are
+// selected the way Stream does.
+func (h *Handler) WebSocket(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseStreamFilter(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sub := h.metricService.Subscribe(*filter)
+	defer sub.Close()
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// The upgrader has already replied.
+		logger.Log.Info("websocket upgrade has failed", zap.Error(err))
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.Log.Info("failed to close websocket", zap.Error(err))
+		}
+	}()
+	// The client sends nothing, reading only notices it going away and answers its control messages.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-heartbeat.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+		case m, ok := <-sub.Updates():
+			if !ok {
+				msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, sub.Err().Error())
+				_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if err = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err == nil {
+				err = conn.WriteJSON(m)
+			}
+		}
+		if err != nil {
+			logger.Log.Info("websocket has ended", zap.Error(err))
+			return
+		}
+	}
+}
+
+func parseStreamFilter(q url.Values) (*stream.Filter, error) {
+	filter := &stream.Filter{}
+	for _, names := range q["name"] {
+		filter.Names = append(filter.Names, strings.Split(names, ",")...)
+	}
+	for _, types := range q["type"] {
+		for _, t := range strings.Split(types, ",") {
+			switch t {
+			case domain.Gauge, domain.Counter, domain.Histogram, domain.Timer:
+				filter.Types = append(filter.Types, t)
+			default:
+				return nil, fmt.Errorf("unknown metric type %q", t)
+			}
+		}
+	}
+	return filter, nil
+}
@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_Stream(t *testing.T) {
+	metricService := newTestService(t)
+	h := Handler{metricService: metricService}
+	srv := httptest.NewServer(h.LoggingRequestMiddleware(http.HandlerFunc(h.Stream)))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?type=gauge,summary")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	resp, err = http.Get(srv.URL + "?type=counter")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, resp.Body.Close()) }()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get(contentType))
+
+	ctx := context.Background()
+	_, err = metricService.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: "Alloc", Value: "1"})
+	require.NoError(t, err)
+	_, err = metricService.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: "Poll", Value: "2"})
+	require.NoError(t, err)
+
+	r := bufio.NewReader(resp.Body)
+	event, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "event: metric\n", event)
+	data, err := r.ReadString('\n')
+	require.NoError(t, err)
+	var m domain.Metric
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &m))
+	assert.Equal(t, "Poll", m.ID)
+	assert.Equal(t, int64(2), *m.Delta)
+}
+
+func TestHandler_WebSocket(t *testing.T) {
+	metricService := newTestService(t)
+	h := Handler{metricService: metricService}
+	srv := httptest.NewServer(h.LoggingRequestMiddleware(http.HandlerFunc(h.WebSocket)))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(url+"?type=summary", nil)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	require.NoError(t, resp.Body.Close())
+
+	conn, resp, err := websocket.DefaultDialer.Dial(url+"?name=Alloc", nil)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	defer func() { require.NoError(t, conn.Close()) }()
+
+	ctx := context.Background()
+	for _, id := range []string{"HeapAlloc", "Alloc"} {
+		_, err = metricService.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: id, Value: "3"})
+		require.NoError(t, err)
+	}
+	var m domain.Metric
+	require.NoError(t, conn.ReadJSON(&m))
+	assert.Equal(t, "Alloc", m.ID)
+	assert.InDelta(t, 3, *m.Value, 0)
+}
@@ -0,0 +1,205 @@
+// Dashboard of the metrics server: filtering, sorting, sparklines of the history and live updates.
+(function () {
+	"use strict";
+
+	const HISTORY_RANGE = "15m";
+	const POLL_INTERVAL = 10000;
+	const MAX_POINTS = 120;
+
+	const table = document.getElementById("metrics");
+	const search = document.getElementById("search");
+	const status = document.getElementById("status");
+	// Samples of the charted series by type and ID.
+	const samples = new Map();
+
+	function key(type, id) {
+		return type + "/" + id;
+	}
+
+	function rows() {
+		return Array.from(table.querySelectorAll("tr.metric"));
+	}
+
+	function findRow(type, id) {
+		return rows().find((tr) => tr.dataset.type === type && tr.dataset.id === id);
+	}
+
+	// Filtering hides the rows whose ID doesn't contain the search, and the groups left empty.
+	function filter() {
+		const q = search.value.trim().toLowerCase();
+		for (const tbody of table.tBodies) {
+			let visible = 0;
+			for (const tr of tbody.querySelectorAll("tr.metric")) {
+				const shown = tr.dataset.id.toLowerCase().includes(q);
+				tr.hidden = !shown;
+				visible += shown ? 1 : 0;
+			}
+			tbody.hidden = visible === 0;
+		}
+	}
+
+	// Sorting orders the rows of every group by a column, numerically when both values are numbers.
+	function sortBy(th) {
+		const column = th.dataset.sort;
+		const desc = th.classList.contains("asc");
+		for (const other of table.tHead.querySelectorAll("th")) {
+			other.classList.remove("asc", "desc");
+		}
+		th.classList.add(desc ? "desc" : "asc");
+		const text = (tr) => tr.querySelector("td." + column).textContent;
+		for (const tbody of table.tBodies) {
+			const sorted = Array.from(tbody.querySelectorAll("tr.metric")).sort((a, b) => {
+				const x = text(a);
+				const y = text(b);
+				const nx = parseFloat(x);
+				const ny = parseFloat(y);
+				const c = isNaN(nx) || isNaN(ny) ? x.localeCompare(y) : nx - ny;
+				return desc ? -c : c;
+			});
+			tbody.append(...sorted);
+		}
+	}
+
+	function draw(tr) {
+		const svg = tr.querySelector("svg.spark");
+		const points = samples.get(key(tr.dataset.type, tr.dataset.id));
+		if (!svg || !points || points.length < 2) {
+			return;
+		}
+		const width = svg.width.baseVal.value;
+		const height = svg.height.baseVal.value;
+		const values = points.map((p) => p.value);
+		const min = Math.min(...values);
+		const span = Math.max(...values) - min || 1;
+		const first = points[0].time;
+		const duration = points[points.length - 1].time - first || 1;
+		const coords = points.map((p) => {
+			const x = ((p.time - first) / duration) * width;
+			const y = height - 1 - ((p.value - min) / span) * (height - 2);
+			return x.toFixed(1) + "," + y.toFixed(1);
+		});
+		svg.innerHTML = '<polyline points="' + coords.join(" ") + '"></polyline>';
+	}
+
+	function addSample(type, id, time, value) {
+		const k = key(type, id);
+		const points = samples.get(k) || [];
+		points.push({ time: time, value: value });
+		samples.set(k, points.slice(-MAX_POINTS));
+	}
+
+	// loadHistory fetches the history of every charted metric name once, as it holds all its series.
+	async function loadHistory() {
+		const names = new Set(rows().filter((tr) => tr.querySelector("svg.spark")).map((tr) => tr.dataset.name));
+		for (const name of names) {
+			const params = new URLSearchParams({ name: name, range: HISTORY_RANGE });
+			const resp = await fetch("/api/v1/history?" + params);
+			if (!resp.ok) {
+				continue;
+			}
+			for (const series of await resp.json()) {
+				samples.set(
+					key(series.type, series.id),
+					series.samples.map((s) => ({ time: Date.parse(s.time), value: s.value })),
+				);
+				const tr = findRow(series.type, series.id);
+				if (tr) {
+					draw(tr);
+				}
+			}
+		}
+	}
+
+	function format(m) {
+		switch (m.type) {
+			case "gauge":
+				return String(m.value);
+			case "counter":
+				return m.rate === undefined ? String(m.delta) : m.delta + " (" + m.rate.toPrecision(3) + "/s)";
+			case "histogram":
+				return "count " + m.histogram.count + ", sum " + m.histogram.sum;
+			case "timer": {
+				const s = m.summary;
+				const p = (v) => v.toPrecision(3);
+				return "count " + s.count + ", p50 " + p(s.p50) + ", p90 " + p(s.p90) + ", p99 " + p(s.p99) + ", max " + p(s.max);
+			}
+		}
+		return "";
+	}
+
+	// update shows a new value, reloading the page for series it doesn't list yet.
+	function update(m) {
+		const tr = findRow(m.type, m.id);
+		if (!tr) {
+			return false;
+		}
+		tr.querySelector("td.value").textContent = format(m);
+		if (m.type === "gauge" || m.type === "counter") {
+			addSample(m.type, m.id, Date.now(), m.type === "gauge" ? m.value : m.delta);
+			draw(tr);
+		}
+		tr.classList.toggle("stale", Boolean(m.stale));
+		tr.classList.add("updated");
+		setTimeout(() => tr.classList.remove("updated"), 1000);
+		return true;
+	}
+
+	function reload() {
+		if (!search.value) {
+			window.location.reload();
+		}
+	}
+
+	// poll lists all the metrics when the stream isn't available.
+	function poll() {
+		status.textContent = "polling every " + POLL_INTERVAL / 1000 + "s";
+		setInterval(async () => {
+			let cursor = "";
+			do {
+				const params = new URLSearchParams({ limit: "1000" });
+				if (cursor) {
+					params.set("cursor", cursor);
+				}
+				const resp = await fetch("/api/v1/metrics?" + params);
+				if (!resp.ok) {
+					return;
+				}
+				const page = await resp.json();
+				for (const m of page.metrics) {
+					if (!update(m)) {
+						reload();
+					}
+				}
+				cursor = page.next || "";
+			} while (cursor);
+		}, POLL_INTERVAL);
+	}
+
+	function stream() {
+		if (!window.EventSource) {
+			poll();
+			return;
+		}
+		const source = new EventSource("/api/v1/stream");
+		source.onopen = () => {
+			status.textContent = "live";
+		};
+		source.addEventListener("metric", (e) => {
+			if (!update(JSON.parse(e.data))) {
+				reload();
+			}
+		});
+		// An evicted or failed stream falls back to polling.
+		source.addEventListener("error", () => {
+			source.close();
+			poll();
+		});
+	}
+
+	search.addEventListener("input", filter);
+	for (const th of table.tHead.querySelectorAll("th[data-sort]")) {
+		th.addEventListener("click", () => sortBy(th));
+	}
+	loadHistory();
+	stream();
+})();
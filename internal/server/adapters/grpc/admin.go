@@ -0,0 +1,86 @@
+package servergrpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "metrics/internal/proto"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// authorize checks the admin token sent as "authorization: Bearer <token>" metadata, the admin RPCs being
+// disabled when no token is configured.
+func (s *GRPCServer) authorize(ctx context.Context) error {
+	token := s.cfg.Load().AdminToken
+	if token == "" {
+		return status.Error(codes.PermissionDenied, "admin token is not configured")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		bearer, found := strings.CutPrefix(auth, "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid admin token")
+}
+
+// adminError maps the errors of the admin operations to gRPC statuses.
+func adminError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrItemNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, domain.ErrEmptyPrefix):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		logger.Log.Error("admin operation has failed", zap.Error(err))
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// Delete removes a series.
+func (s *GRPCServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	mType, found := types[req.GetType()]
+	if !found {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type %v", req.GetType())
+	}
+	if err := s.metricService.DeleteMetric(ctx, mType, req.GetId()); err != nil {
+		return nil, adminError(err)
+	}
+	return &pb.DeleteResponse{Deleted: 1}, nil
+}
+
+// DeleteByPrefix removes the series whose ID starts with a prefix.
+func (s *GRPCServer) DeleteByPrefix(ctx context.Context, req *pb.DeleteByPrefixRequest) (*pb.DeleteResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	deleted, err := s.metricService.DeleteByPrefix(ctx, req.GetPrefix())
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return &pb.DeleteResponse{Deleted: int64(deleted)}, nil
+}
+
+// ResetCounter sets the total of a counter to zero.
+func (s *GRPCServer) ResetCounter(ctx context.Context, req *pb.ResetCounterRequest) (*pb.Metric, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	metric, err := s.metricService.ResetCounter(ctx, req.GetId())
+	if err != nil {
+		return nil, adminError(err)
+	}
+	return toProto(metric), nil
+}
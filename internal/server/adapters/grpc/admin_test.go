@@ -0,0 +1,37 @@
+package servergrpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"metrics/internal/server/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCServer_authorize(t *testing.T) {
+	withToken := func(auth string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", auth))
+	}
+	tests := []struct {
+		name  string
+		token string
+		ctx   context.Context
+		want  codes.Code
+	}{
+		{name: "disabled", ctx: withToken("Bearer secret"), want: codes.PermissionDenied},
+		{name: "missing", token: "secret", ctx: context.Background(), want: codes.Unauthenticated},
+		{name: "wrong", token: "secret", ctx: withToken("Bearer public"), want: codes.Unauthenticated},
+		{name: "valid", token: "secret", ctx: withToken("Bearer secret"), want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewGRPC(nil, &config.Config{AdminToken: tt.token})
+			assert.Equal(t, tt.want, status.Code(s.authorize(tt.ctx)))
+		})
+	}
+}
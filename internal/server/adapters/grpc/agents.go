@@ -0,0 +1,29 @@
+package servergrpc
+
+import (
+	"context"
+
+	"github.com/go-http-utils/headers"
+	"google.golang.org/grpc/metadata"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/agentinfo"
+)
+
+// agentIdentity reads the identity an agent sends as metadata along with its metrics, under the names of
+// the HTTP headers.
+func agentIdentity(ctx context.Context) domain.AgentIdentity {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return domain.AgentIdentity{
+		Address:  get(headers.XRealIP),
+		Hostname: get(agentinfo.HeaderHostname),
+		Version:  get(agentinfo.HeaderVersion),
+		Config:   agentinfo.ParseConfig(get(agentinfo.HeaderConfig)),
+	}
+}
@@ -0,0 +1,27 @@
+package servergrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+
+	"metrics/internal/server/core/domain"
+)
+
+func TestAgentIdentity(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(map[string]string{
+		"X-Real-IP":        "10.0.0.1",
+		"X-Agent-Hostname": "web1",
+		"X-Agent-Version":  "1.2.0",
+		"X-Agent-Config":   "report_interval=10",
+	}))
+	assert.Equal(t, domain.AgentIdentity{
+		Address:  "10.0.0.1",
+		Hostname: "web1",
+		Version:  "1.2.0",
+		Config:   map[string]string{"report_interval": "10"},
+	}, agentIdentity(ctx))
+	assert.Equal(t, domain.AgentIdentity{}, agentIdentity(context.Background()))
+}
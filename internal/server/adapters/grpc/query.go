@@ -0,0 +1,83 @@
+package servergrpc
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "metrics/internal/proto"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Get returns a metric.
+func (s *GRPCServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.Metric, error) {
+	mType, found := types[req.GetType()]
+	if !found {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown metric type %v", req.GetType())
+	}
+	metric, err := s.metricService.GetMetric(ctx, mType, req.GetId())
+	if err != nil {
+		if errors.Is(err, domain.ErrItemNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		logger.Log.Error("failed to get metric", zap.Error(err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return toProto(metric), nil
+}
+
+// List returns a page of the metrics selected by the request.
+func (s *GRPCServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	filter := domain.ListFilter{Prefix: req.GetPrefix(), Limit: defaultPageSize}
+	for _, t := range req.GetTypes() {
+		mType, found := types[t]
+		if !found {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown metric type %v", t)
+		}
+		filter.Types = append(filter.Types, mType)
+	}
+	if limit := req.GetLimit(); limit != 0 {
+		if limit < 0 || limit > maxPageSize {
+			return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", maxPageSize)
+		}
+		filter.Limit = int(limit)
+	}
+	if cursor := req.GetCursor(); cursor != "" {
+		after, err := domain.DecodeCursor(cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		filter.After = after
+	}
+	page, err := s.metricService.ListMetrics(ctx, filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrIncorrectFilter) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		logger.Log.Error("failed to list metrics", zap.Error(err))
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	resp := &pb.ListResponse{Next: page.Next}
+	for _, m := range page.Metrics {
+		resp.Metrics = append(resp.Metrics, toProto(&m))
+	}
+	return resp, nil
+}
+
+// Ping checks the storage of the server.
+func (s *GRPCServer) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := s.metricService.Ping(ctx); err != nil {
+		logger.Log.Info("failed to ping storage", zap.Error(err))
+		return nil, status.Error(codes.Unavailable, "storage is unavailable")
+	}
+	return &pb.PingResponse{}, nil
+}
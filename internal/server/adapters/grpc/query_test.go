@@ -0,0 +1,93 @@
+package servergrpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "metrics/internal/proto"
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/config"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+func newTestServer(t *testing.T) *GRPCServer {
+	t.Helper()
+	metricStorage, err := storage.NewStorage(storage.Config{
+		Memory: &memory.Config{},
+	})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	_, err = metricService.SetMetrics(context.Background(), domain.MetricsList{
+		storagetest.Gauge("HeapAlloc", 1),
+		storagetest.Gauge("HeapInuse", 2),
+		storagetest.Counter("PollCount", 3),
+	})
+	require.NoError(t, err)
+	return NewGRPC(metricService, &config.Config{})
+}
+
+func TestGRPCServer_Get(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	m, err := s.Get(ctx, &pb.GetRequest{Id: "PollCount", Type: pb.Metric_COUNTER})
+	require.NoError(t, err)
+	assert.Equal(t, "PollCount", m.GetId())
+	assert.Equal(t, pb.Metric_COUNTER, m.GetType())
+	assert.Equal(t, int64(3), m.GetDelta())
+	assert.NotZero(t, m.GetUpdatedUnixNano())
+
+	_, err = s.Get(ctx, &pb.GetRequest{Id: "PollCount", Type: pb.Metric_GAUGE})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = s.Get(ctx, &pb.GetRequest{Id: "PollCount", Type: pb.Metric_Type(42)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_List(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	ids := func(resp *pb.ListResponse) []string {
+		var ids []string
+		for _, m := range resp.GetMetrics() {
+			ids = append(ids, m.GetId())
+		}
+		return ids
+	}
+
+	resp, err := s.List(ctx, &pb.ListRequest{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HeapAlloc", "HeapInuse"}, ids(resp))
+	require.NotEmpty(t, resp.GetNext())
+	resp, err = s.List(ctx, &pb.ListRequest{Limit: 2, Cursor: resp.GetNext()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PollCount"}, ids(resp))
+	assert.Empty(t, resp.GetNext())
+
+	resp, err = s.List(ctx, &pb.ListRequest{Types: []pb.Metric_Type{pb.Metric_GAUGE}, Prefix: "Heap"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HeapAlloc", "HeapInuse"}, ids(resp))
+
+	for _, req := range []*pb.ListRequest{
+		{Limit: -1},
+		{Limit: maxPageSize + 1},
+		{Cursor: "not a cursor"},
+		{Types: []pb.Metric_Type{pb.Metric_Type(42)}},
+	} {
+		_, err = s.List(ctx, req)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), req.String())
+	}
+}
+
+func TestGRPCServer_Ping(t *testing.T) {
+	_, err := newTestServer(t).Ping(context.Background(), &pb.PingRequest{})
+	assert.NoError(t, err)
+}
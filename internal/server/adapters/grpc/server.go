@@ -9,49 +9,164 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	pb "metrics/internal/proto"
 	"metrics/internal/server/config"
+	"metrics/internal/server/core/stream"
 )
 
 // MetricService defines the interface for metric operations.
 type MetricService interface {
 	// SetMetric creates or updates a metric.
 	SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error)
+
+	// GetMetric retrieves a specific metric based on type and name.
+	GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error)
+
+	// ListMetrics returns a page of the metrics selected by the filter.
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (*domain.MetricsPage, error)
+
+	// Ping checks the health of the storage system.
+	Ping(ctx context.Context) error
+
+	// Subscribe starts a subscription to the updates of the metrics selected by the filter.
+	Subscribe(filter stream.Filter) *stream.Subscription
+
+	// DeleteMetric removes a series.
+	DeleteMetric(ctx context.Context, mType, mName string) error
+
+	// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+
+	// ResetCounter sets the total of a counter to zero.
+	ResetCounter(ctx context.Context, mName string) (*domain.Metric, error)
+
+	// RecordAgent notes that an agent reported a number of metrics.
+	RecordAgent(id domain.AgentIdentity, metrics int)
+}
+
+// types maps the protobuf metric types to the domain ones.
+var types = map[pb.Metric_Type]string{
+	pb.Metric_GAUGE:     domain.Gauge,
+	pb.Metric_COUNTER:   domain.Counter,
+	pb.Metric_HISTOGRAM: domain.Histogram,
+	pb.Metric_TIMER:     domain.Timer,
 }
 
 type GRPCServer struct {
 	pb.UnimplementedMetricServiceServer
 	metricService MetricService
-	cfg           *config.Config
+	// cfg is swapped on reload.
+	cfg atomic.Pointer[config.Config]
 }
 
 // NewGRPC creates a new instance of the GRPC.
 func NewGRPC(metricService MetricService, cfg *config.Config) *GRPCServer {
-	return &GRPCServer{metricService: metricService, cfg: cfg}
+	s := &GRPCServer{metricService: metricService}
+	s.Reload(cfg)
+	return s
+}
+
+// Reload makes the server use a new config, the port staying as it was at start up.
+func (s *GRPCServer) Reload(cfg *config.Config) {
+	s.cfg.Store(cfg)
 }
 
 func (s *GRPCServer) Update(ctx context.Context, metric *pb.Metric) (*pb.MetricResponse, error) {
 	m := domain.Metric{ID: metric.Id}
-	if metric.Type == pb.Metric_GAUGE {
+	switch metric.Type {
+	case pb.Metric_GAUGE:
 		m.MType = domain.Gauge
 		m.Value = &metric.Value
-	} else {
+	case pb.Metric_TIMER:
+		m.MType = domain.Timer
+		m.Value = &metric.Value
+	case pb.Metric_HISTOGRAM:
+		m.MType = domain.Histogram
+		if h := metric.GetHistogram(); h != nil {
+			m.Histogram = &domain.HistogramValue{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+		}
+	default:
 		m.MType = domain.Counter
 		m.Delta = &metric.Delta
 	}
 	if _, err := s.metricService.SetMetric(ctx, &m); err != nil {
 		return &pb.MetricResponse{Status: 13}, nil
 	}
+	s.metricService.RecordAgent(agentIdentity(ctx), 1)
 	logger.Log.Info("successfully updated metric")
 	return &pb.MetricResponse{Status: 0}, nil
 }
 
+// Watch streams the updates of the metrics selected by the request until the client goes away. A client
+// which doesn't keep up is ended with ResourceExhausted.
+func (s *GRPCServer) Watch(req *pb.WatchRequest, srv pb.MetricService_WatchServer) error {
+	filter := stream.Filter{Names: req.GetNames()}
+	for _, t := range req.GetTypes() {
+		mType, found := types[t]
+		if !found {
+			return status.Errorf(codes.InvalidArgument, "unknown metric type %v", t)
+		}
+		filter.Types = append(filter.Types, mType)
+	}
+	sub := s.metricService.Subscribe(filter)
+	defer sub.Close()
+	for {
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case m, ok := <-sub.Updates():
+			if !ok {
+				return status.Error(codes.ResourceExhausted, sub.Err().Error())
+			}
+			if err := srv.Send(toProto(&m)); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+	}
+}
+
+// toProto converts a stored metric, timers carrying their quantiles rather than the sketch.
+func toProto(m *domain.Metric) *pb.Metric {
+	metric := &pb.Metric{Id: m.ID, Stale: m.Stale}
+	if m.Updated != nil {
+		metric.UpdatedUnixNano = m.Updated.UnixNano()
+	}
+	for t, mType := range types {
+		if mType == m.MType {
+			metric.Type = t
+		}
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	if h := m.Histogram; h != nil {
+		metric.Histogram = &pb.Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+	}
+	if sum := m.Summary; sum != nil {
+		metric.Summary = &pb.TimerSummary{
+			Count: sum.Count,
+			Sum:   sum.Sum,
+			P50:   sum.P50,
+			P90:   sum.P90,
+			P99:   sum.P99,
+			Max:   sum.Max,
+		}
+	}
+	return metric
+}
+
 func (s *GRPCServer) Run() error {
-	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.GRPCPort))
+	listen, err := net.Listen("tcp", fmt.Sprintf(":%d", s.cfg.Load().GRPCPort))
 	if err != nil {
 		return fmt.Errorf("failed to listen: %w", err)
 	}
@@ -0,0 +1,116 @@
+// Package delta converts cumulative counters into the deltas accumulated by the metric service.
+package delta
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultTTL is how long a series may go unreported before its last value is forgotten.
+const DefaultTTL = time.Hour
+
+// Tracker remembers the last cumulative value of every series reported within the TTL.
+//
+// The values live in memory only, so after a restart the first sample of a series is a baseline again
+// rather than an increase: the stored total never gets a lifetime total of the source added twice, at the
+// cost of the increase between the last sample before the restart and the first one after it.
+type Tracker struct {
+	mux   *sync.Mutex
+	last  map[string]sample
+	ttl   time.Duration
+	swept time.Time
+	now   func() time.Time
+}
+
+type sample struct {
+	value float64
+	// start is when the source started counting, zero when it doesn't tell.
+	start time.Time
+	seen  time.Time
+}
+
+// NewTracker creates a new instance of Tracker forgetting the series unreported for ttl.
+func NewTracker(ttl time.Duration) *Tracker {
+	return &Tracker{
+		mux:  &sync.Mutex{},
+		last: make(map[string]sample),
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// Batch returns a batch the deltas of one request are computed in.
+func (t *Tracker) Batch() *Batch {
+	return &Batch{t: t, staged: make(map[string]sample)}
+}
+
+// Batch computes the deltas of one request against the values of the tracker. They are remembered once the
+// batch is committed, after its metrics are stored, so a request that failed to be stored gets the same
+// deltas when it is retried.
+//
+// Cumulative senders report a series from one queue at a time, so batches of the same series are not
+// expected to be computed concurrently.
+type Batch struct {
+	t      *Tracker
+	staged map[string]sample
+}
+
+// Delta returns the increase of a cumulative counter since the previous value of the series.
+//
+// A series seen for the first time contributes nothing, its value being the baseline of the next ones.
+// A value lower than the previous one means the source restarted, the counter is treated as reset to zero.
+func (b *Batch) Delta(series string, value float64) float64 {
+	return b.DeltaSince(series, time.Time{}, value)
+}
+
+// DeltaSince is Delta for a source telling when it started counting, zero if it doesn't. A start differing
+// from the previous one is a reset too, so that a restart is detected even when the new value is higher.
+func (b *Batch) DeltaSince(series string, start time.Time, value float64) float64 {
+	last, found := b.staged[series]
+	if !found {
+		last, found = b.t.sample(series)
+	}
+	b.staged[series] = sample{value: value, start: start}
+	switch {
+	case !found:
+		return 0
+	case value < last.value:
+		return value
+	case !start.IsZero() && !last.start.IsZero() && !start.Equal(last.start):
+		return value
+	default:
+		return value - last.value
+	}
+}
+
+// Commit remembers the values of the batch.
+func (b *Batch) Commit() {
+	b.t.mux.Lock()
+	defer b.t.mux.Unlock()
+	now := b.t.now()
+	for series, s := range b.staged {
+		s.seen = now
+		b.t.last[series] = s
+	}
+	b.t.sweep(now)
+}
+
+func (t *Tracker) sample(series string) (sample, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	s, found := t.last[series]
+	return s, found
+}
+
+// sweep forgets the series unreported for the TTL, looking for them once per TTL.
+func (t *Tracker) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.ttl {
+		return
+	}
+	t.swept = now
+	for series, s := range t.last {
+		if now.Sub(s.seen) >= t.ttl {
+			delete(t.last, series)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package delta
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deltas computes the deltas of values in one batch and commits it.
+func deltas(tr *Tracker, series string, values ...float64) []float64 {
+	b := tr.Batch()
+	result := make([]float64, 0, len(values))
+	for _, v := range values {
+		result = append(result, b.Delta(series, v))
+	}
+	b.Commit()
+	return result
+}
+
+func TestBatch_Delta(t *testing.T) {
+	tr := NewTracker(DefaultTTL)
+	assert.Equal(t, []float64{0, 5, 0}, deltas(tr, "a", 10, 15, 15), "the first value is a baseline")
+	assert.Equal(t, []float64{0}, deltas(tr, "b", 3))
+	assert.Equal(t, []float64{4, 1}, deltas(tr, "a", 4, 5), "reset")
+	assert.Equal(t, []float64{2}, deltas(tr, "b", 5))
+}
+
+func TestBatch_DeltaSince(t *testing.T) {
+	tr := NewTracker(DefaultTTL)
+	started := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	restarted := started.Add(time.Hour)
+	b := tr.Batch()
+	assert.InDelta(t, 0.0, b.DeltaSince("a", started, 10), 0, "the first value is a baseline")
+	assert.InDelta(t, 5.0, b.DeltaSince("a", started, 15), 0)
+	assert.InDelta(t, 20.0, b.DeltaSince("a", restarted, 20), 0, "a new start is a reset, even above the last value")
+	assert.InDelta(t, 2.0, b.DeltaSince("a", time.Time{}, 22), 0, "an unknown start isn't a reset")
+	b.Commit()
+
+	b = tr.Batch()
+	assert.InDelta(t, 3.0, b.DeltaSince("a", restarted, 25), 0)
+	b.Commit()
+}
+
+func TestBatch_Uncommitted(t *testing.T) {
+	tr := NewTracker(DefaultTTL)
+	deltas(tr, "a", 10)
+
+	failed := tr.Batch()
+	assert.InDelta(t, 5.0, failed.Delta("a", 15), 0)
+	// The batch failed to be stored, so its retry gets the same delta.
+	assert.Equal(t, []float64{5}, deltas(tr, "a", 15))
+	assert.Equal(t, []float64{0}, deltas(tr, "a", 15))
+}
+
+func TestTracker_Restart(t *testing.T) {
+	tr := NewTracker(DefaultTTL)
+	deltas(tr, "a", 10, 15)
+
+	restarted := NewTracker(DefaultTTL)
+	assert.Equal(t, []float64{0, 1}, deltas(restarted, "a", 100, 101),
+		"the lifetime total isn't added again after a restart")
+}
+
+func TestTracker_Sweep(t *testing.T) {
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tr := NewTracker(time.Minute)
+	tr.now = func() time.Time { return now }
+	deltas(tr, "a", 10)
+	deltas(tr, "b", 10)
+
+	now = now.Add(45 * time.Second)
+	deltas(tr, "b", 12)
+	now = now.Add(30 * time.Second)
+	deltas(tr, "c", 1)
+	assert.NotContains(t, tr.last, "a", "unreported for the TTL")
+	assert.Contains(t, tr.last, "b")
+	assert.Equal(t, []float64{0}, deltas(tr, "a", 15), "a forgotten series starts from a baseline")
+}
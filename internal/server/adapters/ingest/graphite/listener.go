@@ -0,0 +1,190 @@
+// Package graphite receives samples sent over the Graphite plaintext protocol.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	// maxLineSize limits the length of a line, longer lines are dropped.
+	maxLineSize = 64 << 10
+	// maxBatchSize limits the number of samples stored at once.
+	maxBatchSize = 1000
+	// maxConnections limits the number of open connections, the connections beyond it are closed at once.
+	maxConnections = 1024
+	// readTimeout is how long a line may take to be read before its connection is closed.
+	readTimeout = 5 * time.Minute
+)
+
+// MetricService defines the interface for metric operations.
+type MetricService interface {
+	// SetMetrics sets multiple metrics at once.
+	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
+}
+
+// Listener accepts Graphite plaintext connections.
+type Listener struct {
+	address        string
+	parser         *Parser
+	metricService  MetricService
+	maxConnections int
+	readTimeout    time.Duration
+}
+
+// NewListener creates a new instance of Listener.
+func NewListener(address string, parser *Parser, metricService MetricService) *Listener {
+	return &Listener{
+		address:        address,
+		parser:         parser,
+		metricService:  metricService,
+		maxConnections: maxConnections,
+		readTimeout:    readTimeout,
+	}
+}
+
+// Run accepts connections until ctx is done.
+func (l *Listener) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", l.address)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	return l.Serve(ctx, listener)
+}
+
+// Serve accepts connections on listener until ctx is done, then closes it and waits for open connections.
+func (l *Listener) Serve(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+	open := make(chan struct{}, l.maxConnections)
+	stop := context.AfterFunc(ctx, func() {
+		if err := listener.Close(); err != nil {
+			logger.Log.Error("failed to close graphite listener", zap.Error(err))
+		}
+	})
+	defer stop()
+	logger.Log.Info("started graphite listener", zap.String("address", listener.Addr().String()))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		select {
+		case open <- struct{}{}:
+		default:
+			logger.Log.Warn("too many graphite connections", zap.String("remote", conn.RemoteAddr().String()))
+			closeConn(conn)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-open
+				wg.Done()
+			}()
+			l.handle(ctx, conn)
+		}()
+	}
+}
+
+// handle reads lines from a connection. Samples are batched while more data is buffered and stored once
+// the sender pauses, so a burst of lines becomes a single SetMetrics call. The cumulative values of a batch
+// are remembered once it is stored, the increases of a batch that failed are added by the next one.
+func (l *Listener) handle(ctx context.Context, conn net.Conn) {
+	// Closing the connection on shutdown unblocks the pending read.
+	stop := context.AfterFunc(ctx, func() { closeConn(conn) })
+	defer func() {
+		if stop() {
+			closeConn(conn)
+		}
+	}()
+	r := bufio.NewReaderSize(conn, maxLineSize)
+	batch := make(domain.MetricsList, 0, maxBatchSize)
+	counters := l.parser.Batch()
+	for {
+		line, err := l.readLine(conn, r)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			logger.Log.Info("graphite line is too long", zap.String("remote", conn.RemoteAddr().String()))
+			line, err = nil, l.skipLine(conn, r)
+		}
+		if len(line) > 0 {
+			m, ok, perr := l.parser.ParseLine(counters, string(line))
+			if perr != nil {
+				logger.Log.Info("cannot parse graphite line", zap.ByteString("line", line), zap.Error(perr))
+			} else if ok {
+				batch = append(batch, m)
+			}
+		}
+		if err != nil || r.Buffered() == 0 || len(batch) == maxBatchSize {
+			if l.flush(ctx, batch) {
+				counters.Commit()
+			}
+			batch, counters = batch[:0], l.parser.Batch()
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF) || ctx.Err() != nil:
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				logger.Log.Info("graphite connection timed out", zap.String("remote", conn.RemoteAddr().String()))
+			default:
+				logger.Log.Info("graphite connection failed", zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// flush stores a batch and reports whether it was stored.
+func (l *Listener) flush(ctx context.Context, batch domain.MetricsList) bool {
+	if len(batch) == 0 {
+		return true
+	}
+	if _, err := l.metricService.SetMetrics(context.WithoutCancel(ctx), batch); err != nil {
+		logger.Log.Error("failed to set graphite metrics", zap.Int("count", len(batch)), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// readLine reads a line from the connection, which is closed when no line is sent within the read timeout.
+func (l *Listener) readLine(conn net.Conn, r *bufio.Reader) ([]byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(l.readTimeout)); err != nil {
+		return nil, fmt.Errorf("failed to set read deadline: %w", err)
+	}
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return line, fmt.Errorf("%w", err)
+	}
+	return line, nil
+}
+
+// skipLine discards the rest of a line that doesn't fit the buffer.
+func (l *Listener) skipLine(conn net.Conn, r *bufio.Reader) error {
+	for {
+		_, err := l.readLine(conn, r)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return err
+		}
+	}
+}
+
+func closeConn(conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		logger.Log.Debug("failed to close graphite connection", zap.Error(err))
+	}
+}
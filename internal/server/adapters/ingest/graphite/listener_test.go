@@ -0,0 +1,121 @@
+package graphite
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/ingest/rules"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+func TestListener_Serve(t *testing.T) {
+	metricStorage, err := memory.NewStorage(&memory.Config{})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	r, err := rules.Parse("*.hits=counter")
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- NewListener("", NewParser(r), metricService).Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("api.hits 2 1700000000\nbroken line here now\napi.hits 3 1700000000\ncpu;host=web1 0.25 1700000000\n"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	ctx2 := context.Background()
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		m, err := metricService.GetMetric(ctx2, domain.Counter, "api.hits")
+		if assert.NoError(c, err) {
+			assert.Equal(c, int64(5), *m.Delta)
+		}
+		m, err = metricService.GetMetric(ctx2, domain.Gauge, `cpu{host="web1"}`)
+		if assert.NoError(c, err) {
+			assert.InDelta(c, 0.25, *m.Value, 0)
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener didn't stop")
+	}
+}
+
+func TestListener_ServeLimits(t *testing.T) {
+	metricStorage, err := memory.NewStorage(&memory.Config{})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	r, err := rules.Parse("*.hits=counter")
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	l := NewListener("", NewParser(r), metricService)
+	l.maxConnections, l.readTimeout = 1, 200*time.Millisecond
+	go func() {
+		assert.NoError(t, l.Serve(ctx, ln))
+	}()
+
+	idle, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	_, err = idle.Write([]byte("api.hits 1 1700000000\n"))
+	require.NoError(t, err)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		_, err := metricService.GetMetric(ctx, domain.Counter, "api.hits")
+		assert.NoError(c, err)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	extra, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer extra.Close()
+	require.NoError(t, extra.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = extra.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF, "the connections beyond the limit are closed")
+
+	require.NoError(t, idle.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = idle.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF, "a silent connection is closed after the read timeout")
+
+	// The slot of the closed connection is released once it is handled, shortly after the close.
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if !assert.NoError(c, err) {
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("api.hits 2 1700000000\n"))
+		assert.NoError(c, err)
+		assert.NoError(c, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(c, err, os.ErrDeadlineExceeded, "the connection is accepted")
+	}, 5*time.Second, 10*time.Millisecond)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		m, err := metricService.GetMetric(ctx, domain.Counter, "api.hits")
+		if assert.NoError(c, err) {
+			assert.Equal(c, int64(3), *m.Delta)
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+}
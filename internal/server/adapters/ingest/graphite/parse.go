@@ -0,0 +1,110 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"metrics/internal/server/adapters/ingest/delta"
+	"metrics/internal/server/adapters/ingest/rules"
+	"metrics/internal/server/core/domain"
+)
+
+var (
+	ErrIncorrectLine  = errors.New("incorrect graphite line")
+	ErrIncorrectValue = errors.New("incorrect graphite value")
+)
+
+// point is a single sample of the plaintext protocol.
+type point struct {
+	path  string
+	tags  map[string]string
+	value float64
+}
+
+// parseLine parses a "path value [timestamp]" line, the path may carry tags as in "cpu;host=web1;dc=eu".
+//
+// The timestamp is validated but dropped, samples are stored as received.
+func parseLine(line string) (point, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return point{}, fmt.Errorf("%w: expected path, value and timestamp", ErrIncorrectLine)
+	}
+	p, err := parsePath(fields[0])
+	if err != nil {
+		return point{}, err
+	}
+	p.value, err = strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return point{}, fmt.Errorf("%w %q", ErrIncorrectValue, fields[1])
+	}
+	if len(fields) == 3 && fields[2] != "-1" && fields[2] != "N" {
+		if _, err = strconv.ParseFloat(fields[2], 64); err != nil {
+			return point{}, fmt.Errorf("%w: timestamp %q", ErrIncorrectLine, fields[2])
+		}
+	}
+	return p, nil
+}
+
+func parsePath(s string) (point, error) {
+	parts := strings.Split(s, ";")
+	p := point{path: parts[0]}
+	if len(parts) > 1 {
+		p.tags = make(map[string]string, len(parts)-1)
+	}
+	for _, tag := range parts[1:] {
+		k, v, found := strings.Cut(tag, "=")
+		if !found || v == "" {
+			return point{}, fmt.Errorf("%w: tag %q", ErrIncorrectLine, tag)
+		}
+		p.tags[k] = v
+	}
+	if err := domain.ValidateSeries(p.path, p.tags); err != nil {
+		return point{}, fmt.Errorf("%w: %w", ErrIncorrectLine, err)
+	}
+	return p, nil
+}
+
+// Parser maps Graphite lines to metrics, the path is the metric name and tags become labels.
+type Parser struct {
+	rules *rules.Rules
+}
+
+// NewParser creates a new instance of Parser.
+func NewParser(r *rules.Rules) *Parser {
+	return &Parser{rules: r}
+}
+
+// Batch returns the batch the cumulative samples of one write are converted in, see rules.Rules.Batch.
+func (p *Parser) Batch() *delta.Batch {
+	return p.rules.Batch()
+}
+
+// Parse parses newline separated lines, empty lines are skipped.
+func (p *Parser) Parse(counters *delta.Batch, data string) (domain.MetricsList, error) {
+	metrics := make(domain.MetricsList, 0)
+	for _, line := range strings.Split(data, "\n") {
+		m, ok, err := p.ParseLine(counters, line)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			metrics = append(metrics, m)
+		}
+	}
+	return metrics, nil
+}
+
+// ParseLine parses a single line. It reports false for empty lines and samples that can't be stored.
+func (p *Parser) ParseLine(counters *delta.Batch, line string) (domain.Metric, bool, error) {
+	if strings.TrimSpace(line) == "" {
+		return domain.Metric{}, false, nil
+	}
+	pt, err := parseLine(line)
+	if err != nil {
+		return domain.Metric{}, false, err
+	}
+	m, ok := p.rules.Metric(counters, pt.path, domain.SeriesID(pt.path, pt.tags), pt.value)
+	return m, ok, nil
+}
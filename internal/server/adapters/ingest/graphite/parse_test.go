@@ -0,0 +1,95 @@
+package graphite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/ingest/rules"
+	"metrics/internal/server/core/domain"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want point
+	}{
+		{name: "timestamp", line: "servers.web1.cpu 0.5 1700000000", want: point{path: "servers.web1.cpu", value: 0.5}},
+		{name: "no timestamp", line: "servers.web1.cpu 42", want: point{path: "servers.web1.cpu", value: 42}},
+		{name: "now", line: "cpu\t1e3\t-1\r\n", want: point{path: "cpu", value: 1000}},
+		{
+			name: "tags",
+			line: "cpu;host=web1;dc=eu 7 1700000000",
+			want: point{path: "cpu", tags: map[string]string{"host": "web1", "dc": "eu"}, value: 7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestParseLineError(t *testing.T) {
+	for _, line := range []string{
+		"cpu",
+		"cpu 1 2 3",
+		"cpu one",
+		"cpu 1 yesterday",
+		";host=web1 1",
+		"cpu;host 1",
+		"cpu;=web1 1",
+		"c{pu 1",
+	} {
+		_, err := parseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParser_Parse(t *testing.T) {
+	r, err := rules.Parse("stats_counts.*=counter")
+	require.NoError(t, err)
+	p := NewParser(r)
+	metrics, err := p.Parse(p.Batch(), "servers.web1.cpu 0.5 1700000000\n\nstats_counts.hits 3 1700000000\ncpu;host=web1 nan\n")
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, "servers.web1.cpu", metrics[0].ID)
+	assert.Equal(t, domain.Gauge, metrics[0].MType)
+	assert.InDelta(t, 0.5, *metrics[0].Value, 0)
+	assert.Equal(t, "stats_counts.hits", metrics[1].ID)
+	assert.Equal(t, domain.Counter, metrics[1].MType)
+	assert.Equal(t, int64(3), *metrics[1].Delta)
+
+	_, err = p.Parse(p.Batch(), "cpu 1\ncpu one\n")
+	require.ErrorIs(t, err, ErrIncorrectValue)
+}
+
+func FuzzParseLine(f *testing.F) {
+	for _, seed := range []string{
+		"servers.web1.cpu 0.5 1700000000",
+		"cpu;host=web1;dc=eu 7 -1",
+		"cpu 1e309",
+		"cpu NaN N",
+		";=; 1",
+		"c{pu;a=b 1",
+	} {
+		f.Add(seed)
+	}
+	r, err := rules.New(rules.Rule{Pattern: "*.count", Kind: rules.Cumulative})
+	require.NoError(f, err)
+	p := NewParser(r)
+	f.Fuzz(func(t *testing.T, line string) {
+		m, ok, err := p.ParseLine(p.Batch(), line)
+		if err != nil || !ok {
+			return
+		}
+		name, _, err := domain.ParseSeriesID(m.ID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, name)
+		require.NoError(t, domain.ValidateMetric(&m))
+	})
+}
@@ -0,0 +1,68 @@
+// Package influx receives samples sent over the InfluxDB line protocol.
+package influx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+// maxBodySize limits the size of a write request.
+const maxBodySize = 16 << 20
+
+// MetricService defines the interface for metric operations.
+type MetricService interface {
+	// SetMetrics sets multiple metrics at once.
+	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
+}
+
+// Handler accepts line protocol write requests, as sent to the /write endpoint of InfluxDB.
+type Handler struct {
+	parser        *Parser
+	metricService MetricService
+}
+
+// NewHandler creates a new instance of Handler.
+func NewHandler(parser *Parser, metricService MetricService) *Handler {
+	return &Handler{
+		parser:        parser,
+		metricService: metricService,
+	}
+}
+
+// ServeHTTP stores the points of a request as a single batch, a request with a malformed line is rejected whole.
+// The cumulative values of its samples are remembered once the batch is stored.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		logger.Log.Info("cannot read line protocol body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	counters := h.parser.Batch()
+	metrics, err := h.parser.Parse(counters, string(body))
+	if err != nil {
+		logger.Log.Info("cannot parse line protocol", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(metrics) > 0 {
+		if _, err = h.metricService.SetMetrics(req.Context(), metrics); err != nil {
+			logger.Log.Error("failed to set line protocol metrics", zap.Error(err))
+			if errors.Is(err, domain.ErrIncorrectMetricType) || errors.Is(err, domain.ErrIncorrectMetricValue) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	counters.Commit()
+	w.WriteHeader(http.StatusNoContent)
+}
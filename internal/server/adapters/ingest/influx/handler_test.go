@@ -0,0 +1,51 @@
+package influx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/ingest/rules"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	metricStorage, err := memory.NewStorage(&memory.Config{})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	r, err := rules.Parse("*_hits=counter")
+	require.NoError(t, err)
+	h := NewHandler(NewParser(r), metricService)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "ok", body: "api,host=web1 hits=2i,load=0.75\napi,host=web1 hits=3i\n", want: http.StatusNoContent},
+		{name: "malformed", body: "api,host=web1 hits=1i\napi hits\n", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(tt.body)))
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	ctx := context.Background()
+	m, err := metricService.GetMetric(ctx, domain.Counter, `api_hits{host="web1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *m.Delta, "malformed request must not be stored")
+	m, err = metricService.GetMetric(ctx, domain.Gauge, `api_load{host="web1"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.75, *m.Value, 0)
+}
@@ -0,0 +1,220 @@
+package influx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"metrics/internal/server/adapters/ingest/delta"
+	"metrics/internal/server/adapters/ingest/rules"
+	"metrics/internal/server/core/domain"
+)
+
+var (
+	ErrIncorrectLine  = errors.New("incorrect line protocol")
+	ErrIncorrectField = errors.New("incorrect field value")
+)
+
+// valueField is the field stored under the bare measurement name.
+const valueField = "value"
+
+type field struct {
+	key   string
+	value float64
+}
+
+// point is a single line of the line protocol: measurement,tags fields timestamp.
+type point struct {
+	measurement string
+	tags        map[string]string
+	fields      []field
+}
+
+// parseLine parses a line protocol line. String fields are skipped, booleans are read as 0 and 1,
+// and the timestamp is validated but dropped, samples are stored as received.
+func parseLine(line string) (point, error) {
+	key, rest, err := cutSection(line, false)
+	if err != nil {
+		return point{}, err
+	}
+	fields, rest, err := cutSection(rest, true)
+	if err != nil {
+		return point{}, err
+	}
+	if ts := strings.TrimSpace(rest); ts != "" {
+		if _, err = strconv.ParseInt(ts, 10, 64); err != nil {
+			return point{}, fmt.Errorf("%w: timestamp %q", ErrIncorrectLine, ts)
+		}
+	}
+
+	parts := split(key, ',', false)
+	p := point{measurement: unescape(parts[0])}
+	if len(parts) > 1 {
+		p.tags = make(map[string]string, len(parts)-1)
+	}
+	for _, tag := range parts[1:] {
+		k, v, found := cut(tag, '=')
+		if !found || k == "" || v == "" {
+			return point{}, fmt.Errorf("%w: tag %q", ErrIncorrectLine, tag)
+		}
+		p.tags[unescape(k)] = unescape(v)
+	}
+	if err = domain.ValidateSeries(p.measurement, p.tags); err != nil {
+		return point{}, fmt.Errorf("%w: %w", ErrIncorrectLine, err)
+	}
+
+	if fields == "" {
+		return point{}, fmt.Errorf("%w: no fields", ErrIncorrectLine)
+	}
+	for _, f := range split(fields, ',', true) {
+		k, v, found := cut(f, '=')
+		if !found || k == "" || v == "" {
+			return point{}, fmt.Errorf("%w: field %q", ErrIncorrectLine, f)
+		}
+		value, numeric, err := parseFieldValue(v)
+		if err != nil {
+			return point{}, err
+		}
+		if numeric {
+			p.fields = append(p.fields, field{key: unescape(k), value: value})
+		}
+	}
+	return p, nil
+}
+
+// parseFieldValue parses a field value, it reports false for string fields.
+func parseFieldValue(v string) (float64, bool, error) {
+	switch {
+	case v[0] == '"':
+		if len(v) < 2 || v[len(v)-1] != '"' {
+			return 0, false, fmt.Errorf("%w %q", ErrIncorrectField, v)
+		}
+		return 0, false, nil
+	case v == "t" || v == "T" || v == "true" || v == "True" || v == "TRUE":
+		return 1, true, nil
+	case v == "f" || v == "F" || v == "false" || v == "False" || v == "FALSE":
+		return 0, true, nil
+	case v[len(v)-1] == 'i':
+		i, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w %q", ErrIncorrectField, v)
+		}
+		return float64(i), true, nil
+	case v[len(v)-1] == 'u':
+		u, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w %q", ErrIncorrectField, v)
+		}
+		return float64(u), true, nil
+	default:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w %q", ErrIncorrectField, v)
+		}
+		return f, true, nil
+	}
+}
+
+// cutSection cuts s around the first unescaped space, spaces inside quoted strings are skipped when quoted is set.
+func cutSection(s string, quoted bool) (string, string, error) {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuotes = !inQuotes
+		case s[i] == ' ' && !inQuotes:
+			return s[:i], s[i+1:], nil
+		}
+	}
+	if inQuotes {
+		return "", "", fmt.Errorf("%w: unterminated string", ErrIncorrectLine)
+	}
+	return s, "", nil
+}
+
+// split splits s around unescaped separators, separators inside quoted strings are skipped when quoted is set.
+func split(s string, sep byte, quoted bool) []string {
+	var parts []string
+	inQuotes, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"' && quoted:
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// cut cuts s around the first unescaped separator.
+func cut(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+var unescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ", `\\`, `\`)
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return unescaper.Replace(s)
+}
+
+// Parser maps line protocol points to metrics. A field is named measurement_field, the value field keeps
+// the bare measurement name, and tags become labels.
+type Parser struct {
+	rules *rules.Rules
+}
+
+// NewParser creates a new instance of Parser.
+func NewParser(r *rules.Rules) *Parser {
+	return &Parser{rules: r}
+}
+
+// Batch returns the batch the cumulative samples of one write are converted in, see rules.Rules.Batch.
+func (p *Parser) Batch() *delta.Batch {
+	return p.rules.Batch()
+}
+
+// Parse parses newline separated lines, empty lines and comments are skipped.
+func (p *Parser) Parse(counters *delta.Batch, data string) (domain.MetricsList, error) {
+	metrics := make(domain.MetricsList, 0)
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		pt, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		for _, f := range pt.fields {
+			name := pt.measurement
+			if f.key != valueField {
+				name += "_" + f.key
+			}
+			if err = domain.ValidateSeries(name, nil); err != nil {
+				return nil, fmt.Errorf("line %d: %w: %w", n+1, ErrIncorrectLine, err)
+			}
+			if m, ok := p.rules.Metric(counters, name, domain.SeriesID(name, pt.tags), f.value); ok {
+				metrics = append(metrics, m)
+			}
+		}
+	}
+	return metrics, nil
+}
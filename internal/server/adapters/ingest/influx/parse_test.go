@@ -0,0 +1,135 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/ingest/rules"
+	"metrics/internal/server/core/domain"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want point
+	}{
+		{
+			name: "float",
+			line: "cpu,host=web1,region=eu usage=0.5 1700000000000000000",
+			want: point{
+				measurement: "cpu",
+				tags:        map[string]string{"host": "web1", "region": "eu"},
+				fields:      []field{{key: "usage", value: 0.5}},
+			},
+		},
+		{
+			name: "types",
+			line: `disk free=12i,total=40u,ok=t,failed=FALSE,path="/var, /tmp",ratio=-1.5e2`,
+			want: point{
+				measurement: "disk",
+				fields: []field{
+					{key: "free", value: 12}, {key: "total", value: 40}, {key: "ok", value: 1},
+					{key: "failed", value: 0}, {key: "ratio", value: -150},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseLine(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestParseLineEscapes(t *testing.T) {
+	p, err := parseLine(`my\ cpu,host=web\,1\ a value=1,msg="say \"hi\", bye" 1700000000`)
+	require.NoError(t, err)
+	assert.Equal(t, point{
+		measurement: "my cpu",
+		tags:        map[string]string{"host": "web,1 a"},
+		fields:      []field{{key: "value", value: 1}},
+	}, p)
+}
+
+func TestParseLineError(t *testing.T) {
+	for _, line := range []string{
+		"cpu",
+		"cpu ",
+		"cpu usage",
+		"cpu usage=",
+		"cpu usage=abc",
+		"cpu usage=1x",
+		"cpu usage=12.5i",
+		"cpu usage=-1u",
+		`cpu msg="open`,
+		"cpu,host usage=1",
+		"cpu,=web1 usage=1",
+		",host=web1 usage=1",
+		"cpu usage=1 yesterday",
+		"c{pu usage=1",
+		`cpu,host\=name=web1 usage=1`,
+	} {
+		_, err := parseLine(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParser_Parse(t *testing.T) {
+	r, err := rules.Parse("*_requests=cumulative")
+	require.NoError(t, err)
+	p := NewParser(r)
+	counters := p.Batch()
+	metrics, err := p.Parse(counters, "# comment\n\nhttp,code=200 requests=10i,latency=0.25\ntemperature value=21.5 1700000000\n")
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, domain.Metric{ID: `http_requests{code="200"}`, MType: domain.Counter, Delta: metrics[0].Delta}, metrics[0])
+	assert.Equal(t, int64(0), *metrics[0].Delta, "the first sample is a baseline")
+	assert.Equal(t, `http_latency{code="200"}`, metrics[1].ID)
+	assert.Equal(t, domain.Gauge, metrics[1].MType)
+	assert.Equal(t, "temperature", metrics[2].ID)
+	assert.InDelta(t, 21.5, *metrics[2].Value, 0)
+
+	counters.Commit()
+
+	_, err = p.Parse(p.Batch(), "http,code=200 requests=14i\ncpu value=1\ncpu value=x\n")
+	require.ErrorIs(t, err, ErrIncorrectField)
+	assert.ErrorContains(t, err, "line 3")
+
+	// The rejected request left the tracked value as it was.
+	metrics, err = p.Parse(p.Batch(), "http,code=200 requests=14i")
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, int64(4), *metrics[0].Delta)
+}
+
+func FuzzParseLine(f *testing.F) {
+	for _, seed := range []string{
+		"cpu,host=web1,region=eu usage=0.5 1700000000000000000",
+		`disk free=12i,total=40u,ok=t,path="/var, /tmp"`,
+		`my\ cpu,host=web\,1 value=1,msg="say \"hi\""`,
+		"cpu value=1e309",
+		`a,b=c d="e\\" 1`,
+	} {
+		f.Add(seed)
+	}
+	r, err := rules.New(rules.Rule{Pattern: "*_count", Kind: rules.Cumulative})
+	require.NoError(f, err)
+	p := NewParser(r)
+	f.Fuzz(func(t *testing.T, line string) {
+		metrics, err := p.Parse(p.Batch(), line)
+		if err != nil {
+			return
+		}
+		for _, m := range metrics {
+			name, _, err := domain.ParseSeriesID(m.ID)
+			require.NoError(t, err)
+			assert.NotEmpty(t, name)
+			require.NoError(t, domain.ValidateMetric(&m))
+		}
+	})
+}
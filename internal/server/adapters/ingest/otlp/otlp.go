@@ -0,0 +1,277 @@
+// Package otlp receives metrics sent by OpenTelemetry SDKs over OTLP/HTTP.
+package otlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"metrics/internal/server/adapters/ingest/delta"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	contentType     = "Content-Type"
+	contentProtobuf = "application/x-protobuf"
+	contentJSON     = "application/json"
+
+	// maxBodySize limits the size of an export request.
+	maxBodySize = 16 << 20
+)
+
+// MetricService defines the interface for metric operations.
+type MetricService interface {
+	// SetMetrics sets multiple metrics at once.
+	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
+}
+
+// Handler accepts OTLP/HTTP export requests encoded as protobuf or JSON.
+type Handler struct {
+	metricService MetricService
+	counters      *delta.Tracker
+}
+
+// NewHandler creates a new instance of Handler.
+func NewHandler(metricService MetricService) *Handler {
+	return &Handler{
+		metricService: metricService,
+		counters:      delta.NewTracker(delta.DefaultTTL),
+	}
+}
+
+// ServeHTTP stores the data points of an export request as a single batch. Data points that can't be
+// stored are reported in the partial success of the response. The cumulative values of its sums are
+// remembered once the batch is stored, so a retried request adds the same increases.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get(contentType))
+	if err != nil || (mediaType != contentProtobuf && mediaType != contentJSON) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		logger.Log.Info("cannot read otlp body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var export colmetricspb.ExportMetricsServiceRequest
+	if mediaType == contentJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, &export)
+	} else {
+		err = proto.Unmarshal(body, &export)
+	}
+	if err != nil {
+		logger.Log.Info("cannot decode otlp request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	counters := h.counters.Batch()
+	metrics, rejected := h.metrics(counters, export.GetResourceMetrics())
+	if len(metrics) > 0 {
+		if _, err = h.metricService.SetMetrics(req.Context(), metrics); err != nil {
+			logger.Log.Error("failed to set otlp metrics", zap.Error(err))
+			if errors.Is(err, domain.ErrIncorrectMetricType) || errors.Is(err, domain.ErrIncorrectMetricValue) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// OTLP clients retry 503 responses, unlike 500.
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	counters.Commit()
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected.count > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected.count,
+			ErrorMessage:       rejected.String(),
+		}
+	}
+	var out []byte
+	if mediaType == contentJSON {
+		out, err = protojson.Marshal(resp)
+	} else {
+		out, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		logger.Log.Error("error encoding otlp response", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(contentType, mediaType)
+	if _, err = w.Write(out); err != nil {
+		logger.Log.Error("error writing otlp response", zap.Error(err))
+	}
+}
+
+// rejection counts the data points that were not stored and remembers why.
+type rejection struct {
+	count   int64
+	reasons []string
+}
+
+func (r *rejection) add(n int, reason string) {
+	if n == 0 {
+		return
+	}
+	r.count += int64(n)
+	if !slices.Contains(r.reasons, reason) {
+		r.reasons = append(r.reasons, reason)
+	}
+}
+
+func (r *rejection) String() string {
+	return strings.Join(r.reasons, "; ")
+}
+
+// metrics maps data points to metrics. The metric name is kept as is, resource and data point attributes
+// become labels, with data point attributes taking precedence.
+//
+// Gauges and non-monotonic cumulative sums are stored as gauges, monotonic sums as counters, where
+// cumulative values are converted into deltas, a changed start time being a reset. Histograms, summaries
+// and non-monotonic delta sums are rejected.
+func (h *Handler) metrics(
+	counters *delta.Batch,
+	resourceMetrics []*metricspb.ResourceMetrics,
+) (domain.MetricsList, rejection) {
+	var (
+		metrics  domain.MetricsList
+		rejected rejection
+	)
+	for _, rm := range resourceMetrics {
+		resource := attributes(nil, rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					metrics = appendPoints(metrics, &rejected, counters, m.GetName(), resource,
+						data.Gauge.GetDataPoints(), domain.Gauge, false)
+				case *metricspb.Metric_Sum:
+					temporality := data.Sum.GetAggregationTemporality()
+					cumulative := temporality != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+					mType := domain.Counter
+					if !data.Sum.GetIsMonotonic() {
+						if !cumulative {
+							rejected.add(len(data.Sum.GetDataPoints()),
+								fmt.Sprintf("%s: non-monotonic delta sums are not supported", m.GetName()))
+							continue
+						}
+						mType = domain.Gauge
+					}
+					metrics = appendPoints(metrics, &rejected, counters, m.GetName(), resource,
+						data.Sum.GetDataPoints(), mType, cumulative)
+				case *metricspb.Metric_Histogram:
+					rejected.add(len(data.Histogram.GetDataPoints()),
+						fmt.Sprintf("%s: histograms are not supported", m.GetName()))
+				case *metricspb.Metric_ExponentialHistogram:
+					rejected.add(len(data.ExponentialHistogram.GetDataPoints()),
+						fmt.Sprintf("%s: exponential histograms are not supported", m.GetName()))
+				case *metricspb.Metric_Summary:
+					rejected.add(len(data.Summary.GetDataPoints()),
+						fmt.Sprintf("%s: summaries are not supported", m.GetName()))
+				}
+			}
+		}
+	}
+	return metrics, rejected
+}
+
+// appendPoints appends the metrics of number data points, points without a recorded value are skipped.
+func appendPoints(
+	metrics domain.MetricsList,
+	rejected *rejection,
+	counters *delta.Batch,
+	name string,
+	resource map[string]string,
+	points []*metricspb.NumberDataPoint,
+	mType string,
+	cumulative bool,
+) domain.MetricsList {
+	for _, dp := range points {
+		if dp.GetFlags()&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0 {
+			continue
+		}
+		m, err := metric(counters, name, resource, dp, mType, cumulative)
+		if err != nil {
+			rejected.add(1, err.Error())
+			continue
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func metric(
+	counters *delta.Batch,
+	name string,
+	resource map[string]string,
+	dp *metricspb.NumberDataPoint,
+	mType string,
+	cumulative bool,
+) (domain.Metric, error) {
+	labels := attributes(resource, dp.GetAttributes())
+	if err := domain.ValidateSeries(name, labels); err != nil {
+		return domain.Metric{}, fmt.Errorf("%s: %w", name, err)
+	}
+	id := domain.SeriesID(name, labels)
+	value := dp.GetAsDouble()
+	if v, ok := dp.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		value = float64(v.AsInt)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return domain.Metric{}, fmt.Errorf("%s: %w", name, domain.ErrIncorrectMetricValue)
+	}
+	switch {
+	case mType == domain.Gauge:
+		return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}, nil
+	case cumulative:
+		var start time.Time
+		if dp.GetStartTimeUnixNano() != 0 {
+			start = time.Unix(0, int64(dp.GetStartTimeUnixNano()))
+		}
+		d := int64(counters.DeltaSince(id, start, math.Round(value)))
+		return domain.Metric{ID: id, MType: domain.Counter, Delta: &d}, nil
+	default:
+		d := int64(math.Round(value))
+		return domain.Metric{ID: id, MType: domain.Counter, Delta: &d}, nil
+	}
+}
+
+// attributes merges scalar attributes into a copy of base, arrays, maps and bytes are skipped.
+func attributes(base map[string]string, attrs []*commonpb.KeyValue) map[string]string {
+	labels := make(map[string]string, len(base)+len(attrs))
+	for k, v := range base {
+		labels[k] = v
+	}
+	for _, kv := range attrs {
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			labels[kv.GetKey()] = v.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			labels[kv.GetKey()] = strconv.FormatBool(v.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			labels[kv.GetKey()] = strconv.FormatInt(v.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			labels[kv.GetKey()] = strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+		}
+	}
+	return labels
+}
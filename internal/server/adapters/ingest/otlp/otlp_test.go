@@ -0,0 +1,236 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+func newMetricService(t *testing.T) *service.MetricService {
+	t.Helper()
+	metricStorage, err := memory.NewStorage(&memory.Config{})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	return metricService
+}
+
+func attr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func intPoint(v int64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{Attributes: attrs, Value: &metricspb.NumberDataPoint_AsInt{AsInt: v}}
+}
+
+func doublePoint(v float64, attrs ...*commonpb.KeyValue) *metricspb.NumberDataPoint {
+	return &metricspb.NumberDataPoint{Attributes: attrs, Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: v}}
+}
+
+func exportRequest(requests int64) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{attr("service.name", "api")}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{Name: "http.requests", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				IsMonotonic:            true,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				DataPoints:             []*metricspb.NumberDataPoint{intPoint(requests, attr("code", "200"))},
+			}}},
+			{Name: "jobs.done", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				IsMonotonic:            true,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+				DataPoints:             []*metricspb.NumberDataPoint{intPoint(3)},
+			}}},
+			{Name: "queue.size", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				DataPoints:             []*metricspb.NumberDataPoint{intPoint(-2)},
+			}}},
+			{Name: "cpu.usage", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{
+					doublePoint(0.5, attr("service.name", "worker")),
+					doublePoint(math.NaN()),
+				},
+			}}},
+			{Name: "http.duration", Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				DataPoints: []*metricspb.HistogramDataPoint{{Count: 1}, {Count: 2}},
+			}}},
+		}}},
+	}}}
+}
+
+func post(
+	t *testing.T,
+	h http.Handler,
+	mediaType string,
+	req *colmetricspb.ExportMetricsServiceRequest,
+) *httptest.ResponseRecorder {
+	t.Helper()
+	var (
+		body []byte
+		err  error
+	)
+	if mediaType == contentJSON {
+		body, err = protojson.Marshal(req)
+	} else {
+		body, err = proto.Marshal(req)
+	}
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+	r.Header.Set(contentType, mediaType)
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func export(t *testing.T, h http.Handler, mediaType string, req *colmetricspb.ExportMetricsServiceRequest) *colmetricspb.ExportMetricsServiceResponse {
+	t.Helper()
+	w := post(t, h, mediaType, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, mediaType, w.Header().Get(contentType))
+
+	var resp colmetricspb.ExportMetricsServiceResponse
+	if mediaType == contentJSON {
+		require.NoError(t, protojson.Unmarshal(w.Body.Bytes(), &resp))
+	} else {
+		require.NoError(t, proto.Unmarshal(w.Body.Bytes(), &resp))
+	}
+	return &resp
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	for _, mediaType := range []string{contentProtobuf, contentJSON} {
+		t.Run(mediaType, func(t *testing.T) {
+			ctx := context.Background()
+			metricService := newMetricService(t)
+			h := NewHandler(metricService)
+
+			resp := export(t, h, mediaType, exportRequest(10))
+			assert.Equal(t, int64(3), resp.GetPartialSuccess().GetRejectedDataPoints())
+			assert.Contains(t, resp.GetPartialSuccess().GetErrorMessage(), "http.duration: histograms are not supported")
+			assert.Contains(t, resp.GetPartialSuccess().GetErrorMessage(), "cpu.usage")
+
+			resp = export(t, h, mediaType, exportRequest(25))
+			assert.Equal(t, int64(3), resp.GetPartialSuccess().GetRejectedDataPoints())
+
+			m, err := metricService.GetMetric(ctx, domain.Counter, `http.requests{code="200",service.name="api"}`)
+			require.NoError(t, err)
+			assert.Equal(t, int64(15), *m.Delta, "the first cumulative value is a baseline")
+			m, err = metricService.GetMetric(ctx, domain.Counter, `jobs.done{service.name="api"}`)
+			require.NoError(t, err)
+			assert.Equal(t, int64(6), *m.Delta)
+			m, err = metricService.GetMetric(ctx, domain.Gauge, `queue.size{service.name="api"}`)
+			require.NoError(t, err)
+			assert.InDelta(t, -2.0, *m.Value, 0)
+			m, err = metricService.GetMetric(ctx, domain.Gauge, `cpu.usage{service.name="worker"}`)
+			require.NoError(t, err)
+			assert.InDelta(t, 0.5, *m.Value, 0)
+		})
+	}
+}
+
+// flakyService fails the writes while down is set.
+type flakyService struct {
+	*service.MetricService
+	down bool
+}
+
+func (s *flakyService) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	if s.down {
+		return nil, errors.New("storage is down")
+	}
+	return s.MetricService.SetMetrics(ctx, metrics)
+}
+
+func TestHandler_ServeHTTPRetry(t *testing.T) {
+	ctx := context.Background()
+	metricService := &flakyService{MetricService: newMetricService(t)}
+	h := NewHandler(metricService)
+	export(t, h, contentProtobuf, exportRequest(10))
+
+	metricService.down = true
+	require.Equal(t, http.StatusServiceUnavailable, post(t, h, contentProtobuf, exportRequest(25)).Code)
+	metricService.down = false
+	export(t, h, contentProtobuf, exportRequest(25))
+
+	m, err := metricService.GetMetric(ctx, domain.Counter, `http.requests{code="200",service.name="api"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), *m.Delta, "the retried request adds the increase once")
+}
+
+func TestHandler_ServeHTTPRestart(t *testing.T) {
+	ctx := context.Background()
+	metricService := newMetricService(t)
+	h := NewHandler(metricService)
+	sum := func(start uint64, v int64) *colmetricspb.ExportMetricsServiceRequest {
+		dp := intPoint(v)
+		dp.StartTimeUnixNano = start
+		return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+				{Name: "http.requests", Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					IsMonotonic:            true,
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints:             []*metricspb.NumberDataPoint{dp},
+				}}},
+			}}},
+		}}}
+	}
+	export(t, h, contentProtobuf, sum(1000, 10))
+	export(t, h, contentProtobuf, sum(1000, 12))
+	export(t, h, contentProtobuf, sum(2000, 30))
+
+	m, err := metricService.GetMetric(ctx, domain.Counter, "http.requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(32), *m.Delta, "the whole value after a restart is counted")
+}
+
+func TestHandler_ServeHTTPFullSuccess(t *testing.T) {
+	req := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{
+			{Name: "up", Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+				DataPoints: []*metricspb.NumberDataPoint{doublePoint(1)},
+			}}},
+		}}},
+	}}}
+	resp := export(t, NewHandler(newMetricService(t)), contentProtobuf, req)
+	assert.Nil(t, resp.GetPartialSuccess())
+}
+
+func TestHandler_ServeHTTPBadRequest(t *testing.T) {
+	h := NewHandler(newMetricService(t))
+	tests := []struct {
+		name      string
+		mediaType string
+		body      string
+		want      int
+	}{
+		{name: "unsupported content type", mediaType: "text/plain", body: "up 1", want: http.StatusUnsupportedMediaType},
+		{name: "malformed protobuf", mediaType: contentProtobuf, body: "\xff\xff", want: http.StatusBadRequest},
+		{name: "malformed json", mediaType: contentJSON, body: "{", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewBufferString(tt.body))
+			r.Header.Set(contentType, tt.mediaType)
+			h.ServeHTTP(w, r)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
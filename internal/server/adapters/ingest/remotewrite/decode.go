@@ -0,0 +1,192 @@
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxDecodedSize limits the size of a decompressed WriteRequest.
+const maxDecodedSize = 32 << 20
+
+// Field numbers of the prometheus.WriteRequest message and the messages it is built of.
+const (
+	writeRequestTimeSeries = 1
+
+	timeSeriesLabels  = 1
+	timeSeriesSamples = 2
+
+	labelName  = 1
+	labelValue = 2
+
+	sampleValue     = 1
+	sampleTimestamp = 2
+)
+
+var (
+	ErrTooLarge     = errors.New("write request is too large")
+	ErrInvalidField = errors.New("invalid field type")
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+type timeSeries struct {
+	labels  []label
+	samples []sample
+}
+
+// decode decompresses a snappy block and parses the WriteRequest inside it.
+//
+// Only time series are decoded, metadata and fields added by later protocol versions are skipped.
+func decode(body []byte) ([]timeSeries, error) {
+	size, err := snappy.DecodedLen(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snappy block %w", err)
+	}
+	if size > maxDecodedSize {
+		return nil, ErrTooLarge
+	}
+	buf, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snappy block %w", err)
+	}
+	var series []timeSeries
+	err = consumeMessage(buf, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != writeRequestTimeSeries {
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+		v, n, err := consumeBytes(typ, b)
+		if err != nil {
+			return n, err
+		}
+		ts, err := decodeTimeSeries(v)
+		if err != nil {
+			return n, err
+		}
+		series = append(series, ts)
+		return n, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode write request %w", err)
+	}
+	return series, nil
+}
+
+func decodeTimeSeries(buf []byte) (timeSeries, error) {
+	var ts timeSeries
+	err := consumeMessage(buf, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case timeSeriesLabels:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return n, err
+			}
+			l, err := decodeLabel(v)
+			if err != nil {
+				return n, err
+			}
+			ts.labels = append(ts.labels, l)
+			return n, nil
+		case timeSeriesSamples:
+			v, n, err := consumeBytes(typ, b)
+			if err != nil {
+				return n, err
+			}
+			s, err := decodeSample(v)
+			if err != nil {
+				return n, err
+			}
+			ts.samples = append(ts.samples, s)
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	return ts, err
+}
+
+func decodeLabel(buf []byte) (label, error) {
+	var l label
+	err := consumeMessage(buf, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case labelName:
+			v, n, err := consumeBytes(typ, b)
+			l.name = string(v)
+			return n, err
+		case labelValue:
+			v, n, err := consumeBytes(typ, b)
+			l.value = string(v)
+			return n, err
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	return l, err
+}
+
+func decodeSample(buf []byte) (sample, error) {
+	var s sample
+	err := consumeMessage(buf, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case sampleValue:
+			if typ != protowire.Fixed64Type {
+				return 0, ErrInvalidField
+			}
+			v, n := protowire.ConsumeFixed64(b)
+			s.value = math.Float64frombits(v)
+			return n, nil
+		case sampleTimestamp:
+			if typ != protowire.VarintType {
+				return 0, ErrInvalidField
+			}
+			v, n := protowire.ConsumeVarint(b)
+			s.timestamp = int64(v)
+			return n, nil
+		default:
+			return protowire.ConsumeFieldValue(num, typ, b), nil
+		}
+	})
+	return s, err
+}
+
+// consumeMessage walks over the fields of a message, fn consumes the value of a field and returns its length.
+func consumeMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := fn(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeBytes(typ protowire.Type, b []byte) ([]byte, int, error) {
+	if typ != protowire.BytesType {
+		return nil, 0, ErrInvalidField
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return nil, 0, protowire.ParseError(n)
+	}
+	return v, n, nil
+}
@@ -0,0 +1,140 @@
+// Package remotewrite receives samples sent by Prometheus over the remote_write protocol.
+package remotewrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/adapters/ingest/delta"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+)
+
+const (
+	// metricNameLabel holds the name of a Prometheus series.
+	metricNameLabel = "__name__"
+	// counterSuffix marks the series stored as counters, following the Prometheus naming conventions.
+	counterSuffix = "_total"
+	// maxBodySize limits the size of a compressed WriteRequest.
+	maxBodySize = 16 << 20
+)
+
+var ErrMissingMetricName = errors.New("series has no metric name")
+
+// MetricService defines the interface for metric operations.
+type MetricService interface {
+	// SetMetrics sets multiple metrics at once.
+	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
+}
+
+// Handler accepts Prometheus remote_write requests.
+type Handler struct {
+	metricService MetricService
+	counters      *delta.Tracker
+}
+
+// NewHandler creates a new instance of Handler.
+func NewHandler(metricService MetricService) *Handler {
+	return &Handler{
+		metricService: metricService,
+		counters:      delta.NewTracker(delta.DefaultTTL),
+	}
+}
+
+// ServeHTTP stores the samples of a WriteRequest as a single batch. The cumulative values of its counters are
+// remembered once the batch is stored, so a retried request adds the same increases.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		logger.Log.Info("cannot read remote write body", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	series, err := decode(body)
+	if err != nil {
+		logger.Log.Info("cannot decode remote write request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	counters := h.counters.Batch()
+	metrics, err := h.metrics(counters, series)
+	if err != nil {
+		logger.Log.Info("cannot convert remote write request", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(metrics) > 0 {
+		if _, err = h.metricService.SetMetrics(req.Context(), metrics); err != nil {
+			logger.Log.Error("failed to set remote write metrics", zap.Error(err))
+			// Prometheus retries 5xx responses only, a batch rejected by validation would fail again.
+			if errors.Is(err, domain.ErrIncorrectMetricType) || errors.Is(err, domain.ErrIncorrectMetricValue) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+	counters.Commit()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// metrics maps time series to metrics, labels other than the name are kept in the metric ID.
+//
+// Series named *_total become counters, their cumulative samples are converted into deltas.
+// Other series become gauges holding the last sample. NaN samples, which include staleness markers,
+// and infinities are skipped.
+func (h *Handler) metrics(counters *delta.Batch, series []timeSeries) (domain.MetricsList, error) {
+	metrics := make(domain.MetricsList, 0, len(series))
+	for _, ts := range series {
+		var name string
+		labels := make(map[string]string, len(ts.labels))
+		for _, l := range ts.labels {
+			if l.name == metricNameLabel {
+				name = l.value
+				continue
+			}
+			labels[l.name] = l.value
+		}
+		if name == "" {
+			return nil, ErrMissingMetricName
+		}
+		if err := domain.ValidateSeries(name, labels); err != nil {
+			return nil, err
+		}
+		id := domain.SeriesID(name, labels)
+		if strings.HasSuffix(name, counterSuffix) {
+			var (
+				total   int64
+				sampled bool
+			)
+			for _, s := range ts.samples {
+				if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+					continue
+				}
+				// Counters hold integers, rounding the cumulative value keeps fractional increases from getting lost.
+				total += int64(counters.Delta(id, math.Round(s.value)))
+				sampled = true
+			}
+			if sampled {
+				metrics = append(metrics, domain.Metric{ID: id, MType: domain.Counter, Delta: &total})
+			}
+			continue
+		}
+		for i := len(ts.samples) - 1; i >= 0; i-- {
+			value := ts.samples[i].value
+			if math.IsNaN(value) || math.IsInf(value, 0) {
+				continue
+			}
+			metrics = append(metrics, domain.Metric{ID: id, MType: domain.Gauge, Value: &value})
+			break
+		}
+	}
+	return metrics, nil
+}
@@ -0,0 +1,186 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/service"
+)
+
+type testSeries struct {
+	labels  map[string]string
+	samples []float64
+}
+
+func encodeWriteRequest(series ...testSeries) []byte {
+	var req []byte
+	for _, s := range series {
+		var ts []byte
+		for k, v := range s.labels {
+			var l []byte
+			l = protowire.AppendTag(l, labelName, protowire.BytesType)
+			l = protowire.AppendString(l, k)
+			l = protowire.AppendTag(l, labelValue, protowire.BytesType)
+			l = protowire.AppendString(l, v)
+			ts = protowire.AppendTag(ts, timeSeriesLabels, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, l)
+		}
+		for i, v := range s.samples {
+			var smp []byte
+			smp = protowire.AppendTag(smp, sampleValue, protowire.Fixed64Type)
+			smp = protowire.AppendFixed64(smp, math.Float64bits(v))
+			smp = protowire.AppendTag(smp, sampleTimestamp, protowire.VarintType)
+			smp = protowire.AppendVarint(smp, uint64(1700000000000+i))
+			ts = protowire.AppendTag(ts, timeSeriesSamples, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, smp)
+		}
+		req = protowire.AppendTag(req, writeRequestTimeSeries, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return snappy.Encode(nil, req)
+}
+
+func post(t *testing.T, h http.Handler, body []byte) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", "snappy")
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	h.ServeHTTP(w, r)
+	return w.Code
+}
+
+func newMetricService(t *testing.T) *service.MetricService {
+	t.Helper()
+	metricStorage, err := memory.NewStorage(&memory.Config{})
+	require.NoError(t, err)
+	metricService, err := service.NewMetricService("", metricStorage)
+	require.NoError(t, err)
+	return metricService
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	ctx := context.Background()
+	metricService := newMetricService(t)
+	h := NewHandler(metricService)
+
+	requests := map[string]string{"__name__": "http_requests_total", "job": "api", "code": "200"}
+	temperature := map[string]string{"__name__": "temperature", "room": "kitchen"}
+	code := post(t, h, encodeWriteRequest(
+		testSeries{labels: requests, samples: []float64{10, 12}},
+		testSeries{labels: temperature, samples: []float64{20.5, 21.5, math.NaN()}},
+		testSeries{labels: map[string]string{"__name__": "up"}, samples: []float64{1}},
+	))
+	require.Equal(t, http.StatusNoContent, code)
+
+	requestsID := `http_requests_total{code="200",job="api"}`
+	c, err := metricService.GetMetric(ctx, domain.Counter, requestsID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *c.Delta, "the first sample is a baseline")
+	g, err := metricService.GetMetric(ctx, domain.Gauge, `temperature{room="kitchen"}`)
+	require.NoError(t, err)
+	assert.InDelta(t, 21.5, *g.Value, 0)
+	g, err = metricService.GetMetric(ctx, domain.Gauge, "up")
+	require.NoError(t, err)
+	assert.InDelta(t, 1.0, *g.Value, 0)
+
+	// The cumulative value grew by 5, then Prometheus restarted and the counter started over.
+	require.Equal(t, http.StatusNoContent, post(t, h, encodeWriteRequest(testSeries{labels: requests, samples: []float64{17}})))
+	require.Equal(t, http.StatusNoContent, post(t, h, encodeWriteRequest(testSeries{labels: requests, samples: []float64{3}})))
+	c, err = metricService.GetMetric(ctx, domain.Counter, requestsID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *c.Delta)
+}
+
+func TestHandler_ServeHTTPBadRequest(t *testing.T) {
+	metricService := newMetricService(t)
+	h := NewHandler(metricService)
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{name: "not snappy", body: []byte("not snappy")},
+		{name: "not protobuf", body: snappy.Encode(nil, []byte{0xff, 0xff})},
+		{name: "missing name", body: encodeWriteRequest(testSeries{labels: map[string]string{"job": "api"}, samples: []float64{1}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, post(t, h, tt.body))
+		})
+	}
+}
+
+type failingService struct{}
+
+func (failingService) SetMetrics(context.Context, domain.MetricsList) (domain.MetricsList, error) {
+	return nil, errors.New("storage is down")
+}
+
+func TestHandler_ServeHTTPStorageError(t *testing.T) {
+	h := NewHandler(failingService{})
+	body := encodeWriteRequest(testSeries{labels: map[string]string{"__name__": "up"}, samples: []float64{1}})
+	assert.Equal(t, http.StatusInternalServerError, post(t, h, body))
+}
+
+// flakyService fails the writes while down is set.
+type flakyService struct {
+	*service.MetricService
+	down bool
+}
+
+func (s *flakyService) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	if s.down {
+		return nil, errors.New("storage is down")
+	}
+	return s.MetricService.SetMetrics(ctx, metrics)
+}
+
+func TestHandler_ServeHTTPRetry(t *testing.T) {
+	ctx := context.Background()
+	metricService := &flakyService{MetricService: newMetricService(t)}
+	h := NewHandler(metricService)
+	requests := map[string]string{"__name__": "http_requests_total"}
+	body := encodeWriteRequest(testSeries{labels: requests, samples: []float64{10}})
+	require.Equal(t, http.StatusNoContent, post(t, h, body))
+
+	metricService.down = true
+	body = encodeWriteRequest(testSeries{labels: requests, samples: []float64{15}})
+	require.Equal(t, http.StatusInternalServerError, post(t, h, body))
+	metricService.down = false
+	require.Equal(t, http.StatusNoContent, post(t, h, body))
+
+	c, err := metricService.GetMetric(ctx, domain.Counter, "http_requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *c.Delta, "the retried request adds the increase once")
+}
+
+func TestHandler_ServeHTTPRestart(t *testing.T) {
+	ctx := context.Background()
+	metricService := newMetricService(t)
+	requests := map[string]string{"__name__": "http_requests_total"}
+	body := encodeWriteRequest(testSeries{labels: requests, samples: []float64{10, 15}})
+	require.Equal(t, http.StatusNoContent, post(t, NewHandler(metricService), body))
+
+	// A restarted server keeps the stored total but not the last cumulative values.
+	h := NewHandler(metricService)
+	for _, v := range []float64{20, 22} {
+		require.Equal(t, http.StatusNoContent, post(t, h, encodeWriteRequest(testSeries{labels: requests, samples: []float64{v}})))
+	}
+
+	c, err := metricService.GetMetric(ctx, domain.Counter, "http_requests_total")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *c.Delta, "the lifetime total isn't added again")
+}
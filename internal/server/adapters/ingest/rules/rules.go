@@ -0,0 +1,103 @@
+// Package rules assigns metric types to ingested samples that carry no type of their own.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"metrics/internal/server/adapters/ingest/delta"
+	"metrics/internal/server/core/domain"
+)
+
+// Kinds a rule can assign to a metric.
+const (
+	// Gauge stores the sample as the current value.
+	Gauge = "gauge"
+	// Counter adds the sample to the stored total.
+	Counter = "counter"
+	// Cumulative treats the sample as a running total and adds its increase to the stored total.
+	Cumulative = "cumulative"
+)
+
+var ErrIncorrectRule = errors.New("incorrect type rule")
+
+// Rule assigns a kind to the metrics whose name matches Pattern, see path.Match for the pattern syntax.
+type Rule struct {
+	Pattern string
+	Kind    string
+}
+
+// Rules maps samples to metrics, the first matching rule wins and unmatched samples become gauges.
+type Rules struct {
+	rules    []Rule
+	counters *delta.Tracker
+}
+
+// New creates a new instance of Rules.
+func New(rules ...Rule) (*Rules, error) {
+	for _, r := range rules {
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrIncorrectRule, r.Pattern, err)
+		}
+		switch r.Kind {
+		case Gauge, Counter, Cumulative:
+		default:
+			return nil, fmt.Errorf("%w %q: unknown kind %q", ErrIncorrectRule, r.Pattern, r.Kind)
+		}
+	}
+	return &Rules{rules: rules, counters: delta.NewTracker(delta.DefaultTTL)}, nil
+}
+
+// Parse creates Rules from a comma separated list of pattern=kind pairs, e.g. "*_total=cumulative,stats.*=counter".
+func Parse(spec string) (*Rules, error) {
+	var rules []Rule
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, kind, found := strings.Cut(item, "=")
+		if !found {
+			return nil, fmt.Errorf("%w %q: expected pattern=kind", ErrIncorrectRule, item)
+		}
+		rules = append(rules, Rule{Pattern: strings.TrimSpace(pattern), Kind: strings.TrimSpace(kind)})
+	}
+	return New(rules...)
+}
+
+// Kind returns the kind assigned to a metric name.
+func (r *Rules) Kind(name string) string {
+	for _, rule := range r.rules {
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.Kind
+		}
+	}
+	return Gauge
+}
+
+// Batch returns the batch the cumulative samples of one write are converted in, to be committed once the
+// write is stored.
+func (r *Rules) Batch() *delta.Batch {
+	return r.counters.Batch()
+}
+
+// Metric builds the metric for a sample of the series id, whose rules are looked up by name.
+// It reports false for NaN and infinite samples, which can't be stored.
+func (r *Rules) Metric(counters *delta.Batch, name, id string, value float64) (domain.Metric, bool) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return domain.Metric{}, false
+	}
+	switch r.Kind(name) {
+	case Counter:
+		d := int64(math.Round(value))
+		return domain.Metric{ID: id, MType: domain.Counter, Delta: &d}, true
+	case Cumulative:
+		d := int64(counters.Delta(id, math.Round(value)))
+		return domain.Metric{ID: id, MType: domain.Counter, Delta: &d}, true
+	default:
+		return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}, true
+	}
+}
@@ -0,0 +1,60 @@
+package rules
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/core/domain"
+)
+
+func TestParse(t *testing.T) {
+	r, err := Parse(" *_total = cumulative, stats_counts.* =counter,,")
+	require.NoError(t, err)
+	assert.Equal(t, Cumulative, r.Kind("http_requests_total"))
+	assert.Equal(t, Counter, r.Kind("stats_counts.api.hits"))
+	assert.Equal(t, Gauge, r.Kind("servers.web1.cpu"))
+
+	r, err = Parse("")
+	require.NoError(t, err)
+	assert.Equal(t, Gauge, r.Kind("anything"))
+
+	for _, spec := range []string{"*_total", "*_total=histogram", "[=counter"} {
+		_, err = Parse(spec)
+		assert.ErrorIs(t, err, ErrIncorrectRule, spec)
+	}
+}
+
+func TestRules_Metric(t *testing.T) {
+	r, err := New(Rule{Pattern: "hits", Kind: Counter}, Rule{Pattern: "*_total", Kind: Cumulative})
+	require.NoError(t, err)
+
+	counters := r.Batch()
+	m, ok := r.Metric(counters, "cpu", `cpu{host="a"}`, 0.5)
+	require.True(t, ok)
+	assert.Equal(t, domain.Gauge, m.MType)
+	assert.Equal(t, `cpu{host="a"}`, m.ID)
+	assert.InDelta(t, 0.5, *m.Value, 0)
+
+	m, ok = r.Metric(counters, "hits", "hits", 2.6)
+	require.True(t, ok)
+	assert.Equal(t, domain.Counter, m.MType)
+	assert.Equal(t, int64(3), *m.Delta)
+
+	m, ok = r.Metric(counters, "req_total", "req_total", 10)
+	require.True(t, ok)
+	assert.Equal(t, int64(0), *m.Delta, "the first sample is a baseline")
+	m, _ = r.Metric(counters, "req_total", "req_total", 15)
+	assert.Equal(t, int64(5), *m.Delta)
+	counters.Commit()
+	counters = r.Batch()
+	m, _ = r.Metric(counters, "req_total", "req_total", 2)
+	assert.Equal(t, int64(2), *m.Delta, "reset")
+
+	_, ok = r.Metric(counters, "cpu", "cpu", math.NaN())
+	assert.False(t, ok)
+	_, ok = r.Metric(counters, "hits", "hits", math.Inf(1))
+	assert.False(t, ok)
+}
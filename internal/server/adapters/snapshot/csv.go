@@ -0,0 +1,161 @@
+package snapshot
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+// columns head a CSV snapshot.
+var columns = []string{"id", "type", "value", "delta", "histogram", "sketch", "updated"}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) Encode(m *domain.Metric) error {
+	if !e.header {
+		if err := e.w.Write(columns); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		e.header = true
+	}
+	record := make([]string, len(columns))
+	record[0], record[1] = m.ID, m.MType
+	if m.Value != nil {
+		record[2] = strconv.FormatFloat(*m.Value, 'g', -1, 64)
+	}
+	if m.Delta != nil {
+		record[3] = strconv.FormatInt(*m.Delta, 10)
+	}
+	if m.Histogram != nil {
+		buf, err := json.Marshal(m.Histogram)
+		if err != nil {
+			return fmt.Errorf("failed to encode histogram: %w", err)
+		}
+		record[4] = string(buf)
+	}
+	if m.Sketch != nil {
+		buf, err := json.Marshal(m.Sketch)
+		if err != nil {
+			return fmt.Errorf("failed to encode sketch: %w", err)
+		}
+		record[5] = string(buf)
+	}
+	if m.Updated != nil {
+		record[6] = m.Updated.Format(time.RFC3339Nano)
+	}
+	if err := e.w.Write(record); err != nil {
+		return fmt.Errorf("failed to write metric: %w", err)
+	}
+	return nil
+}
+
+// Close writes the header of an empty snapshot and flushes the records.
+func (e *csvEncoder) Close() error {
+	if !e.header {
+		if err := e.w.Write(columns); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		e.header = true
+	}
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return nil
+}
+
+type csvDecoder struct {
+	r      *csv.Reader
+	header bool
+}
+
+func newCSVDecoder(r io.Reader) *csvDecoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(columns)
+	cr.ReuseRecord = true
+	return &csvDecoder{r: cr}
+}
+
+func (d *csvDecoder) Decode() (*domain.Metric, error) {
+	if !d.header {
+		record, err := d.read()
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Equal(record, columns) {
+			return nil, fmt.Errorf("%w: header %v isn't %v", ErrMalformed, record, columns)
+		}
+		d.header = true
+	}
+	record, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	line, _ := d.r.FieldPos(0)
+	m, err := parseRecord(record)
+	if err != nil {
+		return nil, fmt.Errorf("%w: line %d: %w", ErrMalformed, line, err)
+	}
+	return m, nil
+}
+
+func (d *csvDecoder) read() ([]string, error) {
+	record, err := d.r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return record, nil
+}
+
+func parseRecord(record []string) (*domain.Metric, error) {
+	m := &domain.Metric{ID: record[0], MType: record[1]}
+	if s := record[2]; s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("value: %w", err)
+		}
+		m.Value = &v
+	}
+	if s := record[3]; s != "" {
+		delta, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("delta: %w", err)
+		}
+		m.Delta = &delta
+	}
+	if s := record[4]; s != "" {
+		if err := json.Unmarshal([]byte(s), &m.Histogram); err != nil {
+			return nil, fmt.Errorf("histogram: %w", err)
+		}
+	}
+	if s := record[5]; s != "" {
+		if err := json.Unmarshal([]byte(s), &m.Sketch); err != nil {
+			return nil, fmt.Errorf("sketch: %w", err)
+		}
+	}
+	if s := record[6]; s != "" {
+		updated, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("updated: %w", err)
+		}
+		m.Updated = &updated
+	}
+	return m, nil
+}
@@ -0,0 +1,50 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"metrics/internal/server/core/domain"
+)
+
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newJSONEncoder(w io.Writer) *jsonEncoder {
+	return &jsonEncoder{enc: json.NewEncoder(w)}
+}
+
+func (e *jsonEncoder) Encode(m *domain.Metric) error {
+	if err := e.enc.Encode(m); err != nil {
+		return fmt.Errorf("failed to write metric: %w", err)
+	}
+	return nil
+}
+
+func (e *jsonEncoder) Close() error {
+	return nil
+}
+
+type jsonDecoder struct {
+	dec  *json.Decoder
+	read int
+}
+
+func newJSONDecoder(r io.Reader) *jsonDecoder {
+	return &jsonDecoder{dec: json.NewDecoder(r)}
+}
+
+func (d *jsonDecoder) Decode() (*domain.Metric, error) {
+	var m domain.Metric
+	if err := d.dec.Decode(&m); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%w: metric %d: %w", ErrMalformed, d.read+1, err)
+	}
+	d.read++
+	return &m, nil
+}
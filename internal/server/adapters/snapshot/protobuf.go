@@ -0,0 +1,149 @@
+package snapshot
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	pb "metrics/internal/proto"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/ddsketch"
+)
+
+// types maps the domain metric types to the protobuf ones.
+var types = map[string]pb.Metric_Type{
+	domain.Gauge:     pb.Metric_GAUGE,
+	domain.Counter:   pb.Metric_COUNTER,
+	domain.Histogram: pb.Metric_HISTOGRAM,
+	domain.Timer:     pb.Metric_TIMER,
+}
+
+type protoEncoder struct {
+	w io.Writer
+}
+
+func newProtoEncoder(w io.Writer) *protoEncoder {
+	return &protoEncoder{w: w}
+}
+
+func (e *protoEncoder) Encode(m *domain.Metric) error {
+	metric, err := toProto(m)
+	if err != nil {
+		return err
+	}
+	if _, err = protodelim.MarshalTo(e.w, metric); err != nil {
+		return fmt.Errorf("failed to write metric: %w", err)
+	}
+	return nil
+}
+
+func (e *protoEncoder) Close() error {
+	return nil
+}
+
+type protoDecoder struct {
+	r    *bufio.Reader
+	read int
+}
+
+func newProtoDecoder(r io.Reader) *protoDecoder {
+	return &protoDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *protoDecoder) Decode() (*domain.Metric, error) {
+	var metric pb.Metric
+	if err := protodelim.UnmarshalFrom(d.r, &metric); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%w: metric %d: %w", ErrMalformed, d.read+1, err)
+	}
+	d.read++
+	m, err := fromProto(&metric)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metric %d: %w", ErrMalformed, d.read, err)
+	}
+	return m, nil
+}
+
+func toProto(m *domain.Metric) (*pb.Metric, error) {
+	t, found := types[m.MType]
+	if !found {
+		return nil, fmt.Errorf("%w: %q", domain.ErrIncorrectMetricType, m.MType)
+	}
+	metric := &pb.Metric{Id: m.ID, Type: t}
+	if m.Value != nil {
+		metric.Value = *m.Value
+	}
+	if m.Delta != nil {
+		metric.Delta = *m.Delta
+	}
+	if h := m.Histogram; h != nil {
+		metric.Histogram = &pb.Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+	}
+	if s := m.Sketch; s != nil {
+		metric.Sketch = &pb.Sketch{
+			Alpha:    s.Alpha,
+			Positive: &pb.SketchStore{Offset: int32(s.Positive.Offset), Counts: s.Positive.Counts},
+			Negative: &pb.SketchStore{Offset: int32(s.Negative.Offset), Counts: s.Negative.Counts},
+			Zeros:    s.Zeros,
+			Count:    s.Count,
+			Sum:      s.Sum,
+			Min:      s.Min,
+			Max:      s.Max,
+		}
+	}
+	if m.Updated != nil {
+		metric.UpdatedUnixNano = m.Updated.UnixNano()
+	}
+	return metric, nil
+}
+
+// fromProto converts a snapshot message, the type telling which of its values is set.
+func fromProto(metric *pb.Metric) (*domain.Metric, error) {
+	m := &domain.Metric{ID: metric.GetId()}
+	for mType, t := range types {
+		if t == metric.GetType() {
+			m.MType = mType
+		}
+	}
+	switch m.MType {
+	case domain.Gauge:
+		value := metric.GetValue()
+		m.Value = &value
+	case domain.Counter:
+		delta := metric.GetDelta()
+		m.Delta = &delta
+	case domain.Histogram:
+		if h := metric.GetHistogram(); h != nil {
+			m.Histogram = &domain.HistogramValue{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+		}
+	case domain.Timer:
+		if s := metric.GetSketch(); s != nil {
+			m.Sketch = &ddsketch.Sketch{
+				Alpha:    s.Alpha,
+				Positive: ddsketch.Store{Offset: int(s.GetPositive().GetOffset()), Counts: s.GetPositive().GetCounts()},
+				Negative: ddsketch.Store{Offset: int(s.GetNegative().GetOffset()), Counts: s.GetNegative().GetCounts()},
+				Zeros:    s.Zeros,
+				Count:    s.Count,
+				Sum:      s.Sum,
+				Min:      s.Min,
+				Max:      s.Max,
+			}
+		} else {
+			value := metric.GetValue()
+			m.Value = &value
+		}
+	default:
+		return nil, fmt.Errorf("%w: %v", domain.ErrIncorrectMetricType, metric.GetType())
+	}
+	if nano := metric.GetUpdatedUnixNano(); nano != 0 {
+		updated := time.Unix(0, nano).UTC()
+		m.Updated = &updated
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+// Package snapshot writes and reads full exports of the stored metrics, one metric after another so that
+// neither side holds the whole snapshot in memory.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"metrics/internal/server/core/domain"
+)
+
+// Snapshot formats.
+const (
+	// FormatJSONL is a JSON metric per line, as the value APIs write them.
+	FormatJSONL = "jsonl"
+	// FormatCSV is a header and a record per metric, histograms and sketches being JSON cells.
+	FormatCSV = "csv"
+	// FormatProtobuf is a stream of Metric messages, each preceded by its varint length.
+	FormatProtobuf = "protobuf"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown snapshot format")
+	ErrMalformed     = errors.New("malformed snapshot")
+)
+
+// Encoder writes the metrics of a snapshot.
+type Encoder interface {
+	// Encode writes a metric.
+	Encode(m *domain.Metric) error
+
+	// Close writes what the encoder buffers, leaving the writer open.
+	Close() error
+}
+
+// Decoder reads the metrics of a snapshot.
+type Decoder interface {
+	// Decode reads the next metric, io.EOF telling that there is none left.
+	Decode() (*domain.Metric, error)
+}
+
+// NewEncoder creates an encoder writing to w in the format.
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatJSONL:
+		return newJSONEncoder(w), nil
+	case FormatCSV:
+		return newCSVEncoder(w), nil
+	case FormatProtobuf:
+		return newProtoEncoder(w), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// NewDecoder creates a decoder reading from r in the format.
+func NewDecoder(r io.Reader, format string) (Decoder, error) {
+	switch format {
+	case FormatJSONL:
+		return newJSONDecoder(r), nil
+	case FormatCSV:
+		return newCSVDecoder(r), nil
+	case FormatProtobuf:
+		return newProtoDecoder(r), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+}
+
+// ContentType returns the media type of a snapshot in the format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatProtobuf:
+		return "application/x-protobuf"
+	default:
+		return "application/x-ndjson"
+	}
+}
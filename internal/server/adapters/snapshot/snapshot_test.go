@@ -0,0 +1,106 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+)
+
+func snapshotMetrics() []domain.Metric {
+	updated := time.Date(2024, 5, 1, 10, 0, 0, 123, time.UTC)
+	metrics := []domain.Metric{
+		storagetest.Gauge("Alloc", 0.5),
+		storagetest.Gauge("Zero", 0),
+		storagetest.Counter("PollCount", -3),
+		storagetest.Histogram("latency", []float64{0.1, 1}, []uint64{1, 2, 3}, 7.5),
+		storagetest.Sketch("rtt", 1, 2, 30),
+		storagetest.Timer("sample", 12),
+	}
+	for i := range metrics {
+		metrics[i].Updated = &updated
+	}
+	return metrics
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatCSV, FormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			want := snapshotMetrics()
+			var buf bytes.Buffer
+			enc, err := NewEncoder(&buf, format)
+			require.NoError(t, err)
+			for i := range want {
+				require.NoError(t, enc.Encode(&want[i]))
+			}
+			require.NoError(t, enc.Close())
+
+			dec, err := NewDecoder(&buf, format)
+			require.NoError(t, err)
+			var got []domain.Metric
+			for {
+				m, err := dec.Decode()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, *m)
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	for _, format := range []string{FormatJSONL, FormatCSV, FormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc, err := NewEncoder(&buf, format)
+			require.NoError(t, err)
+			require.NoError(t, enc.Close())
+
+			dec, err := NewDecoder(&buf, format)
+			require.NoError(t, err)
+			_, err = dec.Decode()
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+	}{
+		{format: FormatJSONL, input: `{"id":"a","type":"gauge","value":1}` + "\n{\"id\":"},
+		{format: FormatCSV, input: "id,type,value\na,gauge,1\n"},
+		{format: FormatCSV, input: strings.Join(columns, ",") + "\na,gauge,one,,,,\n"},
+		{format: FormatCSV, input: strings.Join(columns, ",") + "\na,histogram,,,{,,\n"},
+		{format: FormatProtobuf, input: "\x05\x0a\x01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			dec, err := NewDecoder(strings.NewReader(tt.input), tt.format)
+			require.NoError(t, err)
+			for err == nil {
+				_, err = dec.Decode()
+			}
+			assert.ErrorIs(t, err, ErrMalformed)
+		})
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	_, err := NewEncoder(io.Discard, "xml")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+	_, err = NewDecoder(strings.NewReader(""), "xml")
+	require.ErrorIs(t, err, ErrUnknownFormat)
+}
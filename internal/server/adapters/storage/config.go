@@ -4,10 +4,12 @@ import (
 	"metrics/internal/server/adapters/storage/database"
 	"metrics/internal/server/adapters/storage/file"
 	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/sqlite"
 )
 
 type Config struct {
 	Memory   *memory.Config
 	File     *file.Config
 	Database *database.Config
+	SQLite   *sqlite.Config
 }
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/ddsketch"
+)
+
+// upsertBatch applies a batch in a single statement: metrics_latest, which serves reads, is upserted with
+// counters and histograms added to the stored ones, and every resulting row is appended to the metrics
+// history table. Sketches are merged by lockSketches beforehand and just replace the stored ones.
+const upsertBatch = `
+WITH latest AS (
+    INSERT INTO metrics_latest AS l (name, type, delta, value, histogram, sketch)
+    SELECT * FROM unnest(
+        $1::varchar[], $2::varchar[], $3::bigint[], $4::double precision[], $5::jsonb[], $6::jsonb[]
+    )
+    ON CONFLICT (name, type) DO UPDATE SET
+        delta = l.delta + EXCLUDED.delta,
+        value = EXCLUDED.value,
+        histogram = merge_histogram(l.histogram, EXCLUDED.histogram),
+        sketch = EXCLUDED.sketch,
+        updated_at = EXCLUDED.updated_at
+    RETURNING name, type, delta, value, histogram, sketch, updated_at
+)
+INSERT INTO metrics (name, type, delta, value, histogram, sketch, created_at)
+SELECT name, type, delta, value, histogram, sketch, updated_at FROM latest
+RETURNING name, type, delta, value, histogram, sketch, created_at;`
+
+// insertTimers makes sure every timer of a batch has a latest row to lock, an empty sketch standing for
+// a timer not stored yet.
+const insertTimers = `
+INSERT INTO metrics_latest (name, type, sketch)
+SELECT unnest($1::varchar[]), 'timer', $2::jsonb
+ON CONFLICT (name, type) DO NOTHING;`
+
+// selectTimers locks the latest sketches of a batch until it is applied.
+const selectTimers = `
+SELECT name, sketch FROM metrics_latest
+WHERE type = 'timer' AND name = ANY($1::varchar[])
+ORDER BY name
+FOR UPDATE;`
+
+// batch holds a batch in the column layout expected by upsertBatch.
+type batch struct {
+	names      []string
+	types      []string
+	deltas     []*int64
+	values     []*float64
+	histograms []*string
+	sketches   []*string
+}
+
+// aggregate folds a batch to one row per series: counter deltas, histograms and timers are summed and the
+// last gauge value wins.
+//
+// ON CONFLICT can't touch the same row twice in one statement, so duplicates must be merged beforehand.
+// Rows are sorted by key, timers first as lockSketches locks them ahead of the upsert, so concurrent
+// batches lock latest values in the same order and can't deadlock.
+func aggregate(metrics domain.MetricsList) (batch, error) {
+	index := make(map[domain.Key]int, len(metrics))
+	merged := make([]domain.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		key := domain.Key{MType: m.MType, ID: m.ID}
+		var current domain.Value
+		i, found := index[key]
+		if found {
+			current = domain.Value{Delta: merged[i].Delta, Histogram: merged[i].Histogram, Sketch: merged[i].Sketch}
+		}
+		next, err := current.Apply(&m)
+		if err != nil {
+			return batch{}, err
+		}
+		if !found {
+			index[key] = len(merged)
+			merged = append(merged, domain.NewMetric(key, next))
+			continue
+		}
+		merged[i] = domain.NewMetric(key, next)
+	}
+	slices.SortFunc(merged, func(a, b domain.Metric) int {
+		return cmp.Or(
+			-cmp.Compare(lockRank(a.MType), lockRank(b.MType)),
+			cmp.Compare(a.MType, b.MType),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+	b := batch{
+		names:      make([]string, 0, len(merged)),
+		types:      make([]string, 0, len(merged)),
+		deltas:     make([]*int64, 0, len(merged)),
+		values:     make([]*float64, 0, len(merged)),
+		histograms: make([]*string, 0, len(merged)),
+		sketches:   make([]*string, 0, len(merged)),
+	}
+	for _, m := range merged {
+		histogram, err := encodeJSON(m.Histogram)
+		if err != nil {
+			return batch{}, fmt.Errorf("failed to encode histogram %w", err)
+		}
+		sketch, err := encodeJSON(m.Sketch)
+		if err != nil {
+			return batch{}, fmt.Errorf("failed to encode sketch %w", err)
+		}
+		b.names = append(b.names, m.ID)
+		b.types = append(b.types, m.MType)
+		b.deltas = append(b.deltas, m.Delta)
+		b.values = append(b.values, m.Value)
+		b.histograms = append(b.histograms, histogram)
+		b.sketches = append(b.sketches, sketch)
+	}
+	return b, nil
+}
+
+// lockRank orders the types of a batch by when their rows get locked.
+func lockRank(mType string) int {
+	if mType == domain.Timer {
+		return 1
+	}
+	return 0
+}
+
+// lockSketches locks the stored sketches of the timers in b and returns the sketch column of the batch
+// with each of them merged in. b is left untouched, so a retried batch isn't merged twice.
+func lockSketches(ctx context.Context, tx *sqlx.Tx, b *batch) ([]*string, error) {
+	var names []string
+	for i, mType := range b.types {
+		if mType == domain.Timer {
+			names = append(names, b.names[i])
+		}
+	}
+	if len(names) == 0 {
+		return b.sketches, nil
+	}
+	empty, err := json.Marshal(ddsketch.New())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sketch %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, insertTimers, names, string(empty)); err != nil {
+		return nil, fmt.Errorf("failed to insert timers %w", err)
+	}
+	rows, err := tx.QueryContext(ctx, selectTimers, names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock timers %w", err)
+	}
+	stored, err := scanSketches(rows)
+	if err != nil {
+		return nil, err
+	}
+	sketches := slices.Clone(b.sketches)
+	for i, mType := range b.types {
+		s := stored[b.names[i]]
+		if mType != domain.Timer || s == nil || s.Count == 0 {
+			continue
+		}
+		var incoming ddsketch.Sketch
+		if err = json.Unmarshal([]byte(*b.sketches[i]), &incoming); err != nil {
+			return nil, fmt.Errorf("failed to decode sketch %w", err)
+		}
+		next, err := domain.Value{Sketch: s}.Apply(&domain.Metric{MType: domain.Timer, Sketch: &incoming})
+		if err != nil {
+			return nil, err
+		}
+		if sketches[i], err = encodeJSON(next.Sketch); err != nil {
+			return nil, fmt.Errorf("failed to encode sketch %w", err)
+		}
+	}
+	return sketches, nil
+}
+
+// scanSketches reads name and sketch rows and closes them.
+func scanSketches(rows *sql.Rows) (map[string]*ddsketch.Sketch, error) {
+	defer closeRows(rows)
+	sketches := make(map[string]*ddsketch.Sketch)
+	for rows.Next() {
+		var (
+			name   string
+			sketch []byte
+		)
+		if err := rows.Scan(&name, &sketch); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		s := &ddsketch.Sketch{}
+		if err := json.Unmarshal(sketch, s); err != nil {
+			return nil, fmt.Errorf("failed to decode sketch %w", err)
+		}
+		sketches[name] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return sketches, nil
+}
+
+// encodeJSON encodes a JSON column, a nil value being stored as NULL.
+func encodeJSON[T any](v *T) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	encoded := string(buf)
+	return &encoded, nil
+}
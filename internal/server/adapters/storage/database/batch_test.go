@@ -0,0 +1,70 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/ddsketch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregate(t *testing.T) {
+	metrics := domain.MetricsList{
+		storagetest.Gauge("g", 1),
+		storagetest.Counter("c", 2),
+		storagetest.Counter("a", 1),
+		storagetest.Gauge("g", 5),
+		storagetest.Counter("c", 3),
+	}
+	b, err := aggregate(metrics)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "c", "g"}, b.names)
+	assert.Equal(t, []string{domain.Counter, domain.Counter, domain.Gauge}, b.types)
+	assert.Equal(t, int64(1), *b.deltas[0])
+	assert.Equal(t, int64(5), *b.deltas[1])
+	assert.Nil(t, b.deltas[2])
+	assert.Nil(t, b.values[1])
+	assert.InDelta(t, 5.0, *b.values[2], 0)
+	assert.Equal(t, int64(2), *metrics[1].Delta, "input must not be mutated")
+	assert.InDelta(t, 1.0, *metrics[0].Value, 0, "input must not be mutated")
+}
+
+func TestAggregateHistograms(t *testing.T) {
+	metrics := domain.MetricsList{
+		storagetest.Histogram("h", []float64{1, 2}, []uint64{1, 0, 0}, 0.5),
+		storagetest.Histogram("h", []float64{1, 2}, []uint64{0, 2, 1}, 6),
+	}
+	b, err := aggregate(metrics)
+	require.NoError(t, err)
+
+	require.Len(t, b.histograms, 1)
+	assert.JSONEq(t, `{"bounds":[1,2],"counts":[1,2,1],"sum":6.5,"count":4}`, *b.histograms[0])
+	assert.Equal(t, []uint64{1, 0, 0}, metrics[0].Histogram.Counts, "input must not be mutated")
+
+	metrics = append(metrics, storagetest.Histogram("h", []float64{5}, []uint64{1, 0}, 1))
+	_, err = aggregate(metrics)
+	assert.ErrorIs(t, err, domain.ErrHistogramMismatch)
+}
+
+func TestAggregateTimersFirst(t *testing.T) {
+	metrics := domain.MetricsList{
+		storagetest.Counter("c", 1),
+		storagetest.Timer("t", 2),
+		storagetest.Gauge("g", 3),
+		storagetest.Sketch("t", 4, 5),
+	}
+	b, err := aggregate(metrics)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{domain.Timer, domain.Counter, domain.Gauge}, b.types)
+	assert.Nil(t, b.sketches[1])
+	var s ddsketch.Sketch
+	require.NoError(t, json.Unmarshal([]byte(*b.sketches[0]), &s))
+	assert.Equal(t, uint64(3), s.Count)
+	assert.InDelta(t, 11.0, s.Sum, 0)
+}
@@ -2,4 +2,8 @@ package database
 
 type Config struct {
 	DSN string
+	// RetentionDays is how long history is kept, zero keeps it forever.
+	RetentionDays int
+	// MaintainPartitions enables the background job that creates and drops history partitions.
+	MaintainPartitions bool
 }
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+// resetCounter zeroes the latest total of a counter and appends the zero to the history, so rate and
+// increase see the reset.
+const resetCounter = `
+WITH latest AS (
+    UPDATE metrics_latest SET delta = 0, updated_at = (current_timestamp AT TIME ZONE 'UTC')
+    WHERE name = $1 AND type = 'counter'
+    RETURNING name, type, delta, updated_at
+)
+INSERT INTO metrics (name, type, delta, created_at)
+SELECT name, type, delta, updated_at FROM latest
+RETURNING created_at;`
+
+// deleteStale removes the series not written since a time with their history. A series written while
+// it is being deleted is checked again and kept.
+const deleteStale = `
+WITH stale AS (
+    DELETE FROM metrics_latest WHERE updated_at < $1
+    RETURNING name, type
+), history AS (
+    DELETE FROM metrics USING stale WHERE metrics.name = stale.name AND metrics.type = stale.type
+)
+SELECT name, type FROM stale;`
+
+// DeleteMetric removes a series with its history.
+func (s *MetricStorage) DeleteMetric(ctx context.Context, mType, mName string) error {
+	deleted, err := s.delete(ctx, `name = $1 AND type = $2`, mName, mType)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return domain.ErrItemNotFound
+	}
+	return nil
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix with their history and returns how many
+// series there were.
+func (s *MetricStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	return s.delete(ctx, `starts_with(name, $1)`, prefix)
+}
+
+// delete removes the latest values and the history of the series matching a condition and returns how
+// many series there were.
+func (s *MetricStorage) delete(ctx context.Context, cond string, args ...any) (int, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	result, err := tx.ExecContext(ctx, `DELETE FROM metrics_latest WHERE `+cond, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM metrics WHERE `+cond, args...); err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return int(deleted), nil
+}
+
+// ResetCounter sets the total of a counter to zero, the history keeping the values before the reset.
+func (s *MetricStorage) ResetCounter(ctx context.Context, mName string) (*domain.Metric, error) {
+	var updatedAt time.Time
+	if err := s.db.GetContext(ctx, &updatedAt, resetCounter, mName); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrItemNotFound
+		}
+		return nil, fmt.Errorf("%w", err)
+	}
+	var zero int64
+	return &domain.Metric{ID: mName, MType: domain.Counter, Delta: &zero, Updated: &updatedAt}, nil
+}
+
+// DeleteStale removes the series not written since before with their history and returns their keys.
+func (s *MetricStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error) {
+	// updated_at holds UTC without a zone, so the bound is passed as UTC wall clock.
+	rows, err := s.db.QueryContext(ctx, deleteStale, before.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete stale metrics %w", err)
+	}
+	defer closeRows(rows)
+	keys := make([]domain.Key, 0)
+	for rows.Next() {
+		var key domain.Key
+		if err = rows.Scan(&key.ID, &key.MType); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return keys, nil
+}
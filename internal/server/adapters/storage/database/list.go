@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"metrics/internal/server/core/domain"
+)
+
+// ListMetrics returns a page of the metrics selected by the filter, filtered, sorted and paged by the database.
+func (s *MetricStorage) ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error) {
+	query, args := listQuery(&filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metrics %w", err)
+	}
+	return scanMetrics(rows)
+}
+
+// listQuery builds the query of a listing. Pages continue after the key of the cursor in the sort order,
+// compared with the C collation so the order is the byte order used by the other storages.
+//
+// Labels are matched in the series ID, where each one is written as k="v" after a brace or a comma and
+// before a comma or a brace. Quotes in values are escaped, so a match can't start inside a value.
+func listQuery(f *domain.ListFilter) (string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if len(f.Types) > 0 {
+		where = append(where, "type = ANY("+arg(f.Types)+"::varchar[])")
+	}
+	if f.Prefix != "" {
+		where = append(where, "starts_with(name, "+arg(f.Prefix)+")")
+	}
+	if f.Match != nil {
+		where = append(where, "split_part(name, '{', 1) ~ "+arg(f.Match.String()))
+	}
+	for _, k := range slices.Sorted(maps.Keys(f.Labels)) {
+		label := regexp.QuoteMeta(k + "=" + strconv.Quote(f.Labels[k]))
+		where = append(where, "name ~ "+arg("[{,]"+label+"[,}]"))
+	}
+	columns := []string{`name COLLATE "C"`, `type COLLATE "C"`}
+	if f.Sort == domain.SortByType {
+		columns = []string{`type COLLATE "C"`, `name COLLATE "C"`}
+	}
+	op, direction := ">", "ASC"
+	if f.Desc {
+		op, direction = "<", "DESC"
+	}
+	if f.After != nil {
+		first, second := arg(f.After.ID), arg(f.After.MType)
+		if f.Sort == domain.SortByType {
+			first, second = second, first
+		}
+		where = append(where, "("+strings.Join(columns, ", ")+") "+op+" ("+first+", "+second+")")
+	}
+	var b strings.Builder
+	b.WriteString("SELECT name, type, delta, value, histogram, sketch, updated_at FROM metrics_latest")
+	if len(where) > 0 {
+		b.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	b.WriteString(" ORDER BY " + columns[0] + " " + direction + ", " + columns[1] + " " + direction)
+	b.WriteString(" LIMIT " + arg(f.Limit) + ";")
+	return b.String(), args
+}
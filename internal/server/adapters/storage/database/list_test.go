@@ -0,0 +1,36 @@
+package database
+
+import (
+	"regexp"
+	"testing"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListQuery(t *testing.T) {
+	query, args := listQuery(&domain.ListFilter{Limit: 10})
+	assert.Equal(t, `SELECT name, type, delta, value, histogram, sketch, updated_at FROM metrics_latest`+
+		` ORDER BY name COLLATE "C" ASC, type COLLATE "C" ASC LIMIT $1;`, query)
+	assert.Equal(t, []any{10}, args)
+
+	query, args = listQuery(&domain.ListFilter{
+		Types:  []string{domain.Gauge},
+		Prefix: "Heap",
+		Match:  regexp.MustCompile("Alloc$"),
+		Labels: map[string]string{"host": `a"b`, "dc": "eu"},
+		Sort:   domain.SortByType,
+		Desc:   true,
+		After:  &domain.Key{MType: domain.Gauge, ID: "HeapAlloc"},
+		Limit:  5,
+	})
+	assert.Equal(t, `SELECT name, type, delta, value, histogram, sketch, updated_at FROM metrics_latest`+
+		` WHERE type = ANY($1::varchar[]) AND starts_with(name, $2) AND split_part(name, '{', 1) ~ $3`+
+		` AND name ~ $4 AND name ~ $5 AND (type COLLATE "C", name COLLATE "C") < ($7, $6)`+
+		` ORDER BY type COLLATE "C" DESC, name COLLATE "C" DESC LIMIT $8;`, query)
+	assert.Equal(t, []any{
+		[]string{domain.Gauge}, "Heap", "Alloc$", `[{,]dc="eu"[,}]`, `[{,]host="a\\"b"[,}]`,
+		"HeapAlloc", domain.Gauge, 5,
+	}, args)
+}
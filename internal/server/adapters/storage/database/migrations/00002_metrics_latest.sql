@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS metrics_latest
+(
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    updated_at    timestamp without time zone NOT NULL DEFAULT (current_timestamp AT TIME ZONE 'UTC'),
+    PRIMARY KEY (name, type),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL)
+    );
+
+INSERT INTO metrics_latest (name, type, delta, value, updated_at)
+SELECT DISTINCT ON (name, type) name, type, delta, value, created_at
+FROM metrics
+ORDER BY name, type, created_at DESC, id DESC
+ON CONFLICT (name, type) DO NOTHING;
+
+-- +goose Down
+DROP TABLE metrics_latest;
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS name_type_created_at_idx ON metrics (name, type, created_at DESC);
+
+-- +goose Down
+DROP INDEX IF EXISTS name_type_created_at_idx;
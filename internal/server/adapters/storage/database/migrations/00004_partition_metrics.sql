@@ -0,0 +1,76 @@
+-- +goose Up
+ALTER TABLE metrics RENAME TO metrics_unpartitioned;
+
+CREATE TABLE metrics
+(
+    id            bigserial,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    created_at    timestamp without time zone NOT NULL DEFAULT (current_timestamp AT TIME ZONE 'UTC'),
+    PRIMARY KEY (id, created_at),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL)
+    ) PARTITION BY RANGE (created_at);
+
+CREATE TABLE metrics_default PARTITION OF metrics DEFAULT;
+
+-- Only the partitions from today on are created: the older rows land in the default partition, which the
+-- partition maintenance moves to daily partitions within the retention period in batches.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    day date;
+BEGIN
+    FOR day IN
+        SELECT generate_series(
+            (current_timestamp AT TIME ZONE 'UTC')::date,
+            (current_timestamp AT TIME ZONE 'UTC')::date + 7,
+            interval '1 day'
+        )::date
+    LOOP
+        EXECUTE format(
+            'CREATE TABLE IF NOT EXISTS %I PARTITION OF metrics FOR VALUES FROM (%L) TO (%L)',
+            'metrics_p' || to_char(day, 'YYYYMMDD'), day, day + 1
+        );
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+INSERT INTO metrics (id, name, type, delta, value, created_at)
+SELECT id, name, type, delta, value, created_at FROM metrics_unpartitioned;
+
+SELECT setval(pg_get_serial_sequence('metrics', 'id'), COALESCE((SELECT max(id) FROM metrics), 0) + 1, false);
+
+DROP TABLE metrics_unpartitioned;
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
+CREATE INDEX IF NOT EXISTS name_type_created_at_idx ON metrics (name, type, created_at DESC);
+
+-- +goose Down
+ALTER TABLE metrics RENAME TO metrics_partitioned;
+
+CREATE TABLE metrics
+(
+    id            INT PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    created_at    timestamp without time zone NOT NULL DEFAULT (current_timestamp AT TIME ZONE 'UTC')
+    CHECK (delta IS NOT NULL OR value IS NOT NULL)
+    );
+
+INSERT INTO metrics (id, name, type, delta, value, created_at)
+OVERRIDING SYSTEM VALUE
+SELECT id, name, type, delta, value, created_at FROM metrics_partitioned;
+
+SELECT setval(pg_get_serial_sequence('metrics', 'id'), COALESCE((SELECT max(id) FROM metrics), 0) + 1, false);
+
+DROP TABLE metrics_partitioned;
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
+CREATE INDEX IF NOT EXISTS name_type_created_at_idx ON metrics (name, type, created_at DESC);
@@ -0,0 +1,67 @@
+-- +goose Up
+ALTER TABLE metrics ADD COLUMN histogram jsonb;
+ALTER TABLE metrics_latest ADD COLUMN histogram jsonb;
+
+-- The value checks were created unnamed, and the one of metrics got a generated name when the table was
+-- partitioned next to its predecessor, so they are looked up instead of dropped by name.
+-- +goose StatementBegin
+DO $$
+DECLARE
+    c record;
+BEGIN
+    FOR c IN
+        SELECT conrelid::regclass AS tbl, conname
+        FROM pg_constraint
+        WHERE contype = 'c' AND conrelid IN ('metrics'::regclass, 'metrics_latest'::regclass)
+    LOOP
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', c.tbl, c.conname);
+    END LOOP;
+END
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE metrics ADD CONSTRAINT metrics_value_check
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL);
+ALTER TABLE metrics_latest ADD CONSTRAINT metrics_latest_value_check
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL);
+
+-- merge_histogram adds up two histograms with the same bounds, see domain.HistogramValue for the layout.
+-- +goose StatementBegin
+CREATE FUNCTION merge_histogram(a jsonb, b jsonb) RETURNS jsonb
+LANGUAGE plpgsql IMMUTABLE AS $$
+BEGIN
+    IF a IS NULL THEN
+        RETURN b;
+    END IF;
+    IF b IS NULL THEN
+        RETURN a;
+    END IF;
+    IF a->'bounds' <> b->'bounds' THEN
+        RAISE EXCEPTION 'histogram buckets don''t match the stored ones' USING ERRCODE = 'MH001';
+    END IF;
+    RETURN jsonb_build_object(
+        'bounds', a->'bounds',
+        'counts', (
+            SELECT jsonb_agg(x.c::numeric + y.c::numeric ORDER BY x.i)
+            FROM jsonb_array_elements_text(a->'counts') WITH ORDINALITY AS x(c, i)
+            JOIN jsonb_array_elements_text(b->'counts') WITH ORDINALITY AS y(c, i) ON x.i = y.i
+        ),
+        'sum', (a->>'sum')::double precision + (b->>'sum')::double precision,
+        'count', (a->>'count')::numeric + (b->>'count')::numeric
+    );
+END
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION merge_histogram(jsonb, jsonb);
+
+DELETE FROM metrics_latest WHERE histogram IS NOT NULL;
+ALTER TABLE metrics_latest DROP CONSTRAINT metrics_latest_value_check;
+ALTER TABLE metrics_latest DROP COLUMN histogram;
+ALTER TABLE metrics_latest ADD CONSTRAINT metrics_latest_value_check CHECK (delta IS NOT NULL OR value IS NOT NULL);
+
+DELETE FROM metrics WHERE histogram IS NOT NULL;
+ALTER TABLE metrics DROP CONSTRAINT metrics_value_check;
+ALTER TABLE metrics DROP COLUMN histogram;
+ALTER TABLE metrics ADD CONSTRAINT metrics_value_check CHECK (delta IS NOT NULL OR value IS NOT NULL);
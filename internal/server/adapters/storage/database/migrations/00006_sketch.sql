@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE metrics ADD COLUMN sketch jsonb;
+ALTER TABLE metrics_latest ADD COLUMN sketch jsonb;
+
+ALTER TABLE metrics DROP CONSTRAINT metrics_value_check;
+ALTER TABLE metrics ADD CONSTRAINT metrics_value_check
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL OR sketch IS NOT NULL);
+ALTER TABLE metrics_latest DROP CONSTRAINT metrics_latest_value_check;
+ALTER TABLE metrics_latest ADD CONSTRAINT metrics_latest_value_check
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL OR sketch IS NOT NULL);
+
+-- +goose Down
+DELETE FROM metrics_latest WHERE sketch IS NOT NULL;
+ALTER TABLE metrics_latest DROP CONSTRAINT metrics_latest_value_check;
+ALTER TABLE metrics_latest DROP COLUMN sketch;
+ALTER TABLE metrics_latest ADD CONSTRAINT metrics_latest_value_check
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL);
+
+DELETE FROM metrics WHERE sketch IS NOT NULL;
+ALTER TABLE metrics DROP CONSTRAINT metrics_value_check;
+ALTER TABLE metrics DROP COLUMN sketch;
+ALTER TABLE metrics ADD CONSTRAINT metrics_value_check
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL);
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE INDEX IF NOT EXISTS metrics_latest_updated_at_idx ON metrics_latest (updated_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS metrics_latest_updated_at_idx;
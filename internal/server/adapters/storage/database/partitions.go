@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"metrics/internal/server/logger"
+)
+
+const (
+	// partitionPrefix names the daily history partitions, the suffix is the partition day.
+	partitionPrefix = "metrics_p"
+	partitionLayout = "20060102"
+	// partitionsAhead is the number of future days that always have a partition.
+	partitionsAhead = 7
+	// maintenanceInterval is how often partitions are created and dropped.
+	maintenanceInterval = time.Hour
+	// drainBatch is how many rows of the default partition are moved or deleted per transaction.
+	drainBatch = 10000
+	day        = 24 * time.Hour
+)
+
+// MaintainPartitions creates history partitions up to partitionsAhead days after now and drops
+// the partitions that ended more than the retention period before now.
+//
+// Rows outside of the existing partitions land in the default partition, so a missed run never loses data.
+// The days within the retention period those rows fall on get their partitions too, the rows being moved
+// into them, and the rows older than the retention period are deleted from the default partition like their
+// partitions are dropped. Both happen in batches of drainBatch rows, so that history writes aren't blocked.
+func (s *MetricStorage) MaintainPartitions(ctx context.Context, now time.Time) error {
+	today := now.UTC().Truncate(day)
+	var expired time.Time
+	if s.retentionDays > 0 {
+		expired = today.Add(-time.Duration(s.retentionDays) * day)
+	}
+	partitions, err := s.partitions(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(partitions))
+	for _, name := range partitions {
+		existing[name] = true
+	}
+	if s.retentionDays > 0 {
+		if err = s.drain(ctx, `DELETE FROM metrics_default WHERE ctid IN (
+		        SELECT ctid FROM metrics_default WHERE created_at < $1 LIMIT $2
+		    );`, expired); err != nil {
+			return fmt.Errorf("failed to delete expired rows of default partition: %w", err)
+		}
+	}
+	days, err := s.defaultDays(ctx, expired)
+	if err != nil {
+		return err
+	}
+	for i := range partitionsAhead + 1 {
+		days = append(days, today.Add(time.Duration(i)*day))
+	}
+	missing := make([]time.Time, 0, len(days))
+	for _, from := range days {
+		if existing[partitionName(from)] {
+			continue
+		}
+		if err = s.fillPartition(ctx, from); err != nil {
+			return err
+		}
+		existing[partitionName(from)] = true
+		missing = append(missing, from)
+	}
+	// The default partition is scanned when a partition is attached, so it is emptied of all the days first.
+	for _, from := range missing {
+		if err = s.attachPartition(ctx, from); err != nil {
+			return err
+		}
+	}
+	if s.retentionDays <= 0 {
+		return nil
+	}
+	for _, name := range partitions {
+		from, ok := partitionDay(name)
+		if !ok || from.Add(day).After(expired) {
+			continue
+		}
+		if _, err = s.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, name)); err != nil {
+			return fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+		logger.Log.Info("dropped expired partition", zap.String("partition", name))
+	}
+	return nil
+}
+
+// defaultDays returns the days the rows of the default partition fall on, the ones before expired aside.
+func (s *MetricStorage) defaultDays(ctx context.Context, expired time.Time) ([]time.Time, error) {
+	var days []time.Time
+	if err := s.db.SelectContext(ctx, &days,
+		`SELECT DISTINCT date_trunc('day', created_at) FROM metrics_default WHERE created_at >= $1;`, expired,
+	); err != nil {
+		return nil, fmt.Errorf("failed to list days of default partition: %w", err)
+	}
+	for i := range days {
+		days[i] = time.Date(days[i].Year(), days[i].Month(), days[i].Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return days, nil
+}
+
+// fillPartition creates the table of a day's partition, not attached yet, and moves the rows of the day held
+// by the default partition into it. The table of a run that failed before attaching it is filled further.
+// The moved rows are left out of the history until the partition is attached.
+func (s *MetricStorage) fillPartition(ctx context.Context, from time.Time) error {
+	name := partitionName(from)
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s (LIKE metrics INCLUDING DEFAULTS INCLUDING CONSTRAINTS);`, name,
+	)); err != nil {
+		return fmt.Errorf("failed to create partition %s: %w", name, err)
+	}
+	if err := s.drain(ctx, moveQuery(name), from, from.Add(day)); err != nil {
+		return fmt.Errorf("failed to move rows of default partition to %s: %w", name, err)
+	}
+	return nil
+}
+
+// attachPartition attaches the table of a day's partition. Attaching locks the default partition, which
+// must not hold rows of the day, so the ones written since it was filled are moved meanwhile.
+func (s *MetricStorage) attachPartition(ctx context.Context, from time.Time) error {
+	name := partitionName(from)
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	if _, err = tx.ExecContext(ctx, `LOCK TABLE metrics_default IN ACCESS EXCLUSIVE MODE;`); err != nil {
+		return fmt.Errorf("failed to lock default partition: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, moveQuery(name), from, from.Add(day), nil); err != nil {
+		return fmt.Errorf("failed to move rows of default partition to %s: %w", name, err)
+	}
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf(
+		`ALTER TABLE metrics ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s');`,
+		name, from.Format(time.DateOnly), from.Add(day).Format(time.DateOnly),
+	)); err != nil {
+		return fmt.Errorf("failed to attach partition %s: %w", name, err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// moveQuery moves up to a number of rows of the default partition created within a day to a partition,
+// all of them when the number is NULL.
+func moveQuery(partition string) string {
+	return fmt.Sprintf(
+		`WITH moved AS (
+		    DELETE FROM metrics_default WHERE ctid IN (
+		        SELECT ctid FROM metrics_default WHERE created_at >= $1 AND created_at < $2 LIMIT $3
+		    ) RETURNING *
+		)
+		INSERT INTO %s SELECT * FROM moved;`, partition,
+	)
+}
+
+// drain runs a query on the default partition taking a limit of rows as its last argument, one transaction
+// per drainBatch rows, until it affects fewer.
+func (s *MetricStorage) drain(ctx context.Context, query string, args ...any) error {
+	args = append(args, drainBatch)
+	var total int64
+	for {
+		result, err := s.db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("%w", err)
+		}
+		total += n
+		if n < drainBatch {
+			break
+		}
+	}
+	if total > 0 {
+		logger.Log.Warn("drained rows of default partition", zap.Int64("rows", total))
+	}
+	return nil
+}
+
+// maintainPartitions runs MaintainPartitions every maintenanceInterval until ctx is done.
+func (s *MetricStorage) maintainPartitions(ctx context.Context) {
+	defer close(s.done)
+	t := time.NewTicker(maintenanceInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if err := s.MaintainPartitions(ctx, now); err != nil {
+				logger.Log.Error("failed to maintain partitions", zap.Error(err))
+			}
+		}
+	}
+}
+
+// partitions lists the history partitions.
+func (s *MetricStorage) partitions(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.db.SelectContext(ctx, &names,
+		`SELECT c.relname
+		    FROM pg_inherits AS i
+		    JOIN pg_class AS c ON c.oid = i.inhrelid
+		    JOIN pg_class AS p ON p.oid = i.inhparent
+		    WHERE p.relname = 'metrics';`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions: %w", err)
+	}
+	return names, nil
+}
+
+func partitionName(from time.Time) string {
+	return partitionPrefix + from.Format(partitionLayout)
+}
+
+// partitionDay returns the first day covered by a daily partition, the default partition has none.
+func partitionDay(name string) (time.Time, bool) {
+	suffix, found := strings.CutPrefix(name, partitionPrefix)
+	if !found {
+		return time.Time{}, false
+	}
+	from, err := time.Parse(partitionLayout, suffix)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return from, true
+}
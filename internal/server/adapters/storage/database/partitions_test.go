@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPartitionDay(t *testing.T) {
+	from, ok := partitionDay("metrics_p20250131")
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC), from)
+	assert.Equal(t, "metrics_p20250131", partitionName(from))
+
+	_, ok = partitionDay("metrics_default")
+	assert.False(t, ok)
+}
+
+func TestMetricStorage_MaintainPartitions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now().UTC()
+	past := now.Add(-30 * day)
+	require.NoError(t, s.MaintainPartitions(ctx, past))
+
+	partitions, err := s.partitions(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, partitions, partitionName(past.Truncate(day)))
+
+	s.retentionDays = 3
+	require.NoError(t, s.MaintainPartitions(ctx, now))
+	partitions, err = s.partitions(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, partitions, partitionName(past.Truncate(day)))
+	assert.Contains(t, partitions, partitionName(now.Add(-2*day).Truncate(day)))
+	assert.Contains(t, partitions, partitionName(now.Add(partitionsAhead*day).Truncate(day)))
+	assert.Contains(t, partitions, "metrics_default")
+}
+
+func TestMetricStorage_MaintainPartitionsDefaultRows(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now().UTC()
+	expired, kept := now.Add(-40*day).Truncate(day), now.Add(-20*day).Truncate(day)
+	for _, from := range []time.Time{expired, kept} {
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, partitionName(from)))
+		require.NoError(t, err)
+		_, err = s.db.ExecContext(ctx,
+			`INSERT INTO metrics (name, type, value, created_at) VALUES ('load', 'gauge', 1, $1)`, from.Add(time.Hour),
+		)
+		require.NoError(t, err)
+	}
+
+	s.retentionDays = 30
+	require.NoError(t, s.MaintainPartitions(ctx, now), "rows in the default partition don't block its days")
+	partitions, err := s.partitions(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, partitions, partitionName(kept))
+	assert.NotContains(t, partitions, partitionName(expired))
+
+	var rows int
+	require.NoError(t, s.db.GetContext(ctx, &rows, `SELECT COUNT(*) FROM metrics_default`))
+	assert.Zero(t, rows, "kept rows are moved to their partition and expired ones deleted")
+	require.NoError(t, s.db.GetContext(ctx, &rows, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, partitionName(kept))))
+	assert.Equal(t, 1, rows)
+}
+
+func TestMetricStorage_MaintainPartitionsResume(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	now := time.Now().UTC()
+	from := now.Add(-10 * day).Truncate(day)
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s`, partitionName(from)))
+	require.NoError(t, err)
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO metrics (name, type, value, created_at) VALUES ('load', 'gauge', 1, $1), ('load', 'gauge', 2, $1)`,
+		from.Add(time.Hour),
+	)
+	require.NoError(t, err)
+	// A run that failed after filling the partition, before attaching it.
+	require.NoError(t, s.fillPartition(ctx, from))
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO metrics (name, type, value, created_at) VALUES ('load', 'gauge', 3, $1)`, from.Add(2*time.Hour),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, s.MaintainPartitions(ctx, now))
+	partitions, err := s.partitions(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, partitions, partitionName(from))
+	history, err := s.GetHistory(ctx, "load", from, from.Add(day))
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Len(t, history[0].Samples, 3, "the rows moved before and after the failure are all kept")
+}
+
+func TestMetricStorage_Close(t *testing.T) {
+	newTestStorage(t)
+	s, err := NewStorage(&Config{DSN: os.Getenv(testDSN), MaintainPartitions: true})
+	require.NoError(t, err)
+	require.NoError(t, s.Close(), "the maintenance is stopped")
+	require.Error(t, s.Ping(context.Background()))
+}
@@ -4,19 +4,27 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"metrics/internal/server/core/domain"
 	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/ddsketch"
 	"metrics/internal/shared-kernel/retrying"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 )
 
 type MetricStorage struct {
-	db *sqlx.DB
+	db            *sqlx.DB
+	retentionDays int
+	// stop ends the partition maintenance, which closes done once it has returned.
+	stop context.CancelFunc
+	done chan struct{}
 }
 
 func NewStorage(cfg *Config) (*MetricStorage, error) {
@@ -25,182 +33,306 @@ func NewStorage(cfg *Config) (*MetricStorage, error) {
 		return nil, fmt.Errorf("failed to open database %w", err)
 	}
 	if err = db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database %w", err)
+		return nil, errors.Join(fmt.Errorf("failed to ping database %w", err), db.Close())
 	}
-	return &MetricStorage{db: db}, migrate(db)
+	if err = migrate(db); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+	s := &MetricStorage{db: db, retentionDays: cfg.RetentionDays}
+	if cfg.MaintainPartitions {
+		if err = s.MaintainPartitions(context.Background(), time.Now()); err != nil {
+			return nil, errors.Join(err, db.Close())
+		}
+		var ctx context.Context
+		ctx, s.stop = context.WithCancel(context.Background())
+		s.done = make(chan struct{})
+		go s.maintainPartitions(ctx)
+	}
+	return s, nil
+}
+
+// Close stops the partition maintenance and closes the database.
+func (s *MetricStorage) Close() error {
+	if s.stop != nil {
+		s.stop()
+		<-s.done
+	}
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
 }
 
 func (s *MetricStorage) GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error) {
-	var (
-		delta sql.NullInt64
-		value sql.NullFloat64
-	)
-	row := s.db.QueryRowContext(
-		ctx,
-		`select delta, value from metrics where name=$1 and type=$2 ORDER BY created_at DESC LIMIT 1;`,
-		mName,
-		mType,
-	)
-	if row.Err() != nil {
-		return nil, fmt.Errorf("%w", row.Err())
+	return getMetric(ctx, s.db, mType, mName)
+}
+
+func (s *MetricStorage) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
+	metrics, err := s.SetMetrics(ctx, domain.MetricsList{*m})
+	if err != nil {
+		return nil, err
 	}
-	if err := row.Scan(&delta, &value); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, domain.ErrItemNotFound
+	return &metrics[0], nil
+}
+
+func (s *MetricStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	for _, m := range metrics {
+		if err := domain.ValidateMetric(&m); err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("%w", err)
 	}
-	switch mType {
-	case domain.Gauge:
-		return &domain.Metric{ID: mName, MType: mType, Value: &value.Float64}, nil
-	case domain.Counter:
-		return &domain.Metric{ID: mName, MType: mType, Delta: &delta.Int64}, nil
-	default:
-		return nil, domain.ErrIncorrectMetricType
+	b, err := aggregate(metrics)
+	if err != nil {
+		return nil, err
+	}
+	var saved domain.MetricsList
+	err = retrying.Do(ctx, func() error {
+		var err error
+		saved, err = s.upsert(ctx, &b)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	latest := make(map[domain.Key]domain.Value, len(saved))
+	for _, m := range saved {
+		latest[domain.Key{MType: m.MType, ID: m.ID}] = domain.Value{
+			Value:     m.Value,
+			Delta:     m.Delta,
+			Histogram: m.Histogram,
+			Sketch:    m.Sketch,
+			Updated:   m.UpdatedAt(),
+		}
 	}
+	result := make(domain.MetricsList, 0, len(metrics))
+	for _, m := range metrics {
+		key := domain.Key{MType: m.MType, ID: m.ID}
+		result = append(result, domain.NewMetric(key, latest[key]))
+	}
+	return result, nil
 }
 
-func (s *MetricStorage) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
-	switch m.MType {
-	case domain.Gauge:
-		err := retrying.ExecContext(
-			ctx,
-			s.db,
-			`INSERT INTO metrics (name, type, value) VALUES ($1, $2, $3)`,
-			m.ID, m.MType, *m.Value,
+// upsert applies an aggregated batch in one transaction and returns the resulting latest values. A failed
+// commit is marked with retrying.ErrCommit, the other failures leave the batch unapplied.
+func (s *MetricStorage) upsert(ctx context.Context, b *batch) (domain.MetricsList, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	sketches, err := lockSketches(ctx, tx, b)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, upsertBatch, b.names, b.types, b.deltas, b.values, b.histograms, sketches)
+	if err != nil {
+		return nil, upsertError(err)
+	}
+	saved, err := scanMetrics(rows)
+	if err != nil {
+		return nil, upsertError(err)
+	}
+	if err = tx.Commit(); err != nil {
+		// The counter deltas may have been added, retrying would add them twice.
+		return nil, fmt.Errorf("%w %w", retrying.ErrCommit, err)
+	}
+	return saved, nil
+}
+
+func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT name, type, delta, value, histogram, sketch, updated_at FROM metrics_latest;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return scanMetrics(rows)
+}
+
+// GetHistory returns the gauge and counter series of a metric name sampled between from and to.
+func (s *MetricStorage) GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error) {
+	// created_at holds UTC without a zone, so the bounds are passed as UTC wall clock.
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT name, type, delta, value, created_at FROM metrics
+		    WHERE (name = $1 OR starts_with(name, $1 || '{'))
+		      AND type IN ('gauge', 'counter') AND created_at BETWEEN $2 AND $3
+		    ORDER BY name, type, created_at, id;`,
+		name, from.UTC(), to.UTC(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer closeRows(rows)
+	series := make([]domain.Series, 0)
+	for rows.Next() {
+		var (
+			id, mType string
+			delta     sql.NullInt64
+			value     sql.NullFloat64
+			createdAt time.Time
 		)
-		if err != nil {
+		if err = rows.Scan(&id, &mType, &delta, &value, &createdAt); err != nil {
 			return nil, fmt.Errorf("%w", err)
 		}
-	case domain.Counter:
-		current, err := s.GetMetric(ctx, m.MType, m.ID)
-		if err != nil {
-			if !errors.Is(err, domain.ErrItemNotFound) {
-				return nil, fmt.Errorf("%w", err)
-			}
-		} else {
-			*m.Delta += *current.Delta
+		sample := domain.Sample{Time: createdAt, Value: value.Float64}
+		if mType == domain.Counter {
+			sample.Value = float64(delta.Int64)
 		}
-		err = retrying.ExecContext(
-			ctx,
-			s.db,
-			`INSERT INTO metrics (name, type, delta) VALUES ($1, $2, $3)`,
-			m.ID, m.MType, *m.Delta,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("%w", err)
+		if n := len(series); n == 0 || series[n-1].ID != id || series[n-1].MType != mType {
+			series = append(series, domain.Series{ID: id, MType: mType})
 		}
-	default:
-		return nil, domain.ErrIncorrectMetricType
+		series[len(series)-1].Samples = append(series[len(series)-1].Samples, sample)
 	}
-	return m, nil
-}
-
-func (s *MetricStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
-	tx, err := s.db.Begin()
-	if err != nil {
+	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
-	for _, m := range metrics {
-		switch m.MType {
-		case domain.Gauge:
-			err = retrying.ExecContext(
-				ctx,
-				s.db,
-				`INSERT INTO metrics (name, type, value) VALUES ($1, $2, $3)`,
-				m.ID, m.MType, *m.Value,
-			)
-			if err != nil {
-				if txErr := tx.Rollback(); txErr != nil {
-					if !errors.Is(txErr, sql.ErrTxDone) {
-						logger.Log.Error("failed to rollback the transaction", zap.Error(txErr))
-					}
-				}
-				return nil, fmt.Errorf("%w", err)
-			}
+	return series, nil
+}
 
-		case domain.Counter:
-			current, err := s.GetMetric(ctx, m.MType, m.ID)
-			if err != nil {
-				if !errors.Is(err, domain.ErrItemNotFound) {
-					return nil, fmt.Errorf("%w", err)
-				}
+// AppendHistory adds the samples of gauge and counter series to their history, counters being sampled as
+// totals. The latest values are left as they are.
+func (s *MetricStorage) AppendHistory(ctx context.Context, series []domain.Series) error {
+	var (
+		names, types []string
+		deltas       []*int64
+		values       []*float64
+		times        []time.Time
+	)
+	for _, ser := range series {
+		if ser.MType != domain.Gauge && ser.MType != domain.Counter {
+			return fmt.Errorf("%w: %s has no history", domain.ErrIncorrectMetricType, ser.MType)
+		}
+		for _, sample := range ser.Samples {
+			names = append(names, ser.ID)
+			types = append(types, ser.MType)
+			if ser.MType == domain.Counter {
+				delta := int64(sample.Value)
+				deltas, values = append(deltas, &delta), append(values, nil)
 			} else {
-				*m.Delta += *current.Delta
-			}
-			err = retrying.ExecContext(
-				ctx,
-				s.db,
-				`INSERT INTO metrics (name, type, delta) VALUES ($1, $2, $3)`,
-				m.ID, m.MType, *m.Delta,
-			)
-			if err != nil {
-				if txErr := tx.Rollback(); txErr != nil {
-					if !errors.Is(txErr, sql.ErrTxDone) {
-						logger.Log.Error("failed to rollback the transaction", zap.Error(txErr))
-					}
-				}
-				return nil, fmt.Errorf("%w", err)
+				deltas, values = append(deltas, nil), append(values, &sample.Value)
 			}
-		default:
-			return nil, domain.ErrIncorrectMetricType
+			// created_at holds UTC without a zone.
+			times = append(times, sample.Time.UTC())
 		}
 	}
+	if len(names) == 0 {
+		return nil
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`INSERT INTO metrics (name, type, delta, value, created_at)
+		    SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::bigint[], $4::double precision[], $5::timestamp[]);`,
+		names, types, deltas, values, times,
+	); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
 
-	if err = tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction %w", err)
+func (s *MetricStorage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database %w", err)
 	}
-	return metrics, nil
+	return nil
 }
 
-func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList, error) {
-	metrics := make(domain.MetricsList, 0)
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT t1.name, t1.type, m.delta, m.value 
-		    FROM (select name, type, MAX(created_at) as created_at from metrics group by name, type) AS t1
-			LEFT JOIN metrics AS m ON t1.name = m.name AND t1.type=m.type AND t1.created_at = m.created_at;`,
+// errHistogramMismatch is the SQLSTATE raised by merge_histogram when the bounds differ.
+const errHistogramMismatch = "MH001"
+
+// upsertError maps the error of merge_histogram back to the domain one.
+func upsertError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == errHistogramMismatch {
+		return domain.ErrHistogramMismatch
+	}
+	return fmt.Errorf("failed to upsert metrics %w", err)
+}
+
+func getMetric(ctx context.Context, q sqlx.QueryerContext, mType, mName string) (*domain.Metric, error) {
+	var (
+		delta     sql.NullInt64
+		value     sql.NullFloat64
+		histogram []byte
+		sketch    []byte
+		updatedAt time.Time
 	)
-	if err != nil {
+	row := q.QueryRowxContext(
+		ctx,
+		`SELECT delta, value, histogram, sketch, updated_at FROM metrics_latest WHERE name=$1 AND type=$2;`,
+		mName,
+		mType,
+	)
+	if err := row.Scan(&delta, &value, &histogram, &sketch, &updatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrItemNotFound
+		}
 		return nil, fmt.Errorf("%w", err)
 	}
+	m := &domain.Metric{ID: mName, MType: mType, Updated: &updatedAt}
+	if err := setValue(m, delta, value, histogram, sketch); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// setValue sets the value column matching the metric type, histograms and sketches are stored as JSON.
+func setValue(m *domain.Metric, delta sql.NullInt64, value sql.NullFloat64, histogram, sketch []byte) error {
+	switch m.MType {
+	case domain.Gauge:
+		m.Value = &value.Float64
+	case domain.Counter:
+		m.Delta = &delta.Int64
+	case domain.Histogram:
+		m.Histogram = &domain.HistogramValue{}
+		if err := json.Unmarshal(histogram, m.Histogram); err != nil {
+			return fmt.Errorf("failed to decode histogram %w", err)
+		}
+	case domain.Timer:
+		m.Sketch = &ddsketch.Sketch{}
+		if err := json.Unmarshal(sketch, m.Sketch); err != nil {
+			return fmt.Errorf("failed to decode sketch %w", err)
+		}
+	default:
+		return domain.ErrIncorrectMetricType
+	}
+	return nil
+}
+
+// scanMetrics reads name, type, delta, value, histogram, sketch and update time rows and closes them.
+func scanMetrics(rows *sql.Rows) (domain.MetricsList, error) {
+	defer closeRows(rows)
+	metrics := make(domain.MetricsList, 0)
 	for rows.Next() {
 		var (
-			m     domain.Metric
-			delta sql.NullInt64
-			value sql.NullFloat64
+			m         domain.Metric
+			delta     sql.NullInt64
+			value     sql.NullFloat64
+			histogram []byte
+			sketch    []byte
+			updatedAt time.Time
 		)
-
-		err = rows.Scan(&m.ID, &m.MType, &delta, &value)
-		if err != nil {
+		if err := rows.Scan(&m.ID, &m.MType, &delta, &value, &histogram, &sketch, &updatedAt); err != nil {
 			return nil, fmt.Errorf("%w", err)
 		}
-		switch m.MType {
-		case domain.Gauge:
-			m.Value = &value.Float64
-		case domain.Counter:
-			m.Delta = &delta.Int64
-		default:
-			return nil, domain.ErrIncorrectMetricType
+		m.Updated = &updatedAt
+		if err := setValue(&m, delta, value, histogram, sketch); err != nil {
+			return nil, err
 		}
-
 		metrics = append(metrics, m)
 	}
-	defer func() {
-		err := rows.Close()
-		if err != nil {
-			logger.Log.Error("error occurred during closing rows", zap.Error(err))
-		}
-	}()
-	err = rows.Err()
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
 	return metrics, nil
 }
 
-func (s *MetricStorage) Ping(ctx context.Context) error {
-	if err := s.db.PingContext(ctx); err != nil {
-		return fmt.Errorf("failed to ping database %w", err)
+func closeRows(rows *sql.Rows) {
+	if err := rows.Close(); err != nil {
+		logger.Log.Error("error occurred during closing rows", zap.Error(err))
+	}
+}
+
+func rollback(tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Log.Error("failed to rollback the transaction", zap.Error(err))
 	}
-	return nil
 }
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDSN points to a Postgres instance used by the tests, they are skipped when it is not set.
+const testDSN = "TEST_DATABASE_DSN"
+
+// newTestStorage connects to the test database and truncates every table.
+func newTestStorage(tb testing.TB) *MetricStorage {
+	tb.Helper()
+	dsn := os.Getenv(testDSN)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDSN)
+	}
+	s, err := NewStorage(&Config{DSN: dsn})
+	require.NoError(tb, err)
+	_, err = s.db.Exec(`TRUNCATE metrics, metrics_latest`)
+	require.NoError(tb, err)
+	tb.Cleanup(func() {
+		require.NoError(tb, s.Close())
+	})
+	return s
+}
+
+func TestMetricStorage_Conformance(t *testing.T) {
+	if os.Getenv(testDSN) == "" {
+		t.Skipf("%s is not set", testDSN)
+	}
+	storagetest.Run(t, func(t *testing.T) storagetest.MetricStorage {
+		t.Helper()
+		return newTestStorage(t)
+	})
+}
+
+func TestMetricStorage_History(t *testing.T) {
+	storagetest.RunHistory(t, func(t *testing.T) storagetest.HistoryStorage {
+		t.Helper()
+		return newTestStorage(t)
+	})
+}
+
+func BenchmarkMetricStorage_SetMetrics(b *testing.B) {
+	const batchSize = 10000
+	s := newTestStorage(b)
+	ctx := context.Background()
+	for _, series := range []int{100, batchSize} {
+		metrics := make(domain.MetricsList, 0, batchSize)
+		for i := range batchSize {
+			id := fmt.Sprintf("metric%d", i%series)
+			if i%2 == 0 {
+				metrics = append(metrics, storagetest.Counter(id, int64(i)))
+			} else {
+				metrics = append(metrics, storagetest.Gauge(id, float64(i)))
+			}
+		}
+		b.Run(fmt.Sprintf("Batch%dSeries%d", batchSize, series), func(b *testing.B) {
+			for range b.N {
+				if _, err := s.SetMetrics(ctx, metrics); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.N*batchSize)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
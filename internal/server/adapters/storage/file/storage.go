@@ -5,7 +5,9 @@ import (
 	"context"
 	"fmt"
 	"metrics/internal/server/core/files"
+	"strings"
 	"sync"
+	"time"
 
 	"metrics/internal/server/core/domain"
 )
@@ -42,56 +44,66 @@ func NewStorage(cfg *Config) (*MetricStorage, error) {
 }
 
 func (s *MetricStorage) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
-	s.saveMetric(m)
-	if s.syncWrite {
-		err := files.SaveMetricsToFile(s.filepath, s.metrics)
-		if err != nil {
-			return nil, fmt.Errorf("failed to save metrics to file %w", err)
-		}
-	}
-	metric, err := s.GetMetric(ctx, m.MType, m.ID)
+	metrics, err := s.SetMetrics(ctx, domain.MetricsList{*m})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get metric %w", err)
+		return nil, err
 	}
-	return metric, nil
+	return &metrics[0], nil
 }
 
 func (s *MetricStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
 	for _, metric := range metrics {
-		s.saveMetric(&metric)
-	}
-	if s.syncWrite {
-		err := files.SaveMetricsToFile(s.filepath, s.metrics)
-		if err != nil {
-			return nil, fmt.Errorf("failed to save metrics to file %w", err)
+		if err := domain.ValidateMetric(&metric); err != nil {
+			return nil, err
 		}
 	}
-	metricsOut := make(domain.MetricsList, 0)
+	previous, err := s.saveMetrics(metrics)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.persist(previous); err != nil {
+		return nil, err
+	}
+	metricsOut := make(domain.MetricsList, 0, len(metrics))
 	for _, metric := range metrics {
-		m, err := s.GetMetric(ctx, metric.MType, metric.ID)
+		m, err := s.getMetric(metric.MType, metric.ID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get metric %w", err)
 		}
-		if m != nil {
-			metricsOut = append(metricsOut, *m)
-		}
+		metricsOut = append(metricsOut, *m)
 	}
 	return metricsOut, nil
 }
 
+// RestoreMetrics puts the values of a snapshot in place of the stored ones, keeping the time they were last
+// written at, a value without one being written now. Nothing is stored if any value is invalid.
+func (s *MetricStorage) RestoreMetrics(ctx context.Context, values domain.MetricValues) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for k, v := range values {
+		m := domain.NewMetric(k, v)
+		if err := domain.ValidateMetric(&m); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	previous := make(map[domain.Key]domain.Value, len(values))
+	for k, v := range values {
+		if v.Updated.IsZero() {
+			v.Updated = now
+		}
+		previous[k] = s.metrics[k]
+		s.metrics[k] = v
+	}
+	return s.persist(previous)
+}
+
 func (s *MetricStorage) GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error) {
 	s.mux.RLock()
 	defer s.mux.RUnlock()
-	value, found := s.metrics[domain.Key{MType: mType, ID: mName}]
-	if !found {
-		return &domain.Metric{}, domain.ErrItemNotFound
-	}
-	return &domain.Metric{
-		ID:    mName,
-		MType: mType,
-		Value: value.Value,
-		Delta: value.Delta,
-	}, nil
+	return s.getMetric(mType, mName)
 }
 
 func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList, error) {
@@ -99,33 +111,154 @@ func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList,
 	defer s.mux.RUnlock()
 	metrics := make(domain.MetricsList, 0)
 	for k, v := range s.metrics {
-		metrics = append(metrics, domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
+		metrics = append(metrics, domain.NewMetric(k, v))
 	}
 	return metrics, nil
 }
 
-func (s *MetricStorage) Ping(ctx context.Context) error {
-	return nil
+// ListMetrics returns a page of the metrics selected by the filter.
+func (s *MetricStorage) ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error) {
+	metrics, err := s.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(metrics), nil
 }
 
-func (s *MetricStorage) saveMetric(m *domain.Metric) {
+// DeleteMetric removes a series.
+func (s *MetricStorage) DeleteMetric(ctx context.Context, mType, mName string) error {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	key := domain.Key{MType: m.MType, ID: m.ID}
-	if m.MType == domain.Counter {
-		value, found := s.metrics[key]
-		if found {
-			*value.Delta += *m.Delta
-			s.metrics[key] = domain.Value{Delta: value.Delta}
-		} else {
-			s.metrics[key] = domain.Value{Delta: m.Delta}
+	key := domain.Key{MType: mType, ID: mName}
+	value, found := s.metrics[key]
+	if !found {
+		return domain.ErrItemNotFound
+	}
+	delete(s.metrics, key)
+	return s.persist(map[domain.Key]domain.Value{key: value})
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+func (s *MetricStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	previous := make(map[domain.Key]domain.Value)
+	for k, v := range s.metrics {
+		if strings.HasPrefix(k.ID, prefix) {
+			previous[k] = v
+			delete(s.metrics, k)
 		}
-	} else {
-		s.metrics[key] = domain.Value{Value: m.Value}
+	}
+	if len(previous) == 0 {
+		return 0, nil
+	}
+	if err := s.persist(previous); err != nil {
+		return 0, err
+	}
+	return len(previous), nil
+}
+
+// ResetCounter sets the total of a counter to zero.
+func (s *MetricStorage) ResetCounter(ctx context.Context, mName string) (*domain.Metric, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	key := domain.Key{MType: domain.Counter, ID: mName}
+	value, found := s.metrics[key]
+	if !found {
+		return nil, domain.ErrItemNotFound
+	}
+	var zero int64
+	s.metrics[key] = domain.Value{Delta: &zero, Updated: time.Now()}
+	if err := s.persist(map[domain.Key]domain.Value{key: value}); err != nil {
+		return nil, err
+	}
+	return s.getMetric(key.MType, key.ID)
+}
+
+// DeleteStale removes the series not written since before and returns their keys.
+func (s *MetricStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	previous := make(map[domain.Key]domain.Value)
+	for k, v := range s.metrics {
+		if v.Updated.Before(before) {
+			previous[k] = v
+			delete(s.metrics, k)
+		}
+	}
+	keys := make([]domain.Key, 0, len(previous))
+	if len(previous) == 0 {
+		return keys, nil
+	}
+	if err := s.persist(previous); err != nil {
+		return nil, err
+	}
+	for k := range previous {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// persist writes the file on every change when writes are synchronous, rolling the change back to the
+// previous values if it can't be written. The caller must hold the write lock.
+func (s *MetricStorage) persist(previous map[domain.Key]domain.Value) error {
+	if !s.syncWrite {
+		return nil
+	}
+	if err := files.SaveMetricsToFile(s.filepath, s.metrics); err != nil {
+		s.restore(previous)
+		return fmt.Errorf("failed to save metrics to file %w", err)
+	}
+	return nil
+}
+
+func (s *MetricStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *InMemoryStore) getMetric(mType, mName string) (*domain.Metric, error) {
+	key := domain.Key{MType: mType, ID: mName}
+	value, found := s.metrics[key]
+	if !found {
+		return nil, domain.ErrItemNotFound
+	}
+	m := domain.NewMetric(key, value)
+	return &m, nil
+}
+
+// saveMetrics applies a batch to the stored values and returns the values it replaced, nothing is stored
+// if any metric can't be applied. The caller must hold the write lock.
+func (s *InMemoryStore) saveMetrics(metrics domain.MetricsList) (map[domain.Key]domain.Value, error) {
+	staged := make(map[domain.Key]domain.Value, len(metrics))
+	now := time.Now()
+	for _, m := range metrics {
+		key := domain.Key{MType: m.MType, ID: m.ID}
+		current, found := staged[key]
+		if !found {
+			current = s.metrics[key]
+		}
+		next, err := current.Apply(&m)
+		if err != nil {
+			return nil, err
+		}
+		next.Updated = now
+		staged[key] = next
+	}
+	previous := make(map[domain.Key]domain.Value, len(staged))
+	for k, v := range staged {
+		previous[k] = s.metrics[k]
+		s.metrics[k] = v
+	}
+	return previous, nil
+}
+
+// restore rolls back the values changed by a batch that could not be persisted.
+func (s *InMemoryStore) restore(previous map[domain.Key]domain.Value) {
+	for k, v := range previous {
+		if v.Value == nil && v.Delta == nil && v.Histogram == nil && v.Sketch == nil {
+			delete(s.metrics, k)
+			continue
+		}
+		s.metrics[k] = v
 	}
 }
@@ -2,7 +2,10 @@ package file
 
 import (
 	"context"
+	"fmt"
+	"metrics/internal/server/adapters/storage/storagetest"
 	"metrics/internal/server/core/domain"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -22,10 +25,10 @@ func TestMetricStorage_SetMetric(t *testing.T) {
 	require.NoError(t, err)
 	m, err := s.SetMetric(ctx, mCounter)
 	require.NoError(t, err)
-	assert.Equal(t, mCounter, m)
+	assert.Equal(t, mCounter, storagetest.Written(m))
 	m, err = s.SetMetric(ctx, mGauge)
 	require.NoError(t, err)
-	assert.Equal(t, mGauge, m)
+	assert.Equal(t, mGauge, storagetest.Written(m))
 }
 
 func TestMetricStorage_SetMetrics(t *testing.T) {
@@ -35,7 +38,7 @@ func TestMetricStorage_SetMetrics(t *testing.T) {
 	metrics := domain.MetricsList{*mCounter, *mGauge}
 	m, err := s.SetMetrics(ctx, metrics)
 	require.NoError(t, err)
-	assert.Equal(t, metrics, m)
+	assert.Equal(t, metrics, storagetest.WrittenList(m))
 }
 
 func TestMetricStorage_GetMetric(t *testing.T) {
@@ -48,10 +51,10 @@ func TestMetricStorage_GetMetric(t *testing.T) {
 	require.NoError(t, err)
 	metric, err := s.GetMetric(context.Background(), mCounter.MType, mCounter.ID)
 	require.NoError(t, err)
-	assert.Equal(t, metric, mCounter)
+	assert.Equal(t, storagetest.Written(metric), mCounter)
 	metric, err = s.GetMetric(context.Background(), mGauge.MType, mGauge.ID)
 	require.NoError(t, err)
-	assert.Equal(t, metric, mGauge)
+	assert.Equal(t, storagetest.Written(metric), mGauge)
 }
 
 func TestMetricStorage_GetAllMetrics(t *testing.T) {
@@ -61,9 +64,34 @@ func TestMetricStorage_GetAllMetrics(t *testing.T) {
 	metrics := domain.MetricsList{*mCounter, *mGauge}
 	m, err := s.SetMetrics(ctx, metrics)
 	require.NoError(t, err)
-	assert.Equal(t, metrics, m)
+	assert.Equal(t, metrics, storagetest.WrittenList(m))
 
 	allMetrics, err := s.GetAllMetrics(ctx)
 	require.NoError(t, err)
 	assert.Equal(t, 2, len(allMetrics))
 }
+
+func TestMetricStorage_Conformance(t *testing.T) {
+	for _, storeInterval := range []int{0, 300} {
+		t.Run(fmt.Sprintf("StoreInterval%d", storeInterval), func(t *testing.T) {
+			storagetest.Run(t, func(t *testing.T) storagetest.MetricStorage {
+				t.Helper()
+				s, err := NewStorage(&Config{
+					Filepath:      filepath.Join(t.TempDir(), "metrics.json"),
+					StoreInterval: storeInterval,
+				})
+				require.NoError(t, err)
+				return s
+			})
+		})
+	}
+}
+
+func TestMetricStorage_Restore(t *testing.T) {
+	storagetest.RunRestore(t, func(t *testing.T) storagetest.RestoreStorage {
+		t.Helper()
+		s, err := NewStorage(&Config{Filepath: filepath.Join(t.TempDir(), "metrics.json")})
+		require.NoError(t, err)
+		return s
+	})
+}
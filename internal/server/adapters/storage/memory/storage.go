@@ -3,7 +3,9 @@ package memory
 
 import (
 	"context"
+	"strings"
 	"sync"
+	"time"
 
 	"metrics/internal/server/core/domain"
 )
@@ -23,32 +25,62 @@ func NewStorage(cfg *Config) (*MetricStorage, error) {
 func (s *MetricStorage) GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	value, found := s.metrics[domain.Key{MType: mType, ID: mName}]
-	if !found {
-		return &domain.Metric{}, domain.ErrItemNotFound
-	}
-	return &domain.Metric{
-		ID:    mName,
-		MType: mType,
-		Value: value.Value,
-		Delta: value.Delta,
-	}, nil
+	return s.getMetric(mType, mName)
 }
 
 func (s *MetricStorage) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
-	s.saveMetric(m)
-	return m, nil
+	if err := domain.ValidateMetric(m); err != nil {
+		return nil, err
+	}
+	if err := s.saveMetrics(domain.MetricsList{*m}); err != nil {
+		return nil, err
+	}
+	return s.getMetric(m.MType, m.ID)
 }
 
 func (s *MetricStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 	for _, metric := range metrics {
-		s.saveMetric(&metric)
+		if err := domain.ValidateMetric(&metric); err != nil {
+			return nil, err
+		}
 	}
-	return metrics, nil
+	if err := s.saveMetrics(metrics); err != nil {
+		return nil, err
+	}
+	saved := make(domain.MetricsList, 0, len(metrics))
+	for _, metric := range metrics {
+		m, err := s.getMetric(metric.MType, metric.ID)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, *m)
+	}
+	return saved, nil
+}
+
+// RestoreMetrics puts the values of a snapshot in place of the stored ones, keeping the time they were last
+// written at, a value without one being written now. Nothing is stored if any value is invalid.
+func (s *MetricStorage) RestoreMetrics(ctx context.Context, values domain.MetricValues) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for k, v := range values {
+		m := domain.NewMetric(k, v)
+		if err := domain.ValidateMetric(&m); err != nil {
+			return err
+		}
+	}
+	now := time.Now()
+	for k, v := range values {
+		if v.Updated.IsZero() {
+			v.Updated = now
+		}
+		s.metrics[k] = v
+	}
+	return nil
 }
 
 func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList, error) {
@@ -56,31 +88,106 @@ func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList,
 	defer s.mux.Unlock()
 	metrics := make(domain.MetricsList, 0)
 	for k, v := range s.metrics {
-		metrics = append(metrics, domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
+		metrics = append(metrics, domain.NewMetric(k, v))
 	}
 	return metrics, nil
 }
 
+// ListMetrics returns a page of the metrics selected by the filter.
+func (s *MetricStorage) ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error) {
+	metrics, err := s.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(metrics), nil
+}
+
+// DeleteMetric removes a series.
+func (s *MetricStorage) DeleteMetric(ctx context.Context, mType, mName string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	key := domain.Key{MType: mType, ID: mName}
+	if _, found := s.metrics[key]; !found {
+		return domain.ErrItemNotFound
+	}
+	delete(s.metrics, key)
+	return nil
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+func (s *MetricStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	deleted := 0
+	for k := range s.metrics {
+		if strings.HasPrefix(k.ID, prefix) {
+			delete(s.metrics, k)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// ResetCounter sets the total of a counter to zero.
+func (s *MetricStorage) ResetCounter(ctx context.Context, mName string) (*domain.Metric, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	key := domain.Key{MType: domain.Counter, ID: mName}
+	if _, found := s.metrics[key]; !found {
+		return nil, domain.ErrItemNotFound
+	}
+	var zero int64
+	s.metrics[key] = domain.Value{Delta: &zero, Updated: time.Now()}
+	return s.getMetric(key.MType, key.ID)
+}
+
+// DeleteStale removes the series not written since before and returns their keys.
+func (s *MetricStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	keys := make([]domain.Key, 0)
+	for k, v := range s.metrics {
+		if v.Updated.Before(before) {
+			delete(s.metrics, k)
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
+
 func (s *MetricStorage) Ping(ctx context.Context) error {
 	return nil
 }
 
-func (s *MetricStorage) saveMetric(m *domain.Metric) {
-	key := domain.Key{MType: m.MType, ID: m.ID}
-	if m.MType == domain.Counter {
-		value, found := s.metrics[key]
-		if found {
-			*value.Delta += *m.Delta
-			s.metrics[key] = domain.Value{Delta: value.Delta}
-		} else {
-			s.metrics[key] = domain.Value{Delta: m.Delta}
+func (s *MetricStorage) getMetric(mType, mName string) (*domain.Metric, error) {
+	key := domain.Key{MType: mType, ID: mName}
+	value, found := s.metrics[key]
+	if !found {
+		return nil, domain.ErrItemNotFound
+	}
+	m := domain.NewMetric(key, value)
+	return &m, nil
+}
+
+// saveMetrics applies a batch to the stored values, nothing is stored if any metric can't be applied.
+func (s *MetricStorage) saveMetrics(metrics domain.MetricsList) error {
+	staged := make(map[domain.Key]domain.Value, len(metrics))
+	now := time.Now()
+	for _, m := range metrics {
+		key := domain.Key{MType: m.MType, ID: m.ID}
+		current, found := staged[key]
+		if !found {
+			current = s.metrics[key]
 		}
-	} else {
-		s.metrics[key] = domain.Value{Value: m.Value}
+		next, err := current.Apply(&m)
+		if err != nil {
+			return err
+		}
+		next.Updated = now
+		staged[key] = next
+	}
+	for k, v := range staged {
+		s.metrics[k] = v
 	}
+	return nil
 }
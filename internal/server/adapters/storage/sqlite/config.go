@@ -0,0 +1,8 @@
+package sqlite
+
+// Scheme is the DSN prefix that selects the SQLite storage.
+const Scheme = "sqlite://"
+
+type Config struct {
+	DSN string
+}
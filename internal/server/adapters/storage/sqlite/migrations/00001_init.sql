@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS metrics
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    created_at    timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL)
+    );
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
+
+-- +goose Down
+DROP TABLE metrics;
@@ -0,0 +1,43 @@
+-- +goose Up
+-- SQLite can't alter a CHECK constraint, so the table is rebuilt with the histogram column.
+CREATE TABLE metrics_histogram
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    histogram     text,
+    created_at    timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL)
+    );
+
+INSERT INTO metrics_histogram (id, name, type, delta, value, created_at)
+SELECT id, name, type, delta, value, created_at FROM metrics;
+
+DROP TABLE metrics;
+ALTER TABLE metrics_histogram RENAME TO metrics;
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
+
+-- +goose Down
+CREATE TABLE metrics_plain
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    created_at    timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL)
+    );
+
+INSERT INTO metrics_plain (id, name, type, delta, value, created_at)
+SELECT id, name, type, delta, value, created_at FROM metrics WHERE histogram IS NULL;
+
+DROP TABLE metrics;
+ALTER TABLE metrics_plain RENAME TO metrics;
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
@@ -0,0 +1,45 @@
+-- +goose Up
+-- SQLite can't alter a CHECK constraint, so the table is rebuilt with the sketch column.
+CREATE TABLE metrics_sketch
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    histogram     text,
+    sketch        text,
+    created_at    timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL OR sketch IS NOT NULL)
+    );
+
+INSERT INTO metrics_sketch (id, name, type, delta, value, histogram, created_at)
+SELECT id, name, type, delta, value, histogram, created_at FROM metrics;
+
+DROP TABLE metrics;
+ALTER TABLE metrics_sketch RENAME TO metrics;
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
+
+-- +goose Down
+CREATE TABLE metrics_histogram
+(
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          varchar(255) not null,
+    type          varchar(255) not null,
+    delta         bigint,
+    value         double precision,
+    histogram     text,
+    created_at    timestamp NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+    CHECK (delta IS NOT NULL OR value IS NOT NULL OR histogram IS NOT NULL)
+    );
+
+INSERT INTO metrics_histogram (id, name, type, delta, value, histogram, created_at)
+SELECT id, name, type, delta, value, histogram, created_at FROM metrics WHERE sketch IS NULL;
+
+DROP TABLE metrics;
+ALTER TABLE metrics_histogram RENAME TO metrics;
+
+CREATE INDEX IF NOT EXISTS name_idx ON metrics (name);
+CREATE INDEX IF NOT EXISTS type_idx ON metrics (type);
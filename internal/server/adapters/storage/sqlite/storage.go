@@ -0,0 +1,430 @@
+// Package sqlite provides implementations of the MetricStorage interface.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/logger"
+	"metrics/internal/shared-kernel/ddsketch"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+// timeLayout is the layout of created_at, which SQLite stores as UTC text and the driver reads as time.
+const timeLayout = "2006-01-02 15:04:05.000"
+
+type MetricStorage struct {
+	db *sqlx.DB
+}
+
+func NewStorage(cfg *Config) (*MetricStorage, error) {
+	db, err := sqlx.Open("sqlite", cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %w", err)
+	}
+	// SQLite allows a single writer, so one connection serialises access instead of failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if err = db.Ping(); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to ping database %w", err), db.Close())
+	}
+	if err = migrate(db); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+	return &MetricStorage{db: db}, nil
+}
+
+// Close closes the database.
+func (s *MetricStorage) Close() error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+func (s *MetricStorage) GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error) {
+	return getMetric(ctx, s.db, mType, mName)
+}
+
+func (s *MetricStorage) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
+	metrics, err := s.SetMetrics(ctx, domain.MetricsList{*m})
+	if err != nil {
+		return nil, err
+	}
+	return &metrics[0], nil
+}
+
+func (s *MetricStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	saved := make(domain.MetricsList, 0, len(metrics))
+	for _, m := range metrics {
+		metric, err := insertMetric(ctx, tx, &m)
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, *metric)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return saved, nil
+}
+
+func (s *MetricStorage) GetAllMetrics(ctx context.Context) (domain.MetricsList, error) {
+	metrics := make(domain.MetricsList, 0)
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT m.name, m.type, m.delta, m.value, m.histogram, m.sketch, m.created_at
+		    FROM metrics AS m
+		    JOIN (SELECT MAX(id) AS id FROM metrics GROUP BY name, type) AS t ON m.id = t.id;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error occurred during closing rows", zap.Error(err))
+		}
+	}()
+	for rows.Next() {
+		var (
+			name, mType string
+			delta       sql.NullInt64
+			value       sql.NullFloat64
+			histogram   sql.NullString
+			sketch      sql.NullString
+			createdAt   time.Time
+		)
+		if err = rows.Scan(&name, &mType, &delta, &value, &histogram, &sketch, &createdAt); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		m, err := newMetric(name, mType, delta, value, histogram, sketch, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, *m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return metrics, nil
+}
+
+// ListMetrics returns a page of the metrics selected by the filter, which is applied to the latest values.
+func (s *MetricStorage) ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error) {
+	metrics, err := s.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filter.Page(metrics), nil
+}
+
+// GetHistory returns the gauge and counter series of a metric name sampled between from and to.
+func (s *MetricStorage) GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT name, type, delta, value, created_at FROM metrics
+		    WHERE (name = ? OR substr(name, 1, length(?) + 1) = ? || '{')
+		      AND type IN ('gauge', 'counter') AND created_at BETWEEN ? AND ?
+		    ORDER BY name, type, id;`,
+		name, name, name, from.UTC().Format(timeLayout), to.UTC().Format(timeLayout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			logger.Log.Error("error occurred during closing rows", zap.Error(err))
+		}
+	}()
+	series := make([]domain.Series, 0)
+	for rows.Next() {
+		var (
+			id, mType string
+			delta     sql.NullInt64
+			value     sql.NullFloat64
+			createdAt time.Time
+		)
+		if err = rows.Scan(&id, &mType, &delta, &value, &createdAt); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		sample := domain.Sample{Time: createdAt, Value: value.Float64}
+		if mType == domain.Counter {
+			sample.Value = float64(delta.Int64)
+		}
+		if n := len(series); n == 0 || series[n-1].ID != id || series[n-1].MType != mType {
+			series = append(series, domain.Series{ID: id, MType: mType})
+		}
+		series[len(series)-1].Samples = append(series[len(series)-1].Samples, sample)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return series, nil
+}
+
+// AppendHistory adds the samples of gauge and counter series to their history, counters being sampled as
+// totals. The last sample of a series is its latest value until it is written again.
+func (s *MetricStorage) AppendHistory(ctx context.Context, series []domain.Series) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	for _, ser := range series {
+		for _, sample := range ser.Samples {
+			var (
+				delta sql.NullInt64
+				value sql.NullFloat64
+			)
+			switch ser.MType {
+			case domain.Gauge:
+				value = sql.NullFloat64{Float64: sample.Value, Valid: true}
+			case domain.Counter:
+				delta = sql.NullInt64{Int64: int64(sample.Value), Valid: true}
+			default:
+				return fmt.Errorf("%w: %s has no history", domain.ErrIncorrectMetricType, ser.MType)
+			}
+			if _, err = tx.ExecContext(ctx,
+				`INSERT INTO metrics (name, type, delta, value, created_at) VALUES (?, ?, ?, ?, ?);`,
+				ser.ID, ser.MType, delta, value, sample.Time.UTC().Format(timeLayout),
+			); err != nil {
+				return fmt.Errorf("%w", err)
+			}
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return nil
+}
+
+// DeleteMetric removes a series with its history.
+func (s *MetricStorage) DeleteMetric(ctx context.Context, mType, mName string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM metrics WHERE name = ? AND type = ?;`, mName, mType)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	if deleted == 0 {
+		return domain.ErrItemNotFound
+	}
+	return nil
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix with their history and returns how many
+// series there were.
+func (s *MetricStorage) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	var deleted int
+	if err = tx.GetContext(ctx, &deleted,
+		`SELECT COUNT(*) FROM (SELECT DISTINCT name, type FROM metrics WHERE substr(name, 1, length(?)) = ?);`,
+		prefix, prefix,
+	); err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	if _, err = tx.ExecContext(ctx,
+		`DELETE FROM metrics WHERE substr(name, 1, length(?)) = ?;`, prefix, prefix,
+	); err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return deleted, nil
+}
+
+// ResetCounter sets the total of a counter to zero, the history keeping the values before the reset.
+func (s *MetricStorage) ResetCounter(ctx context.Context, mName string) (*domain.Metric, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	if _, err = getMetric(ctx, tx, domain.Counter, mName); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if _, err = tx.ExecContext(ctx,
+		`INSERT INTO metrics (name, type, delta, created_at) VALUES (?, ?, 0, ?);`,
+		mName, domain.Counter, now.Format(timeLayout),
+	); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction %w", err)
+	}
+	var zero int64
+	return &domain.Metric{ID: mName, MType: domain.Counter, Delta: &zero, Updated: &now}, nil
+}
+
+// DeleteStale removes the series whose latest row was written before a time with their history and
+// returns their keys.
+func (s *MetricStorage) DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error) {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction %w", err)
+	}
+	defer rollback(tx)
+	var rows []struct {
+		Name  string `db:"name"`
+		MType string `db:"type"`
+	}
+	if err = tx.SelectContext(ctx, &rows,
+		`SELECT m.name, m.type
+		    FROM metrics AS m
+		    JOIN (SELECT MAX(id) AS id FROM metrics GROUP BY name, type) AS t ON m.id = t.id
+		    WHERE m.created_at < ?;`,
+		before.UTC().Format(timeLayout),
+	); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	keys := make([]domain.Key, 0, len(rows))
+	for _, r := range rows {
+		if _, err = tx.ExecContext(ctx, `DELETE FROM metrics WHERE name = ? AND type = ?;`, r.Name, r.MType); err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		keys = append(keys, domain.Key{MType: r.MType, ID: r.Name})
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction %w", err)
+	}
+	return keys, nil
+}
+
+func (s *MetricStorage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database %w", err)
+	}
+	return nil
+}
+
+func getMetric(ctx context.Context, q sqlx.QueryerContext, mType, mName string) (*domain.Metric, error) {
+	var (
+		delta     sql.NullInt64
+		value     sql.NullFloat64
+		histogram sql.NullString
+		sketch    sql.NullString
+		createdAt time.Time
+	)
+	row := q.QueryRowxContext(
+		ctx,
+		`SELECT delta, value, histogram, sketch, created_at FROM metrics
+		    WHERE name=? AND type=? ORDER BY id DESC LIMIT 1;`,
+		mName,
+		mType,
+	)
+	if err := row.Scan(&delta, &value, &histogram, &sketch, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrItemNotFound
+		}
+		return nil, fmt.Errorf("%w", err)
+	}
+	return newMetric(mName, mType, delta, value, histogram, sketch, createdAt)
+}
+
+// newMetric builds a metric from the columns of a row, histograms and sketches are stored as JSON.
+func newMetric(
+	name, mType string,
+	delta sql.NullInt64,
+	value sql.NullFloat64,
+	histogram, sketch sql.NullString,
+	createdAt time.Time,
+) (*domain.Metric, error) {
+	m := &domain.Metric{ID: name, MType: mType, Updated: &createdAt}
+	switch mType {
+	case domain.Gauge:
+		m.Value = &value.Float64
+	case domain.Counter:
+		m.Delta = &delta.Int64
+	case domain.Histogram:
+		m.Histogram = &domain.HistogramValue{}
+		if err := json.Unmarshal([]byte(histogram.String), m.Histogram); err != nil {
+			return nil, fmt.Errorf("failed to decode histogram %w", err)
+		}
+	case domain.Timer:
+		m.Sketch = &ddsketch.Sketch{}
+		if err := json.Unmarshal([]byte(sketch.String), m.Sketch); err != nil {
+			return nil, fmt.Errorf("failed to decode sketch %w", err)
+		}
+	default:
+		return nil, domain.ErrIncorrectMetricType
+	}
+	return m, nil
+}
+
+// insertMetric appends a metric to the history, counters, histograms and timers are stored merged with
+// the previous value.
+func insertMetric(ctx context.Context, tx *sqlx.Tx, m *domain.Metric) (*domain.Metric, error) {
+	if err := domain.ValidateMetric(m); err != nil {
+		return nil, err
+	}
+	var current domain.Value
+	if m.MType != domain.Gauge {
+		stored, err := getMetric(ctx, tx, m.MType, m.ID)
+		if err != nil && !errors.Is(err, domain.ErrItemNotFound) {
+			return nil, err
+		}
+		if stored != nil {
+			current = domain.Value{Delta: stored.Delta, Histogram: stored.Histogram, Sketch: stored.Sketch}
+		}
+	}
+	next, err := current.Apply(m)
+	if err != nil {
+		return nil, err
+	}
+	histogram, err := encodeJSON(next.Histogram)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode histogram %w", err)
+	}
+	sketch, err := encodeJSON(next.Sketch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode sketch %w", err)
+	}
+	// created_at is set here rather than by its default so the update time of the result is the stored one.
+	next.Updated = time.Now().UTC().Truncate(time.Millisecond)
+	if _, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO metrics (name, type, delta, value, histogram, sketch, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, m.MType, next.Delta, next.Value, histogram, sketch, next.Updated.Format(timeLayout),
+	); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	saved := domain.NewMetric(domain.Key{MType: m.MType, ID: m.ID}, next)
+	return &saved, nil
+}
+
+// encodeJSON encodes a JSON column, a nil value being stored as NULL.
+func encodeJSON[T any](v *T) (sql.NullString, error) {
+	if v == nil {
+		return sql.NullString{}, nil
+	}
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("%w", err)
+	}
+	return sql.NullString{String: string(buf), Valid: true}, nil
+}
+
+func rollback(tx *sqlx.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		logger.Log.Error("failed to rollback the transaction", zap.Error(err))
+	}
+}
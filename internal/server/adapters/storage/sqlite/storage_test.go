@@ -0,0 +1,49 @@
+package sqlite
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"metrics/internal/server/adapters/storage/storagetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storagetest.MetricStorage {
+		t.Helper()
+		s, err := NewStorage(&Config{DSN: filepath.Join(t.TempDir(), "metrics.db")})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, s.Close())
+		})
+		return s
+	})
+}
+
+func TestMetricStorage_History(t *testing.T) {
+	storagetest.RunHistory(t, func(t *testing.T) storagetest.HistoryStorage {
+		t.Helper()
+		s, err := NewStorage(&Config{DSN: filepath.Join(t.TempDir(), "metrics.db")})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, s.Close())
+		})
+		return s
+	})
+}
+
+func TestNewStorage_Error(t *testing.T) {
+	s, err := NewStorage(&Config{DSN: filepath.Join(t.TempDir(), "missing", "metrics.db")})
+	require.Error(t, err)
+	require.Nil(t, s)
+}
+
+func TestMetricStorage_Close(t *testing.T) {
+	s, err := NewStorage(&Config{DSN: filepath.Join(t.TempDir(), "metrics.db")})
+	require.NoError(t, err)
+	var closer io.Closer = s
+	require.NoError(t, closer.Close())
+	require.Error(t, s.db.Ping(), "the database is closed")
+}
@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"metrics/internal/server/adapters/storage/database"
+	"time"
 
 	"metrics/internal/server/adapters/storage/file"
 	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/sqlite"
 	"metrics/internal/server/core/domain"
 )
 
@@ -26,14 +28,30 @@ type MetricStorage interface {
 	// SetMetrics bulk inserts or updates multiple metrics.
 	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
 
+	// ListMetrics returns a page of the metrics selected by the filter.
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error)
+
+	// DeleteMetric removes a series.
+	DeleteMetric(ctx context.Context, mType, mName string) error
+
+	// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+
+	// ResetCounter sets the total of a counter to zero.
+	ResetCounter(ctx context.Context, mName string) (*domain.Metric, error)
+
+	// DeleteStale removes the series not written since before and returns their keys.
+	DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error)
+
 	// Ping checks the health of the storage adapter.
 	Ping(ctx context.Context) error
 }
 
 // NewStorage creates a new MetricStorage instance based on the provided configuration.
 //
-// It supports three types of storage adapters:
+// It supports four types of storage adapters:
 // - Database storage
+// - SQLite storage
 // - Memory storage
 // - File storage
 //
@@ -46,6 +64,13 @@ func NewStorage(cfg Config) (MetricStorage, error) {
 		}
 		return storage, nil
 	}
+	if cfg.SQLite != nil {
+		storage, err := sqlite.NewStorage(cfg.SQLite)
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		return storage, nil
+	}
 	if cfg.Memory != nil {
 		storage, err := memory.NewStorage(cfg.Memory)
 		if err != nil {
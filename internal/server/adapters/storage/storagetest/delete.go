@@ -0,0 +1,81 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDeleteMetric(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{Gauge("Alloc", 1), Counter("Alloc", 2)})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, s.DeleteMetric(ctx, domain.Gauge, "HeapAlloc"), domain.ErrItemNotFound)
+	require.NoError(t, s.DeleteMetric(ctx, domain.Gauge, "Alloc"))
+	_, err = s.GetMetric(ctx, domain.Gauge, "Alloc")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+	require.ErrorIs(t, s.DeleteMetric(ctx, domain.Gauge, "Alloc"), domain.ErrItemNotFound)
+
+	// Only the series of the given type is deleted.
+	counter, err := s.GetMetric(ctx, domain.Counter, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *counter.Delta)
+
+	// A deleted gauge can be written again, a deleted counter starts from zero.
+	require.NoError(t, s.DeleteMetric(ctx, domain.Counter, "Alloc"))
+	saved, err := s.SetMetrics(ctx, domain.MetricsList{Gauge("Alloc", 3), Counter("Alloc", 4)})
+	require.NoError(t, err)
+	assert.InDelta(t, 3, *saved[0].Value, 0)
+	assert.Equal(t, int64(4), *saved[1].Delta)
+}
+
+func testDeleteByPrefix(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{
+		Gauge("HeapAlloc", 1),
+		Gauge(`HeapInuse{host="a"}`, 2),
+		Counter("HeapObjects", 3),
+		Gauge("Alloc", 4),
+	})
+	require.NoError(t, err)
+
+	deleted, err := s.DeleteByPrefix(ctx, "Stack")
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	deleted, err = s.DeleteByPrefix(ctx, "Heap")
+	require.NoError(t, err)
+	assert.Equal(t, 3, deleted)
+
+	metrics, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gauge:Alloc"}, ids(metrics))
+}
+
+func testResetCounter(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.ResetCounter(ctx, "PollCount")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+	_, err = s.SetMetrics(ctx, domain.MetricsList{Counter("PollCount", 5), Gauge("Alloc", 1)})
+	require.NoError(t, err)
+	_, err = s.ResetCounter(ctx, "Alloc")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+
+	m, err := s.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *m.Delta)
+	m, err = s.GetMetric(ctx, domain.Counter, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *m.Delta)
+
+	m, err = s.SetMetric(ctx, &domain.Metric{ID: "PollCount", MType: domain.Counter, Delta: new(int64)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *m.Delta)
+	saved, err := s.SetMetrics(ctx, domain.MetricsList{Counter("PollCount", 2)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *saved[0].Delta)
+}
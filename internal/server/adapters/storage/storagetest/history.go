@@ -0,0 +1,92 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// HistoryStorage defines the storage operations covered by RunHistory.
+type HistoryStorage interface {
+	MetricStorage
+	GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error)
+	AppendHistory(ctx context.Context, series []domain.Series) error
+}
+
+// RunHistory checks the history kept by a storage. newStorage must return an empty storage on every call.
+func RunHistory(t *testing.T, newStorage func(t *testing.T) HistoryStorage) {
+	t.Helper()
+	ctx := context.Background()
+	s := newStorage(t)
+	from := time.Now().Add(-time.Minute)
+	for _, batch := range []domain.MetricsList{
+		{
+			Gauge(`load{host="a"}`, 1), Counter("load", 2), Gauge("loadavg", 9),
+			Histogram("load", []float64{1}, []uint64{1, 0}, 1),
+		},
+		{Gauge(`load{host="a"}`, 3), Counter("load", 5)},
+	} {
+		_, err := s.SetMetrics(ctx, batch)
+		require.NoError(t, err)
+	}
+	to := time.Now().Add(time.Minute)
+
+	series, err := s.GetHistory(ctx, "load", from, to)
+	require.NoError(t, err)
+	require.Len(t, series, 2, "only the gauges and counters of the name are returned")
+	assert.Equal(t, "load", series[0].ID)
+	assert.Equal(t, domain.Counter, series[0].MType)
+	assert.Equal(t, []float64{2, 7}, values(series[0]), "counters are sampled as totals")
+	assert.Equal(t, `load{host="a"}`, series[1].ID)
+	assert.Equal(t, []float64{1, 3}, values(series[1]))
+	for _, sample := range series[1].Samples {
+		assert.WithinRange(t, sample.Time, from, to)
+	}
+
+	series, err = s.GetHistory(ctx, "load", to, to.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, series)
+
+	testAppendHistory(t, newStorage(t))
+}
+
+func testAppendHistory(t *testing.T, s HistoryStorage) {
+	t.Helper()
+	ctx := context.Background()
+	day := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	appended := []domain.Series{
+		{ID: "load", MType: domain.Counter, Samples: []domain.Sample{
+			{Time: day, Value: 2}, {Time: day.Add(time.Hour), Value: 7},
+		}},
+		{ID: `load{host="a"}`, MType: domain.Gauge, Samples: []domain.Sample{{Time: day, Value: 1.5}}},
+	}
+	require.NoError(t, s.AppendHistory(ctx, appended))
+	require.ErrorIs(t, s.AppendHistory(ctx, []domain.Series{
+		{ID: "load", MType: domain.Timer, Samples: []domain.Sample{{Time: day, Value: 1}}},
+	}), domain.ErrIncorrectMetricType)
+
+	series, err := s.GetHistory(ctx, "load", day.Add(-time.Minute), day.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	for i := range series {
+		assert.Equal(t, appended[i].ID, series[i].ID)
+		assert.Equal(t, appended[i].MType, series[i].MType)
+		assert.Equal(t, values(appended[i]), values(series[i]))
+		for j, sample := range series[i].Samples {
+			assert.True(t, appended[i].Samples[j].Time.Equal(sample.Time), "sample times are kept")
+		}
+	}
+}
+
+func values(s domain.Series) []float64 {
+	result := make([]float64, 0, len(s.Samples))
+	for _, sample := range s.Samples {
+		result = append(result, sample.Value)
+	}
+	return result
+}
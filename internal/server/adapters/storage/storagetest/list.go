@@ -0,0 +1,94 @@
+package storagetest
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(metrics domain.MetricsList) []string {
+	result := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		result = append(result, m.MType+":"+m.ID)
+	}
+	return result
+}
+
+func testListMetrics(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{
+		Gauge("HeapAlloc", 1),
+		Gauge(`HeapInuse{dc="eu",host="a"}`, 2),
+		Gauge(`HeapInuse{host="b"}`, 3),
+		Counter(`PollCount{host="a"}`, 4),
+		Counter(`PollCount{host="a\"b"}`, 5),
+		Timer(`rt{xhost="a"}`, 6),
+	})
+	require.NoError(t, err)
+	list := func(f domain.ListFilter) []string {
+		t.Helper()
+		if f.Limit == 0 {
+			f.Limit = 100
+		}
+		metrics, err := s.ListMetrics(ctx, f)
+		require.NoError(t, err)
+		return ids(metrics)
+	}
+
+	assert.Equal(t, []string{
+		"gauge:HeapAlloc", `gauge:HeapInuse{dc="eu",host="a"}`, `gauge:HeapInuse{host="b"}`,
+		`counter:PollCount{host="a"}`, `counter:PollCount{host="a\"b"}`, `timer:rt{xhost="a"}`,
+	}, list(domain.ListFilter{}))
+	assert.Equal(t, []string{`counter:PollCount{host="a"}`, `counter:PollCount{host="a\"b"}`, `timer:rt{xhost="a"}`},
+		list(domain.ListFilter{Types: []string{domain.Counter, domain.Timer}}))
+	assert.Equal(t, []string{"gauge:HeapAlloc", `gauge:HeapInuse{dc="eu",host="a"}`, `gauge:HeapInuse{host="b"}`},
+		list(domain.ListFilter{Prefix: "Heap"}))
+	assert.Equal(t, []string{`gauge:HeapInuse{dc="eu",host="a"}`, `gauge:HeapInuse{host="b"}`},
+		list(domain.ListFilter{Match: regexp.MustCompile("Inuse$")}))
+	assert.Empty(t, list(domain.ListFilter{Match: regexp.MustCompile("host")}), "labels aren't matched by Match")
+	assert.Equal(t, []string{`gauge:HeapInuse{dc="eu",host="a"}`, `counter:PollCount{host="a"}`},
+		list(domain.ListFilter{Labels: map[string]string{"host": "a"}}))
+	assert.Equal(t, []string{`counter:PollCount{host="a\"b"}`},
+		list(domain.ListFilter{Labels: map[string]string{"host": `a"b`}}))
+	assert.Equal(t, []string{`timer:rt{xhost="a"}`, `gauge:HeapInuse{host="b"}`},
+		list(domain.ListFilter{Sort: domain.SortByType, Desc: true, Limit: 2}))
+}
+
+func testListPages(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{Gauge("a", 1), Counter("a", 1), Gauge("b", 1), Gauge("c", 1)})
+	require.NoError(t, err)
+	for _, tt := range []struct {
+		filter domain.ListFilter
+		pages  [][]string
+	}{
+		{
+			filter: domain.ListFilter{Limit: 2},
+			pages:  [][]string{{"counter:a", "gauge:a"}, {"gauge:b", "gauge:c"}, {}},
+		},
+		{
+			filter: domain.ListFilter{Limit: 3, Desc: true},
+			pages:  [][]string{{"gauge:c", "gauge:b", "gauge:a"}, {"counter:a"}},
+		},
+		{
+			filter: domain.ListFilter{Limit: 1, Sort: domain.SortByType},
+			pages:  [][]string{{"counter:a"}, {"gauge:a"}, {"gauge:b"}, {"gauge:c"}, {}},
+		},
+	} {
+		f := tt.filter
+		for _, want := range tt.pages {
+			metrics, err := s.ListMetrics(ctx, f)
+			require.NoError(t, err)
+			assert.Equal(t, want, ids(metrics))
+			if len(metrics) > 0 {
+				last := metrics[len(metrics)-1]
+				f.After = &domain.Key{MType: last.MType, ID: last.ID}
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RestoreStorage defines the storage operations covered by RunRestore.
+type RestoreStorage interface {
+	MetricStorage
+	RestoreMetrics(ctx context.Context, values domain.MetricValues) error
+}
+
+// RunRestore checks the restore of a snapshot. newStorage must return an empty storage on every call.
+func RunRestore(t *testing.T, newStorage func(t *testing.T) RestoreStorage) {
+	t.Helper()
+	ctx := context.Background()
+	s := newStorage(t)
+	before := time.Now()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{Counter("PollCount", 5), Gauge("HeapAlloc", 1)})
+	require.NoError(t, err)
+
+	updated := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	delta, value := int64(2), 3.0
+	require.NoError(t, s.RestoreMetrics(ctx, domain.MetricValues{
+		{MType: domain.Counter, ID: "PollCount"}: {Delta: &delta, Updated: updated},
+		{MType: domain.Gauge, ID: "Alloc"}:       {Value: &value},
+	}))
+
+	m, err := s.GetMetric(ctx, domain.Counter, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *m.Delta, "a restored counter takes the snapshot total")
+	assert.True(t, updated.Equal(m.UpdatedAt()), "the update time is restored")
+	m, err = s.GetMetric(ctx, domain.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.False(t, m.UpdatedAt().Before(before), "a value without update time is written now")
+	_, err = s.GetMetric(ctx, domain.Gauge, "HeapAlloc")
+	require.NoError(t, err, "the series the snapshot hasn't got are kept")
+
+	keys, err := s.DeleteStale(ctx, before)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Key{{MType: domain.Counter, ID: "PollCount"}}, keys)
+
+	err = s.RestoreMetrics(ctx, domain.MetricValues{
+		{MType: domain.Gauge, ID: "Sys"}:     {Value: &value},
+		{MType: domain.Gauge, ID: "invalid"}: {},
+	})
+	require.Error(t, err)
+	_, err = s.GetMetric(ctx, domain.Gauge, "Sys")
+	require.ErrorIs(t, err, domain.ErrItemNotFound, "nothing is restored from an invalid snapshot")
+}
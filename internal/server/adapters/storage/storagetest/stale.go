@@ -0,0 +1,68 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tick is longer than the millisecond precision some storages keep the update time with.
+const tick = 20 * time.Millisecond
+
+func testUpdated(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	before := time.Now().Add(-tick)
+	saved, err := s.SetMetrics(ctx, domain.MetricsList{Gauge("Alloc", 1), Counter("PollCount", 1)})
+	require.NoError(t, err)
+	for _, m := range saved {
+		require.NotNil(t, m.Updated, m.ID)
+		assert.WithinRange(t, *m.Updated, before, time.Now().Add(tick), m.ID)
+	}
+
+	time.Sleep(tick)
+	saved, err = s.SetMetrics(ctx, domain.MetricsList{Counter("PollCount", 1)})
+	require.NoError(t, err)
+	m, err := s.GetMetric(ctx, domain.Counter, "PollCount")
+	require.NoError(t, err)
+	assert.True(t, m.Updated.Equal(*saved[0].Updated))
+	alloc, err := s.GetMetric(ctx, domain.Gauge, "Alloc")
+	require.NoError(t, err)
+	assert.True(t, alloc.Updated.Before(*m.Updated), "only the written series is updated")
+
+	metrics, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	for _, m := range metrics {
+		assert.NotNil(t, m.Updated, m.ID)
+	}
+}
+
+func testDeleteStale(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{Gauge("Alloc", 1), Counter("PollCount", 1)})
+	require.NoError(t, err)
+	time.Sleep(tick)
+	before := time.Now()
+	time.Sleep(tick)
+	_, err = s.SetMetrics(ctx, domain.MetricsList{Counter("PollCount", 1), Gauge("HeapAlloc", 2)})
+	require.NoError(t, err)
+
+	keys, err := s.DeleteStale(ctx, before.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	keys, err = s.DeleteStale(ctx, before)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Key{{MType: domain.Gauge, ID: "Alloc"}}, keys)
+
+	metrics, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"counter:PollCount", "gauge:HeapAlloc"}, ids(metrics))
+	// A counter written again before it was evicted keeps its total.
+	m, err := s.GetMetric(ctx, domain.Counter, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *m.Delta)
+}
@@ -0,0 +1,445 @@
+// Package storagetest provides a conformance suite shared by MetricStorage implementations.
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/ddsketch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MetricStorage defines the storage operations covered by the suite.
+type MetricStorage interface {
+	GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error)
+	SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error)
+	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
+	GetAllMetrics(ctx context.Context) (domain.MetricsList, error)
+	Ping(ctx context.Context) error
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error)
+	DeleteMetric(ctx context.Context, mType, mName string) error
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+	ResetCounter(ctx context.Context, mName string) (*domain.Metric, error)
+	DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error)
+}
+
+// Run executes the conformance suite. newStorage must return an empty storage on every call.
+func Run(t *testing.T, newStorage func(t *testing.T) MetricStorage) {
+	t.Helper()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s MetricStorage)
+	}{
+		{name: "Ping", fn: testPing},
+		{name: "NotFound", fn: testNotFound},
+		{name: "GaugeOverwrite", fn: testGaugeOverwrite},
+		{name: "CounterAccumulation", fn: testCounterAccumulation},
+		{name: "TypesAreIndependent", fn: testTypesAreIndependent},
+		{name: "BatchAccumulation", fn: testBatchAccumulation},
+		{name: "GetAllMetrics", fn: testGetAllMetrics},
+		{name: "BatchResult", fn: testBatchResult},
+		{name: "BatchAtomicity", fn: testBatchAtomicity},
+		{name: "InvalidMetric", fn: testInvalidMetric},
+		{name: "InputNotMutated", fn: testInputNotMutated},
+		{name: "ResultNotShared", fn: testResultNotShared},
+		{name: "Concurrency", fn: testConcurrency},
+		{name: "HistogramMerge", fn: testHistogramMerge},
+		{name: "HistogramMismatch", fn: testHistogramMismatch},
+		{name: "TimerSamples", fn: testTimerSamples},
+		{name: "TimerMismatch", fn: testTimerMismatch},
+		{name: "ListMetrics", fn: testListMetrics},
+		{name: "ListPages", fn: testListPages},
+		{name: "DeleteMetric", fn: testDeleteMetric},
+		{name: "DeleteByPrefix", fn: testDeleteByPrefix},
+		{name: "ResetCounter", fn: testResetCounter},
+		{name: "Updated", fn: testUpdated},
+		{name: "DeleteStale", fn: testDeleteStale},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStorage(t))
+		})
+	}
+}
+
+// Written drops the update time set by the storage, leaving the metric as it was written.
+func Written(m *domain.Metric) *domain.Metric {
+	m.Updated = nil
+	return m
+}
+
+// WrittenList drops the update times set by the storage from every metric of a list.
+func WrittenList(metrics domain.MetricsList) domain.MetricsList {
+	for i := range metrics {
+		Written(&metrics[i])
+	}
+	return metrics
+}
+
+// Gauge builds a gauge metric.
+func Gauge(id string, value float64) domain.Metric {
+	return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}
+}
+
+// Counter builds a counter metric.
+func Counter(id string, delta int64) domain.Metric {
+	return domain.Metric{ID: id, MType: domain.Counter, Delta: &delta}
+}
+
+// Histogram builds a histogram metric, the count is derived from the bucket counts.
+func Histogram(id string, bounds []float64, counts []uint64, sum float64) domain.Metric {
+	h := &domain.HistogramValue{Bounds: bounds, Counts: counts, Sum: sum}
+	for _, c := range counts {
+		h.Count += c
+	}
+	return domain.Metric{ID: id, MType: domain.Histogram, Histogram: h}
+}
+
+// Timer builds a timer metric carrying a single sample.
+func Timer(id string, sample float64) domain.Metric {
+	return domain.Metric{ID: id, MType: domain.Timer, Value: &sample}
+}
+
+// Sketch builds a timer metric carrying a sketch of the samples.
+func Sketch(id string, samples ...float64) domain.Metric {
+	s := ddsketch.New()
+	for _, v := range samples {
+		s.Add(v)
+	}
+	return domain.Metric{ID: id, MType: domain.Timer, Sketch: s}
+}
+
+func testPing(t *testing.T, s MetricStorage) {
+	require.NoError(t, s.Ping(context.Background()))
+}
+
+func testNotFound(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.GetMetric(ctx, domain.Gauge, "missing")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+	_, err = s.GetMetric(ctx, domain.Counter, "missing")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+}
+
+func testGaugeOverwrite(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	first, second := Gauge("g", 1.5), Gauge("g", -2.25)
+	_, err := s.SetMetric(ctx, &first)
+	require.NoError(t, err)
+	saved, err := s.SetMetric(ctx, &second)
+	require.NoError(t, err)
+	assert.InDelta(t, -2.25, *saved.Value, 0)
+
+	m, err := s.GetMetric(ctx, domain.Gauge, "g")
+	require.NoError(t, err)
+	assert.Equal(t, "g", m.ID)
+	assert.Equal(t, domain.Gauge, m.MType)
+	assert.InDelta(t, -2.25, *m.Value, 0)
+}
+
+func testCounterAccumulation(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	first, second := Counter("c", 5), Counter("c", 6)
+	_, err := s.SetMetric(ctx, &first)
+	require.NoError(t, err)
+	saved, err := s.SetMetric(ctx, &second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), *saved.Delta)
+
+	m, err := s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "c", m.ID)
+	assert.Equal(t, domain.Counter, m.MType)
+	assert.Equal(t, int64(11), *m.Delta)
+}
+
+func testTypesAreIndependent(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{Gauge("m", 3), Counter("m", 4)})
+	require.NoError(t, err)
+
+	g, err := s.GetMetric(ctx, domain.Gauge, "m")
+	require.NoError(t, err)
+	assert.InDelta(t, 3.0, *g.Value, 0)
+	c, err := s.GetMetric(ctx, domain.Counter, "m")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *c.Delta)
+}
+
+func testBatchAccumulation(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetrics(ctx, domain.MetricsList{
+		Counter("c", 1), Counter("c", 2), Gauge("g", 1), Gauge("g", 7), Counter("c", 3),
+	})
+	require.NoError(t, err)
+
+	c, err := s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *c.Delta)
+	g, err := s.GetMetric(ctx, domain.Gauge, "g")
+	require.NoError(t, err)
+	assert.InDelta(t, 7.0, *g.Value, 0)
+}
+
+func testGetAllMetrics(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	_, err = s.SetMetrics(ctx, domain.MetricsList{Gauge("a", 1), Counter("b", 2), Gauge("a", 3), Counter("b", 4)})
+	require.NoError(t, err)
+	all, err = s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	for _, m := range all {
+		switch m.MType {
+		case domain.Gauge:
+			assert.Equal(t, "a", m.ID)
+			assert.InDelta(t, 3.0, *m.Value, 0)
+		case domain.Counter:
+			assert.Equal(t, "b", m.ID)
+			assert.Equal(t, int64(6), *m.Delta)
+		default:
+			t.Errorf("unexpected metric type %q", m.MType)
+		}
+	}
+}
+
+func testBatchResult(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	saved, err := s.SetMetrics(ctx, domain.MetricsList{Counter("c", 2), Gauge("g", 1), Counter("c", 3)})
+	require.NoError(t, err)
+	require.Len(t, saved, 3)
+	assert.Equal(t, "c", saved[0].ID)
+	assert.Equal(t, "g", saved[1].ID)
+	assert.InDelta(t, 1.0, *saved[1].Value, 0)
+	assert.Equal(t, "c", saved[2].ID)
+	assert.Equal(t, int64(5), *saved[2].Delta)
+}
+
+func testBatchAtomicity(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	existing := Counter("c", 10)
+	_, err := s.SetMetric(ctx, &existing)
+	require.NoError(t, err)
+
+	_, err = s.SetMetrics(ctx, domain.MetricsList{
+		Counter("c", 1),
+		Gauge("g", 1),
+		{ID: "broken", MType: domain.Gauge},
+	})
+	require.ErrorIs(t, err, domain.ErrNilGaugeValue)
+
+	c, err := s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *c.Delta)
+	_, err = s.GetMetric(ctx, domain.Gauge, "g")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+
+	_, err = s.SetMetrics(ctx, domain.MetricsList{Counter("c", 1), {ID: "x", MType: "unknown"}})
+	require.ErrorIs(t, err, domain.ErrIncorrectMetricType)
+	c, err = s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *c.Delta)
+}
+
+func testInvalidMetric(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	_, err := s.SetMetric(ctx, &domain.Metric{ID: "g", MType: domain.Gauge})
+	require.ErrorIs(t, err, domain.ErrNilGaugeValue)
+	_, err = s.SetMetric(ctx, &domain.Metric{ID: "c", MType: domain.Counter})
+	require.ErrorIs(t, err, domain.ErrNilCounterDelta)
+	_, err = s.SetMetric(ctx, &domain.Metric{ID: "u", MType: "unknown"})
+	require.ErrorIs(t, err, domain.ErrIncorrectMetricType)
+	_, err = s.SetMetric(ctx, &domain.Metric{ID: "h", MType: domain.Histogram})
+	require.ErrorIs(t, err, domain.ErrNilHistogram)
+	broken := Histogram("h", []float64{1}, []uint64{1}, 1)
+	_, err = s.SetMetric(ctx, &broken)
+	require.ErrorIs(t, err, domain.ErrIncorrectHistogram)
+	_, err = s.SetMetric(ctx, &domain.Metric{ID: "t", MType: domain.Timer})
+	require.ErrorIs(t, err, domain.ErrNilTimer)
+	brokenTimer := Sketch("t", 1)
+	brokenTimer.Sketch.Count = 2
+	_, err = s.SetMetric(ctx, &brokenTimer)
+	require.ErrorIs(t, err, domain.ErrIncorrectTimer)
+
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func testInputNotMutated(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	first, second := Counter("c", 5), Counter("c", 6)
+	_, err := s.SetMetric(ctx, &first)
+	require.NoError(t, err)
+	_, err = s.SetMetric(ctx, &second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *first.Delta)
+	assert.Equal(t, int64(6), *second.Delta)
+
+	batch := domain.MetricsList{Counter("c", 1), Counter("c", 2)}
+	_, err = s.SetMetrics(ctx, batch)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *batch[0].Delta)
+	assert.Equal(t, int64(2), *batch[1].Delta)
+}
+
+func testResultNotShared(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	m := Counter("c", 5)
+	saved, err := s.SetMetric(ctx, &m)
+	require.NoError(t, err)
+	*saved.Delta = 100
+	got, err := s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	*got.Delta = 200
+
+	got, err = s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *got.Delta)
+}
+
+func testConcurrency(t *testing.T, s MetricStorage) {
+	const (
+		workers = 8
+		updates = 25
+	)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*updates*3)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range updates {
+				m := Counter("c", 1)
+				if _, err := s.SetMetric(ctx, &m); err != nil {
+					errs <- err
+				}
+				if _, err := s.SetMetrics(ctx, domain.MetricsList{Counter("c", 1), Gauge("g", float64(w*i))}); err != nil {
+					errs <- err
+				}
+				if _, err := s.GetAllMetrics(ctx); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	c, err := s.GetMetric(ctx, domain.Counter, "c")
+	require.NoError(t, err)
+	assert.Equal(t, int64(workers*updates*2), *c.Delta)
+}
+
+func testHistogramMerge(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	bounds := []float64{0.5, 1}
+	first := Histogram("latency", bounds, []uint64{1, 2, 0}, 2.25)
+	saved, err := s.SetMetric(ctx, &first)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2, 0}, saved.Histogram.Counts)
+
+	batch := domain.MetricsList{
+		Histogram("latency", bounds, []uint64{0, 1, 1}, 3.5),
+		Histogram("latency", bounds, []uint64{2, 0, 0}, 0.5),
+	}
+	saved2, err := s.SetMetrics(ctx, batch)
+	require.NoError(t, err)
+	require.Len(t, saved2, 2)
+	assert.Equal(t, []uint64{3, 3, 1}, saved2[1].Histogram.Counts)
+	assert.Equal(t, []uint64{0, 1, 1}, batch[0].Histogram.Counts, "input must not be mutated")
+
+	m, err := s.GetMetric(ctx, domain.Histogram, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, "latency", m.ID)
+	assert.Equal(t, domain.Histogram, m.MType)
+	assert.Equal(t, &domain.HistogramValue{Bounds: bounds, Counts: []uint64{3, 3, 1}, Sum: 6.25, Count: 7}, m.Histogram)
+
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, m, &all[0])
+}
+
+func testHistogramMismatch(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	existing := Histogram("latency", []float64{1}, []uint64{1, 0}, 0.5)
+	_, err := s.SetMetric(ctx, &existing)
+	require.NoError(t, err)
+
+	_, err = s.SetMetrics(ctx, domain.MetricsList{
+		Counter("c", 1),
+		Histogram("latency", []float64{2}, []uint64{1, 0}, 0.5),
+	})
+	require.ErrorIs(t, err, domain.ErrHistogramMismatch)
+
+	_, err = s.GetMetric(ctx, domain.Counter, "c")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+	m, err := s.GetMetric(ctx, domain.Histogram, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, existing.Histogram, m.Histogram)
+
+	_, err = s.SetMetrics(ctx, domain.MetricsList{
+		Histogram("fresh", []float64{1}, []uint64{1, 0}, 0.5),
+		Histogram("fresh", []float64{3}, []uint64{1, 0}, 0.5),
+	})
+	require.ErrorIs(t, err, domain.ErrHistogramMismatch)
+	_, err = s.GetMetric(ctx, domain.Histogram, "fresh")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+}
+
+func testTimerSamples(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	first := Timer("latency", 10)
+	saved, err := s.SetMetric(ctx, &first)
+	require.NoError(t, err)
+	assert.Nil(t, saved.Value)
+	assert.Equal(t, uint64(1), saved.Sketch.Count)
+
+	batch := domain.MetricsList{Timer("latency", 20), Sketch("latency", 30, 40)}
+	saved2, err := s.SetMetrics(ctx, batch)
+	require.NoError(t, err)
+	require.Len(t, saved2, 2)
+	assert.Equal(t, uint64(4), saved2[1].Sketch.Count)
+	assert.Equal(t, uint64(2), batch[1].Sketch.Count, "input must not be mutated")
+
+	m, err := s.GetMetric(ctx, domain.Timer, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, Sketch("latency", 10, 20, 30, 40).Sketch, m.Sketch)
+	assert.InDelta(t, 40.0, m.Sketch.Quantile(1), 0)
+
+	all, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, m, &all[0])
+}
+
+func testTimerMismatch(t *testing.T, s MetricStorage) {
+	ctx := context.Background()
+	existing := Timer("latency", 1)
+	_, err := s.SetMetric(ctx, &existing)
+	require.NoError(t, err)
+
+	coarse := Sketch("latency", 2)
+	coarse.Sketch.Alpha = 0.05
+	_, err = s.SetMetrics(ctx, domain.MetricsList{Counter("c", 1), coarse})
+	require.ErrorIs(t, err, domain.ErrTimerMismatch)
+
+	_, err = s.GetMetric(ctx, domain.Counter, "c")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+	m, err := s.GetMetric(ctx, domain.Timer, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), m.Sketch.Count)
+}
@@ -3,79 +3,197 @@ package config
 
 import (
 	"crypto/rsa"
-	"encoding/json"
-	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"metrics/internal/shared-kernel/cert"
+	"metrics/internal/shared-kernel/settings"
 	"net"
 	"os"
 
-	"github.com/caarlos0/env/v11"
+	"go.uber.org/zap"
 )
 
 const (
 	storeInterval = 300
+	maxPort       = 65535
 )
 
+// Config holds the settings of the server. The ones tagged reload:"live" are swapped on reload, changing the
+// others needs a restart. The ones tagged secret are redacted when the config is printed.
 type Config struct {
 	Address         string          `env:"ADDRESS" json:"address"`
 	StoreInterval   int             `env:"STORE_INTERVAL" json:"store_interval"`
-	DatabaseDSN     string          `env:"DATABASE_DSN" json:"database_dsn"`
+	DatabaseDSN     string          `env:"DATABASE_DSN" json:"database_dsn" secret:"dsn"`
 	FileStoragePath string          `env:"FILE_STORAGE_PATH" json:"store_file"`
-	Key             string          `env:"KEY" json:"key"`
+	Key             string          `env:"KEY" json:"key" reload:"live" secret:"true"`
 	Restore         bool            `env:"RESTORE" json:"restore"`
-	LogLevel        string          `json:"log_level"`
-	CryptoKey       string          `env:"CRYPTO_KEY" json:"crypto_key"`
+	LogLevel        string          `json:"log_level" reload:"live"`
+	CryptoKey       string          `env:"CRYPTO_KEY" json:"crypto_key" reload:"live"`
 	Config          string          `env:"CONFIG" json:"config"`
-	TrustedSubnet   string          `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
-	UseGRPC         bool            `env:"USE_GRPC"`
-	GRPCPort        int             `env:"GRPC_PORT"`
+	TrustedSubnet   string          `env:"TRUSTED_SUBNET" json:"trusted_subnet" reload:"live"`
+	UseGRPC         bool            `env:"USE_GRPC" json:"use_grpc" alias:"UseGRPC"`
+	GRPCPort        int             `env:"GRPC_PORT" json:"grpc_port" alias:"GRPCPort"`
+	HistoryDays     int             `env:"HISTORY_DAYS" json:"history_days"`
+	GraphiteAddress string          `env:"GRAPHITE_ADDRESS" json:"graphite_address"`
+	GraphiteRules   string          `env:"GRAPHITE_RULES" json:"graphite_rules"`
+	InfluxRules     string          `env:"INFLUX_RULES" json:"influx_rules"`
+	Buckets         string          `env:"HISTOGRAM_BUCKETS" json:"histogram_buckets"`
+	MetadataFile    string          `env:"METADATA_FILE" json:"metadata_file"`
+	AlertRulesFile  string          `env:"ALERT_RULES_FILE" json:"alert_rules_file"`
+	HistoryWindow   int             `env:"HISTORY_WINDOW" json:"history_window"`
+	RateInterval    int             `env:"RATE_INTERVAL" json:"rate_interval"`
+	StreamBuffer    int             `env:"STREAM_BUFFER" json:"stream_buffer"`
+	AdminToken      string          `env:"ADMIN_TOKEN" json:"admin_token" reload:"live" secret:"true"`
+	StaleAfter      int             `env:"STALE_AFTER" json:"stale_after"`
+	EvictAfter      int             `env:"EVICT_AFTER" json:"evict_after"`
+	MissedReports   int             `env:"AGENT_MISSED_REPORTS" json:"agent_missed_reports"`
+	PrintConfig     bool            `json:"-"`
 	PrivateKey      *rsa.PrivateKey `json:"-"`
 	Subnet          *net.IPNet      `json:"-"`
+	// args are the command line arguments, parsed again on reload.
+	args []string
 }
 
+// NewConfig reads the config from the defaults, the config file, the environment and the command line.
 func NewConfig() (*Config, error) {
-	cfg := getJSONConfig()
-	flag.StringVar(&cfg.Address, "a", ":8080", "port to run server")
-	flag.IntVar(&cfg.StoreInterval, "i", storeInterval, "time interval (seconds) to backup server data")
-	flag.StringVar(&cfg.FileStoragePath, "f", "/tmp/metrics-db.json", "where to store server data")
-	flag.StringVar(&cfg.DatabaseDSN, "d", "", "database dsn")
-	flag.StringVar(&cfg.Key, "k", "", "hashing key")
-	flag.BoolVar(&cfg.Restore, "r", true, "recover data from files")
-	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
-	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "public key file path")
-	flag.StringVar(&cfg.TrustedSubnet, "t", "", "CIDR")
-	flag.BoolVar(&cfg.UseGRPC, "grpc", false, "using GRPC server")
-	flag.IntVar(&cfg.GRPCPort, "gp", 3200, "GRPC port")
-	flag.StringVar(&cfg.Config, "c", "./configs/agent.json", "agent config file path")
-	flag.Parse()
+	return Load(os.Args[1:])
+}
 
-	err := env.Parse(&cfg)
+// Load reads the config in layers, each overriding the settings of the previous one: the defaults, the JSON
+// or YAML file named by the -c flag or else by CONFIG, the environment and the flags set in args. An invalid
+// config is returned along with the errors naming its invalid settings.
+func Load(args []string) (*Config, error) {
+	cfg := defaults()
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "port to run server")
+	fs.IntVar(&cfg.StoreInterval, "i", cfg.StoreInterval, "time interval (seconds) to backup server data")
+	fs.StringVar(&cfg.FileStoragePath, "f", cfg.FileStoragePath, "where to store server data")
+	fs.StringVar(&cfg.DatabaseDSN, "d", cfg.DatabaseDSN, "database dsn, postgres or sqlite://<path>")
+	fs.StringVar(&cfg.Key, "k", cfg.Key, "hashing key")
+	fs.BoolVar(&cfg.Restore, "r", cfg.Restore, "recover data from files")
+	fs.StringVar(&cfg.LogLevel, "l", cfg.LogLevel, "log level")
+	fs.StringVar(&cfg.CryptoKey, "crypto-key", cfg.CryptoKey, "private key file path")
+	fs.StringVar(&cfg.TrustedSubnet, "t", cfg.TrustedSubnet, "CIDR")
+	fs.BoolVar(&cfg.UseGRPC, "grpc", cfg.UseGRPC, "using GRPC server")
+	fs.IntVar(&cfg.GRPCPort, "gp", cfg.GRPCPort, "GRPC port")
+	fs.IntVar(&cfg.HistoryDays, "history-days", cfg.HistoryDays,
+		"days of metric history kept in database, 0 keeps everything")
+	fs.StringVar(&cfg.GraphiteAddress, "graphite", cfg.GraphiteAddress,
+		"graphite plaintext listener address, empty disables it")
+	fs.StringVar(&cfg.GraphiteRules, "graphite-rules", cfg.GraphiteRules,
+		"graphite type rules, e.g. stats_counts.*=counter")
+	fs.StringVar(&cfg.InfluxRules, "influx-rules", cfg.InfluxRules,
+		"influx line protocol type rules, e.g. *_requests=cumulative")
+	fs.StringVar(&cfg.Buckets, "histogram-buckets", cfg.Buckets,
+		"histogram bucket bounds, e.g. 0.1,0.5,1, empty for defaults")
+	fs.StringVar(&cfg.MetadataFile, "metadata", cfg.MetadataFile,
+		"JSON file with the description, unit and type of metrics")
+	fs.StringVar(&cfg.AlertRulesFile, "alert-rules", cfg.AlertRulesFile,
+		"JSON file the alert rules are kept in, empty keeps them in memory")
+	fs.IntVar(&cfg.HistoryWindow, "history-window", cfg.HistoryWindow,
+		"seconds of history kept in memory without a database")
+	fs.IntVar(&cfg.RateInterval, "rate-interval", cfg.RateInterval,
+		"shortest interval (seconds) the rate of a counter is taken over")
+	fs.IntVar(&cfg.StreamBuffer, "stream-buffer", cfg.StreamBuffer,
+		"updates a stream subscriber may lag behind before eviction")
+	fs.StringVar(&cfg.AdminToken, "admin-token", cfg.AdminToken,
+		"bearer token of delete, reset and alert rule requests, empty disables them")
+	fs.IntVar(&cfg.StaleAfter, "stale-after", cfg.StaleAfter,
+		"seconds without writes before a series is marked stale, 0 never")
+	fs.IntVar(&cfg.EvictAfter, "evict-after", cfg.EvictAfter,
+		"seconds without writes before a series is deleted, 0 keeps it")
+	fs.IntVar(&cfg.MissedReports, "agent-missed-reports", cfg.MissedReports,
+		"report intervals an agent may miss before it is down")
+	fs.StringVar(&cfg.Config, "c", cfg.Config, "config file path, JSON or YAML")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config with the secrets redacted and exit")
+	path, err := settings.Load(&cfg, fs, args, "c", "CONFIG")
 	if err != nil {
-		return &cfg, errors.New("failed to get config for server")
+		return nil, fmt.Errorf("failed to get config for server: %w", err)
 	}
-	cfg.PrivateKey = cert.PrivateKey(cfg.CryptoKey)
-	if cfg.TrustedSubnet != "" {
-		_, cfg.Subnet, err = net.ParseCIDR(cfg.TrustedSubnet)
-		if err != nil {
-			return &cfg, errors.New("failed to parse trusted subnet")
-		}
+	cfg.Config = path
+	cfg.args = args
+	return &cfg, cfg.validate()
+}
+
+// LoadFile reads the config from the defaults and a JSON or YAML file alone, for commands working with the
+// storage of a server other than the one they run as. An invalid config is returned along with its errors.
+func LoadFile(path string) (*Config, error) {
+	cfg := defaults()
+	if err := settings.ReadFile(path, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to get config for server: %w", err)
 	}
-	return &cfg, nil
+	cfg.Config = path
+	return &cfg, cfg.validate()
 }
 
-func getJSONConfig() Config {
-	var cfg Config
-	configPath := os.Getenv("CONFIG")
-	if configPath == "" {
-		return cfg
+// Reload reads the config again from the same command line arguments.
+func (c *Config) Reload() (*Config, error) {
+	return Load(c.args)
+}
+
+// Print writes the config as a JSON config file with the secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	return settings.Print(w, c)
+}
+
+// validate checks the settings, naming every invalid one, and reads the private key and the trusted subnet.
+func (c *Config) validate() error {
+	var errs settings.Errors
+	if c.Address == "" {
+		errs.Add("address", "must not be empty")
 	}
-	buf, err := os.ReadFile(configPath)
-	if err != nil {
-		return cfg
+	for _, s := range []struct {
+		field string
+		value int
+	}{
+		{"store_interval", c.StoreInterval},
+		{"history_days", c.HistoryDays},
+		{"history_window", c.HistoryWindow},
+		{"rate_interval", c.RateInterval},
+		{"stream_buffer", c.StreamBuffer},
+		{"stale_after", c.StaleAfter},
+		{"evict_after", c.EvictAfter},
+	} {
+		if s.value < 0 {
+			errs.Add(s.field, "must not be negative, got %d", s.value)
+		}
+	}
+	if c.MissedReports <= 0 {
+		errs.Add("agent_missed_reports", "must be positive, got %d", c.MissedReports)
+	}
+	if c.GRPCPort <= 0 || c.GRPCPort > maxPort {
+		errs.Add("grpc_port", "must be between 1 and %d, got %d", maxPort, c.GRPCPort)
+	}
+	if _, err := zap.ParseAtomicLevel(c.LogLevel); err != nil {
+		errs.Add("log_level", "%w", err)
+	}
+	var err error
+	if c.PrivateKey, err = cert.PrivateKey(c.CryptoKey); err != nil {
+		errs.Add("crypto_key", "%w", err)
 	}
-	if err = json.Unmarshal(buf, &cfg); err != nil {
-		return cfg
+	c.Subnet = nil
+	if c.TrustedSubnet != "" {
+		if _, c.Subnet, err = net.ParseCIDR(c.TrustedSubnet); err != nil {
+			errs.Add("trusted_subnet", "%w", err)
+		}
+	}
+	return errs.Err()
+}
+
+// defaults returns the settings used when neither the file, nor the environment, nor the flags set them.
+func defaults() Config {
+	return Config{
+		Address:         ":8080",
+		StoreInterval:   storeInterval,
+		FileStoragePath: "/tmp/metrics-db.json",
+		Restore:         true,
+		LogLevel:        "info",
+		GRPCPort:        3200,
+		HistoryWindow:   3600,
+		RateInterval:    10,
+		StreamBuffer:    256,
+		StaleAfter:      300,
+		MissedReports:   3,
 	}
-	return cfg
 }
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"cmp"
+	"time"
+)
+
+// AgentIdentity is what an agent tells about itself along with its metrics.
+type AgentIdentity struct {
+	Address  string            // X-Real-IP of the agent
+	Hostname string            // host the agent runs on
+	Version  string            // build version of the agent
+	Config   map[string]string // summary of the agent configuration, e.g. report_interval
+}
+
+// ID identifies the agent by its hostname, by its address for agents which don't send it.
+func (a *AgentIdentity) ID() string {
+	return cmp.Or(a.Hostname, a.Address)
+}
+
+// Agent is an entry of the agent inventory.
+type Agent struct {
+	ID               string            `json:"id"`
+	Address          string            `json:"address,omitempty"`
+	Hostname         string            `json:"hostname,omitempty"`
+	Version          string            `json:"version,omitempty"`
+	Config           map[string]string `json:"config,omitempty"`
+	FirstSeen        time.Time         `json:"first_seen"`
+	LastSeen         time.Time         `json:"last_seen"`
+	MetricsPerMinute int               `json:"metrics_per_minute"` // metrics received over the last minute
+	Down             bool              `json:"down"`               // the agent missed several reports
+}
@@ -0,0 +1,85 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var ErrIncorrectAlertRule = errors.New("incorrect alert rule")
+
+// Comparison operators of alert rules.
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// alertName matches the names of alert rules, which are part of their URL.
+var alertName = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// AlertRule fires for every series of the result of Query, or for its scalar, whose value compares to
+// Threshold by Op.
+type AlertRule struct {
+	Name        string  `json:"name"`
+	Query       string  `json:"query"`
+	Op          string  `json:"op"`
+	Threshold   float64 `json:"threshold"`
+	Description string  `json:"description,omitempty"`
+}
+
+// ValidateAlertRule checks the name, query and operator of a rule, the query being parsed by its evaluator.
+func ValidateAlertRule(rule *AlertRule) error {
+	if !alertName.MatchString(rule.Name) {
+		return fmt.Errorf("%w: name %q, letters, digits and _.:- only", ErrIncorrectAlertRule, rule.Name)
+	}
+	if rule.Query == "" {
+		return fmt.Errorf("%w: %s has no query", ErrIncorrectAlertRule, rule.Name)
+	}
+	switch rule.Op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+		return nil
+	default:
+		return fmt.Errorf("%w: operator %q", ErrIncorrectAlertRule, rule.Op)
+	}
+}
+
+// Fires reports whether a value compares to the threshold.
+func (r *AlertRule) Fires(value float64) bool {
+	switch r.Op {
+	case OpGreater:
+		return value > r.Threshold
+	case OpGreaterEqual:
+		return value >= r.Threshold
+	case OpLess:
+		return value < r.Threshold
+	case OpLessEqual:
+		return value <= r.Threshold
+	case OpEqual:
+		return value == r.Threshold
+	case OpNotEqual:
+		return value != r.Threshold
+	default:
+		return false
+	}
+}
+
+// AlertSeries is a series an alert fires for, with no name or labels when the query gives a scalar.
+type AlertSeries struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// Alert is a rule with the series it fired for when it was evaluated, Error telling why its query
+// couldn't be evaluated.
+type Alert struct {
+	AlertRule
+	Firing      []AlertSeries `json:"firing"`
+	Error       string        `json:"error,omitempty"`
+	EvaluatedAt time.Time     `json:"evaluated_at"`
+}
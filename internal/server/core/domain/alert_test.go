@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAlertRule(t *testing.T) {
+	assert.NoError(t, ValidateAlertRule(&AlertRule{Name: "high-load", Query: "load", Op: OpGreater, Threshold: 2}))
+	assert.ErrorIs(t, ValidateAlertRule(&AlertRule{Query: "load", Op: OpGreater}), ErrIncorrectAlertRule)
+	assert.ErrorIs(t, ValidateAlertRule(&AlertRule{Name: "a/b", Query: "load", Op: OpGreater}), ErrIncorrectAlertRule)
+	assert.ErrorIs(t, ValidateAlertRule(&AlertRule{Name: "high-load", Op: OpGreater}), ErrIncorrectAlertRule)
+	assert.ErrorIs(t, ValidateAlertRule(&AlertRule{Name: "high-load", Query: "load", Op: "=>"}), ErrIncorrectAlertRule)
+}
+
+func TestAlertRule_Fires(t *testing.T) {
+	for op, want := range map[string][3]bool{
+		OpGreater:      {false, false, true},
+		OpGreaterEqual: {false, true, true},
+		OpLess:         {true, false, false},
+		OpLessEqual:    {true, true, false},
+		OpEqual:        {false, true, false},
+		OpNotEqual:     {true, false, true},
+	} {
+		rule := AlertRule{Op: op, Threshold: 2}
+		assert.Equal(t, want, [3]bool{rule.Fires(1), rule.Fires(2), rule.Fires(3)}, op)
+	}
+}
@@ -1,11 +1,18 @@
 // Package domain.
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"metrics/internal/shared-kernel/ddsketch"
+)
 
 const (
-	Gauge   = "gauge"
-	Counter = "counter"
+	Gauge     = "gauge"
+	Counter   = "counter"
+	Histogram = "histogram"
+	Timer     = "timer"
 )
 
 var (
@@ -14,6 +21,7 @@ var (
 	ErrItemNotFound         = errors.New("item not found")
 	ErrNilGaugeValue        = errors.New("gauge value is nil")
 	ErrNilCounterDelta      = errors.New("counter delta is nil")
+	ErrEmptyPrefix          = errors.New("prefix is empty")
 )
 
 type SetMetricRequest struct {
@@ -27,6 +35,13 @@ type Metric struct {
 	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
 	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
 	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+
+	Histogram *HistogramValue  `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Sketch    *ddsketch.Sketch `json:"sketch,omitempty"`    // значение метрики в случае передачи timer
+	Summary   *TimerSummary    `json:"summary,omitempty"`   // квантили timer, только в ответах
+	Rate      *float64         `json:"rate,omitempty"`      // скорость counter в секунду, только в ответах
+	Updated   *time.Time       `json:"updated,omitempty"`   // время последней записи серии, только в ответах
+	Stale     bool             `json:"stale,omitempty"`     // серия не обновлялась дольше stale TTL, только в ответах
 }
 
 type Key struct {
@@ -35,10 +50,97 @@ type Key struct {
 }
 
 type Value struct {
-	Value *float64
-	Delta *int64
+	Value     *float64
+	Delta     *int64
+	Histogram *HistogramValue
+	Sketch    *ddsketch.Sketch
+	Updated   time.Time // time of the last write, zero if unknown
 }
 
 type MetricValues map[Key]Value
 
 type MetricsList []Metric
+
+// NewMetric builds a metric from a storage key and value, copying the value so the result doesn't share it.
+func NewMetric(k Key, v Value) Metric {
+	m := Metric{ID: k.ID, MType: k.MType}
+	if v.Value != nil {
+		value := *v.Value
+		m.Value = &value
+	}
+	if v.Delta != nil {
+		delta := *v.Delta
+		m.Delta = &delta
+	}
+	if v.Histogram != nil {
+		m.Histogram = v.Histogram.Clone()
+	}
+	if v.Sketch != nil {
+		m.Sketch = v.Sketch.Clone()
+	}
+	if !v.Updated.IsZero() {
+		updated := v.Updated
+		m.Updated = &updated
+	}
+	return m
+}
+
+// UpdatedAt returns the time of the last write of the series, zero if it isn't known.
+func (m *Metric) UpdatedAt() time.Time {
+	if m.Updated == nil {
+		return time.Time{}
+	}
+	return *m.Updated
+}
+
+// Apply returns the value stored once m is applied to v, the zero Value standing for a metric not stored yet.
+// Gauges replace the value, counters, histograms and timers are added to it. The result shares no pointers with
+// either argument.
+func (v Value) Apply(m *Metric) (Value, error) {
+	switch m.MType {
+	case Counter:
+		delta := *m.Delta
+		if v.Delta != nil {
+			delta += *v.Delta
+		}
+		return Value{Delta: &delta}, nil
+	case Histogram:
+		if v.Histogram == nil {
+			return Value{Histogram: m.Histogram.Clone()}, nil
+		}
+		h := v.Histogram.Clone()
+		if err := h.Merge(m.Histogram); err != nil {
+			return Value{}, err
+		}
+		return Value{Histogram: h}, nil
+	case Timer:
+		return applyTimer(v.Sketch, m)
+	default:
+		value := *m.Value
+		return Value{Value: &value}, nil
+	}
+}
+
+// ValidateMetric checks that the metric type is known and the matching value is set.
+func ValidateMetric(m *Metric) error {
+	switch m.MType {
+	case Gauge:
+		if m.Value == nil {
+			return ErrNilGaugeValue
+		}
+	case Counter:
+		if m.Delta == nil {
+			return ErrNilCounterDelta
+		}
+	case Histogram:
+		if m.Histogram == nil {
+			return ErrNilHistogram
+		}
+		return m.Histogram.Validate()
+	case Timer:
+		return validateTimer(m)
+	default:
+		return ErrIncorrectMetricType
+	}
+	return nil
+}
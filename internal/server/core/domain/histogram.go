@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultBuckets are the bucket bounds used for observations that come without a histogram,
+// the same as the default buckets of the Prometheus client libraries.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	ErrNilHistogram       = fmt.Errorf("%w: histogram is nil", ErrIncorrectMetricValue)
+	ErrIncorrectHistogram = fmt.Errorf("%w: incorrect histogram", ErrIncorrectMetricValue)
+	ErrHistogramMismatch  = errors.New("histogram buckets don't match the stored ones")
+)
+
+// HistogramValue is a distribution of observations over buckets.
+//
+// Counts[i] holds the observations in (Bounds[i-1], Bounds[i]], the extra last count holds the
+// observations above every bound. Counts are per bucket, not cumulative.
+type HistogramValue struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram creates an empty histogram with the given bucket bounds.
+func NewHistogram(bounds []float64) *HistogramValue {
+	return &HistogramValue{
+		Bounds: slices.Clone(bounds),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds a single observation.
+func (h *HistogramValue) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.Bounds, v)
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+// Validate checks that bounds are finite and increasing, and that counts match them.
+func (h *HistogramValue) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("%w: %d bounds need %d counts", ErrIncorrectHistogram, len(h.Bounds), len(h.Bounds)+1)
+	}
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) || (i > 0 && b <= h.Bounds[i-1]) {
+			return fmt.Errorf("%w: bounds must be finite and increasing", ErrIncorrectHistogram)
+		}
+	}
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return fmt.Errorf("%w: count %d doesn't match buckets %d", ErrIncorrectHistogram, h.Count, count)
+	}
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return fmt.Errorf("%w: sum must be finite", ErrIncorrectHistogram)
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the histogram.
+func (h *HistogramValue) Clone() *HistogramValue {
+	return &HistogramValue{
+		Bounds: slices.Clone(h.Bounds),
+		Counts: slices.Clone(h.Counts),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Merge adds the observations of o, which must have the same bounds.
+func (h *HistogramValue) Merge(o *HistogramValue) error {
+	if !slices.Equal(h.Bounds, o.Bounds) {
+		return ErrHistogramMismatch
+	}
+	for i, c := range o.Counts {
+		h.Counts[i] += c
+	}
+	h.Sum += o.Sum
+	h.Count += o.Count
+	return nil
+}
+
+// ParseBuckets parses comma separated bucket bounds, e.g. "0.1,0.5,1".
+func ParseBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		b, err := strconv.ParseFloat(item, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bound %q", ErrIncorrectHistogram, item)
+		}
+		bounds = append(bounds, b)
+	}
+	if err := NewHistogram(bounds).Validate(); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramValue_Observe(t *testing.T) {
+	h := NewHistogram([]float64{1, 5})
+	for _, v := range []float64{0.5, 1, 3, 7, 9} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []uint64{2, 1, 2}, h.Counts)
+	assert.Equal(t, uint64(5), h.Count)
+	assert.InDelta(t, 20.5, h.Sum, 0)
+	require.NoError(t, h.Validate())
+}
+
+func TestHistogramValue_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    HistogramValue
+	}{
+		{name: "counts length", h: HistogramValue{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}},
+		{name: "decreasing bounds", h: HistogramValue{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}},
+		{name: "duplicate bounds", h: HistogramValue{Bounds: []float64{1, 1}, Counts: []uint64{0, 0, 0}}},
+		{name: "count mismatch", h: HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 2}, Count: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.h.Validate()
+			require.ErrorIs(t, err, ErrIncorrectHistogram)
+			require.ErrorIs(t, err, ErrIncorrectMetricValue)
+		})
+	}
+}
+
+func TestValue_Apply(t *testing.T) {
+	h := &HistogramValue{Bounds: []float64{1}, Counts: []uint64{1, 2}, Sum: 4, Count: 3}
+	v, err := Value{}.Apply(&Metric{ID: "h", MType: Histogram, Histogram: h})
+	require.NoError(t, err)
+	v, err = v.Apply(&Metric{ID: "h", MType: Histogram, Histogram: h})
+	require.NoError(t, err)
+	assert.Equal(t, &HistogramValue{Bounds: []float64{1}, Counts: []uint64{2, 4}, Sum: 8, Count: 6}, v.Histogram)
+	assert.Equal(t, []uint64{1, 2}, h.Counts, "input must not be mutated")
+
+	other := &HistogramValue{Bounds: []float64{2}, Counts: []uint64{1, 0}, Sum: 1, Count: 1}
+	_, err = v.Apply(&Metric{ID: "h", MType: Histogram, Histogram: other})
+	require.ErrorIs(t, err, ErrHistogramMismatch)
+
+	delta := int64(2)
+	v, err = Value{}.Apply(&Metric{ID: "c", MType: Counter, Delta: &delta})
+	require.NoError(t, err)
+	v, err = v.Apply(&Metric{ID: "c", MType: Counter, Delta: &delta})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *v.Delta)
+}
+
+func TestParseBuckets(t *testing.T) {
+	bounds, err := ParseBuckets(" 0.1, 0.5,1 ,")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 0.5, 1}, bounds)
+	_, err = ParseBuckets("1,0.5")
+	require.ErrorIs(t, err, ErrIncorrectHistogram)
+	_, err = ParseBuckets("1,x")
+	require.ErrorIs(t, err, ErrIncorrectHistogram)
+}
@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// Sample is the value of a series at a point in time, counters being sampled as their running total.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// Series is the history of a gauge or counter, its samples ordered by time.
+type Series struct {
+	ID      string   `json:"id"`
+	MType   string   `json:"type"`
+	Samples []Sample `json:"samples"`
+}
+
+// SampleValue returns the scalar value of a gauge or counter, other types have none.
+func SampleValue(m *Metric) (float64, bool) {
+	switch {
+	case m.MType == Gauge && m.Value != nil:
+		return *m.Value, true
+	case m.MType == Counter && m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
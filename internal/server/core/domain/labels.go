@@ -0,0 +1,87 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var ErrIncorrectSeriesID = errors.New("incorrect series id")
+
+// SeriesID builds the ID of a labelled series, e.g. http_requests_total{code="200",job="api"}.
+//
+// Labels are sorted by name, so the same series always maps to the same ID, and a metric without
+// labels keeps its plain name.
+func SeriesID(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// ValidateSeries checks that a series ID built from name and labels can be parsed back by ParseSeriesID.
+func ValidateSeries(name string, labels map[string]string) error {
+	if name == "" || strings.Contains(name, "{") {
+		return fmt.Errorf("%w: metric name %q", ErrIncorrectSeriesID, name)
+	}
+	for k := range labels {
+		if k == "" || strings.Contains(k, "=") {
+			return fmt.Errorf("%w: label name %q", ErrIncorrectSeriesID, k)
+		}
+	}
+	return nil
+}
+
+// ParseSeriesID splits a series ID built by SeriesID into the metric name and its labels.
+func ParseSeriesID(id string) (string, map[string]string, error) {
+	name, rest, found := strings.Cut(id, "{")
+	if !found {
+		return id, map[string]string{}, nil
+	}
+	rest, found = strings.CutSuffix(rest, "}")
+	if !found {
+		return "", nil, ErrIncorrectSeriesID
+	}
+	labels := make(map[string]string)
+	for rest != "" {
+		k, v, found := strings.Cut(rest, "=")
+		if !found || k == "" {
+			return "", nil, ErrIncorrectSeriesID
+		}
+		quoted, err := strconv.QuotedPrefix(v)
+		if err != nil {
+			return "", nil, ErrIncorrectSeriesID
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", nil, ErrIncorrectSeriesID
+		}
+		labels[k] = value
+		rest = v[len(quoted):]
+		if rest != "" {
+			if rest, found = strings.CutPrefix(rest, ","); !found {
+				return "", nil, ErrIncorrectSeriesID
+			}
+		}
+	}
+	return name, labels, nil
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesID(t *testing.T) {
+	labels := map[string]string{"job": "api", "code": `2"0,0}`}
+	id := SeriesID("http_requests_total", labels)
+	assert.Equal(t, `http_requests_total{code="2\"0,0}",job="api"}`, id)
+
+	name, parsed, err := ParseSeriesID(id)
+	require.NoError(t, err)
+	assert.Equal(t, "http_requests_total", name)
+	assert.Equal(t, labels, parsed)
+
+	assert.Equal(t, "Alloc", SeriesID("Alloc", nil))
+	name, parsed, err = ParseSeriesID("Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "Alloc", name)
+	assert.Empty(t, parsed)
+
+	for _, id := range []string{`m{job="api"`, `m{job=api}`, `m{="api"}`, `m{a="1"b="2"}`} {
+		_, _, err = ParseSeriesID(id)
+		assert.ErrorIs(t, err, ErrIncorrectSeriesID, id)
+	}
+}
+
+func TestValidateSeries(t *testing.T) {
+	require.NoError(t, ValidateSeries("cpu", map[string]string{"host": `a{b}="c"`}))
+	assert.ErrorIs(t, ValidateSeries("", nil), ErrIncorrectSeriesID)
+	assert.ErrorIs(t, ValidateSeries("c{pu", nil), ErrIncorrectSeriesID)
+	assert.ErrorIs(t, ValidateSeries("cpu", map[string]string{"": "a"}), ErrIncorrectSeriesID)
+	assert.ErrorIs(t, ValidateSeries("cpu", map[string]string{"a=b": "c"}), ErrIncorrectSeriesID)
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrIncorrectFilter = errors.New("incorrect filter")
+
+// Sort orders of a listing.
+const (
+	SortByName = "name"
+	SortByType = "type"
+)
+
+// ListFilter selects a page of metrics.
+type ListFilter struct {
+	Types  []string          // metric types, any when empty
+	Prefix string            // prefix of the series ID
+	Match  *regexp.Regexp    // searched in the metric name, which is the series ID without its labels
+	Labels map[string]string // labels the series must have
+	Sort   string            // SortByName or SortByType, by name when empty
+	Desc   bool              // descending order
+	After  *Key              // key of the last metric of the previous page
+	Limit  int               // maximum number of metrics
+}
+
+// Validate checks the types and the sort order of the filter.
+func (f *ListFilter) Validate() error {
+	for _, t := range f.Types {
+		switch t {
+		case Gauge, Counter, Histogram, Timer:
+		default:
+			return fmt.Errorf("%w: type %q", ErrIncorrectFilter, t)
+		}
+	}
+	switch f.Sort {
+	case "", SortByName, SortByType:
+	default:
+		return fmt.Errorf("%w: sort %q", ErrIncorrectFilter, f.Sort)
+	}
+	if f.Limit <= 0 {
+		return fmt.Errorf("%w: limit %d", ErrIncorrectFilter, f.Limit)
+	}
+	return nil
+}
+
+// Matches reports whether a metric is selected by the filter, regardless of the page.
+func (f *ListFilter) Matches(m *Metric) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, m.MType) {
+		return false
+	}
+	if !strings.HasPrefix(m.ID, f.Prefix) {
+		return false
+	}
+	name, labels, err := ParseSeriesID(m.ID)
+	if err != nil {
+		return false
+	}
+	if f.Match != nil && !f.Match.MatchString(name) {
+		return false
+	}
+	for k, v := range f.Labels {
+		if value, found := labels[k]; !found || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare orders keys by the sort of the filter, ID then type or type then ID, descending if set.
+func (f *ListFilter) Compare(a, b Key) int {
+	c := cmp.Or(strings.Compare(a.ID, b.ID), strings.Compare(a.MType, b.MType))
+	if f.Sort == SortByType {
+		c = cmp.Or(strings.Compare(a.MType, b.MType), strings.Compare(a.ID, b.ID))
+	}
+	if f.Desc {
+		return -c
+	}
+	return c
+}
+
+// Page applies the filter to all the metrics of a storage which can't filter them itself.
+func (f *ListFilter) Page(metrics MetricsList) MetricsList {
+	page := make(MetricsList, 0)
+	for _, m := range metrics {
+		if f.Matches(&m) && (f.After == nil || f.Compare(Key{MType: m.MType, ID: m.ID}, *f.After) > 0) {
+			page = append(page, m)
+		}
+	}
+	slices.SortFunc(page, func(a, b Metric) int {
+		return f.Compare(Key{MType: a.MType, ID: a.ID}, Key{MType: b.MType, ID: b.ID})
+	})
+	if len(page) > f.Limit {
+		page = page[:f.Limit]
+	}
+	return page
+}
+
+// MetricsPage is a page of a listing, Next being the cursor of the following page if there is one.
+type MetricsPage struct {
+	Metrics MetricsList `json:"metrics"`
+	Next    string      `json:"next,omitempty"`
+}
+
+type cursor struct {
+	MType string `json:"t"`
+	ID    string `json:"i"`
+}
+
+// EncodeCursor builds the opaque cursor of the page following the given key.
+func EncodeCursor(k Key) string {
+	buf, _ := json.Marshal(cursor{MType: k.MType, ID: k.ID})
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeCursor returns the key a cursor built by EncodeCursor continues after.
+func DecodeCursor(s string) (*Key, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: cursor", ErrIncorrectFilter)
+	}
+	var c cursor
+	if err = json.Unmarshal(buf, &c); err != nil {
+		return nil, fmt.Errorf("%w: cursor", ErrIncorrectFilter)
+	}
+	return &Key{MType: c.MType, ID: c.ID}, nil
+}
@@ -0,0 +1,38 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrTypeConflict      = fmt.Errorf("%w: type conflicts with the registered one", ErrIncorrectMetricType)
+	ErrIncorrectMetadata = fmt.Errorf("%w: incorrect metadata", ErrIncorrectMetricValue)
+)
+
+// Metadata describes a metric name, shared by all the labelled series of it.
+type Metadata struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// ValidateMetadata checks that the name is a plain metric name and the type, if any, is known.
+func ValidateMetadata(md *Metadata) error {
+	if md.Name == "" || strings.ContainsAny(md.Name, "{}") {
+		return fmt.Errorf("%w: name %q", ErrIncorrectMetadata, md.Name)
+	}
+	switch md.Type {
+	case "", Gauge, Counter, Histogram, Timer:
+		return nil
+	default:
+		return fmt.Errorf("%w: type %q", ErrIncorrectMetadata, md.Type)
+	}
+}
+
+// MetricName returns the name a series ID is registered under, which is the ID without its labels.
+func MetricName(id string) string {
+	name, _, _ := strings.Cut(id, "{")
+	return name
+}
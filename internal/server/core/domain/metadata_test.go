@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMetadata(t *testing.T) {
+	assert.NoError(t, ValidateMetadata(&Metadata{Name: "Alloc", Type: Gauge, Unit: "bytes"}))
+	assert.NoError(t, ValidateMetadata(&Metadata{Name: "Alloc"}), "the type is optional")
+	assert.ErrorIs(t, ValidateMetadata(&Metadata{}), ErrIncorrectMetadata)
+	assert.ErrorIs(t, ValidateMetadata(&Metadata{Name: `rt{path="/"}`}), ErrIncorrectMetadata)
+	assert.ErrorIs(t, ValidateMetadata(&Metadata{Name: "Alloc", Type: "meter"}), ErrIncorrectMetadata)
+}
+
+func TestMetricName(t *testing.T) {
+	assert.Equal(t, "rt", MetricName(`rt{path="/"}`))
+	assert.Equal(t, "Alloc", MetricName("Alloc"))
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+var ErrNoRate = fmt.Errorf("%w: counter has no writes far enough apart for a rate", ErrItemNotFound)
+
+// CounterRate is the change of a counter over an interval ending at its last write.
+type CounterRate struct {
+	Delta    int64         `json:"delta"`
+	Rate     float64       `json:"rate"`
+	Interval time.Duration `json:"interval"`
+}
+
+// NextRate returns the change from a total written at prevAt to one written at at. A total lower than the
+// previous one means the counter was reset, so it has grown from zero since.
+func NextRate(prev int64, prevAt time.Time, total int64, at time.Time) CounterRate {
+	delta := total - prev
+	if delta < 0 {
+		delta = total
+	}
+	interval := at.Sub(prevAt)
+	return CounterRate{Delta: delta, Rate: float64(delta) / interval.Seconds(), Interval: interval}
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextRate(t *testing.T) {
+	at := time.Now()
+	assert.Equal(t, CounterRate{Delta: 20, Rate: 2, Interval: 10 * time.Second},
+		NextRate(100, at, 120, at.Add(10*time.Second)))
+	assert.Equal(t, CounterRate{Delta: 30, Rate: 1, Interval: 30 * time.Second},
+		NextRate(100, at, 30, at.Add(30*time.Second)), "a lower total is a reset")
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "errors"
+
+// Import modes.
+const (
+	// ImportMerge writes the snapshot the way reports are written: gauges are replaced, counters,
+	// histograms and timers are added to.
+	ImportMerge = "merge"
+	// ImportReplace makes the stored series those of the snapshot, deleting the series it doesn't hold.
+	ImportReplace = "replace"
+)
+
+var ErrIncorrectImportMode = errors.New("incorrect import mode")
+
+// ImportResult tells what an import did, up to where it stopped if it failed.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Deleted  int `json:"deleted"`
+}
@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// StaleGroup counts the stale series among the series sharing the value of a label, which are usually
+// the series of one agent.
+type StaleGroup struct {
+	Name        string    `json:"name"`         // value of the label, empty for the series without it
+	Series      int       `json:"series"`       // number of series of the group
+	Stale       int       `json:"stale"`        // number of stale series of the group
+	LastUpdated time.Time `json:"last_updated"` // time of the last write of any series of the group
+	Silent      bool      `json:"silent"`       // every series is stale, the agent stopped reporting
+}
+
+// StaleReport lists the groups with stale series, silent ones first, and the stale series themselves.
+type StaleReport struct {
+	StaleAfter string       `json:"stale_after"`
+	Label      string       `json:"label"`
+	Groups     []StaleGroup `json:"groups"`
+	Series     MetricsList  `json:"series"`
+}
+
+// NewStaleReport groups metrics already marked stale by the value of a label.
+func NewStaleReport(metrics MetricsList, label string, staleAfter time.Duration) *StaleReport {
+	report := &StaleReport{
+		StaleAfter: staleAfter.String(),
+		Label:      label,
+		Groups:     make([]StaleGroup, 0),
+		Series:     make(MetricsList, 0),
+	}
+	groups := make(map[string]*StaleGroup)
+	for _, m := range metrics {
+		_, labels, err := ParseSeriesID(m.ID)
+		if err != nil {
+			continue
+		}
+		name := labels[label]
+		g, found := groups[name]
+		if !found {
+			g = &StaleGroup{Name: name}
+			groups[name] = g
+		}
+		g.Series++
+		if updated := m.UpdatedAt(); updated.After(g.LastUpdated) {
+			g.LastUpdated = updated
+		}
+		if m.Stale {
+			g.Stale++
+			report.Series = append(report.Series, m)
+		}
+	}
+	for _, g := range groups {
+		if g.Stale > 0 {
+			g.Silent = g.Stale == g.Series
+			report.Groups = append(report.Groups, *g)
+		}
+	}
+	slices.SortFunc(report.Groups, func(a, b StaleGroup) int {
+		if a.Silent != b.Silent {
+			if a.Silent {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	slices.SortFunc(report.Series, func(a, b Metric) int {
+		return cmp.Or(cmp.Compare(a.ID, b.ID), cmp.Compare(a.MType, b.MType))
+	})
+	return report
+}
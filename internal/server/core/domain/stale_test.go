@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewStaleReport(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	metric := func(id string, updated time.Time, stale bool) Metric {
+		return Metric{ID: id, MType: Gauge, Updated: &updated, Stale: stale}
+	}
+	report := NewStaleReport(MetricsList{
+		metric(`Alloc{host="web2"}`, at, false),
+		metric(`HeapAlloc{host="web2"}`, at.Add(-time.Hour), true),
+		metric(`Alloc{host="web1"}`, at.Add(-2*time.Hour), true),
+		metric(`HeapAlloc{host="web1"}`, at.Add(-3*time.Hour), true),
+		metric(`Alloc{host="web3"}`, at, false),
+		metric("PollCount", at.Add(-time.Hour), true),
+	}, "host", 5*time.Minute)
+
+	assert.Equal(t, "5m0s", report.StaleAfter)
+	assert.Equal(t, "host", report.Label)
+	assert.Equal(t, []StaleGroup{
+		{Name: "", Series: 1, Stale: 1, LastUpdated: at.Add(-time.Hour), Silent: true},
+		{Name: "web1", Series: 2, Stale: 2, LastUpdated: at.Add(-2 * time.Hour), Silent: true},
+		{Name: "web2", Series: 2, Stale: 1, LastUpdated: at},
+	}, report.Groups, "silent groups come first, groups without stale series are left out")
+	ids := make([]string, 0, len(report.Series))
+	for _, m := range report.Series {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, []string{`Alloc{host="web1"}`, `HeapAlloc{host="web1"}`, `HeapAlloc{host="web2"}`, "PollCount"}, ids)
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+
+	"metrics/internal/shared-kernel/ddsketch"
+)
+
+var (
+	ErrNilTimer       = fmt.Errorf("%w: timer has neither value nor sketch", ErrIncorrectMetricValue)
+	ErrIncorrectTimer = fmt.Errorf("%w: incorrect timer", ErrIncorrectMetricValue)
+	ErrTimerMismatch  = ddsketch.ErrSketchMismatch
+)
+
+// TimerSummary is what the value APIs expose of a timer sketch.
+type TimerSummary struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// Summarize estimates the quantiles of a timer sketch.
+func Summarize(s *ddsketch.Sketch) *TimerSummary {
+	return &TimerSummary{
+		Count: s.Count,
+		Sum:   s.Sum,
+		P50:   s.Quantile(0.5),
+		P90:   s.Quantile(0.9),
+		P99:   s.Quantile(0.99),
+		Max:   s.Quantile(1),
+	}
+}
+
+// validateTimer checks a timer, which carries either a single sample in Value or a sketch of many.
+func validateTimer(m *Metric) error {
+	if m.Sketch != nil {
+		if err := m.Sketch.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrIncorrectTimer, err)
+		}
+		return nil
+	}
+	if m.Value == nil {
+		return ErrNilTimer
+	}
+	if math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0) {
+		return fmt.Errorf("%w: sample must be finite", ErrIncorrectTimer)
+	}
+	return nil
+}
+
+// applyTimer folds the sample or the sketch of m into the stored sketch.
+func applyTimer(stored *ddsketch.Sketch, m *Metric) (Value, error) {
+	if stored == nil && m.Sketch != nil {
+		return Value{Sketch: m.Sketch.Clone()}, nil
+	}
+	s := ddsketch.New()
+	if stored != nil {
+		s = stored.Clone()
+	}
+	if m.Sketch == nil {
+		s.Add(*m.Value)
+		return Value{Sketch: s}, nil
+	}
+	if err := s.Merge(m.Sketch); err != nil {
+		return Value{}, err
+	}
+	return Value{Sketch: s}, nil
+}
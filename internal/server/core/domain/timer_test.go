@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"math"
+	"testing"
+
+	"metrics/internal/shared-kernel/ddsketch"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyTimer(t *testing.T) {
+	sample := func(v float64) *Metric { return &Metric{ID: "rt", MType: Timer, Value: &v} }
+
+	first, err := Value{}.Apply(sample(10))
+	require.NoError(t, err)
+	second, err := first.Apply(sample(20))
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(1), first.Sketch.Count, "stored value must not be mutated")
+	assert.Equal(t, uint64(2), second.Sketch.Count)
+	assert.InDelta(t, 30.0, second.Sketch.Sum, 0)
+
+	coarse := &ddsketch.Sketch{Alpha: 0.05}
+	coarse.Add(1)
+	fresh, err := Value{}.Apply(&Metric{MType: Timer, Sketch: coarse})
+	require.NoError(t, err)
+	assert.InDelta(t, 0.05, fresh.Sketch.Alpha, 0, "a new timer keeps the accuracy it was sent with")
+	_, err = second.Apply(&Metric{MType: Timer, Sketch: coarse})
+	assert.ErrorIs(t, err, ErrTimerMismatch)
+}
+
+func TestValidateTimer(t *testing.T) {
+	nan := math.NaN()
+
+	assert.ErrorIs(t, ValidateMetric(&Metric{MType: Timer}), ErrNilTimer)
+	assert.ErrorIs(t, ValidateMetric(&Metric{MType: Timer, Value: &nan}), ErrIncorrectTimer)
+	assert.ErrorIs(t, ValidateMetric(&Metric{MType: Timer, Sketch: &ddsketch.Sketch{}}), ErrIncorrectMetricValue)
+	assert.NoError(t, ValidateMetric(&Metric{MType: Timer, Sketch: ddsketch.New()}))
+}
@@ -37,12 +37,7 @@ func SaveMetricsToFile(filepath string, metrics domain.MetricValues) error {
 	}(file)
 	metricList := make(domain.MetricsList, 0)
 	for k, v := range metrics {
-		metricList = append(metricList, domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
-		})
+		metricList = append(metricList, domain.NewMetric(k, v))
 	}
 	if err = json.NewEncoder(file).Encode(metricList); err != nil {
 		return fmt.Errorf("%w", err)
@@ -86,7 +81,85 @@ func LoadMetricsFromFile(filepath string) (domain.MetricValues, error) {
 	}
 	metricValues := make(domain.MetricValues)
 	for _, v := range metricList {
-		metricValues[domain.Key{MType: v.MType, ID: v.ID}] = domain.Value{Value: v.Value, Delta: v.Delta}
+		metricValues[domain.Key{MType: v.MType, ID: v.ID}] = domain.Value{
+			Value:     v.Value,
+			Delta:     v.Delta,
+			Histogram: v.Histogram,
+			Sketch:    v.Sketch,
+			Updated:   v.UpdatedAt(),
+		}
 	}
 	return metricValues, nil
 }
+
+// LoadMetadataFromFile loads the metadata of metrics from a JSON array.
+//
+// Args:
+//
+//	filepath (string): The path to load the metadata file from.
+//
+// Returns:
+//
+//	[]domain.Metadata: The loaded metadata.
+//	error: Any error that occurred during the operation.
+func LoadMetadataFromFile(filepath string) ([]domain.Metadata, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var list []domain.Metadata
+	if err = json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode file: %w", err)
+	}
+	return list, nil
+}
+
+// LoadAlertRulesFromFile loads alert rules from a JSON array, a missing file holding none.
+//
+// Args:
+//
+//	filepath (string): The path to load the alert rules file from.
+//
+// Returns:
+//
+//	[]domain.AlertRule: The loaded alert rules.
+//	error: Any error that occurred during the operation.
+func LoadAlertRulesFromFile(filepath string) ([]domain.AlertRule, error) {
+	data, err := os.ReadFile(filepath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []domain.AlertRule{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	var rules []domain.AlertRule
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode file: %w", err)
+	}
+	return rules, nil
+}
+
+// SaveAlertRulesToFile saves alert rules to a file as a JSON array, replacing the file once it is written.
+//
+// Args:
+//
+//	filepath (string): The path to save the alert rules file.
+//	rules ([]domain.AlertRule): The alert rules to save.
+//
+// Returns:
+//
+//	error: Any error that occurred during the operation.
+func SaveAlertRulesToFile(filepath string, rules []domain.AlertRule) error {
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode alert rules: %w", err)
+	}
+	tmp := filepath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err = os.Rename(tmp, filepath); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
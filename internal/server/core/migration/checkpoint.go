@@ -0,0 +1,83 @@
+package migration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"metrics/internal/server/core/domain"
+)
+
+// ErrCheckpointMismatch is returned when the checkpoint was saved by a migration between other storages.
+var ErrCheckpointMismatch = errors.New("checkpoint belongs to another migration")
+
+// checkpoint is the progress saved after every batch.
+type checkpoint struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Series  int    `json:"series"`
+	Samples int    `json:"samples"`
+}
+
+// loadCheckpoint returns the progress saved by an interrupted migration, none when there is no checkpoint.
+func (m *Migrator) loadCheckpoint() (Progress, error) {
+	if m.checkpoint == "" {
+		return Progress{}, nil
+	}
+	buf, err := os.ReadFile(m.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return Progress{}, nil
+	}
+	if err != nil {
+		return Progress{}, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var c checkpoint
+	if err = json.Unmarshal(buf, &c); err != nil {
+		return Progress{}, fmt.Errorf("failed to decode checkpoint %s: %w", m.checkpoint, err)
+	}
+	if c.From != m.from || c.To != m.to {
+		return Progress{}, fmt.Errorf("%w: remove %s or choose another checkpoint", ErrCheckpointMismatch, m.checkpoint)
+	}
+	return Progress{Series: c.Series, Samples: c.Samples, Last: &domain.Key{MType: c.Type, ID: c.ID}}, nil
+}
+
+// saveCheckpoint saves the progress. It is written to a temporary file renamed over the checkpoint, so that
+// an interruption leaves either the previous checkpoint or the new one.
+func (m *Migrator) saveCheckpoint(p Progress) error {
+	if m.checkpoint == "" {
+		return nil
+	}
+	buf, err := json.Marshal(checkpoint{
+		From: m.from, To: m.to, Type: p.Last.MType, ID: p.Last.ID, Series: p.Series, Samples: p.Samples,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(m.checkpoint), filepath.Base(m.checkpoint)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	_, err = f.Write(buf)
+	if err = errors.Join(err, f.Close()); err == nil {
+		err = os.Rename(f.Name(), m.checkpoint)
+	}
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to save checkpoint: %w", err), os.Remove(f.Name()))
+	}
+	return nil
+}
+
+// removeCheckpoint removes the checkpoint of a completed migration.
+func (m *Migrator) removeCheckpoint() error {
+	if m.checkpoint == "" {
+		return nil
+	}
+	if err := os.Remove(m.checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
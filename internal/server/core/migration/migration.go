@@ -0,0 +1,264 @@
+// Package migration copies the series of one metric storage to another.
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+// DefaultBatch is how many series are copied at a time unless WithBatch says otherwise.
+const DefaultBatch = 500
+
+// Storage defines the storage operations a migration reads the source and writes the destination with.
+type Storage interface {
+	GetMetric(ctx context.Context, mType, mName string) (*domain.Metric, error)
+	SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error)
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error)
+	DeleteMetric(ctx context.Context, mType, mName string) error
+}
+
+// HistoryReader is a source storage keeping the history of gauges and counters.
+type HistoryReader interface {
+	GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error)
+}
+
+// HistoryWriter is a destination storage the history of gauges and counters can be added to.
+type HistoryWriter interface {
+	AppendHistory(ctx context.Context, series []domain.Series) error
+}
+
+// Progress tells how far a migration went.
+type Progress struct {
+	Series  int         // series copied
+	Samples int         // history samples copied
+	Last    *domain.Key // key of the last series copied, nil before the first batch
+}
+
+// Migrator copies the series of a source storage to a destination one in batches, in key order, with the
+// history of the gauges and counters when the source keeps it and the destination takes it.
+type Migrator struct {
+	src, dst   Storage
+	batch      int
+	checkpoint string
+	from, to   string
+	history    bool
+	progress   func(Progress)
+	flush      func(ctx context.Context) error
+}
+
+// Option configures a Migrator.
+type Option func(m *Migrator)
+
+// WithBatch sets how many series are copied at a time.
+func WithBatch(size int) Option {
+	return func(m *Migrator) {
+		m.batch = size
+	}
+}
+
+// WithCheckpoint sets the file the progress is saved to after every batch, so that an interrupted migration
+// resumes after the last batch copied. The file is removed once the migration completes.
+//
+// from and to identify the source and destination, a checkpoint saved by a migration between other storages
+// is refused rather than resumed.
+func WithCheckpoint(path, from, to string) Option {
+	return func(m *Migrator) {
+		m.checkpoint = path
+		m.from, m.to = from, to
+	}
+}
+
+// WithoutHistory copies the latest values alone.
+func WithoutHistory() Option {
+	return func(m *Migrator) {
+		m.history = false
+	}
+}
+
+// WithProgress sets a function called after every batch with the progress so far.
+func WithProgress(fn func(p Progress)) Option {
+	return func(m *Migrator) {
+		m.progress = fn
+	}
+}
+
+// WithFlush sets a function called after every batch is written, before the checkpoint is saved, for a
+// destination that doesn't persist its writes by itself.
+func WithFlush(fn func(ctx context.Context) error) Option {
+	return func(m *Migrator) {
+		m.flush = fn
+	}
+}
+
+// New creates a Migrator copying src to dst.
+func New(src, dst Storage, opts ...Option) *Migrator {
+	m := &Migrator{src: src, dst: dst, batch: DefaultBatch, history: true}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.batch <= 0 {
+		m.batch = DefaultBatch
+	}
+	return m
+}
+
+// CopiesHistory tells whether the history is copied, which needs the source to keep it and the destination
+// to take it.
+func (m *Migrator) CopiesHistory() bool {
+	_, readable := m.src.(HistoryReader)
+	_, writable := m.dst.(HistoryWriter)
+	return m.history && readable && writable
+}
+
+// Run copies the series of the source, starting after the checkpoint when there is one. A destination
+// series is replaced by the source one rather than merged with it, so a batch interrupted halfway is copied
+// again without counting anything twice. On failure the progress tells how far the migration went.
+func (m *Migrator) Run(ctx context.Context) (Progress, error) {
+	progress, err := m.loadCheckpoint()
+	if err != nil {
+		return progress, err
+	}
+	filter := domain.ListFilter{Limit: m.batch, After: progress.Last}
+	for {
+		metrics, err := m.src.ListMetrics(ctx, filter)
+		if err != nil {
+			return progress, fmt.Errorf("failed to list source metrics: %w", err)
+		}
+		if len(metrics) > 0 {
+			samples, err := m.copyBatch(ctx, metrics)
+			if err != nil {
+				return progress, err
+			}
+			if m.flush != nil {
+				if err = m.flush(ctx); err != nil {
+					return progress, fmt.Errorf("failed to flush destination: %w", err)
+				}
+			}
+			last := metrics[len(metrics)-1]
+			progress.Series += len(metrics)
+			progress.Samples += samples
+			progress.Last = &domain.Key{MType: last.MType, ID: last.ID}
+			if err = m.saveCheckpoint(progress); err != nil {
+				return progress, err
+			}
+			if m.progress != nil {
+				m.progress(progress)
+			}
+		}
+		if len(metrics) < filter.Limit {
+			return progress, m.removeCheckpoint()
+		}
+		filter.After = progress.Last
+	}
+}
+
+// copyBatch replaces the destination series of a batch with the source ones and returns how many history
+// samples were copied. The history goes first, so that a storage taking the latest value from it ends up
+// with the source one.
+func (m *Migrator) copyBatch(ctx context.Context, metrics domain.MetricsList) (int, error) {
+	for _, metric := range metrics {
+		err := m.dst.DeleteMetric(ctx, metric.MType, metric.ID)
+		if err != nil && !errors.Is(err, domain.ErrItemNotFound) {
+			return 0, fmt.Errorf("failed to clear %s %s in destination: %w", metric.MType, metric.ID, err)
+		}
+	}
+	copied, err := m.copyHistory(ctx, metrics)
+	if err != nil {
+		return 0, err
+	}
+	samples := 0
+	writes := make(domain.MetricsList, 0, len(metrics))
+	for i := range metrics {
+		key := domain.Key{MType: metrics[i].MType, ID: metrics[i].ID}
+		samples += copied[key]
+		if writes, err = m.appendLatest(ctx, writes, &metrics[i], copied[key] > 0); err != nil {
+			return 0, err
+		}
+	}
+	if len(writes) == 0 {
+		return samples, nil
+	}
+	if _, err = m.dst.SetMetrics(ctx, writes); err != nil {
+		return 0, fmt.Errorf("failed to write destination metrics: %w", err)
+	}
+	return samples, nil
+}
+
+// copyHistory copies the history of the gauges and counters of a batch and returns how many samples each
+// series had. The history is read by metric name, which covers the series of every label set of a name.
+func (m *Migrator) copyHistory(ctx context.Context, metrics domain.MetricsList) (map[domain.Key]int, error) {
+	if !m.CopiesHistory() {
+		return nil, nil
+	}
+	reader, writer := m.src.(HistoryReader), m.dst.(HistoryWriter)
+	keys := make(map[domain.Key]bool, len(metrics))
+	var names []string
+	seen := make(map[string]bool)
+	for _, metric := range metrics {
+		if metric.MType != domain.Gauge && metric.MType != domain.Counter {
+			continue
+		}
+		keys[domain.Key{MType: metric.MType, ID: metric.ID}] = true
+		if name := domain.MetricName(metric.ID); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	copied := make(map[domain.Key]int, len(keys))
+	to := time.Now()
+	for _, name := range names {
+		history, err := reader.GetHistory(ctx, name, time.Time{}, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history of %s: %w", name, err)
+		}
+		series := make([]domain.Series, 0, len(history))
+		for _, s := range history {
+			key := domain.Key{MType: s.MType, ID: s.ID}
+			if !keys[key] || len(s.Samples) == 0 {
+				continue
+			}
+			series = append(series, s)
+			copied[key] = len(s.Samples)
+		}
+		if len(series) == 0 {
+			continue
+		}
+		if err = writer.AppendHistory(ctx, series); err != nil {
+			return nil, fmt.Errorf("failed to write history of %s: %w", name, err)
+		}
+	}
+	return copied, nil
+}
+
+// appendLatest appends the write giving a destination series the latest value of the source one, if it
+// hasn't got it already. A series whose history was copied may have taken its latest value from it, and as
+// counters add up, a counter write then holds the missing part of the total.
+func (m *Migrator) appendLatest(
+	ctx context.Context, writes domain.MetricsList, src *domain.Metric, hasHistory bool,
+) (domain.MetricsList, error) {
+	write := domain.Metric{
+		ID: src.ID, MType: src.MType, Value: src.Value, Delta: src.Delta, Histogram: src.Histogram, Sketch: src.Sketch,
+	}
+	if !hasHistory {
+		return append(writes, write), nil
+	}
+	stored, err := m.dst.GetMetric(ctx, src.MType, src.ID)
+	if errors.Is(err, domain.ErrItemNotFound) {
+		return append(writes, write), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s in destination: %w", src.MType, src.ID, err)
+	}
+	if sameValue(src, stored) {
+		return writes, nil
+	}
+	if src.MType == domain.Counter && stored.Delta != nil {
+		rest := *src.Delta - *stored.Delta
+		write.Delta = &rest
+	}
+	return append(writes, write), nil
+}
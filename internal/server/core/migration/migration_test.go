@@ -0,0 +1,236 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/sqlite"
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+)
+
+func newSQLite(t *testing.T) *sqlite.MetricStorage {
+	t.Helper()
+	s, err := sqlite.NewStorage(&sqlite.Config{DSN: filepath.Join(t.TempDir(), "metrics.db")})
+	require.NoError(t, err)
+	return s
+}
+
+func newMemory(t *testing.T) *memory.MetricStorage {
+	t.Helper()
+	s, err := memory.NewStorage(&memory.Config{})
+	require.NoError(t, err)
+	return s
+}
+
+// fill writes the batches to a storage one after the other.
+func fill(t *testing.T, s Storage, batches ...domain.MetricsList) {
+	t.Helper()
+	for _, batch := range batches {
+		_, err := s.SetMetrics(context.Background(), batch)
+		require.NoError(t, err)
+	}
+}
+
+// source returns a storage holding every metric type, the gauges and counters written twice.
+func source(t *testing.T) *sqlite.MetricStorage {
+	t.Helper()
+	s := newSQLite(t)
+	fill(t, s,
+		domain.MetricsList{
+			storagetest.Gauge(`load{host="a"}`, 1), storagetest.Gauge(`load{host="b"}`, 2),
+			storagetest.Counter("requests", 2), storagetest.Gauge("heap", 10),
+			storagetest.Histogram("latency", []float64{1}, []uint64{1, 2}, 4),
+			storagetest.Sketch("response", 1, 2, 3),
+		},
+		domain.MetricsList{
+			storagetest.Gauge(`load{host="a"}`, 3), storagetest.Counter("requests", 5), storagetest.Gauge("heap", 11),
+		},
+	)
+	return s
+}
+
+func history(t *testing.T, s HistoryReader, name string) []domain.Series {
+	t.Helper()
+	series, err := s.GetHistory(context.Background(), name, time.Time{}, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	return series
+}
+
+func samples(series []domain.Series) map[string][]float64 {
+	result := make(map[string][]float64, len(series))
+	for _, s := range series {
+		for _, sample := range s.Samples {
+			result[s.ID] = append(result[s.ID], sample.Value)
+		}
+	}
+	return result
+}
+
+func TestMigrator_Run(t *testing.T) {
+	ctx := context.Background()
+	src, dst := source(t), newSQLite(t)
+	// A destination series is replaced rather than added to.
+	fill(t, dst, domain.MetricsList{storagetest.Counter("requests", 100)})
+	checkpoint := filepath.Join(t.TempDir(), "migrate.json")
+	var batches []Progress
+	m := New(src, dst, WithBatch(4), WithCheckpoint(checkpoint, "src", "dst"), WithProgress(func(p Progress) {
+		batches = append(batches, p)
+	}))
+	require.True(t, m.CopiesHistory())
+
+	progress, err := m.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, progress.Series)
+	assert.Equal(t, 7, progress.Samples)
+	require.Len(t, batches, 2)
+	assert.Equal(t, 4, batches[0].Series)
+	assert.NoFileExists(t, checkpoint, "the checkpoint of a completed migration is removed")
+
+	for _, name := range []string{"load", "requests", "heap"} {
+		assert.Equal(t, samples(history(t, src, name)), samples(history(t, dst, name)), name)
+	}
+	counter, err := dst.GetMetric(ctx, domain.Counter, "requests")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *counter.Delta)
+
+	report, err := m.Verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+	assert.Equal(t, 6, report.Source)
+}
+
+func TestMigrator_RunWithoutHistory(t *testing.T) {
+	ctx := context.Background()
+	src := source(t)
+	for _, tt := range []struct {
+		name string
+		dst  Storage
+		opts []Option
+	}{
+		{name: "destination without history", dst: newMemory(t)},
+		{name: "history disabled", dst: newSQLite(t), opts: []Option{WithoutHistory()}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(src, tt.dst, tt.opts...)
+			require.False(t, m.CopiesHistory())
+
+			progress, err := m.Run(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 6, progress.Series)
+			assert.Zero(t, progress.Samples)
+
+			report, err := m.Verify(ctx)
+			require.NoError(t, err)
+			assert.True(t, report.OK(), "%+v", report)
+		})
+	}
+}
+
+// failingStorage fails the latest value writes once the allowed ones are used up.
+type failingStorage struct {
+	Storage
+	HistoryWriter
+	writes int
+}
+
+var errWrite = errors.New("write failed")
+
+func (s *failingStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	if s.writes == 0 {
+		return nil, errWrite
+	}
+	s.writes--
+	return s.Storage.SetMetrics(ctx, metrics)
+}
+
+func TestMigrator_Resume(t *testing.T) {
+	ctx := context.Background()
+	src, dst := source(t), newSQLite(t)
+	checkpoint := filepath.Join(t.TempDir(), "migrate.json")
+
+	progress, err := New(src, &failingStorage{Storage: dst, HistoryWriter: dst, writes: 1},
+		WithBatch(2), WithCheckpoint(checkpoint, "src", "dst"),
+	).Run(ctx)
+	require.ErrorIs(t, err, errWrite)
+	// The gauges of the second batch take their latest values from the history, so the third one fails after
+	// writing the history of requests.
+	assert.Equal(t, 4, progress.Series)
+	require.FileExists(t, checkpoint)
+
+	m := New(src, dst, WithBatch(2), WithCheckpoint(checkpoint, "src", "dst"))
+	progress, err = m.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, progress.Series, "the series copied before the interruption are counted")
+	assert.NoFileExists(t, checkpoint)
+
+	report, err := m.Verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+	assert.Equal(t, samples(history(t, src, "requests")), samples(history(t, dst, "requests")),
+		"the batch interrupted halfway is copied once")
+}
+
+func TestMigrator_Checkpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "migrate.json")
+	require.NoError(t, os.WriteFile(checkpoint, []byte("{"), 0o600))
+
+	_, err := New(newMemory(t), newMemory(t), WithCheckpoint(checkpoint, "src", "dst")).Run(context.Background())
+	require.Error(t, err)
+}
+
+func TestMigrator_CheckpointMismatch(t *testing.T) {
+	ctx := context.Background()
+	src := source(t)
+	checkpoint := filepath.Join(t.TempDir(), "migrate.json")
+	failed := newSQLite(t)
+	_, err := New(src, &failingStorage{Storage: failed, HistoryWriter: failed, writes: 1},
+		WithBatch(2), WithCheckpoint(checkpoint, "src", "dst"),
+	).Run(ctx)
+	require.ErrorIs(t, err, errWrite)
+	require.FileExists(t, checkpoint)
+
+	dst := newSQLite(t)
+	_, err = New(src, dst, WithBatch(2), WithCheckpoint(checkpoint, "src", "other")).Run(ctx)
+	require.ErrorIs(t, err, ErrCheckpointMismatch)
+	all, err := dst.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, all, "nothing is copied")
+	assert.FileExists(t, checkpoint)
+}
+
+func TestMigrator_Verify(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newMemory(t), newMemory(t)
+	fill(t, src, domain.MetricsList{
+		storagetest.Gauge("heap", 1), storagetest.Counter("requests", 2),
+		storagetest.Histogram("latency", []float64{1}, []uint64{1, 0}, 0.5), storagetest.Sketch("response", 1, 2),
+	})
+	fill(t, dst, domain.MetricsList{
+		storagetest.Gauge("heap", 1), storagetest.Counter("requests", 3),
+		storagetest.Histogram("latency", []float64{1}, []uint64{1, 0}, 0.5), storagetest.Sketch("response", 1),
+		storagetest.Gauge("extra", 1),
+	})
+
+	report, err := New(src, dst).Verify(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, 4, report.Source)
+	assert.Equal(t, 5, report.Destination)
+	assert.Empty(t, report.Missing)
+	assert.ElementsMatch(t, []domain.Key{
+		{MType: domain.Counter, ID: "requests"}, {MType: domain.Timer, ID: "response"},
+	}, report.Mismatched)
+
+	report, err = New(dst, src).Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Key{{MType: domain.Gauge, ID: "extra"}}, report.Missing)
+}
@@ -0,0 +1,95 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"metrics/internal/server/core/domain"
+)
+
+// Report is the outcome of a verification.
+type Report struct {
+	Source      int          // series in the source
+	Destination int          // series in the destination
+	Missing     []domain.Key // source series the destination hasn't got
+	Mismatched  []domain.Key // source series whose latest value differs in the destination
+}
+
+// OK tells whether the destination holds the series of the source and nothing else.
+func (r *Report) OK() bool {
+	return r.Source == r.Destination && len(r.Missing) == 0 && len(r.Mismatched) == 0
+}
+
+// Verify compares the destination with the source: the number of series in each, and the latest value of
+// every source series.
+func (m *Migrator) Verify(ctx context.Context) (*Report, error) {
+	report := &Report{}
+	err := walk(ctx, m.src, m.batch, func(src *domain.Metric) error {
+		report.Source++
+		key := domain.Key{MType: src.MType, ID: src.ID}
+		dst, err := m.dst.GetMetric(ctx, src.MType, src.ID)
+		switch {
+		case errors.Is(err, domain.ErrItemNotFound):
+			report.Missing = append(report.Missing, key)
+		case err != nil:
+			return fmt.Errorf("failed to read %s %s in destination: %w", src.MType, src.ID, err)
+		case !sameValue(src, dst):
+			report.Mismatched = append(report.Mismatched, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = walk(ctx, m.dst, m.batch, func(*domain.Metric) error {
+		report.Destination++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// walk calls fn with every metric of a storage in key order, reading it a page at a time.
+func walk(ctx context.Context, s Storage, page int, fn func(m *domain.Metric) error) error {
+	filter := domain.ListFilter{Limit: page}
+	for {
+		metrics, err := s.ListMetrics(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("failed to list metrics: %w", err)
+		}
+		for i := range metrics {
+			if err = fn(&metrics[i]); err != nil {
+				return err
+			}
+		}
+		if len(metrics) < filter.Limit {
+			return nil
+		}
+		last := metrics[len(metrics)-1]
+		filter.After = &domain.Key{MType: last.MType, ID: last.ID}
+	}
+}
+
+// sameValue tells whether two metrics of a series have the same latest value. Timers are compared by the
+// count, sum, minimum and maximum of their sketches.
+func sameValue(a, b *domain.Metric) bool {
+	switch a.MType {
+	case domain.Gauge:
+		return a.Value != nil && b.Value != nil && *a.Value == *b.Value
+	case domain.Counter:
+		return a.Delta != nil && b.Delta != nil && *a.Delta == *b.Delta
+	case domain.Histogram:
+		x, y := a.Histogram, b.Histogram
+		return x != nil && y != nil && slices.Equal(x.Bounds, y.Bounds) && slices.Equal(x.Counts, y.Counts) &&
+			x.Sum == y.Sum && x.Count == y.Count
+	case domain.Timer:
+		x, y := a.Sketch, b.Sketch
+		return x != nil && y != nil && x.Count == y.Count && x.Sum == y.Sum && x.Min == y.Min && x.Max == y.Max
+	default:
+		return false
+	}
+}
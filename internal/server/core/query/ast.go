@@ -0,0 +1,143 @@
+// Package query implements a small query language over the stored metrics.
+//
+// A query is an expression such as
+//
+//	sum by (host) (rate(PollCount[5m]))
+//	max_over_time(HeapAlloc[5m]) / 1024
+//	TotalMemory{host="web1"} - FreeMemory{host="web1"}
+//
+// Selectors pick the gauge and counter series of a metric name whose labels match, with an optional
+// range which turns them into their history. Aggregations, functions and arithmetic work on the values
+// the way their Prometheus counterparts do.
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is a node of a parsed query.
+type Expr interface {
+	String() string
+}
+
+// MatchOp is the operator of a label matcher.
+type MatchOp string
+
+const (
+	MatchEqual     MatchOp = "="
+	MatchNotEqual  MatchOp = "!="
+	MatchRegexp    MatchOp = "=~"
+	MatchNotRegexp MatchOp = "!~"
+)
+
+// Matcher matches the value of a label, a missing label having the empty value.
+type Matcher struct {
+	Name  string
+	Op    MatchOp
+	Value string
+	re    *regexp.Regexp
+}
+
+// Matches reports whether the value of the label is matched.
+func (m *Matcher) Matches(value string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	default:
+		return false
+	}
+}
+
+func (m *Matcher) String() string {
+	return m.Name + string(m.Op) + strconv.Quote(m.Value)
+}
+
+// Selector selects the series of a metric name, their history over Range when it is set.
+type Selector struct {
+	Name     string
+	Matchers []*Matcher
+	Range    time.Duration
+}
+
+func (s *Selector) String() string {
+	var b strings.Builder
+	b.WriteString(s.Name)
+	if len(s.Matchers) > 0 {
+		matchers := make([]string, 0, len(s.Matchers))
+		for _, m := range s.Matchers {
+			matchers = append(matchers, m.String())
+		}
+		b.WriteString("{" + strings.Join(matchers, ",") + "}")
+	}
+	if s.Range > 0 {
+		b.WriteString("[" + s.Range.String() + "]")
+	}
+	return b.String()
+}
+
+// Aggregate folds the series of a vector into one per group of the By labels.
+type Aggregate struct {
+	Op   string
+	By   []string
+	Expr Expr
+}
+
+func (a *Aggregate) String() string {
+	if len(a.By) == 0 {
+		return a.Op + "(" + a.Expr.String() + ")"
+	}
+	return a.Op + " by (" + strings.Join(a.By, ", ") + ") (" + a.Expr.String() + ")"
+}
+
+// Call applies a function to the history of the series.
+type Call struct {
+	Func string
+	Arg  Expr
+}
+
+func (c *Call) String() string {
+	return c.Func + "(" + c.Arg.String() + ")"
+}
+
+// Binary is arithmetic between two expressions.
+type Binary struct {
+	Op  string
+	LHS Expr
+	RHS Expr
+}
+
+func (b *Binary) String() string {
+	return "(" + b.LHS.String() + " " + b.Op + " " + b.RHS.String() + ")"
+}
+
+// Number is a literal.
+type Number struct {
+	Value float64
+}
+
+func (n *Number) String() string {
+	return strconv.FormatFloat(n.Value, 'g', -1, 64)
+}
+
+// aggregations are the operators of Aggregate.
+var aggregations = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+
+// functions are the functions of Call, they all take a range selector.
+var functions = map[string]bool{
+	"rate":            true,
+	"increase":        true,
+	"avg_over_time":   true,
+	"min_over_time":   true,
+	"max_over_time":   true,
+	"sum_over_time":   true,
+	"count_over_time": true,
+}
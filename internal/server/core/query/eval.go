@@ -0,0 +1,378 @@
+package query
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+var ErrEvaluation = errors.New("query can't be evaluated")
+
+// selectorPage is how many series an instant selector lists at a time.
+const selectorPage = 1000
+
+// Result types.
+const (
+	TypeScalar = "scalar"
+	TypeVector = "vector"
+)
+
+// Source provides the metrics a query is evaluated on.
+type Source interface {
+	// ListMetrics returns a page of the metrics selected by the filter.
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (*domain.MetricsPage, error)
+
+	// GetHistory returns the gauge and counter series of a metric name sampled between from and to.
+	GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error)
+}
+
+// Element is a series of a vector. Name is dropped by aggregations, functions and arithmetic, which
+// change what the value means.
+type Element struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels"`
+	Value  float64           `json:"value"`
+}
+
+// Result is the value of a query, either a scalar or a vector sorted by name and labels.
+type Result struct {
+	Type   string    `json:"type"`
+	Scalar *float64  `json:"scalar,omitempty"`
+	Vector []Element `json:"vector,omitempty"`
+}
+
+// matrix is the history of the series picked by a range selector.
+type matrix []domain.Series
+
+// operand is a scalar (float64), a vector ([]Element) or a matrix.
+type operand any
+
+// evaluator evaluates an expression at a point in time.
+type evaluator struct {
+	src Source
+	at  time.Time
+}
+
+// Eval evaluates a parsed query. Instant selectors read the current values and range selectors read
+// the history up to at.
+func Eval(ctx context.Context, src Source, expr Expr, at time.Time) (*Result, error) {
+	e := &evaluator{src: src, at: at}
+	v, err := e.eval(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: result %v isn't a finite number", ErrEvaluation, v)
+		}
+		return &Result{Type: TypeScalar, Scalar: &v}, nil
+	case []Element:
+		sortVector(v)
+		return &Result{Type: TypeVector, Vector: v}, nil
+	default:
+		return nil, fmt.Errorf("%w: a range selector must be passed to a function", ErrEvaluation)
+	}
+}
+
+func (e *evaluator) eval(ctx context.Context, expr Expr) (operand, error) {
+	switch expr := expr.(type) {
+	case *Number:
+		return expr.Value, nil
+	case *Selector:
+		if expr.Range > 0 {
+			return e.history(ctx, expr)
+		}
+		return e.current(ctx, expr)
+	case *Call:
+		arg, err := e.eval(ctx, expr.Arg)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := arg.(matrix)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s expects a range selector", ErrEvaluation, expr.Func)
+		}
+		return call(expr.Func, m)
+	case *Aggregate:
+		arg, err := e.eval(ctx, expr.Expr)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := arg.([]Element)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s expects a vector", ErrEvaluation, expr.Op)
+		}
+		return aggregate(expr.Op, expr.By, v), nil
+	case *Binary:
+		lhs, err := e.eval(ctx, expr.LHS)
+		if err != nil {
+			return nil, err
+		}
+		rhs, err := e.eval(ctx, expr.RHS)
+		if err != nil {
+			return nil, err
+		}
+		return binary(expr.Op, lhs, rhs)
+	default:
+		return nil, fmt.Errorf("%w: unknown expression %s", ErrEvaluation, expr)
+	}
+}
+
+// current selects the current values of the gauges and counters matching s, listing the series of its
+// name a page at a time.
+func (e *evaluator) current(ctx context.Context, s *Selector) ([]Element, error) {
+	filter := domain.ListFilter{
+		Types:  []string{domain.Gauge, domain.Counter},
+		Prefix: s.Name,
+		Match:  regexp.MustCompile("^" + regexp.QuoteMeta(s.Name) + "$"),
+		Limit:  selectorPage,
+	}
+	v := make([]Element, 0)
+	for {
+		page, err := e.src.ListMetrics(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("%w", err)
+		}
+		for _, m := range page.Metrics {
+			sample, ok := domain.SampleValue(&m)
+			if !ok {
+				continue
+			}
+			name, labels, err := domain.ParseSeriesID(m.ID)
+			if err != nil || name != s.Name || !matches(s.Matchers, labels) {
+				continue
+			}
+			v = append(v, Element{Name: name, Labels: labels, Value: sample})
+		}
+		if page.Next == "" || len(page.Metrics) == 0 {
+			return v, nil
+		}
+		last := page.Metrics[len(page.Metrics)-1]
+		filter.After = &domain.Key{MType: last.MType, ID: last.ID}
+	}
+}
+
+// history selects the samples of the gauges and counters matching s over its range.
+func (e *evaluator) history(ctx context.Context, s *Selector) (matrix, error) {
+	series, err := e.src.GetHistory(ctx, s.Name, e.at.Add(-s.Range), e.at)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	m := make(matrix, 0, len(series))
+	for _, ser := range series {
+		_, labels, err := domain.ParseSeriesID(ser.ID)
+		if err != nil || !matches(s.Matchers, labels) {
+			continue
+		}
+		m = append(m, ser)
+	}
+	return m, nil
+}
+
+func matches(matchers []*Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// call applies a function to every series, series without enough samples are left out. rate and increase
+// take counters only, since they read a drop as a reset.
+func call(fn string, m matrix) ([]Element, error) {
+	v := make([]Element, 0, len(m))
+	for _, s := range m {
+		samples := s.Samples
+		if (fn == "rate" || fn == "increase") && s.MType != domain.Counter {
+			return nil, fmt.Errorf("%w: %s expects counters, %s is a %s", ErrEvaluation, fn, s.ID, s.MType)
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		var result float64
+		switch fn {
+		case "rate", "increase":
+			if len(samples) < 2 {
+				continue
+			}
+			result = increase(samples)
+			if fn == "rate" {
+				elapsed := samples[len(samples)-1].Time.Sub(samples[0].Time).Seconds()
+				if elapsed <= 0 {
+					continue
+				}
+				result /= elapsed
+			}
+		case "avg_over_time":
+			result = fold(samples, func(acc, v float64) float64 { return acc + v }) / float64(len(samples))
+		case "min_over_time":
+			result = fold(samples, math.Min)
+		case "max_over_time":
+			result = fold(samples, math.Max)
+		case "sum_over_time":
+			result = fold(samples, func(acc, v float64) float64 { return acc + v })
+		case "count_over_time":
+			result = float64(len(samples))
+		}
+		_, labels, _ := domain.ParseSeriesID(s.ID)
+		v = append(v, Element{Labels: labels, Value: result})
+	}
+	return v, nil
+}
+
+// increase sums the growth of a counter, a drop being a reset after which the counter started from zero.
+func increase(samples []domain.Sample) float64 {
+	var total float64
+	for i := 1; i < len(samples); i++ {
+		if d := samples[i].Value - samples[i-1].Value; d >= 0 {
+			total += d
+		} else {
+			total += samples[i].Value
+		}
+	}
+	return total
+}
+
+func fold(samples []domain.Sample, fn func(acc, v float64) float64) float64 {
+	acc := samples[0].Value
+	for _, s := range samples[1:] {
+		acc = fn(acc, s.Value)
+	}
+	return acc
+}
+
+// aggregate folds a vector into one element per distinct value of the by labels.
+func aggregate(op string, by []string, v []Element) []Element {
+	type group struct {
+		labels map[string]string
+		values []float64
+	}
+	groups := make(map[string]*group)
+	keys := make([]string, 0)
+	for _, el := range v {
+		labels := make(map[string]string, len(by))
+		for _, name := range by {
+			if value, found := el.Labels[name]; found {
+				labels[name] = value
+			}
+		}
+		key := signature(labels)
+		g, found := groups[key]
+		if !found {
+			g = &group{labels: labels}
+			groups[key] = g
+			keys = append(keys, key)
+		}
+		g.values = append(g.values, el.Value)
+	}
+	result := make([]Element, 0, len(groups))
+	for _, key := range keys {
+		g := groups[key]
+		var value float64
+		switch op {
+		case "sum", "avg":
+			for _, x := range g.values {
+				value += x
+			}
+			if op == "avg" {
+				value /= float64(len(g.values))
+			}
+		case "min":
+			value = slices.Min(g.values)
+		case "max":
+			value = slices.Max(g.values)
+		case "count":
+			value = float64(len(g.values))
+		}
+		result = append(result, Element{Labels: g.labels, Value: value})
+	}
+	return result
+}
+
+// binary applies an arithmetic operator. Vectors are matched on identical labels, non-finite results
+// such as a division by zero are left out of vectors.
+func binary(op string, lhs, rhs operand) (operand, error) {
+	switch l := lhs.(type) {
+	case float64:
+		switch r := rhs.(type) {
+		case float64:
+			return arithmetic(op, l, r), nil
+		case []Element:
+			return mapVector(r, func(x float64) float64 { return arithmetic(op, l, x) }), nil
+		}
+	case []Element:
+		switch r := rhs.(type) {
+		case float64:
+			return mapVector(l, func(x float64) float64 { return arithmetic(op, x, r) }), nil
+		case []Element:
+			return matchVectors(op, l, r), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s needs scalars or vectors", ErrEvaluation, op)
+}
+
+func mapVector(v []Element, fn func(float64) float64) []Element {
+	result := make([]Element, 0, len(v))
+	for _, el := range v {
+		if x := fn(el.Value); !math.IsNaN(x) && !math.IsInf(x, 0) {
+			result = append(result, Element{Labels: el.Labels, Value: x})
+		}
+	}
+	return result
+}
+
+// matchVectors applies an operator to the elements with the same labels. Label sets are unique on both
+// sides, as a name has a single type and aggregations yield one element per group.
+func matchVectors(op string, lhs, rhs []Element) []Element {
+	index := make(map[string]float64, len(rhs))
+	for _, el := range rhs {
+		index[signature(el.Labels)] = el.Value
+	}
+	result := make([]Element, 0, len(lhs))
+	for _, el := range lhs {
+		r, found := index[signature(el.Labels)]
+		if !found {
+			continue
+		}
+		if x := arithmetic(op, el.Value, r); !math.IsNaN(x) && !math.IsInf(x, 0) {
+			result = append(result, Element{Labels: el.Labels, Value: x})
+		}
+	}
+	return result
+}
+
+func arithmetic(op string, l, r float64) float64 {
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		return l / r
+	default:
+		return math.NaN()
+	}
+}
+
+// signature identifies a label set.
+func signature(labels map[string]string) string {
+	return domain.SeriesID("", labels)
+}
+
+func sortVector(v []Element) {
+	slices.SortFunc(v, func(a, b Element) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(signature(a.Labels), signature(b.Labels)))
+	})
+}
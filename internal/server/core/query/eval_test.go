@@ -0,0 +1,218 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves fixed metrics and history, filtering them like a storage. It counts the pages listed.
+type fakeSource struct {
+	metrics domain.MetricsList
+	history []domain.Series
+	pages   int
+}
+
+func (s *fakeSource) ListMetrics(_ context.Context, filter domain.ListFilter) (*domain.MetricsPage, error) {
+	s.pages++
+	size := filter.Limit
+	filter.Limit++
+	page := &domain.MetricsPage{Metrics: filter.Page(s.metrics)}
+	if len(page.Metrics) > size {
+		page.Metrics = page.Metrics[:size]
+		page.Next = "next"
+	}
+	return page, nil
+}
+
+func (s *fakeSource) GetHistory(_ context.Context, name string, from, to time.Time) ([]domain.Series, error) {
+	result := make([]domain.Series, 0)
+	for _, ser := range s.history {
+		if domain.MetricName(ser.ID) != name {
+			continue
+		}
+		picked := domain.Series{ID: ser.ID, MType: ser.MType}
+		for _, sample := range ser.Samples {
+			if !sample.Time.Before(from) && !sample.Time.After(to) {
+				picked.Samples = append(picked.Samples, sample)
+			}
+		}
+		result = append(result, picked)
+	}
+	return result, nil
+}
+
+var now = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func gauge(id string, v float64) domain.Metric {
+	return domain.Metric{ID: id, MType: domain.Gauge, Value: &v}
+}
+
+func counter(id string, d int64) domain.Metric {
+	return domain.Metric{ID: id, MType: domain.Counter, Delta: &d}
+}
+
+// series builds a history with one sample every minute up to now.
+func series(id, mType string, values ...float64) domain.Series {
+	s := domain.Series{ID: id, MType: mType}
+	for i, v := range values {
+		at := now.Add(time.Duration(i-len(values)+1) * time.Minute)
+		s.Samples = append(s.Samples, domain.Sample{Time: at, Value: v})
+	}
+	return s
+}
+
+func newSource() *fakeSource {
+	return &fakeSource{
+		metrics: domain.MetricsList{
+			counter(`PollCount{host="a",job="agent"}`, 10),
+			counter(`PollCount{host="b",job="agent"}`, 30),
+			counter(`PollCount{host="b",job="batch"}`, 5),
+			gauge(`HeapAlloc{host="a"}`, 100),
+			gauge(`HeapAlloc{host="b"}`, 300),
+			gauge(`TotalMemory{host="a"}`, 1000),
+			gauge(`TotalMemory{host="b"}`, 2000),
+			{ID: "PollCount", MType: domain.Histogram, Histogram: domain.NewHistogram([]float64{1})},
+		},
+		history: []domain.Series{
+			series(`PollCount{host="a"}`, domain.Counter, 0, 60, 120, 180),
+			series(`PollCount{host="b"}`, domain.Counter, 100, 160, 10, 70),
+			series(`HeapAlloc{host="a"}`, domain.Gauge, 5, 50, 20, 10, 30, 40),
+		},
+	}
+}
+
+func eval(t *testing.T, q string) *Result {
+	t.Helper()
+	expr, err := Parse(q)
+	require.NoError(t, err)
+	result, err := Eval(context.Background(), newSource(), expr, now)
+	require.NoError(t, err)
+	return result
+}
+
+func TestEvalSelector(t *testing.T) {
+	result := eval(t, `PollCount{job="agent"}`)
+	assert.Equal(t, TypeVector, result.Type)
+	assert.Equal(t, []Element{
+		{Name: "PollCount", Labels: map[string]string{"host": "a", "job": "agent"}, Value: 10},
+		{Name: "PollCount", Labels: map[string]string{"host": "b", "job": "agent"}, Value: 30},
+	}, result.Vector, "histograms aren't selected")
+
+	result = eval(t, `PollCount{host!="a",job=~"ag.*"}`)
+	require.Len(t, result.Vector, 1)
+	assert.InDelta(t, 30.0, result.Vector[0].Value, 0)
+
+	assert.Empty(t, eval(t, `PollCount{job!~"agent|batch"}`).Vector)
+	assert.Len(t, eval(t, `PollCount{zone=""}`).Vector, 3, "a missing label matches the empty value")
+}
+
+func TestEvalSelectorPages(t *testing.T) {
+	src := &fakeSource{}
+	for i := range 2*selectorPage + 1 {
+		src.metrics = append(src.metrics, gauge(fmt.Sprintf(`load{cpu="%d"}`, i), 1))
+	}
+	src.metrics = append(src.metrics, gauge("loadavg", 1), gauge(`load_{cpu="0"}`, 1))
+	expr, err := Parse("count(load)")
+	require.NoError(t, err)
+
+	result, err := Eval(context.Background(), src, expr, now)
+	require.NoError(t, err)
+	require.Len(t, result.Vector, 1)
+	assert.InDelta(t, float64(2*selectorPage+1), result.Vector[0].Value, 0, "other names sharing the prefix are left out")
+	assert.Equal(t, 3, src.pages)
+}
+
+func TestEvalAggregate(t *testing.T) {
+	result := eval(t, "sum by (host) (PollCount)")
+	assert.Equal(t, []Element{
+		{Labels: map[string]string{"host": "a"}, Value: 10},
+		{Labels: map[string]string{"host": "b"}, Value: 35},
+	}, result.Vector)
+
+	for q, want := range map[string]float64{
+		"sum(PollCount)":   45,
+		"avg(PollCount)":   15,
+		"min(PollCount)":   5,
+		"max(PollCount)":   30,
+		"count(PollCount)": 3,
+	} {
+		result = eval(t, q)
+		require.Len(t, result.Vector, 1, q)
+		assert.InDelta(t, want, result.Vector[0].Value, 1e-9, q)
+		assert.Empty(t, result.Vector[0].Labels, q)
+	}
+}
+
+func TestEvalFunctions(t *testing.T) {
+	result := eval(t, `increase(PollCount[10m])`)
+	assert.Equal(t, []Element{
+		{Labels: map[string]string{"host": "a"}, Value: 180},
+		{Labels: map[string]string{"host": "b"}, Value: 130},
+	}, result.Vector, "a drop is a counter reset")
+
+	result = eval(t, `rate(PollCount{host="a"}[10m])`)
+	require.Len(t, result.Vector, 1)
+	assert.InDelta(t, 1.0, result.Vector[0].Value, 1e-9)
+
+	result = eval(t, `rate(PollCount{host="a"}[1m])`)
+	require.Len(t, result.Vector, 1, "the window includes samples on both bounds")
+	assert.InDelta(t, 1.0, result.Vector[0].Value, 1e-9)
+	assert.Empty(t, eval(t, `rate(PollCount[30s])`).Vector, "a single sample has no rate")
+
+	for q, want := range map[string]float64{
+		"max_over_time(HeapAlloc[5m])":   50,
+		"max_over_time(HeapAlloc[2m])":   40,
+		"min_over_time(HeapAlloc[4m])":   10,
+		"avg_over_time(HeapAlloc[4m])":   30,
+		"sum_over_time(HeapAlloc[4m])":   150,
+		"count_over_time(HeapAlloc[4m])": 5,
+	} {
+		result = eval(t, q)
+		require.Len(t, result.Vector, 1, q)
+		assert.InDelta(t, want, result.Vector[0].Value, 1e-9, q)
+	}
+}
+
+func TestEvalArithmetic(t *testing.T) {
+	result := eval(t, "1 + 2 * 3")
+	assert.Equal(t, TypeScalar, result.Type)
+	assert.InDelta(t, 7.0, *result.Scalar, 0)
+
+	result = eval(t, "HeapAlloc / TotalMemory * 100")
+	assert.Equal(t, []Element{
+		{Labels: map[string]string{"host": "a"}, Value: 10},
+		{Labels: map[string]string{"host": "b"}, Value: 15},
+	}, result.Vector)
+
+	result = eval(t, `sum(PollCount) - sum(PollCount{job="batch"})`)
+	require.Len(t, result.Vector, 1)
+	assert.InDelta(t, 40.0, result.Vector[0].Value, 0)
+
+	assert.Empty(t, eval(t, "HeapAlloc / 0").Vector, "non-finite values are left out")
+}
+
+func TestEvalErrors(t *testing.T) {
+	for _, q := range []string{
+		"PollCount[5m]",
+		"rate(PollCount)",
+		"rate(HeapAlloc[10m])",
+		"increase(HeapAlloc[10m])",
+		"sum(PollCount[5m])",
+		"PollCount[5m] + 1",
+		"1 / 0",
+	} {
+		t.Run(q, func(t *testing.T) {
+			expr, err := Parse(q)
+			require.NoError(t, err)
+			_, err = Eval(context.Background(), newSource(), expr, now)
+			assert.ErrorIs(t, err, ErrEvaluation)
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrSyntax = errors.New("query syntax error")
+
+const (
+	// MaxLength is the length of the longest query parsed, in bytes.
+	MaxLength = 4096
+	// MaxDepth is how deeply parentheses, aggregations, functions and negations may be nested.
+	MaxDepth = 32
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits a query into tokens.
+func lex(q string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(q); {
+		r := rune(q[i])
+		start := i
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+			continue
+		case isIdentStart(r):
+			for i < len(q) && isIdentPart(rune(q[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: q[start:i], pos: start})
+		case r >= '0' && r <= '9' || r == '.':
+			for i < len(q) && (q[i] >= '0' && q[i] <= '9' || q[i] == '.') {
+				i++
+			}
+			kind := tokenNumber
+			if n := exponent(q[i:]); n > 0 {
+				i += n
+			} else if i < len(q) && isIdentStart(rune(q[i])) {
+				// A unit right after the digits makes a duration, which may go on with more digits and
+				// units, e.g. 5m or 1h30m.
+				kind = tokenDuration
+				for i < len(q) && (isIdentStart(rune(q[i])) || q[i] >= '0' && q[i] <= '9') {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind: kind, text: q[start:i], pos: start})
+		case r == '"':
+			quoted, err := strconv.QuotedPrefix(q[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w at %d: unterminated string", ErrSyntax, start)
+			}
+			value, err := strconv.Unquote(quoted)
+			if err != nil {
+				return nil, fmt.Errorf("%w at %d: %w", ErrSyntax, start, err)
+			}
+			i += len(quoted)
+			tokens = append(tokens, token{kind: tokenString, text: value, pos: start})
+		default:
+			op := q[i : i+1]
+			if i+1 < len(q) {
+				if pair := q[i : i+2]; pair == "!=" || pair == "=~" || pair == "!~" {
+					op = pair
+				}
+			}
+			if len(op) == 1 && !strings.Contains("(){}[],=+-*/", op) {
+				return nil, fmt.Errorf("%w at %d: unexpected %q", ErrSyntax, start, op)
+			}
+			i += len(op)
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: start})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(q)}), nil
+}
+
+// exponent returns the length of the exponent s starts with, e.g. e5 or E-3, zero if it doesn't start with one.
+func exponent(s string) int {
+	if len(s) < 2 || s[0] != 'e' && s[0] != 'E' {
+		return 0
+	}
+	i := 1
+	if s[i] == '+' || s[i] == '-' {
+		i++
+	}
+	digits := i
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	if i == digits {
+		return 0
+	}
+	return i
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || r >= '0' && r <= '9' || r == '.' || r == ':'
+}
+
+// parser is a recursive descent parser over the tokens of a query:
+//
+//	expr       = term { ("+" | "-") term }
+//	term       = unary { ("*" | "/") unary }
+//	unary      = "-" unary | primary
+//	primary    = number | "(" expr ")" | aggregate | call | selector
+//	aggregate  = op [ "by" labels ] "(" expr ")" [ "by" labels ]
+//	call       = func "(" expr ")"
+//	selector   = name [ "{" [ matcher { "," matcher } ] "}" ] [ "[" duration "]" ]
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// Parse parses a query of up to MaxLength bytes nested up to MaxDepth levels.
+func Parse(q string) (Expr, error) {
+	if len(q) > MaxLength {
+		return nil, fmt.Errorf("%w: query is longer than %d bytes", ErrSyntax, MaxLength)
+	}
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is the given operator.
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokenOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return p.errorf(t, "expected %q, got %q", op, t.text)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("%w at %d: %s", ErrSyntax, t.pos, fmt.Sprintf(format, args...))
+}
+
+// nest enters a nested expression, failing past MaxDepth. The caller leaves it by decrementing depth.
+func (p *parser) nest() error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return p.errorf(p.peek(), "expression nested deeper than %d", MaxDepth)
+	}
+	return nil
+}
+
+func (p *parser) expr() (Expr, error) {
+	if err := p.nest(); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+	lhs, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if !p.accept("+") && !p.accept("-") {
+			return lhs, nil
+		}
+		rhs, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) term() (Expr, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek().text
+		if !p.accept("*") && !p.accept("/") {
+			return lhs, nil
+		}
+		rhs, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &Binary{Op: op, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) unary() (Expr, error) {
+	if p.accept("-") {
+		if err := p.nest(); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := expr.(*Number); ok {
+			return &Number{Value: -n.Value}, nil
+		}
+		return &Binary{Op: "*", LHS: &Number{Value: -1}, RHS: expr}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokenNumber:
+		p.next()
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "bad number %q", t.text)
+		}
+		return &Number{Value: v}, nil
+	case p.accept("("):
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	case t.kind == tokenIdent:
+		p.next()
+		// A keyword not followed by its arguments is a metric of the same name.
+		following := p.peek()
+		isOp := following.kind == tokenOp && following.text == "("
+		if aggregations[t.text] && (isOp || following.kind == tokenIdent && following.text == "by") {
+			return p.aggregate(t.text)
+		}
+		if functions[t.text] && isOp {
+			return p.call(t.text)
+		}
+		return p.selector(t.text)
+	default:
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+}
+
+func (p *parser) aggregate(op string) (Expr, error) {
+	a := &Aggregate{Op: op}
+	var err error
+	if a.By, err = p.by(); err != nil {
+		return nil, err
+	}
+	if err = p.expect("("); err != nil {
+		return nil, err
+	}
+	if a.Expr, err = p.expr(); err != nil {
+		return nil, err
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	if a.By == nil {
+		if a.By, err = p.by(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// by parses an optional "by (label, ...)" clause.
+func (p *parser) by() ([]string, error) {
+	if t := p.peek(); t.kind != tokenIdent || t.text != "by" {
+		return nil, nil
+	}
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	labels := make([]string, 0)
+	for !p.accept(")") {
+		if len(labels) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, p.errorf(t, "expected a label name, got %q", t.text)
+		}
+		labels = append(labels, t.text)
+	}
+	return labels, nil
+}
+
+func (p *parser) call(name string) (Expr, error) {
+	p.next()
+	arg, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	return &Call{Func: name, Arg: arg}, nil
+}
+
+func (p *parser) selector(name string) (Expr, error) {
+	s := &Selector{Name: name}
+	if p.accept("{") {
+		for !p.accept("}") {
+			if len(s.Matchers) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			m, err := p.matcher()
+			if err != nil {
+				return nil, err
+			}
+			s.Matchers = append(s.Matchers, m)
+		}
+	}
+	if p.accept("[") {
+		t := p.next()
+		if t.kind != tokenDuration {
+			return nil, p.errorf(t, "expected a duration, got %q", t.text)
+		}
+		d, err := parseDuration(t.text)
+		if err != nil || d <= 0 {
+			return nil, p.errorf(t, "bad duration %q", t.text)
+		}
+		s.Range = d
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) matcher() (*Matcher, error) {
+	name := p.next()
+	if name.kind != tokenIdent {
+		return nil, p.errorf(name, "expected a label name, got %q", name.text)
+	}
+	op := p.next()
+	switch MatchOp(op.text) {
+	case MatchEqual, MatchNotEqual, MatchRegexp, MatchNotRegexp:
+	default:
+		return nil, p.errorf(op, "expected a match operator, got %q", op.text)
+	}
+	value := p.next()
+	if value.kind != tokenString {
+		return nil, p.errorf(value, "expected a string, got %q", value.text)
+	}
+	m := &Matcher{Name: name.text, Op: MatchOp(op.text), Value: value.text}
+	if m.Op == MatchRegexp || m.Op == MatchNotRegexp {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, p.errorf(value, "bad regexp: %v", err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// parseDuration parses a duration such as 30s, 5m or 1h30m, d standing for days as in 1d12h.
+func parseDuration(s string) (time.Duration, error) {
+	var days time.Duration
+	if n, rest, found := strings.Cut(s, "d"); found {
+		count, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("%w", err)
+		}
+		days = time.Duration(count) * 24 * time.Hour
+		if rest == "" {
+			return days, nil
+		}
+		s = rest
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	return days + d, nil
+}
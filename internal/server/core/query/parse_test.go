@@ -0,0 +1,86 @@
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "PollCount", want: "PollCount"},
+		{query: `HeapAlloc{host="a", job=~"agent.*"}`, want: `HeapAlloc{host="a",job=~"agent.*"}`},
+		{query: "sum by (host) (rate(PollCount[5m]))", want: "sum by (host) (rate(PollCount[5m0s]))"},
+		{query: "sum(PollCount) by (host, job)", want: "sum by (host, job) (PollCount)"},
+		{query: "max_over_time(HeapAlloc[1d])", want: "max_over_time(HeapAlloc[24h0m0s])"},
+		{query: "1 + 2 * 3", want: "(1 + (2 * 3))"},
+		{query: "(1 + 2) * -3", want: "((1 + 2) * -3)"},
+		{query: "TotalMemory - FreeMemory / 1024", want: "(TotalMemory - (FreeMemory / 1024))"},
+		{query: "-Alloc", want: "(-1 * Alloc)"},
+		{query: "sum", want: "sum"},
+		{query: "rate + 1", want: "(rate + 1)"},
+		{query: "http.requests:total{}", want: "http.requests:total"},
+		{query: "HeapAlloc / 1e6", want: "(HeapAlloc / 1e+06)"},
+		{query: "2.5E-3 + 1e+2", want: "(0.0025 + 100)"},
+		{query: "avg_over_time(HeapAlloc[1h30m])", want: "avg_over_time(HeapAlloc[1h30m0s])"},
+		{query: "avg_over_time(HeapAlloc[1d12h])", want: "avg_over_time(HeapAlloc[36h0m0s])"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := Parse(tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr.String())
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"PollCount)",
+		"sum(PollCount",
+		`PollCount{host}`,
+		`PollCount{host=a}`,
+		`PollCount{host=~"("}`,
+		`PollCount{host="a"`,
+		"PollCount[5]",
+		"PollCount[5x]",
+		"PollCount[1h30x]",
+		"PollCount[1e5]",
+		"1e",
+		"PollCount[0s]",
+		"sum by host (PollCount)",
+		"1 % 2",
+		`"unterminated`,
+		"1 +",
+	} {
+		t.Run(q, func(t *testing.T) {
+			_, err := Parse(q)
+			assert.ErrorIs(t, err, ErrSyntax)
+		})
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth)
+	}
+	_, err := Parse(nested(MaxDepth - 1))
+	require.NoError(t, err)
+	_, err = Parse(nested(MaxDepth))
+	require.ErrorIs(t, err, ErrSyntax)
+	_, err = Parse(strings.Repeat("-", MaxDepth-1) + "1")
+	require.NoError(t, err)
+	_, err = Parse(strings.Repeat("-", MaxDepth) + "1")
+	require.ErrorIs(t, err, ErrSyntax)
+
+	_, err = Parse("1" + strings.Repeat("+1", (MaxLength-1)/2))
+	require.NoError(t, err)
+	_, err = Parse("1" + strings.Repeat("+1", MaxLength/2))
+	require.ErrorIs(t, err, ErrSyntax)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/shared-kernel/agentinfo"
+)
+
+const (
+	// DefaultReportInterval is assumed for agents which don't tell their report interval, it is the
+	// default of the agent.
+	DefaultReportInterval = 10 * time.Second
+
+	// DefaultMissedReports is how many report intervals an agent may miss before it is down.
+	DefaultMissedReports = 3
+)
+
+// throughputWindow is the window of the metrics per minute of agents.
+const throughputWindow = time.Minute
+
+// agentReport is a batch of metrics received from an agent.
+type agentReport struct {
+	at      time.Time
+	metrics int
+}
+
+type agentState struct {
+	agent   domain.Agent
+	reports []agentReport // within the throughput window
+	down    bool          // state as of the last check
+}
+
+// inventory keeps the agents seen writing metrics through the service.
+type inventory struct {
+	mux    *sync.Mutex
+	missed int
+	agents map[string]*agentState
+}
+
+func newInventory(missed int) *inventory {
+	return &inventory{mux: &sync.Mutex{}, missed: missed, agents: make(map[string]*agentState)}
+}
+
+// record notes that an agent reported a number of metrics at the given time.
+func (inv *inventory) record(at time.Time, id domain.AgentIdentity, metrics int) {
+	key := id.ID()
+	if key == "" {
+		return
+	}
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+	state, found := inv.agents[key]
+	if !found {
+		state = &agentState{agent: domain.Agent{ID: key, FirstSeen: at}}
+		inv.agents[key] = state
+	}
+	state.agent.Address = id.Address
+	state.agent.Hostname = id.Hostname
+	state.agent.Version = id.Version
+	state.agent.Config = id.Config
+	state.agent.LastSeen = at
+	state.reports = append(prune(state.reports, at), agentReport{at: at, metrics: metrics})
+}
+
+// list returns the agents as of now sorted by ID.
+func (inv *inventory) list(now time.Time) []domain.Agent {
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+	agents := make([]domain.Agent, 0, len(inv.agents))
+	for _, key := range slices.Sorted(maps.Keys(inv.agents)) {
+		agents = append(agents, inv.snapshot(inv.agents[key], now))
+	}
+	return agents
+}
+
+// check returns the agents which went down or came back since the previous check.
+func (inv *inventory) check(now time.Time) []domain.Agent {
+	inv.mux.Lock()
+	defer inv.mux.Unlock()
+	changed := make([]domain.Agent, 0)
+	for _, state := range inv.agents {
+		agent := inv.snapshot(state, now)
+		if agent.Down != state.down {
+			state.down = agent.Down
+			changed = append(changed, agent)
+		}
+	}
+	slices.SortFunc(changed, func(a, b domain.Agent) int { return cmp.Compare(a.ID, b.ID) })
+	return changed
+}
+
+// snapshot copies the agent of a state with its throughput and whether it is down as of now.
+func (inv *inventory) snapshot(state *agentState, now time.Time) domain.Agent {
+	agent := state.agent
+	agent.Config = maps.Clone(state.agent.Config)
+	for _, r := range prune(state.reports, now) {
+		agent.MetricsPerMinute += r.metrics
+	}
+	interval := cmp.Or(agentinfo.Interval(agent.Config), DefaultReportInterval)
+	agent.Down = now.Sub(agent.LastSeen) > time.Duration(inv.missed)*interval
+	return agent
+}
+
+// prune drops the reports out of the throughput window.
+func prune(reports []agentReport, now time.Time) []agentReport {
+	first := 0
+	for first < len(reports) && now.Sub(reports[first].at) >= throughputWindow {
+		first++
+	}
+	return reports[first:]
+}
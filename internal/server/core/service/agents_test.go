@@ -0,0 +1,64 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInventory(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	inv := newInventory(3)
+	web1 := domain.AgentIdentity{
+		Address:  "10.0.0.1",
+		Hostname: "web1",
+		Version:  "1.2.0",
+		Config:   map[string]string{"report_interval": "20"},
+	}
+	inv.record(at, web1, 5)
+	inv.record(at.Add(30*time.Second), web1, 5)
+	inv.record(at.Add(40*time.Second), domain.AgentIdentity{Address: "10.0.0.2"}, 7)
+	inv.record(at, domain.AgentIdentity{}, 1)
+
+	agents := inv.list(at.Add(50 * time.Second))
+	require.Len(t, agents, 2)
+	assert.Equal(t, domain.Agent{
+		ID:               "10.0.0.2",
+		Address:          "10.0.0.2",
+		FirstSeen:        at.Add(40 * time.Second),
+		LastSeen:         at.Add(40 * time.Second),
+		MetricsPerMinute: 7,
+	}, agents[0], "agents without a hostname are known by their address")
+	assert.Equal(t, domain.Agent{
+		ID:               "web1",
+		Address:          "10.0.0.1",
+		Hostname:         "web1",
+		Version:          "1.2.0",
+		Config:           map[string]string{"report_interval": "20"},
+		FirstSeen:        at,
+		LastSeen:         at.Add(30 * time.Second),
+		MetricsPerMinute: 10,
+	}, agents[1])
+
+	// web1 reports every 20s and may miss 3 reports, the other agent every 10s by default.
+	assert.Empty(t, inv.check(at.Add(70*time.Second)))
+	changed := inv.check(at.Add(71 * time.Second))
+	require.Len(t, changed, 1)
+	assert.Equal(t, "10.0.0.2", changed[0].ID)
+	assert.True(t, changed[0].Down)
+	assert.Empty(t, inv.check(at.Add(72*time.Second)), "a change is reported once")
+
+	changed = inv.check(at.Add(91 * time.Second))
+	require.Len(t, changed, 1)
+	assert.Equal(t, "web1", changed[0].ID)
+	assert.Equal(t, 5, inv.list(at.Add(61 * time.Second))[1].MetricsPerMinute, "only the last minute is counted")
+
+	inv.record(at.Add(100*time.Second), web1, 1)
+	changed = inv.check(at.Add(100 * time.Second))
+	require.Len(t, changed, 1)
+	assert.False(t, changed[0].Down, "the agent is back")
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/files"
+	"metrics/internal/server/core/query"
+)
+
+// alertRules keeps the alert rules by name, saved to a file when one is set so that they outlive restarts.
+type alertRules struct {
+	mux   *sync.Mutex
+	path  string
+	rules map[string]domain.AlertRule
+}
+
+func newAlertRules() *alertRules {
+	return &alertRules{mux: &sync.Mutex{}, rules: make(map[string]domain.AlertRule)}
+}
+
+// load reads the rules of the file, which holds none until a rule is set.
+func (a *alertRules) load() error {
+	if a.path == "" {
+		return nil
+	}
+	list, err := files.LoadAlertRulesFromFile(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to load alert rules: %w", err)
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for _, rule := range list {
+		if err = validateAlertRule(&rule); err != nil {
+			return err
+		}
+		a.rules[rule.Name] = rule
+	}
+	return nil
+}
+
+// update applies a change to a copy of the rules, which replaces them once it is saved to the file.
+func (a *alertRules) update(change func(rules map[string]domain.AlertRule) error) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	staged := maps.Clone(a.rules)
+	if err := change(staged); err != nil {
+		return err
+	}
+	if a.path != "" {
+		if err := files.SaveAlertRulesToFile(a.path, sortedRules(staged)); err != nil {
+			return fmt.Errorf("failed to save alert rules: %w", err)
+		}
+	}
+	a.rules = staged
+	return nil
+}
+
+func (a *alertRules) all() []domain.AlertRule {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return sortedRules(a.rules)
+}
+
+func sortedRules(rules map[string]domain.AlertRule) []domain.AlertRule {
+	list := slices.Collect(maps.Values(rules))
+	slices.SortFunc(list, func(a, b domain.AlertRule) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list
+}
+
+// validateAlertRule checks a rule, its query included.
+func validateAlertRule(rule *domain.AlertRule) error {
+	if err := domain.ValidateAlertRule(rule); err != nil {
+		return err
+	}
+	if _, err := query.Parse(rule.Query); err != nil {
+		return fmt.Errorf("%w: %s: %w", domain.ErrIncorrectAlertRule, rule.Name, err)
+	}
+	return nil
+}
+
+// SetAlertRule creates an alert rule or replaces the one of the same name.
+func (ms *MetricService) SetAlertRule(_ context.Context, rule domain.AlertRule) error {
+	if err := validateAlertRule(&rule); err != nil {
+		return err
+	}
+	return ms.alerts.update(func(rules map[string]domain.AlertRule) error {
+		rules[rule.Name] = rule
+		return nil
+	})
+}
+
+// DeleteAlertRule removes an alert rule.
+func (ms *MetricService) DeleteAlertRule(_ context.Context, name string) error {
+	return ms.alerts.update(func(rules map[string]domain.AlertRule) error {
+		if _, found := rules[name]; !found {
+			return fmt.Errorf("%w: alert rule %s", domain.ErrItemNotFound, name)
+		}
+		delete(rules, name)
+		return nil
+	})
+}
+
+// Alerts evaluates every alert rule, sorted by name. A rule whose query can't be evaluated against the
+// stored metrics gets the reason as its error rather than failing the others.
+func (ms *MetricService) Alerts(ctx context.Context) ([]domain.Alert, error) {
+	rules := ms.alerts.all()
+	alerts := make([]domain.Alert, 0, len(rules))
+	for _, rule := range rules {
+		alert := domain.Alert{AlertRule: rule, Firing: make([]domain.AlertSeries, 0), EvaluatedAt: time.Now()}
+		result, err := ms.Query(ctx, rule.Query)
+		switch {
+		case errors.Is(err, query.ErrEvaluation):
+			alert.Error = err.Error()
+		case err != nil:
+			return nil, fmt.Errorf("failed to evaluate alert rule %s: %w", rule.Name, err)
+		case result.Scalar != nil:
+			if rule.Fires(*result.Scalar) {
+				alert.Firing = append(alert.Firing, domain.AlertSeries{Value: *result.Scalar})
+			}
+		default:
+			for _, e := range result.Vector {
+				if rule.Fires(e.Value) {
+					alert.Firing = append(alert.Firing, domain.AlertSeries{Name: e.Name, Labels: e.Labels, Value: e.Value})
+				}
+			}
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/core/domain"
+)
+
+func TestMetricService_Alerts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "alerts.json")
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("", memoryStorage, WithAlertRules(path))
+	require.NoError(t, err)
+	for _, req := range []domain.SetMetricRequest{
+		{MType: domain.Gauge, ID: `load{host="a"}`, Value: "3"},
+		{MType: domain.Gauge, ID: `load{host="b"}`, Value: "1"},
+	} {
+		_, err = s.SetMetricValue(ctx, &req)
+		require.NoError(t, err)
+	}
+
+	for _, rule := range []domain.AlertRule{
+		{Name: "high-load", Query: "load", Op: domain.OpGreater, Threshold: 2},
+		{Name: "total-load", Query: "sum(load)", Op: domain.OpGreaterEqual, Threshold: 10},
+		{Name: "range", Query: "load[1m]", Op: domain.OpGreater},
+	} {
+		require.NoError(t, s.SetAlertRule(ctx, rule))
+	}
+	require.ErrorIs(t, s.SetAlertRule(ctx, domain.AlertRule{Name: "bad", Query: "sum(", Op: domain.OpLess}),
+		domain.ErrIncorrectAlertRule)
+
+	alerts, err := s.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 3)
+	assert.Equal(t, "high-load", alerts[0].Name)
+	assert.Equal(t, []domain.AlertSeries{{Name: "load", Labels: map[string]string{"host": "a"}, Value: 3}},
+		alerts[0].Firing)
+	assert.Equal(t, "range", alerts[1].Name)
+	assert.NotEmpty(t, alerts[1].Error, "a query which can't be evaluated doesn't fail the others")
+	assert.Equal(t, "total-load", alerts[2].Name)
+	assert.Empty(t, alerts[2].Firing)
+	assert.Empty(t, alerts[2].Error)
+
+	require.NoError(t, s.DeleteAlertRule(ctx, "range"))
+	require.ErrorIs(t, s.DeleteAlertRule(ctx, "range"), domain.ErrItemNotFound)
+
+	// The rules outlive a restart.
+	s, err = NewMetricService("", memoryStorage, WithAlertRules(path))
+	require.NoError(t, err)
+	alerts, err = s.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "high-load", alerts[0].Name)
+	assert.Equal(t, "total-load", alerts[1].Name)
+}
+
+func TestMetricService_AlertsInMemory(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("", memoryStorage)
+	require.NoError(t, err)
+	require.NoError(t, s.SetAlertRule(ctx, domain.AlertRule{Name: "up", Query: "1", Op: domain.OpEqual, Threshold: 1}))
+
+	alerts, err := s.Alerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, []domain.AlertSeries{{Value: 1}}, alerts[0].Firing, "a scalar fires without labels")
+}
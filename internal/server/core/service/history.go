@@ -0,0 +1,110 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+// DefaultHistoryWindow is how long samples are kept in memory when the storage keeps no history.
+const DefaultHistoryWindow = time.Hour
+
+// HistoryStorage is implemented by storages that keep the history of metrics.
+type HistoryStorage interface {
+	// GetHistory returns the gauge and counter series of a metric name sampled between from and to.
+	GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error)
+}
+
+// recorder keeps the recent samples of gauges and counters written through the service, standing in
+// for the history of storages which keep only the latest values. The samples out of the window are swept
+// from all series every tenth of the window and on reads, so that the series no longer written, such as
+// those of labels seen once, don't outlive it.
+type recorder struct {
+	mux    *sync.Mutex
+	window time.Duration
+	swept  time.Time
+	series map[domain.Key][]domain.Sample
+}
+
+func newRecorder(window time.Duration) *recorder {
+	return &recorder{mux: &sync.Mutex{}, window: window, series: make(map[domain.Key][]domain.Sample)}
+}
+
+// record appends the stored values of metrics and drops the samples of their series out of the window.
+func (r *recorder) record(at time.Time, metrics ...domain.Metric) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, m := range metrics {
+		v, ok := domain.SampleValue(&m)
+		if !ok {
+			continue
+		}
+		key := domain.Key{MType: m.MType, ID: m.ID}
+		r.series[key] = append(r.expire(r.series[key], at), domain.Sample{Time: at, Value: v})
+	}
+	if at.Sub(r.swept) >= r.window/10 {
+		r.sweep(at)
+	}
+}
+
+// sweep drops the samples out of the window as of now from all series, and the series left empty.
+func (r *recorder) sweep(now time.Time) {
+	for key, samples := range r.series {
+		if samples = r.expire(samples, now); len(samples) == 0 {
+			delete(r.series, key)
+		} else {
+			r.series[key] = samples
+		}
+	}
+	r.swept = now
+}
+
+// expire returns the samples within the window as of now.
+func (r *recorder) expire(samples []domain.Sample, now time.Time) []domain.Sample {
+	first := 0
+	for first < len(samples) && now.Sub(samples[first].Time) > r.window {
+		first++
+	}
+	return samples[first:]
+}
+
+// forget drops the samples of the series whose key is matched.
+func (r *recorder) forget(match func(key domain.Key) bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for key := range r.series {
+		if match(key) {
+			delete(r.series, key)
+		}
+	}
+}
+
+// history returns the recorded series of a metric name sampled between from and to.
+func (r *recorder) history(name string, from, to time.Time) []domain.Series {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.sweep(time.Now())
+	result := make([]domain.Series, 0)
+	for key, samples := range r.series {
+		if domain.MetricName(key.ID) != name {
+			continue
+		}
+		s := domain.Series{ID: key.ID, MType: key.MType}
+		for _, sample := range samples {
+			if !sample.Time.Before(from) && !sample.Time.After(to) {
+				s.Samples = append(s.Samples, sample)
+			}
+		}
+		if len(s.Samples) > 0 {
+			result = append(result, s)
+		}
+	}
+	slices.SortFunc(result, func(a, b domain.Series) int {
+		return cmp.Or(cmp.Compare(a.ID, b.ID), cmp.Compare(a.MType, b.MType))
+	})
+	return result
+}
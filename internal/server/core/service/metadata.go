@@ -0,0 +1,132 @@
+package service
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+
+	"metrics/internal/server/core/domain"
+)
+
+// registry holds the metadata of metric names. A name gets its type registered the first time it is
+// written, so it can't be written with another type later on, until no series of the name is left.
+type registry struct {
+	mux      *sync.RWMutex
+	metadata map[string]domain.Metadata
+}
+
+func newRegistry() *registry {
+	return &registry{mux: &sync.RWMutex{}, metadata: make(map[string]domain.Metadata)}
+}
+
+// register merges metadata into the registry, all or nothing. Empty fields keep the registered values.
+func (r *registry) register(list []domain.Metadata) error {
+	_, err := r.claim(list)
+	return err
+}
+
+// claim merges metadata into the registry like register and returns the names it registered a type for.
+func (r *registry) claim(list []domain.Metadata) ([]string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	staged := make(map[string]domain.Metadata, len(list))
+	for _, md := range list {
+		if err := domain.ValidateMetadata(&md); err != nil {
+			return nil, err
+		}
+		current, found := staged[md.Name]
+		if !found {
+			current = r.metadata[md.Name]
+		}
+		if md.Type != "" && current.Type != "" && md.Type != current.Type {
+			return nil, fmt.Errorf("%w: %s is registered as %s", domain.ErrTypeConflict, md.Name, current.Type)
+		}
+		staged[md.Name] = domain.Metadata{
+			Name:        md.Name,
+			Type:        cmp.Or(md.Type, current.Type),
+			Unit:        cmp.Or(md.Unit, current.Unit),
+			Description: cmp.Or(md.Description, current.Description),
+		}
+	}
+	var claimed []string
+	for name, md := range staged {
+		if md.Type != "" && r.metadata[name].Type == "" {
+			claimed = append(claimed, name)
+		}
+		r.metadata[name] = md
+	}
+	return claimed, nil
+}
+
+// check registers the types of metrics, failing if any of them conflicts with a registered type. It returns
+// the names whose type it registered, to be released if the metrics can't be stored.
+func (r *registry) check(metrics ...domain.Metric) ([]string, error) {
+	list := make([]domain.Metadata, 0, len(metrics))
+	for _, m := range metrics {
+		list = append(list, domain.Metadata{Name: domain.MetricName(m.ID), Type: m.MType})
+	}
+	return r.claim(list)
+}
+
+// load registers the types of stored metrics. A name stored with several types, written before types were
+// registered, keeps the first one.
+func (r *registry) load(metrics domain.MetricsList) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, m := range metrics {
+		name := domain.MetricName(m.ID)
+		md := r.metadata[name]
+		if md.Type == "" {
+			r.metadata[name] = domain.Metadata{Name: name, Type: m.MType, Unit: md.Unit, Description: md.Description}
+		}
+	}
+}
+
+// release drops the registered type of a name, its unit and description being kept.
+func (r *registry) release(name string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	md, found := r.metadata[name]
+	if !found {
+		return
+	}
+	if md.Unit == "" && md.Description == "" {
+		delete(r.metadata, name)
+		return
+	}
+	md.Type = ""
+	r.metadata[name] = md
+}
+
+// typed returns the names with a registered type.
+func (r *registry) typed() []string {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	names := make([]string, 0, len(r.metadata))
+	for name, md := range r.metadata {
+		if md.Type != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (r *registry) lookup(name string) (domain.Metadata, bool) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	md, found := r.metadata[name]
+	return md, found
+}
+
+// all returns the registered metadata sorted by name.
+func (r *registry) all() []domain.Metadata {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	list := make([]domain.Metadata, 0, len(r.metadata))
+	for _, md := range r.metadata {
+		list = append(list, md)
+	}
+	slices.SortFunc(list, func(a, b domain.Metadata) int { return cmp.Compare(a.Name, b.Name) })
+	return list
+}
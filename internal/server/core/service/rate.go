@@ -0,0 +1,120 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"metrics/internal/server/core/domain"
+)
+
+// DefaultRateInterval is the shortest interval the rate of a counter is taken over.
+const DefaultRateInterval = 10 * time.Second
+
+// totalAt is a total of a counter and the time it was written at.
+type totalAt struct {
+	total int64
+	at    time.Time
+}
+
+// counterState holds the writes of a counter the rate is taken over, oldest first, the first being the latest
+// write at least the rate interval before the last one, and the rate taken over them.
+type counterState struct {
+	writes []totalAt
+	rate   *domain.CounterRate
+}
+
+// rates tracks the totals of counters written through the service to derive their per-second rates. A rate
+// is taken over at least the interval, so that batches written a moment apart, by different agents for
+// instance, don't make it spike.
+type rates struct {
+	mux      *sync.Mutex
+	interval time.Duration
+	series   map[string]*counterState
+}
+
+func newRates(interval time.Duration) *rates {
+	return &rates{mux: &sync.Mutex{}, interval: interval, series: make(map[string]*counterState)}
+}
+
+// seed takes the stored totals of counters as their first writes, at the time they were last written, so
+// that the rates are known again after a restart once the counters are written once more. The counters
+// already tracked and those without a write time are left out.
+func (r *rates) seed(metrics []domain.Metric) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, m := range metrics {
+		if m.MType != domain.Counter || m.Delta == nil || m.Updated == nil {
+			continue
+		}
+		if _, found := r.series[m.ID]; !found {
+			r.series[m.ID] = &counterState{writes: []totalAt{{total: *m.Delta, at: *m.Updated}}}
+		}
+	}
+}
+
+// record takes the stored totals of counters written at the given time.
+func (r *rates) record(at time.Time, metrics ...domain.Metric) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, m := range metrics {
+		if m.MType != domain.Counter || m.Delta == nil {
+			continue
+		}
+		s, found := r.series[m.ID]
+		if !found {
+			r.series[m.ID] = &counterState{writes: []totalAt{{total: *m.Delta, at: at}}}
+			continue
+		}
+		// A batch may carry a series several times, its stored total is the same for all of them.
+		if !at.After(s.writes[len(s.writes)-1].at) {
+			continue
+		}
+		s.writes = append(s.writes, totalAt{total: *m.Delta, at: at})
+		for len(s.writes) > 2 && at.Sub(s.writes[1].at) >= r.interval {
+			s.writes = s.writes[1:]
+		}
+		if at.Sub(s.writes[0].at) >= r.interval {
+			rate := rateOver(s.writes)
+			s.rate = &rate
+		}
+	}
+}
+
+// rateOver returns the change of a counter over its writes, summing the changes between each of them so
+// that a reset in between doesn't lose what the counter grew before it.
+func rateOver(writes []totalAt) domain.CounterRate {
+	first, last := writes[0], writes[len(writes)-1]
+	var delta int64
+	for i := 1; i < len(writes); i++ {
+		delta += domain.NextRate(writes[i-1].total, writes[i-1].at, writes[i].total, writes[i].at).Delta
+	}
+	interval := last.at.Sub(first.at)
+	return domain.CounterRate{Delta: delta, Rate: float64(delta) / interval.Seconds(), Interval: interval}
+}
+
+// forget drops the counter series whose ID is matched, so that a new series with the same ID starts over.
+func (r *rates) forget(match func(id string) bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for id := range r.series {
+		if match(id) {
+			delete(r.series, id)
+		}
+	}
+}
+
+// get returns the rate of a counter series as of now, nil until it has been written over the rate interval.
+// A counter no longer written for twice the interval its rate was taken over has stopped changing, so its
+// rate is zero since its last write.
+func (r *rates) get(id string, now time.Time) *domain.CounterRate {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	s, found := r.series[id]
+	if !found || s.rate == nil {
+		return nil
+	}
+	if idle := now.Sub(s.writes[len(s.writes)-1].at); idle > 2*s.rate.Interval {
+		return &domain.CounterRate{Interval: idle}
+	}
+	return s.rate
+}
@@ -3,10 +3,19 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"metrics/internal/server/core/domain"
 	"metrics/internal/server/core/files"
+	"metrics/internal/server/core/query"
+	"metrics/internal/server/core/stream"
+	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // MetricStorage defines the interface for metric storage operations.
@@ -23,6 +32,21 @@ type MetricStorage interface {
 	// GetAllMetrics retrieves all stored metrics.
 	GetAllMetrics(ctx context.Context) (domain.MetricsList, error)
 
+	// ListMetrics returns a page of the metrics selected by the filter.
+	ListMetrics(ctx context.Context, filter domain.ListFilter) (domain.MetricsList, error)
+
+	// DeleteMetric removes a series.
+	DeleteMetric(ctx context.Context, mType, mName string) error
+
+	// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were.
+	DeleteByPrefix(ctx context.Context, prefix string) (int, error)
+
+	// ResetCounter sets the total of a counter to zero.
+	ResetCounter(ctx context.Context, mName string) (*domain.Metric, error)
+
+	// DeleteStale removes the series not written since before and returns their keys.
+	DeleteStale(ctx context.Context, before time.Time) ([]domain.Key, error)
+
 	// Ping checks the health of the storage system.
 	Ping(ctx context.Context) error
 }
@@ -31,14 +55,110 @@ type MetricStorage interface {
 type MetricService struct {
 	storage  MetricStorage
 	filepath string
+	buckets  []float64
+	registry *registry
+	window   time.Duration
+	recorder *recorder
+	rates    *rates
+	interval time.Duration
+	buffer   int
+	hub      *stream.Hub
+	// staleAfter is how long a series may go unwritten before it is marked stale and evictAfter before it
+	// is removed, zero disabling either.
+	staleAfter time.Duration
+	evictAfter time.Duration
+	missed     int
+	agents     *inventory
+	alerts     *alertRules
+}
+
+// Option configures a MetricService.
+type Option func(ms *MetricService)
+
+// WithHistogramBuckets sets the bucket bounds of histograms built from single observations.
+func WithHistogramBuckets(bounds []float64) Option {
+	return func(ms *MetricService) {
+		ms.buckets = bounds
+	}
+}
+
+// WithHistoryWindow sets how long samples are kept in memory when the storage keeps no history.
+func WithHistoryWindow(window time.Duration) Option {
+	return func(ms *MetricService) {
+		ms.window = window
+	}
+}
+
+// WithRateInterval sets the shortest interval the rate of a counter is taken over.
+func WithRateInterval(interval time.Duration) Option {
+	return func(ms *MetricService) {
+		ms.interval = interval
+	}
+}
+
+// WithStreamBuffer sets how many updates a stream subscriber may lag behind before it is evicted.
+func WithStreamBuffer(buffer int) Option {
+	return func(ms *MetricService) {
+		ms.buffer = buffer
+	}
+}
+
+// WithStaleness sets how long a series may go unwritten before it is marked stale and before it is
+// evicted, zero disabling either.
+func WithStaleness(staleAfter, evictAfter time.Duration) Option {
+	return func(ms *MetricService) {
+		ms.staleAfter = staleAfter
+		ms.evictAfter = evictAfter
+	}
+}
+
+// WithMissedReports sets how many report intervals an agent may miss before it is down.
+func WithMissedReports(missed int) Option {
+	return func(ms *MetricService) {
+		ms.missed = missed
+	}
+}
+
+// WithAlertRules sets the file the alert rules are loaded from and saved to, without one they are kept in
+// memory only.
+func WithAlertRules(path string) Option {
+	return func(ms *MetricService) {
+		ms.alerts.path = path
+	}
 }
 
 // NewMetricService creates a new instance of MetricService.
-func NewMetricService(filepath string, storage MetricStorage) (*MetricService, error) {
+func NewMetricService(filepath string, storage MetricStorage, opts ...Option) (*MetricService, error) {
 	ms := MetricService{
 		storage:  storage,
 		filepath: filepath,
+		buckets:  domain.DefaultBuckets,
+		registry: newRegistry(),
+		window:   DefaultHistoryWindow,
+		interval: DefaultRateInterval,
+		buffer:   stream.DefaultBuffer,
+		missed:   DefaultMissedReports,
+		alerts:   newAlertRules(),
+	}
+	for _, opt := range opts {
+		opt(&ms)
+	}
+	if _, ok := storage.(HistoryStorage); !ok {
+		ms.recorder = newRecorder(ms.window)
+	}
+	ms.rates = newRates(ms.interval)
+	ms.hub = stream.NewHub(ms.buffer)
+	ms.agents = newInventory(ms.missed)
+	if err := ms.alerts.load(); err != nil {
+		return nil, err
+	}
+	// The names stored before a restart keep their types.
+	metrics, err := storage.GetAllMetrics(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metric types: %w", err)
 	}
+	ms.registry.load(metrics)
+	ms.rates.seed(metrics)
 	return &ms, nil
 }
 
@@ -48,41 +168,48 @@ func (ms *MetricService) GetMetric(ctx context.Context, mType, mName string) (*d
 	if err != nil {
 		return metric, fmt.Errorf("failed to get metric: %w", err)
 	}
+	ms.derive(metric)
 	return metric, nil
 }
 
 // SetMetric sets a single metric based on its type.
 func (ms *MetricService) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
-	switch m.MType {
-	case domain.Gauge:
-		if m.Value == nil {
-			return nil, domain.ErrNilGaugeValue
-		}
-		metric, err := ms.storage.SetMetric(ctx, m)
-		if err != nil {
-			return metric, fmt.Errorf("%w", err)
-		}
-		return metric, nil
-	case domain.Counter:
-		if m.Delta == nil {
-			return nil, domain.ErrNilCounterDelta
-		}
-		metric, err := ms.storage.SetMetric(ctx, m)
-		if err != nil {
-			return metric, fmt.Errorf("%w", err)
-		}
-		return metric, nil
-	default:
-		return &domain.Metric{}, domain.ErrIncorrectMetricType
+	claimed, err := ms.validate(*m)
+	if err != nil {
+		return nil, err
 	}
+	metric, err := ms.storage.SetMetric(ctx, m)
+	if err != nil {
+		return metric, ms.unclaim(ctx, claimed, fmt.Errorf("%w", err))
+	}
+	now := time.Now()
+	ms.rates.record(now, *metric)
+	if ms.recorder != nil {
+		ms.recorder.record(now, *metric)
+	}
+	if metric.Sketch != nil {
+		metric.Summary = domain.Summarize(metric.Sketch)
+	}
+	ms.publish(*metric)
+	return metric, nil
 }
 
 // SetMetrics sets multiple metrics at once.
 func (ms *MetricService) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
-	metrics, err := ms.storage.SetMetrics(ctx, metrics)
+	claimed, err := ms.validate(metrics...)
+	if err != nil {
+		return nil, err
+	}
+	metrics, err = ms.storage.SetMetrics(ctx, metrics)
 	if err != nil {
-		return metrics, fmt.Errorf("%w", err)
+		return metrics, ms.unclaim(ctx, claimed, fmt.Errorf("%w", err))
 	}
+	now := time.Now()
+	ms.rates.record(now, metrics...)
+	if ms.recorder != nil {
+		ms.recorder.record(now, metrics...)
+	}
+	ms.publish(metrics...)
 	return metrics, nil
 }
 
@@ -94,7 +221,7 @@ func (ms *MetricService) SetMetricValue(ctx context.Context, req *domain.SetMetr
 		if err != nil {
 			return &domain.Metric{}, domain.ErrIncorrectMetricValue
 		}
-		metric, err := ms.storage.SetMetric(ctx, &domain.Metric{
+		metric, err := ms.SetMetric(ctx, &domain.Metric{
 			ID:    req.ID,
 			MType: req.MType,
 			Value: &value,
@@ -109,7 +236,7 @@ func (ms *MetricService) SetMetricValue(ctx context.Context, req *domain.SetMetr
 			return &domain.Metric{}, domain.ErrIncorrectMetricValue
 		}
 		valueInt := int64(value)
-		metric, err := ms.storage.SetMetric(ctx, &domain.Metric{
+		metric, err := ms.SetMetric(ctx, &domain.Metric{
 			ID:    req.ID,
 			MType: req.MType,
 			Delta: &valueInt,
@@ -118,6 +245,38 @@ func (ms *MetricService) SetMetricValue(ctx context.Context, req *domain.SetMetr
 			return metric, fmt.Errorf("%w", err)
 		}
 		return metric, nil
+	case domain.Histogram:
+		// A single observation is recorded into a histogram with the configured buckets.
+		value, err := strconv.ParseFloat(req.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return &domain.Metric{}, domain.ErrIncorrectMetricValue
+		}
+		h := domain.NewHistogram(ms.buckets)
+		h.Observe(value)
+		metric, err := ms.SetMetric(ctx, &domain.Metric{
+			ID:        req.ID,
+			MType:     req.MType,
+			Histogram: h,
+		})
+		if err != nil {
+			return metric, fmt.Errorf("%w", err)
+		}
+		return metric, nil
+	case domain.Timer:
+		// A single sample is folded into the stored sketch.
+		value, err := strconv.ParseFloat(req.Value, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return &domain.Metric{}, domain.ErrIncorrectMetricValue
+		}
+		metric, err := ms.SetMetric(ctx, &domain.Metric{
+			ID:    req.ID,
+			MType: req.MType,
+			Value: &value,
+		})
+		if err != nil {
+			return metric, fmt.Errorf("%w", err)
+		}
+		return metric, nil
 	default:
 		return &domain.Metric{}, domain.ErrIncorrectMetricType
 	}
@@ -136,20 +295,308 @@ func (ms *MetricService) GetMetricValue(ctx context.Context, mType, mName string
 	case domain.Counter:
 		value := strconv.Itoa(int(*metric.Delta))
 		return value, nil
+	case domain.Histogram:
+		value, err := json.Marshal(metric.Histogram)
+		if err != nil {
+			return "", fmt.Errorf("%w", err)
+		}
+		return string(value), nil
+	case domain.Timer:
+		value, err := json.Marshal(domain.Summarize(metric.Sketch))
+		if err != nil {
+			return "", fmt.Errorf("%w", err)
+		}
+		return string(value), nil
 	default:
 		return "", domain.ErrIncorrectMetricType
 	}
 }
 
+// validate checks metrics and registers their types, failing if a type conflicts with the registered one.
+// It returns the names whose type it registered, to be unclaimed if the metrics can't be stored.
+func (ms *MetricService) validate(metrics ...domain.Metric) ([]string, error) {
+	for _, m := range metrics {
+		if err := domain.ValidateMetric(&m); err != nil {
+			return nil, err
+		}
+	}
+	return ms.registry.check(metrics...)
+}
+
+// unclaim releases the types registered for names by a write which failed with err, unless series of the
+// names were stored meanwhile, and returns err.
+func (ms *MetricService) unclaim(ctx context.Context, names []string, err error) error {
+	if len(names) == 0 {
+		return err
+	}
+	if releaseErr := ms.release(ctx, func(name string) bool { return slices.Contains(names, name) }); releaseErr != nil {
+		return errors.Join(err, releaseErr)
+	}
+	return err
+}
+
+// RegisterMetadata registers the description, unit and type of metric names.
+func (ms *MetricService) RegisterMetadata(_ context.Context, list []domain.Metadata) error {
+	return ms.registry.register(list)
+}
+
+// GetMetadata returns the metadata of every registered metric name.
+func (ms *MetricService) GetMetadata(_ context.Context) []domain.Metadata {
+	return ms.registry.all()
+}
+
+// GetHistory returns the gauge and counter series of a metric name sampled between from and to. Storages
+// without history are served from the samples recorded in memory over the history window.
+func (ms *MetricService) GetHistory(ctx context.Context, name string, from, to time.Time) ([]domain.Series, error) {
+	if ms.recorder != nil {
+		return ms.recorder.history(name, from, to), nil
+	}
+	series, err := ms.storage.(HistoryStorage).GetHistory(ctx, name, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history: %w", err)
+	}
+	return series, nil
+}
+
+// Query evaluates a query at the current time.
+func (ms *MetricService) Query(ctx context.Context, q string) (*query.Result, error) {
+	expr, err := query.Parse(q)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	result, err := query.Eval(ctx, ms, expr, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return result, nil
+}
+
 // GetAllMetrics retrieves all stored metrics.
 func (ms *MetricService) GetAllMetrics(ctx context.Context) (domain.MetricsList, error) {
 	metrics, err := ms.storage.GetAllMetrics(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w", err)
 	}
+	for i := range metrics {
+		ms.derive(&metrics[i])
+	}
 	return metrics, nil
 }
 
+// ListMetrics returns a page of the metrics selected by the filter, its limit being the page size.
+func (ms *MetricService) ListMetrics(ctx context.Context, filter domain.ListFilter) (*domain.MetricsPage, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	// One more metric than the page holds tells whether there is a next page.
+	size := filter.Limit
+	filter.Limit++
+	metrics, err := ms.storage.ListMetrics(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	page := &domain.MetricsPage{Metrics: metrics}
+	if len(metrics) > size {
+		page.Metrics = metrics[:size]
+		last := page.Metrics[size-1]
+		page.Next = domain.EncodeCursor(domain.Key{MType: last.MType, ID: last.ID})
+	}
+	for i := range page.Metrics {
+		ms.derive(&page.Metrics[i])
+	}
+	return page, nil
+}
+
+// DeleteMetric removes a series and the samples and rate the service keeps for it.
+func (ms *MetricService) DeleteMetric(ctx context.Context, mType, mName string) error {
+	if err := ms.storage.DeleteMetric(ctx, mType, mName); err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	ms.forget(func(key domain.Key) bool { return key.MType == mType && key.ID == mName })
+	if err := ms.release(ctx, func(name string) bool { return name == domain.MetricName(mName) }); err != nil {
+		return err
+	}
+	return ms.saveSnapshot()
+}
+
+// DeleteByPrefix removes the series whose ID starts with prefix and returns how many there were. An empty
+// prefix, which would delete everything, is refused.
+func (ms *MetricService) DeleteByPrefix(ctx context.Context, prefix string) (int, error) {
+	if prefix == "" {
+		return 0, domain.ErrEmptyPrefix
+	}
+	deleted, err := ms.storage.DeleteByPrefix(ctx, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("%w", err)
+	}
+	ms.forget(func(key domain.Key) bool { return strings.HasPrefix(key.ID, prefix) })
+	// A prefix ending inside the name matches the names it starts, one with labels matches its name alone.
+	if err = ms.release(ctx, func(name string) bool {
+		return strings.HasPrefix(name, domain.MetricName(prefix))
+	}); err != nil {
+		return deleted, err
+	}
+	return deleted, ms.saveSnapshot()
+}
+
+// ResetCounter sets the total of a counter to zero. The reset is recorded like a write, so the rate and
+// the history see the counter drop.
+func (ms *MetricService) ResetCounter(ctx context.Context, mName string) (*domain.Metric, error) {
+	metric, err := ms.storage.ResetCounter(ctx, mName)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	now := time.Now()
+	ms.rates.record(now, *metric)
+	if ms.recorder != nil {
+		ms.recorder.record(now, *metric)
+	}
+	ms.publish(*metric)
+	return metric, ms.saveSnapshot()
+}
+
+// forget drops what the service keeps in memory about deleted series.
+func (ms *MetricService) forget(match func(key domain.Key) bool) {
+	ms.rates.forget(func(id string) bool { return match(domain.Key{MType: domain.Counter, ID: id}) })
+	if ms.recorder != nil {
+		ms.recorder.forget(match)
+	}
+}
+
+// release drops the registered type of the matched names no series is left of, so that a deleted name can
+// be written with another type.
+func (ms *MetricService) release(ctx context.Context, match func(name string) bool) error {
+	for _, name := range ms.registry.typed() {
+		if !match(name) {
+			continue
+		}
+		left, err := ms.storage.ListMetrics(ctx, domain.ListFilter{
+			Prefix: name,
+			Match:  regexp.MustCompile("^" + regexp.QuoteMeta(name) + "$"),
+			Limit:  1,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to look up series of %s: %w", name, err)
+		}
+		if len(left) == 0 {
+			ms.registry.release(name)
+		}
+	}
+	return nil
+}
+
+// saveSnapshot saves the metrics to the file right away, so that a restore doesn't bring deleted series
+// or reset totals back before the next periodic save.
+func (ms *MetricService) saveSnapshot() error {
+	if ms.filepath == "" {
+		return nil
+	}
+	return ms.SaveMetrics()
+}
+
+// EvictStale removes the series not written for the eviction TTL before now with what the service keeps
+// for them and returns their keys. Nothing is evicted when the TTL is zero.
+func (ms *MetricService) EvictStale(ctx context.Context, now time.Time) ([]domain.Key, error) {
+	if ms.evictAfter <= 0 {
+		return nil, nil
+	}
+	keys, err := ms.storage.DeleteStale(ctx, now.Add(-ms.evictAfter))
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	if len(keys) == 0 {
+		return keys, nil
+	}
+	evicted := make(map[domain.Key]bool, len(keys))
+	for _, key := range keys {
+		evicted[key] = true
+	}
+	ms.forget(func(key domain.Key) bool { return evicted[key] })
+	names := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		names[domain.MetricName(key.ID)] = true
+	}
+	if err = ms.release(ctx, func(name string) bool { return names[name] }); err != nil {
+		return keys, err
+	}
+	return keys, ms.saveSnapshot()
+}
+
+// Staleness reports the stale series grouped by the value of a label, a group whose series are all
+// stale being an agent which stopped reporting.
+func (ms *MetricService) Staleness(ctx context.Context, label string) (*domain.StaleReport, error) {
+	metrics, err := ms.GetAllMetrics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return domain.NewStaleReport(metrics, label, ms.staleAfter), nil
+}
+
+// RecordAgent notes that an agent reported a number of metrics. Writes which don't tell the address nor
+// the hostname of their agent aren't recorded.
+func (ms *MetricService) RecordAgent(id domain.AgentIdentity, metrics int) {
+	ms.agents.record(time.Now(), id, metrics)
+}
+
+// Agents returns the agents which reported metrics sorted by ID.
+func (ms *MetricService) Agents() []domain.Agent {
+	return ms.agents.list(time.Now())
+}
+
+// CheckAgents returns the agents which went down or came back since the previous check.
+func (ms *MetricService) CheckAgents(now time.Time) []domain.Agent {
+	return ms.agents.check(now)
+}
+
+// GetCounterRate returns the change of a counter over the rate interval, up to its last write.
+func (ms *MetricService) GetCounterRate(ctx context.Context, id string) (*domain.CounterRate, error) {
+	if _, err := ms.storage.GetMetric(ctx, domain.Counter, id); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	rate := ms.rates.get(id, time.Now())
+	if rate == nil {
+		return nil, domain.ErrNoRate
+	}
+	return rate, nil
+}
+
+// derive fills the values derived from the stored one: the quantiles of timers, the rate of counters and
+// whether the series is stale.
+func (ms *MetricService) derive(m *domain.Metric) {
+	if ms.staleAfter > 0 && m.Updated != nil {
+		m.Stale = time.Since(*m.Updated) > ms.staleAfter
+	}
+	switch m.MType {
+	case domain.Timer:
+		if m.Sketch != nil {
+			m.Summary = domain.Summarize(m.Sketch)
+		}
+	case domain.Counter:
+		if rate := ms.rates.get(m.ID, time.Now()); rate != nil {
+			perSecond := rate.Rate
+			m.Rate = &perSecond
+		}
+	}
+}
+
+// Subscribe starts a subscription to the updates of the metrics selected by the filter.
+func (ms *MetricService) Subscribe(filter stream.Filter) *stream.Subscription {
+	return ms.hub.Subscribe(filter)
+}
+
+// publish sends the stored metrics with their derived values to the stream subscribers.
+func (ms *MetricService) publish(metrics ...domain.Metric) {
+	if ms.hub.Subscribers() == 0 {
+		return
+	}
+	updates := make(domain.MetricsList, 0, len(metrics))
+	for _, m := range metrics {
+		ms.derive(&m)
+		updates = append(updates, m)
+	}
+	ms.hub.Publish(updates...)
+}
+
 // Ping checks the health of the storage system.
 func (ms *MetricService) Ping(ctx context.Context) error {
 	err := ms.storage.Ping(ctx)
@@ -167,7 +614,13 @@ func (ms *MetricService) SaveMetrics() error {
 		return fmt.Errorf("failed to get metrics for saving to file: %w", err)
 	}
 	for _, v := range metrics {
-		metricValues[domain.Key{ID: v.ID, MType: v.MType}] = domain.Value{Value: v.Value, Delta: v.Delta}
+		metricValues[domain.Key{ID: v.ID, MType: v.MType}] = domain.Value{
+			Value:     v.Value,
+			Delta:     v.Delta,
+			Histogram: v.Histogram,
+			Sketch:    v.Sketch,
+			Updated:   v.UpdatedAt(),
+		}
 	}
 	err = files.SaveMetricsToFile(ms.filepath, metricValues)
 	if err != nil {
@@ -176,22 +629,47 @@ func (ms *MetricService) SaveMetrics() error {
 	return nil
 }
 
-// LoadMetrics loads all metrics from a file.
+// RestoreStorage is implemented by storages that restore a snapshot with the time its values were written at.
+type RestoreStorage interface {
+	RestoreMetrics(ctx context.Context, values domain.MetricValues) error
+}
+
+// LoadMetrics loads all metrics from a file. Storages restoring snapshots keep the time the values were last
+// written at, so that series stale before a restart are still evicted after it.
 func (ms *MetricService) LoadMetrics() error {
 	metrics, err := files.LoadMetricsFromFile(ms.filepath)
 	if err != nil {
 		return fmt.Errorf("failed to load metrics for restore: %w", err)
 	}
+	if rs, ok := ms.storage.(RestoreStorage); ok {
+		if err = rs.RestoreMetrics(context.TODO(), metrics); err != nil {
+			return fmt.Errorf("failed to save metrics in restore: %w", err)
+		}
+		return ms.loadTypes()
+	}
 	for k, v := range metrics {
 		_, err = ms.storage.SetMetric(context.TODO(), &domain.Metric{
-			ID:    k.ID,
-			MType: k.MType,
-			Value: v.Value,
-			Delta: v.Delta,
+			ID:        k.ID,
+			MType:     k.MType,
+			Value:     v.Value,
+			Delta:     v.Delta,
+			Histogram: v.Histogram,
+			Sketch:    v.Sketch,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to save metrics in restore: %w", err)
 		}
 	}
+	return ms.loadTypes()
+}
+
+// loadTypes registers the types of the restored metrics and takes their totals as the start of their rates.
+func (ms *MetricService) loadTypes() error {
+	restored, err := ms.storage.GetAllMetrics(context.TODO())
+	if err != nil {
+		return fmt.Errorf("failed to load metric types: %w", err)
+	}
+	ms.registry.load(restored)
+	ms.rates.seed(restored)
 	return nil
 }
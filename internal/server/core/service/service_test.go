@@ -2,11 +2,17 @@ package service
 
 import (
 	"context"
+	"errors"
 	"metrics/internal/server/adapters/storage"
 	"metrics/internal/server/adapters/storage/memory"
 	"metrics/internal/server/core/domain"
+	"metrics/internal/server/core/files"
+	"metrics/internal/server/core/query"
+	"metrics/internal/server/core/stream"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -24,6 +30,8 @@ func TestMetricService_SetMetric(t *testing.T) {
 	saved, err := s.SetMetric(ctx, m)
 
 	require.NoError(t, err)
+	require.NotNil(t, saved.Updated)
+	saved.Updated = nil
 	assert.Equal(t, m, saved)
 }
 
@@ -42,6 +50,10 @@ func TestMetricService_SetMetrics(t *testing.T) {
 	saved, err := s.SetMetrics(ctx, metrics)
 
 	require.NoError(t, err)
+	for i := range saved {
+		require.NotNil(t, saved[i].Updated)
+		saved[i].Updated = nil
+	}
 	assert.Equal(t, metrics, saved)
 }
 
@@ -57,9 +69,439 @@ func TestMetricService_SetMetricValue(t *testing.T) {
 	saved, err := s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: `test`, Value: "100"})
 
 	require.NoError(t, err)
+	require.NotNil(t, saved.Updated)
+	saved.Updated = nil
 	assert.Equal(t, expected, saved)
 }
 
+func TestMetricService_SetMetricValueHistogram(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("/tmp/test.json", memoryStorage, WithHistogramBuckets([]float64{1, 10}))
+	require.NoError(t, err)
+
+	for _, v := range []string{"0.5", "5", "50", "5"} {
+		_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Histogram, ID: `latency`, Value: v})
+		require.NoError(t, err)
+	}
+	saved, err := s.GetMetric(ctx, domain.Histogram, `latency`)
+
+	require.NoError(t, err)
+	assert.Equal(t, &domain.HistogramValue{Bounds: []float64{1, 10}, Counts: []uint64{1, 2, 1}, Sum: 60.5, Count: 4},
+		saved.Histogram)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Histogram, ID: `latency`, Value: "NaN"})
+	assert.ErrorIs(t, err, domain.ErrIncorrectMetricValue)
+}
+
+func TestMetricService_Timer(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("/tmp/test.json", memoryStorage)
+	require.NoError(t, err)
+
+	for i := 1; i <= 100; i++ {
+		_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Timer, ID: `rt`, Value: strconv.Itoa(i)})
+		require.NoError(t, err)
+	}
+	m, err := s.GetMetric(ctx, domain.Timer, `rt`)
+	require.NoError(t, err)
+	require.NotNil(t, m.Summary)
+	assert.Equal(t, uint64(100), m.Summary.Count)
+	assert.InEpsilon(t, 50.0, m.Summary.P50, 0.02)
+	assert.InEpsilon(t, 99.0, m.Summary.P99, 0.02)
+	assert.InDelta(t, 100.0, m.Summary.Max, 0)
+
+	value, err := s.GetMetricValue(ctx, domain.Timer, `rt`)
+	require.NoError(t, err)
+	assert.Contains(t, value, `"count":100`)
+	assert.Contains(t, value, `"max":100`)
+}
+
+func TestMetricService_TypeConflict(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("/tmp/test.json", memoryStorage)
+	require.NoError(t, err)
+
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: `Alloc`, Value: "1"})
+	require.NoError(t, err)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `Alloc`, Value: "1"})
+	assert.ErrorIs(t, err, domain.ErrTypeConflict)
+
+	delta := int64(1)
+	_, err = s.SetMetrics(ctx, domain.MetricsList{
+		{MType: domain.Counter, ID: `requests{code="200"}`, Delta: &delta},
+		{MType: domain.Gauge, ID: `requests{code="500"}`, Value: new(float64)},
+	})
+	require.ErrorIs(t, err, domain.ErrTypeConflict, "labelled series share the type of their name")
+	_, err = s.GetMetric(ctx, domain.Counter, `requests{code="200"}`)
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+
+	err = s.RegisterMetadata(ctx, []domain.Metadata{{Name: "rt", Type: domain.Timer, Unit: "seconds"}})
+	require.NoError(t, err)
+	err = s.RegisterMetadata(ctx, []domain.Metadata{{Name: "rt", Description: "request time"}})
+	require.NoError(t, err)
+	_, err = s.SetMetric(ctx, &domain.Metric{MType: domain.Gauge, ID: `rt`, Value: new(float64)})
+	require.ErrorIs(t, err, domain.ErrTypeConflict)
+	err = s.RegisterMetadata(ctx, []domain.Metadata{{Name: "Alloc", Type: domain.Counter}})
+	require.ErrorIs(t, err, domain.ErrTypeConflict)
+
+	assert.Equal(t, []domain.Metadata{
+		{Name: "Alloc", Type: domain.Gauge},
+		{Name: "rt", Type: domain.Timer, Unit: "seconds", Description: "request time"},
+	}, s.GetMetadata(ctx))
+}
+
+func TestMetricService_TypeRestored(t *testing.T) {
+	ctx := context.Background()
+	snapshot := filepath.Join(t.TempDir(), "metrics.json")
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService(snapshot, memoryStorage)
+	require.NoError(t, err)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: `Alloc`, Value: "1"})
+	require.NoError(t, err)
+	require.NoError(t, s.SaveMetrics())
+
+	// A service started over the storage knows the stored types.
+	s, err = NewMetricService(snapshot, memoryStorage)
+	require.NoError(t, err)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `Alloc`, Value: "1"})
+	require.ErrorIs(t, err, domain.ErrTypeConflict)
+
+	// So does one restoring the snapshot.
+	restoredStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err = NewMetricService(snapshot, restoredStorage)
+	require.NoError(t, err)
+	require.NoError(t, s.LoadMetrics())
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `Alloc`, Value: "1"})
+	require.ErrorIs(t, err, domain.ErrTypeConflict)
+}
+
+func TestMetricService_TypeReleased(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("", memoryStorage)
+	require.NoError(t, err)
+	for _, id := range []string{`Alloc`, `load{host="a"}`, `load{host="b"}`} {
+		_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: id, Value: "1"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.RegisterMetadata(ctx, []domain.Metadata{{Name: "load", Unit: "percent"}}))
+
+	require.NoError(t, s.DeleteMetric(ctx, domain.Gauge, `Alloc`))
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `Alloc`, Value: "1"})
+	require.NoError(t, err, "a deleted name can be written with another type")
+
+	require.NoError(t, s.DeleteMetric(ctx, domain.Gauge, `load{host="a"}`))
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `load{host="a"}`, Value: "1"})
+	require.ErrorIs(t, err, domain.ErrTypeConflict, "a series of the name is left")
+
+	_, err = s.DeleteByPrefix(ctx, `load{`)
+	require.NoError(t, err)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `load{host="a"}`, Value: "1"})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Metadata{
+		{Name: "Alloc", Type: domain.Counter},
+		{Name: "load", Type: domain.Counter, Unit: "percent"},
+	}, s.GetMetadata(ctx))
+}
+
+// failingStorage fails the writes while err is set.
+type failingStorage struct {
+	MetricStorage
+	err error
+}
+
+func (s *failingStorage) SetMetric(ctx context.Context, m *domain.Metric) (*domain.Metric, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.MetricStorage.SetMetric(ctx, m)
+}
+
+func (s *failingStorage) SetMetrics(ctx context.Context, metrics domain.MetricsList) (domain.MetricsList, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.MetricStorage.SetMetrics(ctx, metrics)
+}
+
+func TestMetricService_TypeUnclaimed(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	failing := &failingStorage{MetricStorage: memoryStorage, err: errors.New("disk full")}
+	s, err := NewMetricService("", failing)
+	require.NoError(t, err)
+	require.NoError(t, s.RegisterMetadata(ctx, []domain.Metadata{{Name: "load", Unit: "percent"}}))
+
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: `Alloc`, Value: "1"})
+	require.ErrorContains(t, err, "disk full")
+	_, err = s.SetMetrics(ctx, domain.MetricsList{{MType: domain.Gauge, ID: `load{host="a"}`, Value: new(float64)}})
+	require.ErrorContains(t, err, "disk full")
+	assert.Equal(t, []domain.Metadata{{Name: "load", Unit: "percent"}}, s.GetMetadata(ctx),
+		"the types of failed writes aren't kept")
+
+	failing.err = nil
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: `Alloc`, Value: "1"})
+	require.NoError(t, err, "a name whose write failed can be written with another type")
+}
+
+func TestMetricService_Query(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("/tmp/test.json", memoryStorage)
+	require.NoError(t, err)
+
+	for _, id := range []string{`PollCount{host="a"}`, `PollCount{host="b"}`, `PollCount{host="a"}`} {
+		_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: id, Value: "5"})
+		require.NoError(t, err)
+	}
+	result, err := s.Query(ctx, "sum(PollCount)")
+	require.NoError(t, err)
+	require.Len(t, result.Vector, 1)
+	assert.InDelta(t, 15.0, result.Vector[0].Value, 0)
+
+	result, err = s.Query(ctx, "increase(PollCount[1m])")
+	require.NoError(t, err, "history is recorded in memory")
+	require.Len(t, result.Vector, 1, "a single sample has no increase")
+	assert.Equal(t, map[string]string{"host": "a"}, result.Vector[0].Labels)
+	assert.InDelta(t, 5.0, result.Vector[0].Value, 0)
+
+	_, err = s.Query(ctx, "sum(")
+	require.ErrorIs(t, err, query.ErrSyntax)
+}
+
+func TestRecorder(t *testing.T) {
+	r := newRecorder(time.Minute)
+	at := time.Now()
+	gauge := func(v float64) domain.Metric { return domain.Metric{ID: "g", MType: domain.Gauge, Value: &v} }
+	r.record(at, gauge(1))
+	r.record(at.Add(time.Minute), gauge(2))
+	r.record(at.Add(2*time.Minute), gauge(3), domain.Metric{ID: "h", MType: domain.Histogram})
+
+	series := r.history("g", at, at.Add(time.Hour))
+	require.Len(t, series, 1)
+	require.Len(t, series[0].Samples, 2, "samples out of the window are dropped")
+	assert.InDelta(t, 2.0, series[0].Samples[0].Value, 0)
+	assert.Empty(t, r.history("h", at, at.Add(time.Hour)), "only gauges and counters are recorded")
+}
+
+func TestRecorder_Sweep(t *testing.T) {
+	r := newRecorder(time.Minute)
+	at := time.Now().Add(-time.Hour)
+	for i := range 100 {
+		v := float64(i)
+		r.record(at, domain.Metric{ID: `load{pid="` + strconv.Itoa(i) + `"}`, MType: domain.Gauge, Value: &v})
+	}
+	require.Len(t, r.series, 100)
+	v := 1.0
+	r.record(time.Now(), domain.Metric{ID: "Alloc", MType: domain.Gauge, Value: &v})
+	assert.Len(t, r.series, 1, "the series no longer written are dropped once out of the window")
+
+	r.record(time.Now().Add(-2*time.Minute), domain.Metric{ID: "old", MType: domain.Gauge, Value: &v})
+	assert.Empty(t, r.history("old", time.Time{}, time.Now()), "a read sweeps the samples out of the window")
+	assert.NotContains(t, r.series, domain.Key{MType: domain.Gauge, ID: "old"})
+}
+
+func TestRates(t *testing.T) {
+	r := newRates(2 * time.Second)
+	at := time.Now()
+	var now time.Time
+	write := func(after time.Duration, totals ...int64) {
+		now = at.Add(after)
+		for _, total := range totals {
+			r.record(now, domain.Metric{ID: "c", MType: domain.Counter, Delta: &total})
+		}
+	}
+	write(0, 10)
+	assert.Nil(t, r.get("c", now), "a single write has no rate")
+	write(time.Millisecond, 12)
+	assert.Nil(t, r.get("c", now), "writes a moment apart have no rate")
+	write(2*time.Second, 16, 16)
+	assert.Equal(t, &domain.CounterRate{Delta: 6, Rate: 3, Interval: 2 * time.Second}, r.get("c", now))
+	write(2*time.Second+time.Millisecond, 100)
+	assert.Equal(t, &domain.CounterRate{Delta: 88, Rate: 44, Interval: 2 * time.Second}, r.get("c", now),
+		"the rate is taken from the latest write at least the interval before")
+	write(4*time.Second+time.Millisecond, 4)
+	assert.Equal(t, &domain.CounterRate{Delta: 4, Rate: 2, Interval: 2 * time.Second}, r.get("c", now),
+		"the counter was reset")
+	write(5*time.Second, 6)
+	write(5*time.Second+time.Millisecond, 1)
+	write(6*time.Second+time.Millisecond, 3)
+	assert.Equal(t, &domain.CounterRate{Delta: 5, Rate: 2.5, Interval: 2 * time.Second}, r.get("c", now),
+		"the growth before a reset within the interval is kept")
+
+	assert.Equal(t, &domain.CounterRate{Delta: 5, Rate: 2.5, Interval: 2 * time.Second},
+		r.get("c", now.Add(4*time.Second)), "a write may come late")
+	assert.Equal(t, &domain.CounterRate{Interval: 5 * time.Second}, r.get("c", now.Add(5*time.Second)),
+		"a counter no longer written has stopped changing")
+}
+
+func TestRates_Seed(t *testing.T) {
+	r := newRates(time.Second)
+	at := time.Now()
+	total, later := int64(10), int64(20)
+	r.seed([]domain.Metric{
+		{ID: "c", MType: domain.Counter, Delta: &total, Updated: &at},
+		{ID: "unknown", MType: domain.Counter, Delta: &total},
+	})
+	r.record(at.Add(5*time.Second), domain.Metric{ID: "c", MType: domain.Counter, Delta: &later})
+	assert.Equal(t, &domain.CounterRate{Delta: 10, Rate: 2, Interval: 5 * time.Second}, r.get("c", at.Add(5*time.Second)))
+	assert.Nil(t, r.get("unknown", at))
+}
+
+func TestMetricService_GetCounterRate(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	const interval = 20 * time.Millisecond
+	s, err := NewMetricService("/tmp/test.json", memoryStorage, WithRateInterval(interval))
+	require.NoError(t, err)
+
+	_, err = s.GetCounterRate(ctx, "PollCount")
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: "PollCount", Value: "5"})
+	require.NoError(t, err)
+	_, err = s.GetCounterRate(ctx, "PollCount")
+	require.ErrorIs(t, err, domain.ErrNoRate)
+	time.Sleep(interval)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: "PollCount", Value: "7"})
+	require.NoError(t, err)
+
+	rate, err := s.GetCounterRate(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), rate.Delta)
+	m, err := s.GetMetric(ctx, domain.Counter, "PollCount")
+	require.NoError(t, err)
+	require.NotNil(t, m.Rate)
+	assert.InDelta(t, rate.Rate, *m.Rate, 0)
+}
+
+func TestMetricService_GetCounterRateRestored(t *testing.T) {
+	ctx := context.Background()
+	snapshot := filepath.Join(t.TempDir(), "metrics.json")
+	total := int64(100)
+	require.NoError(t, files.SaveMetricsToFile(snapshot, domain.MetricValues{
+		{MType: domain.Counter, ID: "PollCount"}: {Delta: &total, Updated: time.Now().Add(-time.Minute)},
+	}))
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService(snapshot, memoryStorage)
+	require.NoError(t, err)
+	require.NoError(t, s.LoadMetrics())
+
+	// The restored total is the start of the rate, so a single write after the restart is enough.
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: "PollCount", Value: "60"})
+	require.NoError(t, err)
+	rate, err := s.GetCounterRate(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), rate.Delta)
+	assert.InDelta(t, 1, rate.Rate, 0.1)
+}
+
+func TestMetricService_ListMetrics(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("/tmp/test.json", memoryStorage)
+	require.NoError(t, err)
+	for _, id := range []string{"c", "a", "b"} {
+		_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: id, Value: "1"})
+		require.NoError(t, err)
+	}
+
+	_, err = s.ListMetrics(ctx, domain.ListFilter{Sort: "value", Limit: 2})
+	require.ErrorIs(t, err, domain.ErrIncorrectFilter)
+
+	page, err := s.ListMetrics(ctx, domain.ListFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Metrics, 2)
+	assert.Equal(t, "a", page.Metrics[0].ID)
+	assert.Equal(t, "b", page.Metrics[1].ID)
+	require.NotEmpty(t, page.Next)
+
+	after, err := domain.DecodeCursor(page.Next)
+	require.NoError(t, err)
+	page, err = s.ListMetrics(ctx, domain.ListFilter{After: after, Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Metrics, 1)
+	assert.Equal(t, "c", page.Metrics[0].ID)
+	assert.Empty(t, page.Next)
+}
+
+func TestMetricService_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("/tmp/test.json", memoryStorage, WithStreamBuffer(1))
+	require.NoError(t, err)
+	sub := s.Subscribe(stream.Filter{Types: []string{domain.Counter}})
+	defer sub.Close()
+
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: "Alloc", Value: "1"})
+	require.NoError(t, err)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: "PollCount", Value: "2"})
+	require.NoError(t, err)
+	m := <-sub.Updates()
+	assert.Equal(t, "PollCount", m.ID)
+	assert.Equal(t, int64(2), *m.Delta)
+
+	// A batch overflowing the buffer evicts the subscriber.
+	_, err = s.SetMetrics(ctx, domain.MetricsList{
+		{MType: domain.Counter, ID: "PollCount", Delta: m.Delta},
+		{MType: domain.Counter, ID: "Errors", Delta: m.Delta},
+	})
+	require.NoError(t, err)
+	require.ErrorIs(t, sub.Err(), stream.ErrSlowConsumer)
+}
+
+func TestMetricService_Delete(t *testing.T) {
+	ctx := context.Background()
+	snapshot := filepath.Join(t.TempDir(), "metrics.json")
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService(snapshot, memoryStorage, WithRateInterval(0))
+	require.NoError(t, err)
+	for _, id := range []string{"HeapAlloc", "HeapInuse", "PollCount"} {
+		_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Counter, ID: id, Value: "5"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.SaveMetrics())
+
+	_, err = s.DeleteByPrefix(ctx, "")
+	require.ErrorIs(t, err, domain.ErrEmptyPrefix)
+	deleted, err := s.DeleteByPrefix(ctx, "Heap")
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+	require.ErrorIs(t, s.DeleteMetric(ctx, domain.Gauge, "PollCount"), domain.ErrItemNotFound)
+	m, err := s.ResetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), *m.Delta)
+	rate, err := s.GetCounterRate(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rate.Delta)
+
+	// The snapshot is saved right away, so a restore doesn't bring the deleted series back.
+	restoredStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	restored, err := NewMetricService(snapshot, restoredStorage)
+	require.NoError(t, err)
+	require.NoError(t, restored.LoadMetrics())
+	metrics, err := restored.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "PollCount", metrics[0].ID)
+	assert.Equal(t, int64(0), *metrics[0].Delta)
+}
+
 func TestMetricService_GetMetric(t *testing.T) {
 	ctx := context.Background()
 	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
@@ -130,8 +572,8 @@ func TestMetricService_SaveLoadMetrics(t *testing.T) {
 	metrics := []domain.Metric{
 		{MType: domain.Counter, ID: "name1", Delta: &delta5},
 		{MType: domain.Counter, ID: "name1", Delta: &delta6},
-		{MType: domain.Gauge, ID: "name1", Value: &value10},
-		{MType: domain.Gauge, ID: "name1", Value: &value15},
+		{MType: domain.Gauge, ID: "name3", Value: &value10},
+		{MType: domain.Gauge, ID: "name3", Value: &value15},
 		{MType: domain.Gauge, ID: "name2", Value: &value20},
 	}
 	_, err = saveService.SetMetrics(ctx, metrics)
@@ -150,7 +592,7 @@ func TestMetricService_SaveLoadMetrics(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, int64(11), *m.Delta)
 
-	m, err = loadService.GetMetric(ctx, domain.Gauge, "name1")
+	m, err = loadService.GetMetric(ctx, domain.Gauge, "name3")
 	require.NoError(t, err)
 	assert.Equal(t, float64(15), *m.Value)
 
@@ -158,3 +600,94 @@ func TestMetricService_SaveLoadMetrics(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, float64(20), *m.Value)
 }
+
+func TestMetricService_Staleness(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService(filepath.Join(t.TempDir(), "metrics.json"), memoryStorage, WithStaleness(ttl, ttl))
+	require.NoError(t, err)
+	for _, req := range []domain.SetMetricRequest{
+		{MType: domain.Gauge, ID: `Alloc{host="web1"}`, Value: "1"},
+		{MType: domain.Gauge, ID: `Alloc{host="web2"}`, Value: "2"},
+		{MType: domain.Counter, ID: `PollCount{host="web2"}`, Value: "3"},
+	} {
+		_, err = s.SetMetricValue(ctx, &req)
+		require.NoError(t, err)
+	}
+	time.Sleep(ttl + 10*time.Millisecond)
+	fresh, err := s.SetMetricValue(ctx, &domain.SetMetricRequest{
+		MType: domain.Gauge, ID: `Alloc{host="web2"}`, Value: "4",
+	})
+	require.NoError(t, err)
+	assert.False(t, fresh.Stale)
+
+	m, err := s.GetMetric(ctx, domain.Gauge, `Alloc{host="web1"}`)
+	require.NoError(t, err)
+	assert.True(t, m.Stale)
+	report, err := s.Staleness(ctx, "host")
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 2)
+	assert.Equal(t, "web1", report.Groups[0].Name)
+	assert.True(t, report.Groups[0].Silent)
+	assert.Equal(t, "web2", report.Groups[1].Name)
+	assert.False(t, report.Groups[1].Silent)
+	assert.Len(t, report.Series, 2)
+
+	keys, err := s.EvictStale(ctx, time.Now())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []domain.Key{
+		{MType: domain.Gauge, ID: `Alloc{host="web1"}`},
+		{MType: domain.Counter, ID: `PollCount{host="web2"}`},
+	}, keys)
+	metrics, err := s.GetAllMetrics(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, `Alloc{host="web2"}`, metrics[0].ID)
+	_, err = s.GetCounterRate(ctx, `PollCount{host="web2"}`)
+	require.ErrorIs(t, err, domain.ErrItemNotFound)
+}
+
+func TestMetricService_StalenessRestored(t *testing.T) {
+	const ttl = time.Minute
+	ctx := context.Background()
+	snapshot := filepath.Join(t.TempDir(), "metrics.json")
+	old, fresh := 1.0, 2.0
+	require.NoError(t, files.SaveMetricsToFile(snapshot, domain.MetricValues{
+		{MType: domain.Gauge, ID: `Alloc{host="web1"}`}: {Value: &old, Updated: time.Now().Add(-2 * ttl)},
+		{MType: domain.Gauge, ID: `Alloc{host="web2"}`}: {Value: &fresh, Updated: time.Now()},
+	}))
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService(snapshot, memoryStorage, WithStaleness(ttl, ttl))
+	require.NoError(t, err)
+	require.NoError(t, s.LoadMetrics())
+
+	// The series stale before the restart is still stale after it.
+	report, err := s.Staleness(ctx, "host")
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, "web1", report.Groups[0].Name)
+	assert.True(t, report.Groups[0].Silent)
+	keys, err := s.EvictStale(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Key{{MType: domain.Gauge, ID: `Alloc{host="web1"}`}}, keys)
+}
+
+func TestMetricService_StalenessDisabled(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("", memoryStorage)
+	require.NoError(t, err)
+	_, err = s.SetMetricValue(ctx, &domain.SetMetricRequest{MType: domain.Gauge, ID: "Alloc", Value: "1"})
+	require.NoError(t, err)
+
+	keys, err := s.EvictStale(ctx, time.Now().Add(24*time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	report, err := s.Staleness(ctx, "host")
+	require.NoError(t, err)
+	assert.Empty(t, report.Groups)
+}
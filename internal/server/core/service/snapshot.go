@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"metrics/internal/server/core/domain"
+)
+
+// snapshotBatch is how many metrics an export reads and an import writes at a time.
+const snapshotBatch = 500
+
+// ExportMetrics calls fn with every stored metric in key order, reading the storage a page at a time so
+// that a large export isn't held in memory. It returns how many metrics fn was called with.
+func (ms *MetricService) ExportMetrics(ctx context.Context, fn func(m *domain.Metric) error) (int, error) {
+	filter := domain.ListFilter{Limit: snapshotBatch}
+	exported := 0
+	for {
+		metrics, err := ms.storage.ListMetrics(ctx, filter)
+		if err != nil {
+			return exported, fmt.Errorf("failed to list metrics for export: %w", err)
+		}
+		for i := range metrics {
+			if err = fn(&metrics[i]); err != nil {
+				return exported, err
+			}
+			exported++
+		}
+		if len(metrics) < filter.Limit {
+			return exported, nil
+		}
+		last := metrics[len(metrics)-1]
+		filter.After = &domain.Key{MType: last.MType, ID: last.ID}
+	}
+}
+
+// ImportMetrics writes the metrics read by next, until it returns io.EOF, in batches. With ImportMerge they
+// are written like reports. With ImportReplace a stored series is deleted before the snapshot one takes its
+// place, so counters, histograms and timers get the snapshot values rather than adding up, and the stored
+// series the snapshot doesn't hold are deleted once it is written; the replaced series lose their history
+// as deleted ones do. On failure the batches written stay and the result tells how far the import went.
+func (ms *MetricService) ImportMetrics(
+	ctx context.Context, next func() (*domain.Metric, error), mode string,
+) (*domain.ImportResult, error) {
+	var stored map[domain.Key]bool
+	switch mode {
+	case domain.ImportMerge:
+	case domain.ImportReplace:
+		stored = make(map[domain.Key]bool)
+		if _, err := ms.ExportMetrics(ctx, func(m *domain.Metric) error {
+			stored[domain.Key{MType: m.MType, ID: m.ID}] = true
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %q", domain.ErrIncorrectImportMode, mode)
+	}
+	result := &domain.ImportResult{}
+	batch := make(domain.MetricsList, 0, snapshotBatch)
+	write := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		claimed, err := ms.validate(batch...)
+		if err != nil {
+			return err
+		}
+		for _, m := range batch {
+			key := domain.Key{MType: m.MType, ID: m.ID}
+			if !stored[key] {
+				continue
+			}
+			if err = ms.deleteSeries(ctx, key); err != nil {
+				return ms.unclaim(ctx, claimed, err)
+			}
+			delete(stored, key)
+		}
+		if _, err = ms.SetMetrics(ctx, batch); err != nil {
+			return ms.unclaim(ctx, claimed, err)
+		}
+		result.Imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		m, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		batch = append(batch, *m)
+		if len(batch) < snapshotBatch {
+			continue
+		}
+		if err = write(); err != nil {
+			return result, err
+		}
+	}
+	if err := write(); err != nil {
+		return result, err
+	}
+	for key := range stored {
+		if err := ms.deleteSeries(ctx, key); err != nil {
+			return result, err
+		}
+		result.Deleted++
+	}
+	return result, ms.saveSnapshot()
+}
+
+// deleteSeries removes a series and what the service keeps for it, a series deleted meanwhile being gone
+// already.
+func (ms *MetricService) deleteSeries(ctx context.Context, key domain.Key) error {
+	err := ms.storage.DeleteMetric(ctx, key.MType, key.ID)
+	if err != nil && !errors.Is(err, domain.ErrItemNotFound) {
+		return fmt.Errorf("failed to delete %s %s: %w", key.MType, key.ID, err)
+	}
+	ms.forget(func(k domain.Key) bool { return k == key })
+	return ms.release(ctx, func(name string) bool { return name == domain.MetricName(key.ID) })
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"metrics/internal/server/adapters/storage"
+	"metrics/internal/server/adapters/storage/memory"
+	"metrics/internal/server/adapters/storage/storagetest"
+	"metrics/internal/server/core/domain"
+)
+
+func newSnapshotService(t *testing.T, metrics ...domain.Metric) *MetricService {
+	t.Helper()
+	memoryStorage, err := storage.NewStorage(storage.Config{Memory: &memory.Config{}})
+	require.NoError(t, err)
+	s, err := NewMetricService("", memoryStorage)
+	require.NoError(t, err)
+	if len(metrics) > 0 {
+		_, err = s.SetMetrics(context.Background(), metrics)
+		require.NoError(t, err)
+	}
+	return s
+}
+
+// reader returns the metrics one by one, then io.EOF.
+func reader(metrics ...domain.Metric) func() (*domain.Metric, error) {
+	return func() (*domain.Metric, error) {
+		if len(metrics) == 0 {
+			return nil, io.EOF
+		}
+		m := metrics[0]
+		metrics = metrics[1:]
+		return &m, nil
+	}
+}
+
+func TestMetricService_ExportMetrics(t *testing.T) {
+	metrics := make(domain.MetricsList, 0, snapshotBatch+1)
+	for i := range snapshotBatch + 1 {
+		metrics = append(metrics, storagetest.Gauge("g"+strconv.Itoa(i), float64(i)))
+	}
+	s := newSnapshotService(t, metrics...)
+
+	seen := make(map[string]bool)
+	exported, err := s.ExportMetrics(context.Background(), func(m *domain.Metric) error {
+		assert.False(t, seen[m.ID], "%s is exported once", m.ID)
+		seen[m.ID] = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, snapshotBatch+1, exported, "the export follows the pages")
+	assert.Len(t, seen, snapshotBatch+1)
+
+	errStop := errors.New("stop")
+	exported, err = s.ExportMetrics(context.Background(), func(*domain.Metric) error { return errStop })
+	require.ErrorIs(t, err, errStop)
+	assert.Zero(t, exported)
+}
+
+func TestMetricService_ImportMetrics(t *testing.T) {
+	snapshot := []domain.Metric{
+		storagetest.Gauge("Alloc", 5),
+		storagetest.Counter("PollCount", 10),
+		storagetest.Histogram("latency", []float64{1}, []uint64{1, 1}, 3),
+	}
+	tests := []struct {
+		name        string
+		mode        string
+		wantCounter int64
+		wantCount   uint64
+		wantGone    bool
+		wantDeleted int
+	}{
+		{name: "merge", mode: domain.ImportMerge, wantCounter: 13, wantCount: 4},
+		{name: "replace", mode: domain.ImportReplace, wantCounter: 10, wantCount: 2, wantGone: true, wantDeleted: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newSnapshotService(t,
+				storagetest.Gauge("Alloc", 1),
+				storagetest.Gauge("Old", 1),
+				storagetest.Counter("PollCount", 3),
+				storagetest.Histogram("latency", []float64{1}, []uint64{2, 0}, 1),
+			)
+
+			result, err := s.ImportMetrics(ctx, reader(snapshot...), tt.mode)
+			require.NoError(t, err)
+			assert.Equal(t, &domain.ImportResult{Imported: 3, Deleted: tt.wantDeleted}, result)
+
+			gauge, err := s.GetMetric(ctx, domain.Gauge, "Alloc")
+			require.NoError(t, err)
+			assert.InDelta(t, 5, *gauge.Value, 0)
+			counter, err := s.GetMetric(ctx, domain.Counter, "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCounter, *counter.Delta)
+			histogram, err := s.GetMetric(ctx, domain.Histogram, "latency")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCount, histogram.Histogram.Count)
+			_, err = s.GetMetric(ctx, domain.Gauge, "Old")
+			assert.Equal(t, tt.wantGone, errors.Is(err, domain.ErrItemNotFound))
+		})
+	}
+}
+
+func TestMetricService_ImportMetricsErrors(t *testing.T) {
+	ctx := context.Background()
+	s := newSnapshotService(t, storagetest.Gauge("Old", 1))
+
+	_, err := s.ImportMetrics(ctx, reader(), "append")
+	require.ErrorIs(t, err, domain.ErrIncorrectImportMode)
+
+	errRead := errors.New("truncated")
+	calls := 0
+	result, err := s.ImportMetrics(ctx, func() (*domain.Metric, error) {
+		calls++
+		if calls > snapshotBatch {
+			return nil, errRead
+		}
+		m := storagetest.Gauge("g"+strconv.Itoa(calls), 1)
+		return &m, nil
+	}, domain.ImportReplace)
+	require.ErrorIs(t, err, errRead)
+	assert.Equal(t, snapshotBatch, result.Imported, "the full batch is written")
+	assert.Zero(t, result.Deleted, "nothing is deleted before the snapshot is read")
+	_, err = s.GetMetric(ctx, domain.Gauge, "Old")
+	require.NoError(t, err)
+
+	bad := domain.Metric{ID: "bad", MType: domain.Gauge}
+	result, err = s.ImportMetrics(ctx, reader(bad), domain.ImportMerge)
+	require.ErrorIs(t, err, domain.ErrNilGaugeValue)
+	assert.Zero(t, result.Imported)
+}
@@ -0,0 +1,119 @@
+// Package stream fans the metric updates of the service out to subscribers such as SSE, WebSocket
+// and gRPC streams.
+package stream
+
+import (
+	"errors"
+	"slices"
+	"sync"
+
+	"metrics/internal/server/core/domain"
+)
+
+// DefaultBuffer is how many updates a subscriber may lag behind before it is evicted.
+const DefaultBuffer = 256
+
+var ErrSlowConsumer = errors.New("subscriber is too slow, updates were dropped")
+
+// Filter selects the updates a subscriber receives.
+type Filter struct {
+	Names []string // metric names, which are series IDs without labels, any when empty
+	Types []string // metric types, any when empty
+}
+
+// Matches reports whether an update of the metric is selected.
+func (f Filter) Matches(m *domain.Metric) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, m.MType) {
+		return false
+	}
+	return len(f.Names) == 0 || slices.Contains(f.Names, domain.MetricName(m.ID))
+}
+
+// Subscription receives the updates selected by its filter until it is closed or evicted.
+type Subscription struct {
+	hub     *Hub
+	filter  Filter
+	updates chan domain.Metric
+	err     error
+}
+
+// Updates returns the channel of updates, which is closed when the subscription ends.
+func (s *Subscription) Updates() <-chan domain.Metric {
+	return s.updates
+}
+
+// Err returns ErrSlowConsumer once the subscription has been evicted for not keeping up.
+func (s *Subscription) Err() error {
+	s.hub.mux.Lock()
+	defer s.hub.mux.Unlock()
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.hub.mux.Lock()
+	defer s.hub.mux.Unlock()
+	s.hub.remove(s)
+}
+
+// Hub publishes metric updates to subscribers. A subscriber whose buffer is full is evicted rather
+// than slowing down the writers.
+type Hub struct {
+	mux    *sync.Mutex
+	buffer int
+	subs   map[*Subscription]struct{}
+}
+
+// NewHub creates a hub buffering up to buffer updates per subscriber.
+func NewHub(buffer int) *Hub {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	return &Hub{mux: &sync.Mutex{}, buffer: buffer, subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe starts a subscription to the updates selected by the filter.
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	s := &Subscription{hub: h, filter: filter, updates: make(chan domain.Metric, h.buffer)}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Publish sends updates to the subscribers which select them without blocking.
+func (h *Hub) Publish(metrics ...domain.Metric) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for s := range h.subs {
+		for _, m := range metrics {
+			if !s.filter.Matches(&m) {
+				continue
+			}
+			select {
+			case s.updates <- m:
+			default:
+				s.err = ErrSlowConsumer
+				h.remove(s)
+			}
+			if s.err != nil {
+				break
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return len(h.subs)
+}
+
+// remove ends a subscription, h.mux being held.
+func (h *Hub) remove(s *Subscription) {
+	if _, found := h.subs[s]; found {
+		delete(h.subs, s)
+		close(s.updates)
+	}
+}
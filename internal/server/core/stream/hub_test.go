@@ -0,0 +1,51 @@
+package stream
+
+import (
+	"testing"
+
+	"metrics/internal/server/core/domain"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(id string, value float64) domain.Metric {
+	return domain.Metric{ID: id, MType: domain.Gauge, Value: &value}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	m := gauge(`Alloc{host="a"}`, 1)
+	assert.True(t, Filter{}.Matches(&m))
+	assert.True(t, Filter{Names: []string{"Alloc"}, Types: []string{domain.Gauge}}.Matches(&m))
+	assert.False(t, Filter{Names: []string{`Alloc{host="a"}`}}.Matches(&m))
+	assert.False(t, Filter{Types: []string{domain.Counter}}.Matches(&m))
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub(2)
+	all := h.Subscribe(Filter{})
+	heap := h.Subscribe(Filter{Names: []string{"HeapAlloc"}})
+	assert.Equal(t, 2, h.Subscribers())
+
+	h.Publish(gauge("Alloc", 1), gauge("HeapAlloc", 2))
+	assert.Equal(t, "Alloc", (<-all.Updates()).ID)
+	assert.Equal(t, "HeapAlloc", (<-all.Updates()).ID)
+	assert.Equal(t, "HeapAlloc", (<-heap.Updates()).ID)
+
+	// The third update overflows the buffer of the subscriber reading nothing.
+	h.Publish(gauge("Alloc", 1), gauge("Alloc", 2), gauge("Alloc", 3))
+	assert.Equal(t, 1, h.Subscribers())
+	require.ErrorIs(t, all.Err(), ErrSlowConsumer)
+	<-all.Updates()
+	<-all.Updates()
+	_, ok := <-all.Updates()
+	assert.False(t, ok)
+	require.NoError(t, heap.Err())
+
+	heap.Close()
+	heap.Close()
+	all.Close()
+	assert.Equal(t, 0, h.Subscribers())
+	_, ok = <-heap.Updates()
+	assert.False(t, ok)
+}
@@ -0,0 +1,53 @@
+// Package agentinfo defines how an agent identifies itself to the server with every report.
+package agentinfo
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Headers carrying the identity of an agent, along with X-Real-IP. Over gRPC they are sent as metadata
+// under the lower case names.
+const (
+	HeaderHostname = "X-Agent-Hostname"
+	HeaderVersion  = "X-Agent-Version"
+	HeaderConfig   = "X-Agent-Config"
+)
+
+// ReportInterval is the key of the config summary holding the report interval in seconds.
+const ReportInterval = "report_interval"
+
+// EncodeConfig writes a config summary as a query string, its keys sorted.
+func EncodeConfig(summary map[string]string) string {
+	values := make(url.Values, len(summary))
+	for k, v := range summary {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// ParseConfig reads a config summary written by EncodeConfig, nil if s is empty or malformed.
+func ParseConfig(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil
+	}
+	summary := make(map[string]string, len(values))
+	for k := range values {
+		summary[k] = values.Get(k)
+	}
+	return summary
+}
+
+// Interval returns the report interval of a config summary, zero if it has none.
+func Interval(summary map[string]string) time.Duration {
+	seconds, err := strconv.Atoi(summary[ReportInterval])
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
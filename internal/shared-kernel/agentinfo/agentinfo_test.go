@@ -0,0 +1,21 @@
+package agentinfo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	summary := map[string]string{ReportInterval: "10", "exporters": "server,otlp"}
+	encoded := EncodeConfig(summary)
+	assert.Equal(t, "exporters=server%2Cotlp&report_interval=10", encoded)
+	assert.Equal(t, summary, ParseConfig(encoded))
+	assert.Nil(t, ParseConfig(""))
+	assert.Nil(t, ParseConfig("%zz"))
+
+	assert.Equal(t, 10*time.Second, Interval(summary))
+	assert.Zero(t, Interval(map[string]string{ReportInterval: "soon"}))
+	assert.Zero(t, Interval(nil))
+}
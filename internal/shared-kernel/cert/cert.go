@@ -4,45 +4,54 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
+	"fmt"
 	"os"
-
-	"go.uber.org/zap"
 )
 
-func PublicKey(path string) *rsa.PublicKey {
+var errNoPEM = errors.New("no PEM data found")
+
+// PublicKey reads a PKCS #1 public key from the PEM file at path, nil if path is empty.
+func PublicKey(path string) (*rsa.PublicKey, error) {
 	if path == "" {
-		return nil
+		return nil, nil
 	}
-
-	buf, err := os.ReadFile(path)
+	block, err := readPEM(path)
 	if err != nil {
-		zap.L().Info(err.Error())
-		return nil
+		return nil, err
 	}
-	block, _ := pem.Decode(buf)
 	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
 	if err != nil {
-		zap.L().Info(err.Error())
-		return nil
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
 	}
-	return key
+	return key, nil
 }
 
-func PrivateKey(path string) *rsa.PrivateKey {
+// PrivateKey reads a PKCS #1 private key from the PEM file at path, nil if path is empty.
+func PrivateKey(path string) (*rsa.PrivateKey, error) {
 	if path == "" {
-		return nil
+		return nil, nil
+	}
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
 	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return key, nil
+}
 
+// readPEM reads the first PEM block of the file at path.
+func readPEM(path string) (*pem.Block, error) {
 	buf, err := os.ReadFile(path)
 	if err != nil {
-		zap.L().Error(err.Error())
-		return nil
+		return nil, fmt.Errorf("failed to read key: %w", err)
 	}
 	block, _ := pem.Decode(buf)
-	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		zap.L().Error(err.Error())
-		return nil
+	if block == nil {
+		return nil, errNoPEM
 	}
-	return key
+	return block, nil
 }
@@ -0,0 +1,235 @@
+// Package ddsketch implements DDSketch, a mergeable quantile sketch with relative error guarantees.
+//
+// Values are counted in logarithmic bins, so any quantile is estimated within the relative accuracy of
+// the true value, and two sketches with the same accuracy merge by adding up their bins. See
+// https://arxiv.org/abs/1908.10693.
+package ddsketch
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DefaultRelativeAccuracy is the relative accuracy of sketches created by New.
+const DefaultRelativeAccuracy = 0.01
+
+// MaxBins bounds the bins of each store. Once exceeded, the lowest bins are collapsed, which keeps the
+// accuracy of the upper quantiles: at 1% accuracy 2048 bins cover values over 17 orders of magnitude.
+const MaxBins = 2048
+
+// minIndexableValue is the smallest magnitude counted in a bin, smaller values are counted as zeros.
+const minIndexableValue = 1e-9
+
+var (
+	ErrIncorrectSketch = errors.New("incorrect sketch")
+	ErrSketchMismatch  = errors.New("sketch accuracy doesn't match the stored one")
+)
+
+// Store is a dense run of bin counts, Counts[i] being the count of bin Offset+i.
+type Store struct {
+	Offset int      `json:"offset"`
+	Counts []uint64 `json:"counts"`
+}
+
+// Sketch is a DDSketch. Positive values and the magnitudes of negative ones are counted in separate stores.
+type Sketch struct {
+	Alpha    float64 `json:"alpha"`
+	Positive Store   `json:"positive"`
+	Negative Store   `json:"negative"`
+	Zeros    uint64  `json:"zeros"`
+	Count    uint64  `json:"count"`
+	Sum      float64 `json:"sum"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+}
+
+// New creates an empty sketch with the default relative accuracy.
+func New() *Sketch {
+	return &Sketch{Alpha: DefaultRelativeAccuracy}
+}
+
+// Add counts a single value, NaN and infinite values are ignored.
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	switch {
+	case v >= minIndexableValue:
+		s.Positive.add(s.index(v), 1)
+	case v <= -minIndexableValue:
+		s.Negative.add(s.index(-v), 1)
+	default:
+		s.Zeros++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+}
+
+// Merge adds the values counted by o, which must have the same relative accuracy.
+func (s *Sketch) Merge(o *Sketch) error {
+	if s.Alpha != o.Alpha {
+		return ErrSketchMismatch
+	}
+	if o.Count == 0 {
+		return nil
+	}
+	s.Positive.merge(&o.Positive)
+	s.Negative.merge(&o.Negative)
+	s.Zeros += o.Zeros
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.Count += o.Count
+	s.Sum += o.Sum
+	return nil
+}
+
+// Quantile estimates the q-quantile, q being in [0, 1]. An empty sketch returns 0.
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return s.Min
+	}
+	if q >= 1 {
+		return s.Max
+	}
+	rank := uint64(q * float64(s.Count-1))
+	var seen uint64
+	// Negative values go first, the most negative ones being in the highest bins.
+	for i := len(s.Negative.Counts) - 1; i >= 0; i-- {
+		seen += s.Negative.Counts[i]
+		if seen > rank {
+			return s.clamp(-s.value(s.Negative.Offset + i))
+		}
+	}
+	seen += s.Zeros
+	if seen > rank {
+		return 0
+	}
+	for i, c := range s.Positive.Counts {
+		seen += c
+		if seen > rank {
+			return s.clamp(s.value(s.Positive.Offset + i))
+		}
+	}
+	return s.Max
+}
+
+// Validate checks that the sketch is consistent, so it can be merged and queried.
+func (s *Sketch) Validate() error {
+	if !(s.Alpha > 0 && s.Alpha < 1) {
+		return fmt.Errorf("%w: relative accuracy %v must be in (0, 1)", ErrIncorrectSketch, s.Alpha)
+	}
+	// Bins out of the range of finite values would make merging allocate arbitrarily large stores.
+	lowest, highest := s.index(minIndexableValue), s.index(math.MaxFloat64)
+	for _, st := range []Store{s.Positive, s.Negative} {
+		if len(st.Counts) > MaxBins {
+			return fmt.Errorf("%w: more than %d bins", ErrIncorrectSketch, MaxBins)
+		}
+		if len(st.Counts) > 0 && (st.Offset < lowest || st.Offset+len(st.Counts)-1 > highest) {
+			return fmt.Errorf("%w: bins out of range", ErrIncorrectSketch)
+		}
+	}
+	count := s.Zeros
+	for _, c := range s.Positive.Counts {
+		count += c
+	}
+	for _, c := range s.Negative.Counts {
+		count += c
+	}
+	if count != s.Count {
+		return fmt.Errorf("%w: count %d doesn't match bins %d", ErrIncorrectSketch, s.Count, count)
+	}
+	for _, v := range []float64{s.Sum, s.Min, s.Max} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%w: sum, min and max must be finite", ErrIncorrectSketch)
+		}
+	}
+	if s.Count > 0 && s.Min > s.Max {
+		return fmt.Errorf("%w: min is above max", ErrIncorrectSketch)
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the sketch.
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	c.Positive.Counts = append([]uint64(nil), s.Positive.Counts...)
+	c.Negative.Counts = append([]uint64(nil), s.Negative.Counts...)
+	return &c
+}
+
+// gamma is the ratio between the bounds of a bin.
+func (s *Sketch) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+// index returns the bin of a positive value: bin i holds the values in (gamma^(i-1), gamma^i].
+func (s *Sketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+// value returns the representative value of bin i, which is within the relative accuracy of every value in it.
+func (s *Sketch) value(i int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// clamp keeps estimates within the observed range, which is exact at the extremes.
+func (s *Sketch) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+func (st *Store) add(index int, n uint64) {
+	if len(st.Counts) == 0 {
+		st.Offset = index
+		st.Counts = []uint64{n}
+		return
+	}
+	if index < st.Offset {
+		grown := make([]uint64, st.Offset-index+len(st.Counts))
+		copy(grown[st.Offset-index:], st.Counts)
+		st.Counts = grown
+		st.Offset = index
+	}
+	if last := st.Offset + len(st.Counts) - 1; index > last {
+		st.Counts = append(st.Counts, make([]uint64, index-last)...)
+	}
+	st.Counts[index-st.Offset] += n
+	st.collapse()
+}
+
+func (st *Store) merge(o *Store) {
+	for i, c := range o.Counts {
+		if c > 0 {
+			st.add(o.Offset+i, c)
+		}
+	}
+}
+
+// collapse folds the lowest bins into one so that at most MaxBins remain.
+func (st *Store) collapse() {
+	extra := len(st.Counts) - MaxBins
+	if extra <= 0 {
+		return
+	}
+	var folded uint64
+	for _, c := range st.Counts[:extra+1] {
+		folded += c
+	}
+	st.Counts = append([]uint64(nil), st.Counts[extra:]...)
+	st.Counts[0] = folded
+	st.Offset += extra
+}
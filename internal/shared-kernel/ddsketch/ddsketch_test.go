@@ -0,0 +1,107 @@
+package ddsketch
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantile(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	values := make([]float64, 0, 10000)
+	s := New()
+	for range 10000 {
+		v := math.Exp(r.NormFloat64()) * 100
+		values = append(values, v)
+		s.Add(v)
+	}
+	slices.Sort(values)
+
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		exact := values[int(q*float64(len(values)-1))]
+		assert.InEpsilon(t, exact, s.Quantile(q), DefaultRelativeAccuracy, "q=%v", q)
+	}
+	assert.InDelta(t, values[len(values)-1], s.Quantile(1), 0)
+	assert.InDelta(t, values[0], s.Quantile(0), 0)
+	assert.Equal(t, uint64(10000), s.Count)
+	require.NoError(t, s.Validate())
+}
+
+func TestQuantileSigns(t *testing.T) {
+	s := New()
+	for _, v := range []float64{-10, -1, 0, 0, 1, 10, math.NaN()} {
+		s.Add(v)
+	}
+
+	assert.Equal(t, uint64(6), s.Count)
+	assert.InDelta(t, -10, s.Quantile(0), 0)
+	assert.InEpsilon(t, -1, s.Quantile(0.2), DefaultRelativeAccuracy)
+	assert.InDelta(t, 0, s.Quantile(0.5), 0)
+	assert.InEpsilon(t, 1, s.Quantile(0.8), DefaultRelativeAccuracy)
+	assert.InDelta(t, 10, s.Quantile(1), 0)
+	assert.InDelta(t, 0, New().Quantile(0.5), 0)
+}
+
+func TestMerge(t *testing.T) {
+	a, b, all := New(), New(), New()
+	for i := 1; i <= 1000; i++ {
+		v := float64(i)
+		if i%2 == 0 {
+			a.Add(v)
+		} else {
+			b.Add(v)
+		}
+		all.Add(v)
+	}
+	require.NoError(t, a.Merge(b))
+
+	assert.Equal(t, all, a)
+	assert.ErrorIs(t, a.Merge(&Sketch{Alpha: 0.05}), ErrSketchMismatch)
+}
+
+func TestCollapse(t *testing.T) {
+	s := New()
+	for e := -9; e <= 300; e++ {
+		s.Add(math.Pow(10, float64(e)))
+	}
+
+	assert.Len(t, s.Positive.Counts, MaxBins)
+	require.NoError(t, s.Validate())
+	assert.InEpsilon(t, 1e299, s.Quantile(0.999), DefaultRelativeAccuracy)
+}
+
+func TestValidate(t *testing.T) {
+	s := New()
+	s.Add(5)
+	var decoded Sketch
+	buf, err := json.Marshal(s)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &decoded))
+	require.NoError(t, decoded.Validate())
+
+	broken := []*Sketch{
+		{Alpha: 0},
+		{Alpha: 0.01, Count: 1},
+		{Alpha: 0.01, Count: 1, Positive: Store{Offset: 1 << 40, Counts: []uint64{1}}},
+		{Alpha: 0.01, Count: 1, Zeros: 1, Sum: math.NaN()},
+		{Alpha: 0.01, Positive: Store{Counts: make([]uint64, MaxBins+1)}},
+	}
+	for _, s := range broken {
+		assert.ErrorIs(t, s.Validate(), ErrIncorrectSketch)
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := New()
+	s.Add(1)
+	c := s.Clone()
+	c.Add(1)
+
+	assert.Equal(t, []uint64{1}, s.Positive.Counts)
+	assert.Equal(t, []uint64{2}, c.Positive.Counts)
+}
@@ -0,0 +1,150 @@
+// Package reload swaps the config of a running process when it gets SIGHUP or its config file changes,
+// as long as only the settings which can change live differ.
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// PollInterval is how often the config file is checked for changes.
+const PollInterval = 2 * time.Second
+
+// RestartError is returned by Reload when settings which are read once at start up have changed.
+type RestartError struct {
+	// Fields are the names of the settings.
+	Fields []string
+}
+
+func (e *RestartError) Error() string {
+	return "settings can't change without a restart: " + strings.Join(e.Fields, ", ")
+}
+
+// Reloader holds the current config of a process and notifies the subscribers when it is swapped.
+type Reloader[T any] struct {
+	mux     *sync.Mutex
+	current atomic.Pointer[T]
+	load    func(cur *T) (*T, error)
+	subs    []func(cfg *T)
+}
+
+// New creates a new instance of Reloader holding cfg, load reading the config again.
+func New[T any](cfg *T, load func(cur *T) (*T, error)) *Reloader[T] {
+	r := &Reloader[T]{mux: &sync.Mutex{}, load: load}
+	r.current.Store(cfg)
+	return r
+}
+
+// Current returns the current config, which must not be modified.
+func (r *Reloader[T]) Current() *T {
+	return r.current.Load()
+}
+
+// Subscribe registers fn to be called with every new config.
+func (r *Reloader[T]) Subscribe(fn func(cfg *T)) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.subs = append(r.subs, fn)
+}
+
+// Reload loads the config and swaps it for the current one when only the live settings differ, reporting
+// whether it changed. Otherwise, the current config is kept and the error names the settings which need a
+// restart.
+func (r *Reloader[T]) Reload() (bool, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	cur := r.current.Load()
+	next, err := r.load(cur)
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+	if fields := Changed(cur, next); len(fields) > 0 {
+		return false, &RestartError{Fields: fields}
+	}
+	if reflect.DeepEqual(cur, next) {
+		return false, nil
+	}
+	r.current.Store(next)
+	for _, fn := range r.subs {
+		fn(next)
+	}
+	return true, nil
+}
+
+// Watch reloads the config on SIGHUP and whenever the modification time of the file at path changes, checked
+// every interval, and reports the outcome of every reload to done. An empty path only watches the signal.
+// Watch returns at once, watching in the background until ctx is done.
+func (r *Reloader[T]) Watch(ctx context.Context, path string, interval time.Duration, done func(bool, error)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if path != "" {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	modified := modTime(path)
+	go func() {
+		defer signal.Stop(hup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-tick:
+				m := modTime(path)
+				if m.Equal(modified) {
+					continue
+				}
+				modified = m
+			}
+			done(r.Reload())
+		}
+	}()
+}
+
+// modTime returns the modification time of the file at path, zero when there is none.
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Changed returns the names of the fields which differ between two configs and can't change live: all but
+// those tagged reload:"live" and those kept out of config files with json:"-", which are derived from others
+// or set at run time. T must be a struct, a field being named as in JSON.
+func Changed[T any](cur, next *T) []string {
+	a, b := reflect.ValueOf(cur).Elem(), reflect.ValueOf(next).Elem()
+	var fields []string
+	for i := range a.NumField() {
+		f := a.Type().Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" || f.Tag.Get("reload") == "live" {
+			continue
+		}
+		if reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
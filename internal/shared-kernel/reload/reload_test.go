@@ -0,0 +1,150 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfig struct {
+	Address  string `json:"address"`
+	Port     int
+	Key      string `json:"key" reload:"live"`
+	Interval int    `json:"interval,omitempty" reload:"live"`
+	Derived  string `json:"-"`
+	args     []string
+}
+
+func TestChanged(t *testing.T) {
+	cur := &testConfig{Address: ":8080", Port: 1, Key: "a", Interval: 1, Derived: "x", args: []string{"-a"}}
+	tests := []struct {
+		name string
+		next testConfig
+		want []string
+	}{
+		{
+			name: "same",
+			next: *cur,
+		},
+		{
+			name: "live and derived fields",
+			next: testConfig{Address: ":8080", Port: 1, Key: "b", Interval: 2, Derived: "y", args: []string{"-a"}},
+		},
+		{
+			name: "restart fields",
+			next: testConfig{Address: ":9090", Port: 2, Key: "a", Interval: 1, args: []string{"-b"}},
+			want: []string{"address", "Port"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Changed(cur, &tt.next))
+		})
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	errLoad := errors.New("malformed config")
+	tests := []struct {
+		name    string
+		next    testConfig
+		err     error
+		changed bool
+		wantErr bool
+		want    testConfig
+	}{
+		{
+			name:    "live change",
+			next:    testConfig{Address: ":8080", Key: "b"},
+			changed: true,
+			want:    testConfig{Address: ":8080", Key: "b"},
+		},
+		{
+			name: "no change",
+			next: testConfig{Address: ":8080", Key: "a"},
+			want: testConfig{Address: ":8080", Key: "a"},
+		},
+		{
+			name:    "restart change",
+			next:    testConfig{Address: ":9090", Key: "b"},
+			wantErr: true,
+			want:    testConfig{Address: ":8080", Key: "a"},
+		},
+		{
+			name:    "load error",
+			err:     errLoad,
+			wantErr: true,
+			want:    testConfig{Address: ":8080", Key: "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(&testConfig{Address: ":8080", Key: "a"}, func(cur *testConfig) (*testConfig, error) {
+				if tt.err != nil {
+					return nil, tt.err
+				}
+				return &tt.next, nil
+			})
+			var notified []testConfig
+			r.Subscribe(func(cfg *testConfig) {
+				notified = append(notified, *cfg)
+			})
+			changed, err := r.Reload()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.changed, changed)
+			assert.Equal(t, tt.want, *r.Current())
+			if tt.changed {
+				assert.Equal(t, []testConfig{tt.want}, notified)
+			} else {
+				assert.Empty(t, notified)
+			}
+		})
+	}
+}
+
+func TestReloader_ReloadRestartError(t *testing.T) {
+	r := New(&testConfig{Address: ":8080"}, func(cur *testConfig) (*testConfig, error) {
+		return &testConfig{Address: ":9090", Port: 1}, nil
+	})
+	_, err := r.Reload()
+	var restartErr *RestartError
+	require.ErrorAs(t, err, &restartErr)
+	assert.Equal(t, []string{"address", "Port"}, restartErr.Fields)
+	assert.EqualError(t, err, "settings can't change without a restart: address, Port")
+}
+
+func TestReloader_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0o600))
+	loads := 0
+	r := New(&testConfig{}, func(cur *testConfig) (*testConfig, error) {
+		loads++
+		return &testConfig{Interval: loads}, nil
+	})
+	reloads := make(chan int, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Watch(ctx, path, 10*time.Millisecond, func(changed bool, err error) {
+		assert.True(t, changed)
+		assert.NoError(t, err)
+		reloads <- r.Current().Interval
+	})
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Equal(t, 1, <-reloads)
+
+	modified := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modified, modified))
+	assert.Equal(t, 2, <-reloads)
+}
@@ -38,6 +38,10 @@ func OnRetry(n uint, err error) {
 	logger.Log.Error(fmt.Sprintf(`%d %s`, n, err.Error()))
 }
 
+// ErrCommit marks a failure to commit a transaction. The server may have applied the transaction before
+// the connection failed, so Do never retries it.
+var ErrCommit = errors.New("failed to commit transaction")
+
 // Transaction represents a database transaction interface.
 type Transaction interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
@@ -58,13 +62,7 @@ func ExecContext(ctx context.Context, tx Transaction, query string, args ...any)
 			}
 			return nil
 		},
-		retry.RetryIf(func(err error) bool {
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) && pgerrcode.IsConnectionException(pgErr.Code) {
-				return true
-			}
-			return false
-		}),
+		retry.RetryIf(isConnectionException),
 		retry.Attempts(Attempts),
 		retry.DelayType(DelayType),
 		retry.OnRetry(OnRetry),
@@ -75,3 +73,29 @@ func ExecContext(ctx context.Context, tx Transaction, query string, args ...any)
 	}
 	return originalErr
 }
+
+// Do calls fn with retry logic, fn is called again only when it fails with a connection exception before
+// committing, see ErrCommit.
+func Do(ctx context.Context, fn func() error) error {
+	err := retry.Do(
+		fn,
+		retry.RetryIf(func(err error) bool {
+			return !errors.Is(err, ErrCommit) && isConnectionException(err)
+		}),
+		retry.Attempts(Attempts),
+		retry.DelayType(DelayType),
+		retry.OnRetry(OnRetry),
+		retry.LastErrorOnly(true),
+		retry.Context(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("%w", err)
+	}
+	return nil
+}
+
+// isConnectionException reports whether err is a Postgres connection exception worth retrying.
+func isConnectionException(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgerrcode.IsConnectionException(pgErr.Code)
+}
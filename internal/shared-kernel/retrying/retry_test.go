@@ -0,0 +1,24 @@
+package retrying
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo_Commit(t *testing.T) {
+	calls := 0
+	connErr := &pgconn.PgError{Code: pgerrcode.ConnectionFailure}
+	err := Do(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("%w %w", ErrCommit, connErr)
+	})
+	require.ErrorIs(t, err, ErrCommit)
+	assert.ErrorAs(t, err, &connErr)
+	assert.Equal(t, 1, calls, "a commit that may have been applied isn't retried")
+}
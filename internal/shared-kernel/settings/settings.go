@@ -0,0 +1,218 @@
+// Package settings loads configs in layers of increasing precedence: the defaults, a JSON or YAML file,
+// the environment and the command line flags.
+package settings
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"gopkg.in/yaml.v3"
+)
+
+// Redacted replaces the secrets printed by Print.
+const Redacted = "[redacted]"
+
+// FieldError is an invalid setting, named as in config files.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors collects the invalid settings of a config.
+type Errors []error
+
+// Add records that field is invalid, err being formatted with args.
+func (e *Errors) Add(field, format string, args ...any) {
+	*e = append(*e, &FieldError{Field: field, Err: fmt.Errorf(format, args...)})
+}
+
+// Err returns the collected errors joined, nil if there are none.
+func (e Errors) Err() error {
+	return errors.Join(e...)
+}
+
+// Load fills cfg, whose flags are defined on fs, from its layers. The flags set in args come first, the
+// environment next, then the file named by the fileFlag flag or else the fileEnv variable, the defaults
+// being what cfg holds before. It returns the path of the file, empty if there is none.
+func Load[T any](cfg *T, fs *flag.FlagSet, args []string, fileFlag, fileEnv string) (string, error) {
+	defaults := *cfg
+	if err := fs.Parse(args); err != nil {
+		return "", fmt.Errorf("failed to parse flags: %w", err)
+	}
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	*cfg = defaults
+	path := cmp.Or(set[fileFlag], os.Getenv(fileEnv))
+	if err := ReadFile(path, cfg); err != nil {
+		return path, err
+	}
+	if err := env.Parse(cfg); err != nil {
+		return path, fmt.Errorf("failed to read environment: %w", err)
+	}
+	for name, value := range set {
+		if err := fs.Set(name, value); err != nil {
+			return path, fmt.Errorf("failed to set flag %s: %w", name, err)
+		}
+	}
+	return path, nil
+}
+
+// ReadFile reads the settings of the file at path into cfg, as YAML if its extension is .yaml or .yml and as
+// JSON otherwise, keys being named by the json tags either way. Unknown keys are errors, so are typos.
+// The former keys of a setting, listed by its alias tag, are still read as its key, and ignored if the
+// setting is no longer read from files. Nothing is read if path is empty.
+func ReadFile(path string, cfg any) error {
+	if path == "" {
+		return nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if buf, err = yamlToJSON(buf); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+	if buf, err = renameAliases(buf, cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(cfg); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// renameAliases renames the former keys of the settings of cfg, a pointer to a struct, to their json keys,
+// dropping those of settings tagged json:"-". Keys are matched regardless of case, as encoding/json does.
+func renameAliases(buf []byte, cfg any) ([]byte, error) {
+	aliases := make(map[string]string)
+	t := reflect.TypeOf(cfg).Elem()
+	for i := range t.NumField() {
+		tag := t.Field(i).Tag
+		if tag.Get("alias") == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(tag.Get("json"), ",")
+		for _, alias := range strings.Split(tag.Get("alias"), ",") {
+			aliases[strings.ToLower(alias)] = key
+		}
+	}
+	if len(aliases) == 0 {
+		return buf, nil
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	renamed := false
+	for alias, value := range doc {
+		key, ok := aliases[strings.ToLower(alias)]
+		if !ok {
+			continue
+		}
+		delete(doc, alias)
+		renamed = true
+		if key == "-" {
+			continue
+		}
+		if _, set := doc[key]; set {
+			return nil, fmt.Errorf("both %s and its former key %s are set", key, alias)
+		}
+		doc[key] = value
+	}
+	if !renamed {
+		return buf, nil
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return out, nil
+}
+
+// yamlToJSON converts a YAML document to JSON, so that a single set of tags names the settings.
+func yamlToJSON(buf []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(buf, &doc); err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w", err)
+	}
+	return out, nil
+}
+
+// dsnPassword matches the password of a key/value connection string.
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// Print writes cfg as an indented JSON config file, the string fields tagged secret:"true" being replaced by
+// Redacted and the passwords of those tagged secret:"dsn" too. cfg must be a pointer to a struct.
+func Print(w io.Writer, cfg any) error {
+	v := reflect.ValueOf(cfg).Elem()
+	redacted := reflect.New(v.Type()).Elem()
+	redacted.Set(v)
+	for i := range v.NumField() {
+		f := redacted.Field(i)
+		if f.Kind() != reflect.String || f.String() == "" {
+			continue
+		}
+		switch v.Type().Field(i).Tag.Get("secret") {
+		case "true":
+			f.SetString(Redacted)
+		case "dsn":
+			f.SetString(redactDSN(f.String()))
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(redacted.Addr().Interface()); err != nil {
+		return fmt.Errorf("failed to print config: %w", err)
+	}
+	return nil
+}
+
+// redactDSN hides the password of a connection string, either a URL or key/value pairs.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.User != nil {
+		password, ok := u.User.Password()
+		if !ok {
+			return dsn
+		}
+		if redacted := strings.Replace(dsn, ":"+password+"@", ":"+Redacted+"@", 1); redacted != dsn {
+			return redacted
+		}
+		// The password is escaped in the URL.
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}"+Redacted)
+}